@@ -0,0 +1,149 @@
+package xmlapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Permissions is a set of the operations a principal may perform on a file
+type Permissions uint8
+
+// File permissions
+const (
+	PermRead Permissions = 1 << iota
+	PermWrite
+	PermDelete
+)
+
+// permissionNames are the wire names of the permissions, in bit order
+var permissionNames = []string{"read", "write", "delete"}
+
+// Has reports whether p includes every permission of q
+func (p Permissions) Has(q Permissions) bool {
+	return p&q == q
+}
+
+// names returns the wire names of the permissions in p
+func (p Permissions) names() []string {
+	names := []string{}
+	for i, name := range permissionNames {
+		if p&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// String renders the permissions as e.g. "read|write", or "none"
+func (p Permissions) String() string {
+	names := p.names()
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// MarshalJSON encodes the permissions as a list of names, e.g. ["read","write"]
+func (p Permissions) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.names())
+}
+
+// UnmarshalJSON decodes a list of permission names
+func (p *Permissions) UnmarshalJSON(data []byte) error {
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return err
+	}
+	*p = 0
+	for _, name := range names {
+		perm, err := parsePermission(name)
+		if err != nil {
+			return err
+		}
+		*p |= perm
+	}
+	return nil
+}
+
+// parsePermission returns the permission with the given wire name
+func parsePermission(name string) (Permissions, error) {
+	for i, known := range permissionNames {
+		if strings.EqualFold(name, known) {
+			return 1 << i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown permission %q", name)
+}
+
+// ACLEntry grants a principal, a token identity, permissions on a file
+type ACLEntry struct {
+	Principal   string      `json:"principal"`
+	Permissions Permissions `json:"permissions"`
+}
+
+// ACL is the access control list of a file. Principals without an entry
+// have no access, apart from the owner.
+type ACL struct {
+	Owner   string     `json:"owner"`
+	Entries []ACLEntry `json:"entries"`
+}
+
+// GetFileACL reads the access control list of a file
+func (c *Client) GetFileACL(deviceID, filename string, opts ...RequestOption) (_ *ACL, err error) {
+	ctx, op := startOp(context.Background(), "GetFileACL", opts, deviceID, filename, nil)
+	defer op.finish(&err)
+
+	params := map[string]string{
+		"deviceid": deviceID,
+		"filename": filename,
+	}
+
+	resp, err := c.requestContext(ctx, "GET", "/acl", params, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var acl ACL
+	err = c.decode(resp, &acl)
+	if err != nil {
+		return nil, err
+	}
+
+	return &acl, nil
+}
+
+// SetFileACL replaces the access control list of a file. The owner cannot
+// be changed this way and is ignored.
+func (c *Client) SetFileACL(deviceID, filename string, acl *ACL, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "SetFileACL", opts, deviceID, filename, nil)
+	defer op.finish(&err)
+
+	params := map[string]string{
+		"deviceid": deviceID,
+		"filename": filename,
+	}
+	body := map[string]interface{}{
+		"entries": acl.Entries,
+	}
+
+	return c.statusRequestContext(ctx, "PUT", "/acl", params, body)
+}
+
+// ShareFile grants principal perms on a file, replacing any permissions it
+// had. Sharing with no permissions revokes its access.
+func (c *Client) ShareFile(deviceID, filename, principal string, perms Permissions, opts ...RequestOption) (err error) {
+	ctx, op := startOp(context.Background(), "ShareFile", opts, deviceID, filename, nil)
+	defer op.finish(&err)
+
+	params := map[string]string{
+		"deviceid":    deviceID,
+		"filename":    filename,
+		"principal":   principal,
+		"permissions": strings.Join(perms.names(), ","),
+	}
+
+	_, err = c.statusRequestContext(ctx, "POST", "/acl/share", params, nil)
+	return err
+}
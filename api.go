@@ -0,0 +1,47 @@
+package xmlapi
+
+import (
+	"io"
+)
+
+// API is the file, node and attribute interface of the gateway. Client
+// implements it; code written against it can be tested with the xmlapimock
+// and xmlapimem packages instead of a gateway, both of which implement all
+// of API. The rest of Client, such as searching, watching, transactions,
+// trash and access control, is not part of API and has no stand-in.
+type API interface {
+	FileAPI
+	NodeAPI
+	AttributeAPI
+}
+
+// FileAPI is the part of API listing, creating, copying and deleting whole
+// files
+type FileAPI interface {
+	ListFiles(deviceID string, opts ...RequestOption) ([]string, error)
+	CreateFile(deviceID, filename, rootName string, opts ...RequestOption) (string, error)
+	UploadFile(deviceID, filename string, r io.Reader, overwrite bool, opts ...UploadOption) (string, error)
+	CopyDevice(deviceID, newDeviceID, filename string, overwrite bool, opts ...RequestOption) (string, error)
+	DeleteFile(deviceID, filename string, opts ...DeleteOption) (string, error)
+	ReadFile(deviceID, filename string, opts ...RequestOption) (*Node, error)
+}
+
+// NodeAPI is the part of API reading and changing elements
+type NodeAPI interface {
+	ReadNode(deviceID, filename string, path PathLike, opts ...RequestOption) (*Node, error)
+	ReadNodes(deviceID, filename string, paths []string, opts ...RequestOption) ([]*Node, error)
+	CreateNode(deviceID, filename string, parentPath PathLike, tag, value string, opts ...RequestOption) (string, error)
+	UpdateNode(deviceID, filename string, path PathLike, value string, opts ...RequestOption) (string, error)
+	UpsertNode(deviceID, filename string, parentPath PathLike, tag, value string, opts ...RequestOption) (string, error)
+	DeleteNode(deviceID, filename string, path PathLike, opts ...RequestOption) (string, error)
+	DeleteNodes(deviceID, filename string, paths []string, opts ...RequestOption) (string, error)
+}
+
+// AttributeAPI is the part of API reading and changing attributes
+type AttributeAPI interface {
+	GetAttribute(deviceID, filename string, path PathLike, name string, opts ...RequestOption) (string, error)
+	SetAttribute(deviceID, filename string, path PathLike, name, value string, opts ...RequestOption) (string, error)
+	DeleteAttribute(deviceID, filename string, path PathLike, name string, opts ...RequestOption) (string, error)
+}
+
+var _ API = (*Client)(nil)
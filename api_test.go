@@ -0,0 +1,165 @@
+package xmlapi_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	xmlapi "github.com/Applied-Information/golibxml"
+	"github.com/Applied-Information/golibxml/xmlapimem"
+)
+
+const differentialDoc = `<plan version="3"><phase id="1"><minGreen>5</minGreen></phase><phase id="2"><minGreen>7</minGreen></phase></plan>`
+
+// The operands the differential operations draw from
+var (
+	differentialPaths = []string{
+		"/plan", "/plan/phase", "/plan/phase[2]", "/plan/phase[1]/minGreen",
+		"/plan/phase[3]", "/plan/missing", "/other", "/plan/note",
+	}
+	differentialTags   = []string{"phase", "minGreen", "note"}
+	differentialValues = []string{"", "5", "a<b & c", "x y"}
+)
+
+// differentialOps are the operations of the differential test, each
+// returning a description of its result
+var differentialOps = []func(api xmlapi.API, path, tag, value string) (string, error){
+	func(api xmlapi.API, path, tag, value string) (string, error) {
+		n, err := api.ReadNode("dev", "plan.xml", path)
+		return render(n), err
+	},
+	func(api xmlapi.API, path, tag, value string) (string, error) {
+		_, err := api.CreateNode("dev", "plan.xml", path, tag, value)
+		return "", err
+	},
+	func(api xmlapi.API, path, tag, value string) (string, error) {
+		_, err := api.UpdateNode("dev", "plan.xml", path, value)
+		return "", err
+	},
+	func(api xmlapi.API, path, tag, value string) (string, error) {
+		_, err := api.UpsertNode("dev", "plan.xml", path, tag, value)
+		return "", err
+	},
+	func(api xmlapi.API, path, tag, value string) (string, error) {
+		_, err := api.DeleteNode("dev", "plan.xml", path)
+		return "", err
+	},
+	func(api xmlapi.API, path, tag, value string) (string, error) {
+		_, err := api.SetAttribute("dev", "plan.xml", path, "id", value)
+		return "", err
+	},
+	func(api xmlapi.API, path, tag, value string) (string, error) {
+		return api.GetAttribute("dev", "plan.xml", path, "id")
+	},
+	func(api xmlapi.API, path, tag, value string) (string, error) {
+		_, err := api.DeleteAttribute("dev", "plan.xml", path, "id")
+		return "", err
+	},
+	func(api xmlapi.API, path, tag, value string) (string, error) {
+		nodes, err := api.ReadNodes("dev", "plan.xml", []string{path, "/plan/phase[1]"})
+		var rendered []string
+		for _, n := range nodes {
+			rendered = append(rendered, render(n))
+		}
+		return strings.Join(rendered, " "), err
+	},
+	func(api xmlapi.API, path, tag, value string) (string, error) {
+		_, err := api.DeleteNodes("dev", "plan.xml", []string{path})
+		return "", err
+	},
+	func(api xmlapi.API, path, tag, value string) (string, error) {
+		_, err := api.CreateFile("dev", tag+".xml", tag)
+		return "", err
+	},
+	func(api xmlapi.API, path, tag, value string) (string, error) {
+		_, err := api.DeleteFile("dev", tag+".xml")
+		return "", err
+	},
+	func(api xmlapi.API, path, tag, value string) (string, error) {
+		files, err := api.ListFiles("dev")
+		return strings.Join(files, " "), err
+	},
+}
+
+// render describes a node by its XML
+func render(n *xmlapi.Node) string {
+	if n == nil {
+		return "<nil>"
+	}
+	var b strings.Builder
+	if err := n.ToXML(&b, xmlapi.MarshalOptions{}); err != nil {
+		return "error: " + err.Error()
+	}
+	return b.String()
+}
+
+// errorClass describes an error by the sentinel it matches
+func errorClass(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, xmlapi.ErrAttrNotFound):
+		return "attribute not found"
+	case errors.Is(err, xmlapi.ErrNotFound):
+		return "not found"
+	case errors.Is(err, xmlapi.ErrAlreadyExists):
+		return "already exists"
+	case errors.Is(err, xmlapi.ErrInvalidPath):
+		return "invalid path"
+	}
+	return "error"
+}
+
+func FuzzMemClientMatchesGateway(f *testing.F) {
+	f.Add([]byte{0, 0, 0, 0})
+	f.Add([]byte{1, 1, 2, 2, 0, 7, 0, 0})
+	f.Add([]byte{4, 1, 0, 0, 0, 1, 0, 0, 2, 2, 0, 3})
+	f.Add([]byte{3, 0, 2, 1, 3, 0, 2, 2, 0, 7, 0, 0})
+	f.Add([]byte{5, 0, 0, 1, 6, 0, 0, 0, 7, 0, 0, 0, 7, 0, 0, 0, 6, 4, 0, 0})
+	f.Add([]byte{8, 5, 0, 0, 9, 1, 0, 0, 9, 1, 0, 0, 0, 0, 0, 0})
+	f.Add([]byte{10, 0, 0, 0, 10, 0, 0, 0, 12, 0, 0, 0, 11, 0, 0, 0, 11, 0, 0, 0})
+
+	f.Fuzz(func(t *testing.T, program []byte) {
+		if len(program) > 64 {
+			program = program[:64]
+		}
+		gateway := xmlapi.NewFakeGatewayClient(t)
+		if _, err := gateway.UploadFile("dev", "plan.xml", strings.NewReader(differentialDoc), false); err != nil {
+			t.Fatal(err)
+		}
+		mem := xmlapimem.New()
+		if err := mem.PreloadXML("dev", "plan.xml", differentialDoc); err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i+3 < len(program); i += 4 {
+			op := differentialOps[int(program[i])%len(differentialOps)]
+			path := differentialPaths[int(program[i+1])%len(differentialPaths)]
+			tag := differentialTags[int(program[i+2])%len(differentialTags)]
+			value := differentialValues[int(program[i+3])%len(differentialValues)]
+			step := fmt.Sprintf("op %d (%s, %s, %q)", program[i]%byte(len(differentialOps)), path, tag, value)
+
+			want, wantErr := op(gateway, path, tag, value)
+			got, gotErr := op(mem, path, tag, value)
+			if errorClass(gotErr) != errorClass(wantErr) {
+				t.Fatalf("%s: MemClient error %v, gateway %v", step, gotErr, wantErr)
+			}
+			if wantErr == nil && got != want {
+				t.Fatalf("%s: MemClient returned %s, gateway %s", step, got, want)
+			}
+
+			wantFile, err := gateway.ReadFile("dev", "plan.xml")
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotFile, err := mem.ReadFile("dev", "plan.xml")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if render(gotFile) != render(wantFile) {
+				t.Fatalf("after %s: MemClient holds %s, gateway %s", step, render(gotFile), render(wantFile))
+			}
+		}
+	})
+}
@@ -0,0 +1,141 @@
+package xmlapi
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// AuditAction is the kind of change an audit entry records
+type AuditAction string
+
+// Audit actions
+const (
+	AuditCreate AuditAction = "create"
+	AuditUpdate AuditAction = "update"
+	AuditDelete AuditAction = "delete"
+)
+
+// AuditQuery filters the audit trail of a device. Zero fields match
+// everything.
+type AuditQuery struct {
+	Filename   string
+	PathPrefix string
+	Since      time.Time
+	Until      time.Time
+	Action     AuditAction
+
+	// Cursor continues after the entry it was taken from; see AuditEntry.Cursor
+	Cursor string
+	// Limit caps the entries returned per call; the gateway picks when 0
+	Limit int
+}
+
+// AuditEntry is a single change recorded in the audit trail
+type AuditEntry struct {
+	Timestamp time.Time   `json:"timestamp"`
+	Actor     string      `json:"actor"`
+	Action    AuditAction `json:"action"`
+	Filename  string      `json:"filename"`
+	Path      string      `json:"path"`
+	OldValue  string      `json:"old_value"`
+	NewValue  string      `json:"new_value"`
+
+	// Cursor resumes the query after this entry when set on AuditQuery.Cursor
+	Cursor string `json:"cursor"`
+}
+
+// auditResponse represents the response of the audit endpoint
+type auditResponse struct {
+	Entries []AuditEntry `json:"entries"`
+	Next    string       `json:"next"`
+	Error   string       `json:"error"`
+}
+
+// AuditLog returns one page of a device's audit trail, oldest first. To
+// fetch the next page, repeat the query with Cursor set to the last entry's
+// Cursor; an empty result means there are no more entries.
+func (c *Client) AuditLog(deviceID string, q AuditQuery, opts ...RequestOption) (_ []AuditEntry, err error) {
+	ctx, op := startOp(context.Background(), "AuditLog", opts, deviceID, "", nil)
+	defer op.finish(&err)
+
+	result, err := c.auditPage(ctx, deviceID, q)
+	if err != nil {
+		return nil, err
+	}
+	return result.Entries, nil
+}
+
+// AuditLogAll calls fn for every entry matching q, fetching pages as needed,
+// and stops at the first error fn returns
+func (c *Client) AuditLogAll(deviceID string, q AuditQuery, fn func(AuditEntry) error, opts ...RequestOption) (err error) {
+	ctx, op := startOp(context.Background(), "AuditLogAll", opts, deviceID, "", nil)
+	defer op.finish(&err)
+
+	for {
+		result, err := c.auditPage(ctx, deviceID, q)
+		if err != nil {
+			return err
+		}
+		for _, entry := range result.Entries {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+		if result.Next == "" || len(result.Entries) == 0 {
+			return nil
+		}
+		q.Cursor = result.Next
+	}
+}
+
+// auditPage fetches one page of the audit trail
+func (c *Client) auditPage(ctx context.Context, deviceID string, q AuditQuery) (*auditResponse, error) {
+	params := map[string]string{
+		"deviceid": deviceID,
+	}
+	if q.Filename != "" {
+		params["filename"] = q.Filename
+	}
+	if q.PathPrefix != "" {
+		params["path_prefix"] = q.PathPrefix
+	}
+	if !q.Since.IsZero() {
+		params["since"] = q.Since.UTC().Format(time.RFC3339Nano)
+	}
+	if !q.Until.IsZero() {
+		params["until"] = q.Until.UTC().Format(time.RFC3339Nano)
+	}
+	if q.Action != "" {
+		params["action"] = string(q.Action)
+	}
+	if q.Cursor != "" {
+		params["cursor"] = q.Cursor
+	}
+	if q.Limit > 0 {
+		params["limit"] = strconv.Itoa(q.Limit)
+	}
+
+	resp, err := c.requestContext(ctx, "GET", "/audit", params, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result auditResponse
+	err = c.decode(resp, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Error != "" {
+		return nil, errors.New(result.Error)
+	}
+
+	// Older gateways only report the cursor of the page, not of each entry
+	if n := len(result.Entries); n > 0 && result.Entries[n-1].Cursor == "" {
+		result.Entries[n-1].Cursor = result.Next
+	}
+
+	return &result, nil
+}
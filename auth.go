@@ -0,0 +1,466 @@
+package xmlapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CredentialsProvider supplies the API key presented to the authorize
+// endpoint. It is consulted on every authorization, so keys rotated by a
+// secrets manager take effect on the next re-authorization.
+type CredentialsProvider interface {
+	APIKey(ctx context.Context) (string, error)
+}
+
+// staticCredentials is the provider of the API key given to NewClient
+type staticCredentials string
+
+// APIKey implements CredentialsProvider
+func (k staticCredentials) APIKey(ctx context.Context) (string, error) {
+	return string(k), nil
+}
+
+// Authorize authorizes the client and obtains a token. Requests authorize
+// by themselves when the client has no token yet, so calling it is only
+// needed to obtain a token up front or to replace the current one.
+func (c *Client) Authorize(opts ...RequestOption) (err error) {
+	ctx, op := startOp(context.Background(), "Authorize", opts, "", "", nil)
+	defer op.finish(&err)
+
+	return c.authorize(ctx)
+}
+
+// AuthorizeWithScopes authorizes the client for a token limited to scopes,
+// which are also requested on later re-authorizations. A scope the gateway
+// refuses yields an error matching ErrScopeDenied.
+func (c *Client) AuthorizeWithScopes(scopes []string, opts ...RequestOption) (err error) {
+	ctx, op := startOp(context.Background(), "AuthorizeWithScopes", opts, "", "", nil)
+	defer op.finish(&err)
+
+	c.tokenMu.Lock()
+	c.scopes = append([]string(nil), scopes...)
+	c.tokenMu.Unlock()
+
+	return c.authorize(ctx)
+}
+
+// GrantedScopes returns the scopes of the current token as reported by the
+// gateway, nil if it reported none
+func (c *Client) GrantedScopes() []string {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	return append([]string(nil), c.granted...)
+}
+
+// authProvider is an authentication scheme: it authorizes each request and
+// replaces credentials the gateway rejected
+type authProvider interface {
+	// setAuthorization sets the credentials of a request to deviceID
+	setAuthorization(ctx context.Context, req *http.Request, deviceID string) error
+	// refreshable reports whether rejected credentials can be replaced
+	refreshable() bool
+	// refresh obtains new credentials for deviceID after a 401
+	refresh(ctx context.Context, deviceID string) error
+}
+
+// keyTokenAuth is the built-in scheme exchanging the API key for a token at
+// the authorize endpoint
+type keyTokenAuth struct {
+	c *Client
+}
+
+// setAuthorization implements authProvider. The first request authorizes
+// the client, so Authorize need not be called; a token about to expire is
+// replaced before it is sent.
+func (a *keyTokenAuth) setAuthorization(ctx context.Context, req *http.Request, deviceID string) error {
+	token, expires := a.c.tokenFor(deviceID)
+	if (token == "" && a.c.hasCredentials()) || (token != "" && a.c.expiring(expires)) {
+		if err := a.c.authorizeShared(ctx, deviceID); err != nil {
+			return err
+		}
+		token, _ = a.c.tokenFor(deviceID)
+	}
+	req.Header.Set("Authorization", token)
+	return nil
+}
+
+// refreshable implements authProvider
+func (a *keyTokenAuth) refreshable() bool {
+	return true
+}
+
+// refresh implements authProvider
+func (a *keyTokenAuth) refresh(ctx context.Context, deviceID string) error {
+	return a.c.authorizeShared(ctx, deviceID)
+}
+
+// WithAutoReauth controls whether a request rejected with 401 obtains a new
+// token and is repeated, which is the default. Either way a call
+// re-authorizes at most once, however often it is retried, so a revoked API
+// key fails with ErrUnauthorized instead of looping.
+func WithAutoReauth(enabled bool) Option {
+	return func(c *Client) {
+		c.noAutoReauth = !enabled
+	}
+}
+
+// reauthAllowed reports whether a 401 from endpoint may be answered by
+// re-authorizing. The authorize and revoke endpoints never are, since a new
+// token cannot fix their rejection.
+func (c *Client) reauthAllowed(endpoint string) bool {
+	return !c.noAutoReauth && c.auth.refreshable() && endpoint != "/authorize" && endpoint != "/revoke"
+}
+
+// reauthFailed wraps the failure to re-authorize after a 401
+func reauthFailed(err error) error {
+	if errors.Is(err, ErrUnauthorized) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return fmt.Errorf("%w: re-authorization failed: %w", ErrUnauthorized, err)
+}
+
+// hasCredentials reports whether the client has an API key to authorize
+// with. Without one, requests are sent without a token rather than
+// authorizing lazily.
+func (c *Client) hasCredentials() bool {
+	key, static := c.credentials.(staticCredentials)
+	return !static || key != ""
+}
+
+// authCall is an authorization in progress, shared by the callers that
+// need the same token at the same time
+type authCall struct {
+	done chan struct{}
+	err  error
+}
+
+// authorizeShared is authorizeFor, except that concurrent callers for the
+// same device wait for a single authorization instead of each making one.
+// A waiter whose ctx ends stops waiting; the authorization itself runs
+// with the ctx of the caller that started it.
+func (c *Client) authorizeShared(ctx context.Context, deviceID string) error {
+	key := ""
+	if c.perDevice {
+		key = deviceID
+	}
+
+	c.authMu.Lock()
+	if call, ok := c.authCalls[key]; ok {
+		c.authMu.Unlock()
+		select {
+		case <-call.done:
+			return call.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	call := &authCall{done: make(chan struct{})}
+	if c.authCalls == nil {
+		c.authCalls = make(map[string]*authCall)
+	}
+	c.authCalls[key] = call
+	c.authMu.Unlock()
+
+	call.err = c.authorizeFor(ctx, deviceID)
+
+	c.authMu.Lock()
+	delete(c.authCalls, key)
+	c.authMu.Unlock()
+	close(call.done)
+	return call.err
+}
+
+// basicAuth is HTTP Basic authentication for units without the token scheme
+type basicAuth struct {
+	username string
+	password string
+}
+
+// setAuthorization implements authProvider
+func (a *basicAuth) setAuthorization(ctx context.Context, req *http.Request, deviceID string) error {
+	req.SetBasicAuth(a.username, a.password)
+	return nil
+}
+
+// refreshable implements authProvider; fixed credentials cannot be replaced
+func (a *basicAuth) refreshable() bool {
+	return false
+}
+
+// refresh implements authProvider
+func (a *basicAuth) refresh(ctx context.Context, deviceID string) error {
+	return ErrUnauthorized
+}
+
+// authorize implements Authorize, carrying ctx to the HTTP request. Schemes
+// without refreshable credentials have nothing to authorize.
+func (c *Client) authorize(ctx context.Context) error {
+	if err := c.usable(); err != nil {
+		return err
+	}
+	if !c.auth.refreshable() {
+		return nil
+	}
+	return c.auth.refresh(ctx, "")
+}
+
+// authorizeFor obtains the token used for requests to deviceID: a token
+// bound to the device with WithPerDeviceTokens, otherwise the shared one
+func (c *Client) authorizeFor(ctx context.Context, deviceID string) error {
+	c.tokenMu.Lock()
+	scopes := c.scopes
+	perDevice := c.perDevice && deviceID != ""
+	if perDevice {
+		delete(c.deviceTokens, deviceID)
+	}
+	c.tokenMu.Unlock()
+
+	parent := ctx
+	if timeout := c.timeoutFor(ctx, "/authorize"); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	url := c.endpointURL("/authorize")
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+
+	apiKey, err := c.credentials.APIKey(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCredentialsUnavailable, err)
+	}
+
+	req.Header.Set("Authorization", apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	for key, values := range withCallHeader(nil, requestConfig(ctx).header) {
+		req.Header[key] = values
+	}
+	q := req.URL.Query()
+	if len(scopes) > 0 {
+		q.Set("scope", strings.Join(scopes, " "))
+	}
+	if perDevice {
+		q.Set("deviceid", deviceID)
+	}
+	req.URL.RawQuery = q.Encode()
+	c.sign(req, nil)
+
+	resp, err := c.do(req)
+	if err != nil {
+		return attemptTimeout(parent, req, err)
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			c.logger.Printf("Error closing body: %v", err)
+		}
+	}(resp.Body)
+
+	respBody, err := readBody(ctx, resp.Body)
+	if err != nil {
+		return transportError(req, err)
+	}
+
+	// The gateway may serve the API under a prefix we have not been told about
+	if resp.StatusCode == http.StatusNotFound && c.prefix.probe() {
+		err := c.authorizeFor(ctx, deviceID)
+		if !errors.Is(err, ErrUnsupportedByServer) && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		c.prefix.set("")
+	}
+
+	if resp.StatusCode >= 400 {
+		c.logger.Printf("Authorization request failed with status: %d, response: %s", resp.StatusCode, respBody)
+		apiErr := newAPIError(resp.StatusCode, resp.Header, respBody)
+		if len(scopes) > 0 && (resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusForbidden) {
+			return fmt.Errorf("%w: %w", ErrScopeDenied, apiErr)
+		}
+		return apiErr
+	}
+
+	var result AuthorizationResponse
+	err = c.decode(&Response{StatusCode: resp.StatusCode, Header: resp.Header, Body: respBody}, &result)
+	if err != nil {
+		return err
+	}
+
+	skew := c.observeClock(resp.Header.Get("Date"))
+	expires := parseExpires(result.Expires, skew)
+
+	if perDevice {
+		c.tokenMu.Lock()
+		if c.deviceTokens == nil {
+			c.deviceTokens = make(map[string]cachedToken)
+		}
+		c.deviceTokens[deviceID] = cachedToken{token: result.Token, expires: expires}
+		c.tokenMu.Unlock()
+		return nil
+	}
+
+	c.setToken(result.Token, expires, result.Scopes)
+	return nil
+}
+
+// cachedToken is a device-bound token held by the per-device cache
+type cachedToken struct {
+	token   string
+	expires time.Time
+}
+
+// tokenFor returns the token to send on a request to deviceID and its
+// expiry. Requests without a device always use the shared token.
+func (c *Client) tokenFor(deviceID string) (string, time.Time) {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	if c.perDevice && deviceID != "" {
+		cached := c.deviceTokens[deviceID]
+		return cached.token, cached.expires
+	}
+	return c.token, c.expires
+}
+
+// RevokeToken invalidates the client's current token on the gateway, along
+// with the device tokens cached by WithPerDeviceTokens. Each token is sent
+// to be revoked with itself, and the revoked ones are cleared from the cache
+// once every revoke has been answered, so the next request authorizes
+// again; tokens the gateway refused to revoke stay cached and their errors
+// are joined.
+func (c *Client) RevokeToken(ctx context.Context, opts ...RequestOption) (err error) {
+	ctx, op := startOp(ctx, "RevokeToken", opts, "", "", nil)
+	defer op.finish(&err)
+
+	token, deviceTokens := c.currentTokens()
+
+	var errs []error
+	sharedRevoked := false
+	if token != "" {
+		if err := c.revoke(ctx, "", token); err != nil {
+			errs = append(errs, err)
+		} else {
+			sharedRevoked = true
+		}
+	}
+	revoked := make(map[string]string, len(deviceTokens))
+	for deviceID, token := range deviceTokens {
+		if err := c.revoke(ctx, deviceID, token); err != nil {
+			errs = append(errs, fmt.Errorf("device %s: %w", deviceID, err))
+		} else {
+			revoked[deviceID] = token
+		}
+	}
+
+	if sharedRevoked {
+		c.clearToken(token)
+	}
+	for deviceID, token := range revoked {
+		c.clearDeviceToken(deviceID, token)
+	}
+	return errors.Join(errs...)
+}
+
+// revoke invalidates token, bound to deviceID unless it is empty, on the
+// gateway. The token is sent explicitly and authorizes its own revocation,
+// so a concurrent re-authorization cannot change which token is revoked and
+// no new token is obtained to send it.
+func (c *Client) revoke(ctx context.Context, deviceID, token string) error {
+	params := map[string]string{
+		"token": token,
+	}
+	if deviceID != "" {
+		params["deviceid"] = deviceID
+	}
+	_, err := c.statusRequestContext(ctx, "POST", "/revoke", params, nil)
+	return err
+}
+
+// Logout revokes the client's current tokens, treating gateways without a
+// revoke endpoint as already logged out
+func (c *Client) Logout(opts ...RequestOption) (err error) {
+	ctx, op := startOp(context.Background(), "Logout", opts, "", "", nil)
+	defer op.finish(&err)
+
+	err = c.RevokeToken(ctx)
+	if errors.Is(err, ErrUnsupportedByServer) {
+		token, deviceTokens := c.currentTokens()
+		c.clearToken(token)
+		for deviceID, token := range deviceTokens {
+			c.clearDeviceToken(deviceID, token)
+		}
+		return nil
+	}
+	return err
+}
+
+// currentTokens returns the cached shared token and a copy of the cached
+// device tokens, by device
+func (c *Client) currentTokens() (string, map[string]string) {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	deviceTokens := make(map[string]string, len(c.deviceTokens))
+	for deviceID, cached := range c.deviceTokens {
+		if cached.token != "" {
+			deviceTokens[deviceID] = cached.token
+		}
+	}
+	return c.token, deviceTokens
+}
+
+// setToken caches a new token with its expiry and granted scopes
+func (c *Client) setToken(token string, expires time.Time, granted []string) {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	c.token = token
+	c.issued = time.Now()
+	c.expires = expires
+	c.granted = granted
+
+	select {
+	case c.tokenChanged <- struct{}{}:
+	default:
+	}
+}
+
+// clearToken drops the cached token if it is still token, leaving any newer
+// one obtained in the meantime in place
+func (c *Client) clearToken(token string) {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	if c.token == token {
+		c.token = ""
+		c.expires = time.Time{}
+		c.granted = nil
+	}
+}
+
+// clearDeviceToken drops the cached token of deviceID if it is still token
+func (c *Client) clearDeviceToken(deviceID, token string) {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	if c.deviceTokens[deviceID].token == token {
+		delete(c.deviceTokens, deviceID)
+	}
+}
+
+// parseExpires parses the expiry reported by the authorize endpoint, either
+// an RFC 3339 time or a lifetime in seconds, and returns it on the local
+// clock. skew is how far the server's clock is ahead of the local one. The
+// zero time means unknown.
+func parseExpires(expires string, skew time.Duration) time.Time {
+	if t, err := time.Parse(time.RFC3339, expires); err == nil {
+		return t.Add(-skew)
+	}
+	if seconds, err := strconv.ParseInt(expires, 10, 64); err == nil && seconds > 0 {
+		return time.Now().Add(time.Duration(seconds) * time.Second)
+	}
+	return time.Time{}
+}
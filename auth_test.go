@@ -0,0 +1,291 @@
+package xmlapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// rotatingCredentials is a CredentialsProvider whose key can be replaced
+type rotatingCredentials struct {
+	mu    sync.Mutex
+	key   string
+	err   error
+	calls int
+}
+
+// APIKey implements CredentialsProvider
+func (p *rotatingCredentials) APIKey(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	return p.key, p.err
+}
+
+// rotate replaces the key
+func (p *rotatingCredentials) rotate(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.key = key
+}
+
+func TestCredentialsProviderRotation(t *testing.T) {
+	g := newFakeGateway(t)
+	g.allowKey("key-1")
+	g.load("dev", "plan.xml", planDoc)
+	p := &rotatingCredentials{key: "key-1"}
+	c := g.client(WithCredentialsProvider(p))
+
+	if _, err := c.ReadFile("dev", "plan.xml"); err != nil {
+		t.Fatalf("ReadFile with the first key: %v", err)
+	}
+
+	// The secrets manager rotates the key and the gateway drops the old one
+	g.allowKey("key-2")
+	g.revokeKey("key-1")
+	p.rotate("key-2")
+
+	if _, err := c.ReadFile("dev", "plan.xml"); err != nil {
+		t.Fatalf("ReadFile after rotation: %v", err)
+	}
+
+	var keys []string
+	for _, req := range g.receivedAt("/authorize") {
+		keys = append(keys, req.Header.Get("Authorization"))
+	}
+	if len(keys) != 2 || keys[0] != "key-1" || keys[1] != "key-2" {
+		t.Errorf("authorized with %q, want key-1 then key-2", keys)
+	}
+	if p.calls != 2 {
+		t.Errorf("provider consulted %d times, want once per authorization", p.calls)
+	}
+}
+
+func TestCredentialsProviderErrors(t *testing.T) {
+	errVault := errors.New("vault sealed")
+
+	g := newFakeGateway(t)
+	g.load("dev", "plan.xml", planDoc)
+
+	c := g.client(WithCredentialsProvider(&rotatingCredentials{err: errVault}))
+	_, err := c.ReadFile("dev", "plan.xml")
+	if !errors.Is(err, ErrCredentialsUnavailable) || !errors.Is(err, errVault) {
+		t.Errorf("provider failure: %v, want ErrCredentialsUnavailable wrapping the cause", err)
+	}
+	if errors.Is(err, ErrUnauthorized) {
+		t.Errorf("provider failure %v matches ErrUnauthorized", err)
+	}
+	if n := len(g.receivedAt("/authorize")); n != 0 {
+		t.Errorf("%d authorize requests without a key, want none", n)
+	}
+
+	// A key the gateway rejects is a different failure
+	c = g.client(WithCredentialsProvider(&rotatingCredentials{key: "unknown"}))
+	_, err = c.ReadFile("dev", "plan.xml")
+	if !errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrCredentialsUnavailable) {
+		t.Errorf("rejected key: %v, want ErrUnauthorized only", err)
+	}
+}
+
+func TestLazyAuthorizeOnce(t *testing.T) {
+	const callers = 16
+
+	g := newFakeGateway(t)
+	g.load("dev", "plan.xml", planDoc)
+	// A slow authorization keeps every caller waiting on it
+	g.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path == "/authorize" {
+			time.Sleep(20 * time.Millisecond)
+		}
+		return false
+	}
+	c := g.client()
+
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.ReadNode("dev", "plan.xml", "/plan"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := len(g.receivedAt("/authorize")); n != 1 {
+		t.Errorf("%d authorizations, want 1", n)
+	}
+	reads := g.receivedAt("/read")
+	if len(reads) != callers {
+		t.Fatalf("%d reads, want %d", len(reads), callers)
+	}
+	for _, read := range reads {
+		if token := read.Header.Get("Authorization"); token == "" || token != reads[0].Header.Get("Authorization") {
+			t.Errorf("read with token %q, want the one token %q", token, reads[0].Header.Get("Authorization"))
+		}
+	}
+}
+
+func TestNoLazyAuthorizeWithoutKey(t *testing.T) {
+	g := newFakeGateway(t)
+	g.load("dev", "plan.xml", planDoc)
+	g.mu.Lock()
+	g.tokens["injected"] = ""
+	g.mu.Unlock()
+
+	c := NewClient("", g.URL(), WithLogger(discardLogger{}))
+	defer c.Close()
+	c.setToken("injected", time.Time{}, nil)
+
+	if _, err := c.ReadNode("dev", "plan.xml", "/plan"); err != nil {
+		t.Fatalf("ReadNode with the injected token: %v", err)
+	}
+	if n := len(g.receivedAt("/authorize")); n != 0 {
+		t.Errorf("%d authorizations, want none", n)
+	}
+	if token := g.receivedAt("/read")[0].Header.Get("Authorization"); token != "injected" {
+		t.Errorf("read with token %q, want the injected one", token)
+	}
+}
+
+func TestReauthorizeAtMostOnce(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts []Option
+		// reject makes the gateway reject what the client holds
+		reject func(g *fakeGateway)
+		// reads and authorizations are the requests expected after reject
+		reads, authorizations int
+	}{
+		{
+			name:   "revoked key",
+			reject: func(g *fakeGateway) { g.revokeKey(testAPIKey) },
+			reads:  1, authorizations: 1,
+		},
+		{
+			name: "new tokens rejected too",
+			reject: func(g *fakeGateway) {
+				g.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+					if r.URL.Path != "/read" {
+						return false
+					}
+					writeJSON(w, http.StatusUnauthorized, APIResponse{Error: "invalid token", Code: "UNAUTHORIZED"})
+					return true
+				}
+			},
+			reads: 2, authorizations: 1,
+		},
+		{
+			name:   "auto reauth disabled",
+			opts:   []Option{WithAutoReauth(false)},
+			reject: func(g *fakeGateway) { g.revokeTokens() },
+			reads:  1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := newFakeGateway(t)
+			g.load("dev", "plan.xml", planDoc)
+			c := g.client(append([]Option{WithRetries(3), WithBackoff(&recordBackoff{})}, tc.opts...)...)
+			if err := c.Authorize(); err != nil {
+				t.Fatal(err)
+			}
+			tc.reject(g)
+			g.reset()
+
+			if _, err := c.ReadNode("dev", "plan.xml", "/plan"); !errors.Is(err, ErrUnauthorized) {
+				t.Errorf("ReadNode: %v, want ErrUnauthorized", err)
+			}
+			if n := len(g.receivedAt("/read")); n != tc.reads {
+				t.Errorf("%d reads, want %d", n, tc.reads)
+			}
+			if n := len(g.receivedAt("/authorize")); n != tc.authorizations {
+				t.Errorf("%d authorizations, want %d", n, tc.authorizations)
+			}
+		})
+	}
+}
+
+func TestRevokeLeavesNoLiveTokens(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		opts   []Option
+		revoke func(c *Client) error
+	}{
+		{name: "RevokeToken", revoke: func(c *Client) error { return c.RevokeToken(context.Background()) }},
+		{name: "Logout", revoke: func(c *Client) error { return c.Logout() }},
+		{name: "RevokeToken per device", opts: []Option{WithPerDeviceTokens()}, revoke: func(c *Client) error { return c.RevokeToken(context.Background()) }},
+		{name: "Logout per device", opts: []Option{WithPerDeviceTokens()}, revoke: func(c *Client) error { return c.Logout() }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := newFakeGateway(t)
+			g.load("dev1", "plan.xml", planDoc)
+			g.load("dev2", "plan.xml", planDoc)
+			c := g.client(tc.opts...)
+			if err := c.Authorize(); err != nil {
+				t.Fatal(err)
+			}
+			for _, deviceID := range []string{"dev1", "dev2"} {
+				if _, err := c.ReadNode(deviceID, "plan.xml", "/plan"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			g.reset()
+
+			if err := tc.revoke(c); err != nil {
+				t.Fatal(err)
+			}
+			if live := g.validTokens(); len(live) != 0 {
+				t.Errorf("live tokens after revoking: %v", live)
+			}
+			if n := len(g.receivedAt("/authorize")); n != 0 {
+				t.Errorf("%d authorizations while revoking, want none", n)
+			}
+			for _, req := range g.receivedAt("/revoke") {
+				if token := req.Header.Get("Authorization"); token != req.Query.Get("token") {
+					t.Errorf("revoked %s with token %q, want itself", req.Query.Get("token"), token)
+				}
+			}
+			if token, deviceTokens := c.currentTokens(); token != "" || len(deviceTokens) != 0 {
+				t.Errorf("cached after revoking: %q, %v", token, deviceTokens)
+			}
+		})
+	}
+}
+
+func TestRevokeKeepsRefusedTokens(t *testing.T) {
+	g := newFakeGateway(t)
+	g.load("dev1", "plan.xml", planDoc)
+	g.load("dev2", "plan.xml", planDoc)
+	c := g.client(WithPerDeviceTokens())
+	for _, deviceID := range []string{"dev1", "dev2"} {
+		if _, err := c.ReadNode(deviceID, "plan.xml", "/plan"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/revoke" || r.URL.Query().Get("deviceid") != "dev2" {
+			return false
+		}
+		writeJSON(w, http.StatusForbidden, APIResponse{Error: "revoke refused", Code: "FORBIDDEN"})
+		return true
+	}
+
+	if err := c.RevokeToken(context.Background()); err == nil {
+		t.Fatal("RevokeToken succeeded with a refused revoke")
+	}
+	_, deviceTokens := c.currentTokens()
+	if _, ok := deviceTokens["dev1"]; ok {
+		t.Error("revoked token of dev1 still cached")
+	}
+	token, ok := deviceTokens["dev2"]
+	if !ok {
+		t.Fatal("refused token of dev2 dropped")
+	}
+	if _, live := g.validTokens()[token]; !live {
+		t.Errorf("token %s of dev2 no longer live", token)
+	}
+}
@@ -0,0 +1,164 @@
+package xmlapi
+
+import (
+	"errors"
+	"fmt"
+	"unicode"
+)
+
+// NodeBuilder constructs a Node tree fluently:
+//
+//	b := xmlapi.NewNode("intersection")
+//	b.Child("phase").Attr("id", "1").Child("minGreen").Text("12")
+//	root, err := b.Build()
+//
+// Child descends into the new element and Up returns to the parent. Invalid
+// names are collected and reported by Build instead of panicking.
+type NodeBuilder struct {
+	state *builderState
+	elem  *builderElem
+}
+
+// builderState is shared by every NodeBuilder of one tree
+type builderState struct {
+	root *builderElem
+	errs []error
+}
+
+// builderElem is an element under construction
+type builderElem struct {
+	node     Node
+	children []*builderElem
+	subtree  *Node // set for comments and appended subtrees
+	parent   *builderElem
+}
+
+// NewNode starts building a tree whose root element is named local
+func NewNode(local string) *NodeBuilder {
+	return NewNodeNS("", local)
+}
+
+// NewNodeNS starts building a tree whose root element is in namespace space
+func NewNodeNS(space, local string) *NodeBuilder {
+	state := &builderState{}
+	state.root = &builderElem{node: Node{XMLName: XMLName{Space: space, Local: local}}}
+	state.checkName("element", local)
+	return &NodeBuilder{state: state, elem: state.root}
+}
+
+// Child appends a child element and returns a builder positioned on it
+func (b *NodeBuilder) Child(local string) *NodeBuilder {
+	return b.ChildNS("", local)
+}
+
+// ChildNS appends a namespaced child element and returns a builder positioned on it
+func (b *NodeBuilder) ChildNS(space, local string) *NodeBuilder {
+	b.state.checkName("element", local)
+	child := &builderElem{node: Node{XMLName: XMLName{Space: space, Local: local}}, parent: b.elem}
+	b.elem.children = append(b.elem.children, child)
+	return &NodeBuilder{state: b.state, elem: child}
+}
+
+// Up returns a builder positioned on the parent element; on the root it is a no-op
+func (b *NodeBuilder) Up() *NodeBuilder {
+	if b.elem.parent == nil {
+		return b
+	}
+	return &NodeBuilder{state: b.state, elem: b.elem.parent}
+}
+
+// Attr sets an attribute on the current element, replacing any previous value
+func (b *NodeBuilder) Attr(name, value string) *NodeBuilder {
+	return b.AttrNS("", name, value)
+}
+
+// AttrNS sets a namespaced attribute on the current element
+func (b *NodeBuilder) AttrNS(space, name, value string) *NodeBuilder {
+	b.state.checkName("attribute", name)
+	attrName := XMLName{Space: space, Local: name}
+	for i := range b.elem.node.Attrs {
+		if b.elem.node.Attrs[i].Name == attrName {
+			b.elem.node.Attrs[i].Value = value
+			return b
+		}
+	}
+	b.elem.node.Attrs = append(b.elem.node.Attrs, Attr{Name: attrName, Value: value})
+	return b
+}
+
+// Text sets the value of the current element
+func (b *NodeBuilder) Text(value string) *NodeBuilder {
+	b.elem.node.Value = value
+	b.elem.node.ValueKind = ValueText
+	return b
+}
+
+// CDATA sets the value of the current element, to be stored as a CDATA section
+func (b *NodeBuilder) CDATA(value string) *NodeBuilder {
+	b.elem.node.Value = value
+	b.elem.node.ValueKind = ValueCDATA
+	return b
+}
+
+// Comment appends a comment to the current element
+func (b *NodeBuilder) Comment(text string) *NodeBuilder {
+	b.elem.children = append(b.elem.children, &builderElem{subtree: &Node{Kind: NodeComment, Value: text}})
+	return b
+}
+
+// Append adds a copy of an existing subtree as a child of the current element
+func (b *NodeBuilder) Append(n *Node) *NodeBuilder {
+	if n == nil {
+		b.state.errs = append(b.state.errs, errors.New("cannot append a nil node"))
+		return b
+	}
+	b.elem.children = append(b.elem.children, &builderElem{subtree: n.Clone()})
+	return b
+}
+
+// Build returns the whole tree, from the root, or the errors collected while
+// building it
+func (b *NodeBuilder) Build() (*Node, error) {
+	if len(b.state.errs) > 0 {
+		return nil, errors.Join(b.state.errs...)
+	}
+	return b.state.root.build(), nil
+}
+
+// build converts the element and its descendants into a Node
+func (e *builderElem) build() *Node {
+	if e.subtree != nil {
+		return e.subtree.Clone()
+	}
+	node := e.node
+	node.Attrs = append([]Attr(nil), e.node.Attrs...)
+	node.Nodes = make([]Node, len(e.children))
+	for i, child := range e.children {
+		node.Nodes[i] = *child.build()
+	}
+	return &node
+}
+
+// checkName records an error if name is not a valid XML name
+func (s *builderState) checkName(kind, name string) {
+	if !isValidName(name) {
+		s.errs = append(s.errs, fmt.Errorf("invalid %s name %q", kind, name))
+	}
+}
+
+// isValidName reports whether name is a valid unprefixed XML name
+func isValidName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		if r == '_' || unicode.IsLetter(r) {
+			continue
+		}
+		if i > 0 && (r == '-' || r == '.' || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)) {
+			continue
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,307 @@
+package xmlapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+)
+
+// errBulkCount reports a /readBulk response with a node count other than
+// the number of paths read
+var errBulkCount = errors.New("unexpected number of nodes")
+
+// bulkReadResponse represents the response of /readBulk
+type bulkReadResponse struct {
+	Nodes []Node `json:"nodes"`
+}
+
+// ReadNodes reads several nodes of the XML file in one request, returned
+// in the order of paths
+func (c *Client) ReadNodes(deviceID, filename string, paths []string, opts ...RequestOption) (_ []*Node, err error) {
+	ctx, op := startOp(context.Background(), "ReadNodes", opts, deviceID, filename, nil)
+	defer op.finish(&err)
+
+	return c.readNodes(ctx, deviceID, filename, paths)
+}
+
+// readNodes implements ReadNodes, carrying ctx
+func (c *Client) readNodes(ctx context.Context, deviceID, filename string, paths []string) ([]*Node, error) {
+	params := map[string]string{
+		"deviceid": deviceID,
+		"filename": filename,
+	}
+	multi := url.Values{"path": paths}
+
+	resp, err := c.requestMulti(ctx, "GET", "/readBulk", params, multi, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result bulkReadResponse
+	err = c.decode(resp, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	// The nodes are matched to their paths by position
+	if len(result.Nodes) != len(paths) {
+		return nil, resp.op.wrap(fmt.Errorf("%w: %d nodes for %d paths", errBulkCount, len(result.Nodes), len(paths)))
+	}
+	nodes := make([]*Node, len(result.Nodes))
+	for i := range result.Nodes {
+		result.Nodes[i].normalizeValues()
+		if err := c.decodeNode(ctx, paths[i], &result.Nodes[i]); err != nil {
+			return nil, resp.op.wrap(err)
+		}
+		nodes[i] = &result.Nodes[i]
+	}
+	return nodes, nil
+}
+
+// DeleteNodes deletes several nodes of the XML file in one request
+func (c *Client) DeleteNodes(deviceID, filename string, paths []string, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "DeleteNodes", opts, deviceID, filename, nil)
+	defer op.finish(&err)
+
+	return c.deleteNodes(ctx, deviceID, filename, paths)
+}
+
+// deleteNodes implements DeleteNodes, carrying ctx
+func (c *Client) deleteNodes(ctx context.Context, deviceID, filename string, paths []string) (string, error) {
+	params := map[string]string{
+		"deviceid": deviceID,
+		"filename": filename,
+	}
+	multi := url.Values{"path": paths}
+
+	resp, err := c.requestMulti(ctx, "DELETE", "/deleteBulk", params, multi, nil)
+	if err != nil {
+		return "", err
+	}
+	return c.status(resp)
+}
+
+// defaultBulkConcurrency is how many individual updates UpdateNodes runs at
+// once when BulkOptions does not say
+const defaultBulkConcurrency = 4
+
+// BulkOptions configures UpdateNodes
+type BulkOptions struct {
+	// Concurrency bounds the individual updates run at once when the gateway
+	// has no batch endpoint
+	Concurrency int
+	// AllOrNothing reads the current values first and restores those already
+	// updated if any update fails
+	AllOrNothing bool
+}
+
+// BulkResult reports the outcome of a bulk operation per path or file
+type BulkResult struct {
+	// Applied lists the paths or files changed, in sorted order. After a
+	// rollback they hold their previous values again.
+	Applied []string
+	// Errors holds the error of every path that failed
+	Errors map[string]error
+	// Skipped lists what was deliberately left alone, in sorted order
+	Skipped []string
+	// RolledBack is set when AllOrNothing restored the applied paths
+	RolledBack bool
+	// RollbackErrors holds the error of every path that could not be restored
+	RollbackErrors map[string]error
+}
+
+// Err returns nil if every item succeeded, otherwise the error of the
+// first failed one in sorted order
+func (r *BulkResult) Err() error {
+	paths := make([]string, 0, len(r.Errors))
+	for path := range r.Errors {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	if len(paths) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d of %d failed, first %s: %w", len(paths), len(paths)+len(r.Applied), paths[0], r.Errors[paths[0]])
+}
+
+// bulkUpdateResponse represents the response of /updateBulk
+type bulkUpdateResponse struct {
+	APIResponse
+	// Failed maps each path that was not updated to the reason
+	Failed map[string]string `json:"failed"`
+}
+
+// UpdateNodes sets the value of every path in values. The gateway's
+// /updateBulk is used where available, applying all or none of the values
+// when AllOrNothing is set; otherwise the paths are updated individually
+// with bounded concurrency. The result is returned either way, and the
+// error is that of BulkResult.Err.
+func (c *Client) UpdateNodes(ctx context.Context, deviceID, filename string, values map[string]string, opts BulkOptions, reqOpts ...RequestOption) (_ *BulkResult, err error) {
+	ctx, op := startOp(ctx, "UpdateNodes", reqOpts, deviceID, filename, nil)
+	defer op.finish(&err)
+
+	result, err := c.updateBulk(ctx, deviceID, filename, values, opts.AllOrNothing)
+	if !errors.Is(err, ErrUnsupportedByServer) {
+		if err != nil {
+			return nil, err
+		}
+		return result, result.Err()
+	}
+
+	paths := make([]string, 0, len(values))
+	for path := range values {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var previous map[string]string
+	if opts.AllOrNothing {
+		previous, err = c.currentValues(ctx, deviceID, filename, paths)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result = &BulkResult{Errors: make(map[string]error)}
+	errs := c.updateEach(ctx, deviceID, filename, paths, values, opts.Concurrency)
+	for _, path := range paths {
+		if errs[path] != nil {
+			result.Errors[path] = errs[path]
+		} else {
+			result.Applied = append(result.Applied, path)
+		}
+	}
+
+	if opts.AllOrNothing && len(result.Errors) > 0 && len(result.Applied) > 0 {
+		restore := make(map[string]string, len(result.Applied))
+		for _, path := range result.Applied {
+			restore[path] = previous[path]
+		}
+		result.RolledBack = true
+		errs := c.updateEach(context.WithoutCancel(ctx), deviceID, filename, result.Applied, restore, opts.Concurrency)
+		for _, path := range result.Applied {
+			if errs[path] != nil {
+				if result.RollbackErrors == nil {
+					result.RollbackErrors = make(map[string]error)
+				}
+				result.RollbackErrors[path] = errs[path]
+			}
+		}
+	}
+
+	return result, result.Err()
+}
+
+// updateBulk calls the gateway's batch update endpoint
+func (c *Client) updateBulk(ctx context.Context, deviceID, filename string, values map[string]string, atomic bool) (*BulkResult, error) {
+	params := map[string]string{
+		"deviceid": deviceID,
+		"filename": filename,
+	}
+	if atomic {
+		params["atomic"] = "true"
+	}
+	stored := make(map[string]string, len(values))
+	for path, value := range values {
+		value, err := c.encodeValue(ctx, path, value)
+		if err != nil {
+			return nil, err
+		}
+		stored[path] = value
+	}
+	body := map[string]interface{}{
+		"values": stored,
+	}
+
+	resp, err := c.requestContext(ctx, "PUT", "/updateBulk", params, body)
+	if err != nil {
+		return nil, err
+	}
+
+	var response bulkUpdateResponse
+	err = c.decode(resp, &response)
+	if err != nil {
+		return nil, err
+	}
+	if response.Error != "" && len(response.Failed) == 0 {
+		return nil, resp.op.wrap(response.err(resp.StatusCode))
+	}
+
+	result := &BulkResult{Errors: make(map[string]error)}
+	for path := range values {
+		if reason, failed := response.Failed[path]; failed {
+			result.Errors[path] = resp.op.wrap(errors.New(reason))
+		} else if !atomic || len(response.Failed) == 0 {
+			result.Applied = append(result.Applied, path)
+		}
+	}
+	sort.Strings(result.Applied)
+	return result, nil
+}
+
+// currentValues reads the values of paths, in one request where the
+// gateway supports it
+func (c *Client) currentValues(ctx context.Context, deviceID, filename string, paths []string) (map[string]string, error) {
+	values := make(map[string]string, len(paths))
+
+	nodes, err := c.readNodes(ctx, deviceID, filename, paths)
+	if err == nil {
+		for i, path := range paths {
+			values[path] = nodes[i].Value
+		}
+		return values, nil
+	}
+	if !errors.Is(err, ErrUnsupportedByServer) && !errors.Is(err, errBulkCount) {
+		return nil, err
+	}
+
+	for _, path := range paths {
+		node, err := c.readNode(ctx, deviceID, filename, path)
+		if err != nil {
+			return nil, err
+		}
+		values[path] = node.Value
+	}
+	return values, nil
+}
+
+// updateEach updates paths individually with at most concurrency running at
+// once, returning the error of each path that failed
+func (c *Client) updateEach(ctx context.Context, deviceID, filename string, paths []string, values map[string]string, concurrency int) map[string]error {
+	return runEach(paths, concurrency, func(path string) error {
+		_, err := c.updateNode(ctx, deviceID, filename, path, values[path])
+		return err
+	})
+}
+
+// runEach calls fn for every item with at most concurrency calls running at
+// once, returning the error of each item that failed
+func runEach(items []string, concurrency int, fn func(item string) error) map[string]error {
+	if concurrency < 1 {
+		concurrency = defaultBulkConcurrency
+	}
+
+	errs := make(map[string]error)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, concurrency)
+	for _, item := range items {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(item string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			if err := fn(item); err != nil {
+				mu.Lock()
+				errs[item] = err
+				mu.Unlock()
+			}
+		}(item)
+	}
+	wg.Wait()
+	return errs
+}
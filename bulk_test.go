@@ -0,0 +1,75 @@
+package xmlapi
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestReadNodesRepeatedPaths(t *testing.T) {
+	g := newFakeGateway(t)
+	g.load("dev", "plan.xml", planDoc)
+	c := g.client()
+
+	nodes, err := c.ReadNodes("dev", "plan.xml", []string{"/plan/phase[2]", "/plan/phase[1]/minGreen", "/plan/phase[2]"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 3 || nodes[0].XMLName.Local != "phase" || nodes[1].Value != "5" || nodes[2].XMLName.Local != "phase" {
+		t.Errorf("nodes %+v, want phase 2, minGreen 5 and phase 2 again", nodes)
+	}
+	if id, _ := nodes[0].Attr("id"); id != "2" {
+		t.Errorf("first node has id %q, want 2", id)
+	}
+
+	// Keys are sorted, repeated values keep their order
+	const want = "deviceid=dev&filename=plan.xml&path=%2Fplan%2Fphase%5B2%5D&path=%2Fplan%2Fphase%5B1%5D%2FminGreen&path=%2Fplan%2Fphase%5B2%5D"
+	if got := g.receivedAt("/readBulk")[0].RawQuery; got != want {
+		t.Errorf("query %s\nwant  %s", got, want)
+	}
+}
+
+func TestDeleteNodesRepeatedPaths(t *testing.T) {
+	g := newFakeGateway(t)
+	g.load("dev", "plan.xml", planDoc)
+	c := g.client(WithLegacyFormEncoding())
+
+	if _, err := c.DeleteNodes("dev", "plan.xml", []string{"/plan/phase[2]", "/plan/phase[1]/minGreen"}); err != nil {
+		t.Fatal(err)
+	}
+	// DELETE keeps its parameters in the query even in legacy form mode
+	const want = "deviceid=dev&filename=plan.xml&path=%2Fplan%2Fphase%5B2%5D&path=%2Fplan%2Fphase%5B1%5D%2FminGreen"
+	if got := g.receivedAt("/deleteBulk")[0].RawQuery; got != want {
+		t.Errorf("query %s\nwant  %s", got, want)
+	}
+	if got := mustXML(t, g.file("dev", "plan.xml")); got != `<plan version="3"><phase id="1" mode="fixed"/></plan>` {
+		t.Errorf("file %s", got)
+	}
+}
+
+func TestReadNodesNamespaces(t *testing.T) {
+	g := newFakeGateway(t)
+	c := g.client(WithNamespace("n", "urn:n"), WithNamespace("unused", "urn:unused"))
+
+	c.ReadNodes("dev", "plan.xml", []string{"/plan", "/plan/n:phase", "/plan/n:phase/n:minGreen"})
+	const want = "deviceid=dev&filename=plan.xml&path=%2Fplan&path=%2Fplan%2Fn%3Aphase&path=%2Fplan%2Fn%3Aphase%2Fn%3AminGreen&xmlns%3An=urn%3An"
+	if got := g.receivedAt("/readBulk")[0].RawQuery; got != want {
+		t.Errorf("query %s\nwant  %s", got, want)
+	}
+}
+
+func TestReadNodesCountMismatch(t *testing.T) {
+	g := newFakeGateway(t)
+	g.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/readBulk" {
+			return false
+		}
+		writeJSON(w, http.StatusOK, bulkReadResponse{Nodes: []Node{{XMLName: XMLName{Local: "plan"}}}})
+		return true
+	}
+	c := g.client()
+
+	if _, err := c.ReadNodes("dev", "plan.xml", []string{"/plan", "/plan"}); !errors.Is(err, errBulkCount) {
+		t.Errorf("ReadNodes = %v, want errBulkCount", err)
+	}
+}
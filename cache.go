@@ -0,0 +1,245 @@
+package xmlapi
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// WithReadCache serves ReadNode and ReadFile from memory for ttl after a
+// node was read, keeping at most maxEntries nodes and evicting the least
+// recently used. Expired nodes the gateway sent an ETag for are revalidated
+// with a conditional read instead of being downloaded again. Writes through
+// the client invalidate the reads they affect; use InvalidateCache for
+// changes made by others.
+func WithReadCache(ttl time.Duration, maxEntries int) Option {
+	return func(c *Client) {
+		c.cache = newReadCache(ttl, maxEntries)
+	}
+}
+
+// InvalidateCache drops cached reads of a device. An empty filename drops
+// every file of the device. Otherwise the reads of filename dropped are
+// those at or below pathPrefix, and of its ancestors since they contain it;
+// "" or "/" drops the whole file.
+func (c *Client) InvalidateCache(deviceID, filename, pathPrefix string) {
+	if c.cache != nil {
+		c.cache.invalidate(deviceID, filename, pathPrefix)
+	}
+}
+
+// cacheKey identifies a cached read
+type cacheKey struct {
+	deviceID string
+	filename string
+	path     string
+}
+
+// fileKey identifies a file of a device
+type fileKey struct {
+	deviceID string
+	filename string
+}
+
+// cacheEntry is a cached read, held in the LRU list
+type cacheEntry struct {
+	key     cacheKey
+	node    *Node
+	etag    string
+	expires time.Time
+}
+
+// readCache is a TTL and LRU bounded cache of read nodes
+type readCache struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[cacheKey]*list.Element
+	files   map[fileKey]map[string]*list.Element // entries by file, then path
+	lru     *list.List                           // most recently used first
+}
+
+// newReadCache creates an empty cache
+func newReadCache(ttl time.Duration, maxEntries int) *readCache {
+	return &readCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[cacheKey]*list.Element),
+		files:      make(map[fileKey]map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// get returns a copy of the cached node for key with its ETag, and whether
+// it is still fresh. Expired entries without an ETag are dropped; those with
+// one are kept for revalidation.
+func (rc *readCache) get(key cacheKey) (*Node, string, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	elem, ok := rc.entries[key]
+	if !ok {
+		return nil, "", false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		if entry.etag == "" {
+			rc.remove(elem)
+			return nil, "", false
+		}
+		return entry.node.Clone(), entry.etag, false
+	}
+	rc.lru.MoveToFront(elem)
+	return entry.node.Clone(), entry.etag, true
+}
+
+// put caches a copy of node for key, fresh for the TTL
+func (rc *readCache) put(key cacheKey, node *Node, etag string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	entry := &cacheEntry{key: key, node: node.Clone(), etag: etag, expires: time.Now().Add(rc.ttl)}
+	if elem, ok := rc.entries[key]; ok {
+		elem.Value = entry
+		rc.lru.MoveToFront(elem)
+		return
+	}
+	elem := rc.lru.PushFront(entry)
+	rc.entries[key] = elem
+	file := fileKey{key.deviceID, key.filename}
+	if rc.files[file] == nil {
+		rc.files[file] = make(map[string]*list.Element)
+	}
+	rc.files[file][key.path] = elem
+
+	for rc.maxEntries > 0 && rc.lru.Len() > rc.maxEntries {
+		rc.remove(rc.lru.Back())
+	}
+}
+
+// remove drops a cache element; rc.mu must be held
+func (rc *readCache) remove(elem *list.Element) {
+	key := elem.Value.(*cacheEntry).key
+	delete(rc.entries, key)
+	file := fileKey{key.deviceID, key.filename}
+	delete(rc.files[file], key.path)
+	if len(rc.files[file]) == 0 {
+		delete(rc.files, file)
+	}
+	rc.lru.Remove(elem)
+}
+
+// invalidate drops the reads matched as described by InvalidateCache
+func (rc *readCache) invalidate(deviceID, filename, pathPrefix string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	for file, paths := range rc.files {
+		if file.deviceID != deviceID || (filename != "" && file.filename != filename) {
+			continue
+		}
+		for path, elem := range paths {
+			if filename == "" || pathsOverlap(path, pathPrefix) {
+				rc.remove(elem)
+			}
+		}
+	}
+}
+
+// invalidateWrite drops the reads a write request to endpoint with params
+// may have made stale: those overlapping the path it writes, or the whole
+// file when it has none, plus the copy made by CopyDevice and the output of
+// a transform. Structural writes add or remove elements and so shift the
+// indexes of their siblings; they drop the whole subtree of the parent.
+func (rc *readCache) invalidateWrite(endpoint string, params map[string]string) {
+	deviceID, filename := params["deviceid"], params["filename"]
+	if deviceID == "" {
+		return
+	}
+
+	path := params["path"]
+	if path == "" {
+		path = params["parent_path"]
+	} else if structuralWrite(endpoint, params) {
+		path = parentPathOf(path)
+	}
+	rc.invalidate(deviceID, filename, path)
+
+	if target := params["new_deviceid"]; target != "" {
+		rc.invalidate(target, filename, "")
+	}
+	if output := params["output_filename"]; output != "" {
+		rc.invalidate(deviceID, output, "")
+	}
+}
+
+// structuralWrite reports whether a write to endpoint addressing the
+// element at params["path"] removes or replaces that element, rather than
+// changing it in place. Writes addressing a parent_path already drop the
+// parent's subtree.
+func structuralWrite(endpoint string, params map[string]string) bool {
+	switch endpoint {
+	case "/delete":
+		return params["attr"] == ""
+	case "/replace":
+		return true
+	}
+	return false
+}
+
+// parentPathOf returns the path of the parent of the element at path, or ""
+// for the whole file when it has none or path cannot be parsed
+func parentPathOf(path string) string {
+	p, err := parsePath(path)
+	if err != nil {
+		return ""
+	}
+	p.Segments = elementSegments(p)
+	if len(p.Segments) < 2 {
+		return ""
+	}
+	return p.prefix(len(p.Segments) - 1).String()
+}
+
+// pathsOverlap reports whether one of two paths addresses an ancestor of,
+// or the same element as, the other, so that a change at either is visible
+// in a read of the other. Attribute segments stand for their element, and
+// wildcards and unindexed segments may match any sibling. An empty or
+// unparsable path overlaps everything.
+func pathsOverlap(a, b string) bool {
+	pa, errA := parsePath(a)
+	pb, errB := parsePath(b)
+	if errA != nil || errB != nil || pa.Absolute != pb.Absolute {
+		return true
+	}
+
+	segA, segB := elementSegments(pa), elementSegments(pb)
+	for i := 0; i < len(segA) && i < len(segB); i++ {
+		if !segmentsOverlap(segA[i], segB[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// elementSegments returns the segments of p without a final attribute
+func elementSegments(p parsedPath) []pathSegment {
+	if n := len(p.Segments); n > 0 && p.Segments[n-1].Attr {
+		return p.Segments[:n-1]
+	}
+	return p.Segments
+}
+
+// segmentsOverlap reports whether two segments may select the same element
+func segmentsOverlap(a, b pathSegment) bool {
+	if !a.Wildcard && !b.Wildcard {
+		if a.Local != b.Local {
+			return false
+		}
+		if a.Prefix != "" && b.Prefix != "" && a.Prefix != b.Prefix {
+			return false
+		}
+	}
+	return a.Index == 0 || b.Index == 0 || a.Index == b.Index
+}
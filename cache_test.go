@@ -0,0 +1,296 @@
+package xmlapi
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// cachedReads returns the cached reads as "device file path", sorted
+func cachedReads(c *Client) []string {
+	c.cache.mu.Lock()
+	defer c.cache.mu.Unlock()
+	var keys []string
+	for key := range c.cache.entries {
+		keys = append(keys, key.deviceID+" "+key.filename+" "+key.path)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	paths := []string{"/plan", "/plan/phase[1]", "/plan/phase[1]/minGreen", "/plan/phase[2]", "/plan/phase[2]/minGreen", "/plan/name"}
+	const doc = `<plan version="3"><phase id="1"><minGreen>5</minGreen></phase><phase id="2"><minGreen>7</minGreen></phase><name>n</name></plan>`
+	others := []string{"dev other.xml /plan", "dev2 plan.xml /plan"}
+
+	for _, tc := range []struct {
+		name  string
+		write func(c *Client) error
+		// dropped are the paths of dev plan.xml the write invalidates
+		dropped []string
+		// othersDropped drops the reads of the other file and device too
+		othersDropped []string
+	}{
+		{
+			name: "update a leaf",
+			write: func(c *Client) error {
+				_, err := c.UpdateNode("dev", "plan.xml", "/plan/phase[1]/minGreen", "6")
+				return err
+			},
+			dropped: []string{"/plan", "/plan/phase[1]", "/plan/phase[1]/minGreen"},
+		},
+		{
+			name: "set an attribute",
+			write: func(c *Client) error {
+				_, err := c.SetAttribute("dev", "plan.xml", "/plan/phase[2]", "mode", "x")
+				return err
+			},
+			dropped: []string{"/plan", "/plan/phase[2]", "/plan/phase[2]/minGreen"},
+		},
+		{
+			name: "create a child",
+			write: func(c *Client) error {
+				_, err := c.CreateNode("dev", "plan.xml", "/plan/phase[1]", "maxGreen", "9")
+				return err
+			},
+			dropped: []string{"/plan", "/plan/phase[1]", "/plan/phase[1]/minGreen"},
+		},
+		{
+			name:    "create a sibling",
+			write:   func(c *Client) error { _, err := c.CreateNode("dev", "plan.xml", "/plan", "phase", ""); return err },
+			dropped: paths,
+		},
+		{
+			name:    "delete a node shifting its siblings",
+			write:   func(c *Client) error { _, err := c.DeleteNode("dev", "plan.xml", "/plan/phase[1]"); return err },
+			dropped: paths,
+		},
+		{
+			name: "delete a leaf",
+			write: func(c *Client) error {
+				_, err := c.DeleteNode("dev", "plan.xml", "/plan/phase[2]/minGreen")
+				return err
+			},
+			dropped: []string{"/plan", "/plan/phase[2]", "/plan/phase[2]/minGreen"},
+		},
+		{
+			name: "delete an attribute",
+			write: func(c *Client) error {
+				_, err := c.DeleteAttribute("dev", "plan.xml", "/plan/phase[1]", "id")
+				return err
+			},
+			dropped: []string{"/plan", "/plan/phase[1]", "/plan/phase[1]/minGreen"},
+		},
+		{
+			name: "copy the device",
+			write: func(c *Client) error {
+				_, err := c.CopyDevice("dev", "dev2", "plan.xml", true)
+				return err
+			},
+			dropped:       paths,
+			othersDropped: []string{"dev2 plan.xml /plan"},
+		},
+		{
+			name:    "unindexed path",
+			write:   func(c *Client) error { _, err := c.UpdateNode("dev", "plan.xml", "/plan/name", "m"); return err },
+			dropped: []string{"/plan", "/plan/name"},
+		},
+		{
+			name:    "delete the file",
+			write:   func(c *Client) error { _, err := c.DeleteFile("dev", "plan.xml"); return err },
+			dropped: paths,
+		},
+		{
+			name:          "invalidate a device",
+			write:         func(c *Client) error { c.InvalidateCache("dev", "", ""); return nil },
+			dropped:       paths,
+			othersDropped: []string{"dev other.xml /plan"},
+		},
+		{
+			name:    "invalidate a subtree",
+			write:   func(c *Client) error { c.InvalidateCache("dev", "plan.xml", "/plan/phase[2]"); return nil },
+			dropped: []string{"/plan", "/plan/phase[2]", "/plan/phase[2]/minGreen"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := newFakeGateway(t)
+			g.load("dev", "plan.xml", doc)
+			g.load("dev", "other.xml", doc)
+			g.load("dev2", "plan.xml", doc)
+			c := g.client(WithReadCache(time.Minute, 0))
+
+			for _, path := range paths {
+				if _, err := c.ReadNode("dev", "plan.xml", path); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, read := range []struct{ dev, file string }{{"dev", "other.xml"}, {"dev2", "plan.xml"}} {
+				if _, err := c.ReadNode(read.dev, read.file, "/plan"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := len(cachedReads(c)); got != len(paths)+len(others) {
+				t.Fatalf("%d cached reads, want %d", got, len(paths)+len(others))
+			}
+
+			if err := tc.write(c); err != nil {
+				t.Fatal(err)
+			}
+
+			dropped := make(map[string]bool)
+			for _, path := range tc.dropped {
+				dropped["dev plan.xml "+path] = true
+			}
+			for _, key := range tc.othersDropped {
+				dropped[key] = true
+			}
+			var want []string
+			for _, path := range paths {
+				if key := "dev plan.xml " + path; !dropped[key] {
+					want = append(want, key)
+				}
+			}
+			for _, key := range others {
+				if !dropped[key] {
+					want = append(want, key)
+				}
+			}
+			sort.Strings(want)
+
+			if got := cachedReads(c); !reflect.DeepEqual(got, want) {
+				t.Errorf("surviving reads\n%q\nwant\n%q", got, want)
+			}
+
+			// Surviving reads are served from memory
+			g.reset()
+			for _, key := range want {
+				f := strings.Fields(key)
+				if _, err := c.ReadNode(f[0], f[1], f[2]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if n := len(g.receivedAt("/read")); n != 0 {
+				t.Errorf("%d reads reached the gateway, want none", n)
+			}
+		})
+	}
+}
+
+func TestCacheDeleteShiftsSiblings(t *testing.T) {
+	g := newFakeGateway(t)
+	g.load("dev", "plan.xml", `<plan><phase id="1"/><phase id="2"/><phase id="3"/></plan>`)
+	c := g.client(WithReadCache(time.Minute, 0))
+	for _, path := range []string{"/plan/phase[2]", "/plan/phase[3]"} {
+		if _, err := c.ReadNode("dev", "plan.xml", path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := c.DeleteNode("dev", "plan.xml", "/plan/phase[1]"); err != nil {
+		t.Fatal(err)
+	}
+	n, err := c.ReadNode("dev", "plan.xml", "/plan/phase[2]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := n.Attr("id"); id != "3" {
+		t.Errorf("phase[2] after the delete has id %q, want 3", id)
+	}
+	if _, err := c.ReadNode("dev", "plan.xml", "/plan/phase[3]"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("phase[3] after the delete: %v, want ErrNotFound", err)
+	}
+}
+
+func TestPathsOverlap(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want bool
+	}{
+		{"/plan", "/plan/phase[1]/minGreen", true},
+		{"/plan/phase[1]", "/plan/phase[1]", true},
+		{"/plan/phase[1]", "/plan/phase[2]", false},
+		{"/plan/phase", "/plan/phase[2]", true},
+		{"/plan/phase[1]/minGreen", "/plan/phase[2]/minGreen", false},
+		{"/plan/*/minGreen", "/plan/phase[2]/minGreen", true},
+		{"/plan/phase[1]/@id", "/plan/phase[1]/minGreen", true},
+		{"/plan/phase[2]/@id", "/plan/phase[1]", false},
+		{"/plan/name", "/plan/phase", false},
+		{"/plan/a:x", "/plan/b:x", false},
+		{"/plan/x", "/plan/b:x", true},
+		{"", "/plan/phase", true},
+		{"/plan[", "/plan/phase", true},
+	} {
+		if got := pathsOverlap(tc.a, tc.b); got != tc.want {
+			t.Errorf("pathsOverlap(%q, %q) = %v, want %v", tc.a, tc.b, got, tc.want)
+		}
+		if got := pathsOverlap(tc.b, tc.a); got != tc.want {
+			t.Errorf("pathsOverlap(%q, %q) = %v, want %v", tc.b, tc.a, got, tc.want)
+		}
+	}
+}
+
+func TestCacheRevalidation(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		noETag bool
+	}{
+		{name: "with ETag"},
+		{name: "without ETag", noETag: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := newFakeGateway(t)
+			g.noETag = tc.noETag
+			g.load("dev", "plan.xml", planDoc)
+			// Every cached read has expired by the time it is used again
+			c := g.client(WithReadCache(time.Nanosecond, 0))
+
+			first, err := c.ReadNode("dev", "plan.xml", "/plan")
+			if err != nil {
+				t.Fatal(err)
+			}
+			size := g.bytesSent("/read")
+			if size == 0 {
+				t.Fatal("no body bytes counted")
+			}
+
+			for i := 0; i < 3; i++ {
+				n, err := c.ReadNode("dev", "plan.xml", "/plan")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got, want := mustXML(t, n), mustXML(t, first); got != want {
+					t.Errorf("read %s, want %s", got, want)
+				}
+			}
+			reads := g.receivedAt("/read")
+			if len(reads) != 4 {
+				t.Fatalf("%d reads, want every expired read to reach the gateway", len(reads))
+			}
+			wantBytes := size
+			if tc.noETag {
+				wantBytes = 4 * size
+			}
+			if got := g.bytesSent("/read"); got != wantBytes {
+				t.Errorf("%d body bytes sent, want %d", got, wantBytes)
+			}
+			for _, read := range reads[1:] {
+				if conditional := read.Header.Get("If-None-Match") != ""; conditional == tc.noETag {
+					t.Errorf("conditional read = %v", conditional)
+				}
+			}
+
+			// A changed node is downloaded again
+			g.load("dev", "plan.xml", `<plan version="4"/>`)
+			n, err := c.ReadNode("dev", "plan.xml", "/plan")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := mustXML(t, n); got != `<plan version="4"/>` {
+				t.Errorf("read after the change %s", got)
+			}
+		})
+	}
+}
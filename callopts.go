@@ -0,0 +1,188 @@
+package xmlapi
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProcessingTimeHeader is the response header in which the gateway reports
+// how long it spent on a request, in milliseconds
+const ProcessingTimeHeader = "X-Processing-Time"
+
+// RequestOption configures a single call. Every method that talks to the
+// gateway takes them as its final arguments; methods with options of their
+// own accept RequestOptions among those.
+type RequestOption func(*callConfig)
+
+// callConfig holds the options of a call. It travels in the call's context
+// so that every request the call makes sees it.
+type callConfig struct {
+	timeout time.Duration
+	header  http.Header
+	meta    bool
+	capture *ResponseMeta
+
+	// rawValues skips field encryption, see rawValues
+	rawValues bool
+	// method is the Client method the call is made by, see startOp
+	method string
+}
+
+// RequestTimeout limits each request of the call, its retries and backoff
+// included, to d. Unlike WithTimeout, which bounds single attempts, it
+// bounds the whole request, and it replaces the attempt timeouts of
+// WithTimeout and WithEndpointTimeout for the call.
+func RequestTimeout(d time.Duration) RequestOption {
+	return func(cfg *callConfig) {
+		cfg.timeout = d
+	}
+}
+
+// RequestHeader sets a header on every request of the call, replacing any
+// the client would set itself except Authorization
+func RequestHeader(key, value string) RequestOption {
+	return func(cfg *callConfig) {
+		header := cfg.header.Clone()
+		if header == nil {
+			header = make(http.Header)
+		}
+		header.Set(key, value)
+		cfg.header = header
+	}
+}
+
+// callConfigKey is the context key of the callConfig
+type callConfigKey struct{}
+
+// withRequestOptions returns ctx carrying opts on top of the options it
+// already carries
+func withRequestOptions(ctx context.Context, opts []RequestOption) context.Context {
+	if len(opts) == 0 {
+		return ctx
+	}
+	cfg := requestConfig(ctx)
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return context.WithValue(ctx, callConfigKey{}, cfg)
+}
+
+// requestConfig returns the options carried by ctx
+func requestConfig(ctx context.Context) callConfig {
+	cfg, _ := ctx.Value(callConfigKey{}).(callConfig)
+	return cfg
+}
+
+// withCallHeader returns header with the call's extra headers added. The
+// client's credentials are never replaced.
+func withCallHeader(header, extra http.Header) http.Header {
+	if len(extra) == 0 {
+		return header
+	}
+	merged := header.Clone()
+	if merged == nil {
+		merged = make(http.Header)
+	}
+	for key, values := range extra {
+		if key == "Authorization" {
+			continue
+		}
+		merged[key] = values
+	}
+	return merged
+}
+
+// ResponseMeta describes the response that ended a call
+type ResponseMeta struct {
+	// StatusCode is 0 when no response was received
+	StatusCode int
+	// Header holds the response headers, such as X-Revision,
+	// X-RateLimit-Remaining and Warning
+	Header http.Header
+	// Attempts is how many attempts the call made, 1 if the first succeeded
+	Attempts int
+	// ProcessingTime is the time the gateway reported in
+	// ProcessingTimeHeader, 0 if it reported none
+	ProcessingTime time.Duration
+}
+
+// CaptureResponse stores the status, headers and attempt count of the
+// call's final response in meta once the call completes. A call that
+// re-authorizes or retries reports the last attempt, and one that makes
+// several requests reports the last request. Reads with this option bypass
+// the read cache.
+func CaptureResponse(meta *ResponseMeta) RequestOption {
+	return func(cfg *callConfig) {
+		cfg.capture = meta
+	}
+}
+
+// captureResponse fills in the ResponseMeta requested through ctx, if any
+func captureResponse(ctx context.Context, resp *Response, attempts int) {
+	meta := requestConfig(ctx).capture
+	if meta == nil {
+		return
+	}
+	*meta = ResponseMeta{Attempts: attempts}
+	if resp == nil {
+		return
+	}
+	meta.StatusCode = resp.StatusCode
+	meta.Header = resp.Header.Clone()
+	meta.ProcessingTime = parseProcessingTime(resp.Header.Get(ProcessingTimeHeader))
+}
+
+// parseProcessingTime parses a processing time header, given in
+// milliseconds or as a Go duration
+func parseProcessingTime(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if ms, err := strconv.ParseFloat(value, 64); err == nil && ms >= 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return d
+	}
+	return 0
+}
+
+// The methods below make RequestOptions usable wherever a method takes
+// options of its own
+
+func (o RequestOption) applyCompare(cfg *compareConfig) {
+	cfg.call = append(cfg.call, o)
+}
+
+func (o RequestOption) applyCSV(cfg *csvConfig) {
+	cfg.call = append(cfg.call, o)
+}
+
+func (o RequestOption) applyDeleteAll(cfg *deleteAllConfig) {
+	cfg.call = append(cfg.call, o)
+}
+
+func (o RequestOption) applyJSONImport(cfg *jsonImportConfig) {
+	cfg.call = append(cfg.call, o)
+}
+
+func (o RequestOption) applyPatch(cfg *patchConfig) {
+	cfg.call = append(cfg.call, o)
+}
+
+func (o RequestOption) applyReplace(cfg *replaceConfig) {
+	cfg.call = append(cfg.call, o)
+}
+
+func (o RequestOption) applyDelete(cfg *deleteConfig) {
+	cfg.call = append(cfg.call, o)
+}
+
+func (o RequestOption) applyUpload(cfg *uploadConfig) {
+	cfg.call = append(cfg.call, o)
+}
+
+func (o RequestOption) applyCreate(cfg *createConfig) {
+	cfg.call = append(cfg.call, o)
+}
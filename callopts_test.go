@@ -0,0 +1,212 @@
+package xmlapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// localMethods are the Client methods that never talk to the gateway
+var localMethods = map[string]bool{
+	"Close":           true,
+	"GrantedScopes":   true,
+	"InvalidateCache": true,
+}
+
+// conformanceArgs build the arguments of the methods that would stop short
+// of the gateway with those of conformanceArg
+var conformanceArgs = map[string]func() []interface{}{
+	"ApplyPatch": func() []interface{} {
+		patch := []PatchOp{{Op: PatchReplace, Path: "/plan/phase[1]/minGreen", Value: "6"}}
+		return []interface{}{context.Background(), "plan.xml", "plan.xml", patch}
+	},
+	"ImportFileJSON": func() []interface{} {
+		return []interface{}{context.Background(), "plan.xml", "plan.json", strings.NewReader(`{"minGreen":5}`), "plan"}
+	},
+	"ImportNDJSON": func() []interface{} {
+		lines := `{"path":"/plan","value":""}` + "\n" + `{"path":"/plan/phase","value":""}` + "\n"
+		return []interface{}{context.Background(), "plan.xml", "plan.xml", strings.NewReader(lines), ImportOptions{}}
+	},
+	"RotateEncryptionKey": func() []interface{} {
+		return []interface{}{context.Background(), "plan.xml", "plan.xml", make([]byte, 32)}
+	},
+	"TruncateFile": func() []interface{} {
+		return []interface{}{"plan.xml", "plan.xml", TruncateOptions{Confirm: true}}
+	},
+}
+
+// conformanceOptions are the client options some methods need to reach
+// the gateway at all
+var conformanceOptions = map[string][]Option{
+	"RotateEncryptionKey": {WithFieldEncryption(make([]byte, 32), []string{"/plan/phase/minGreen"})},
+}
+
+// conformanceArg returns an argument of type typ for a call in the
+// conformance test, plausible enough for the call to reach the gateway
+func conformanceArg(t *testing.T, typ reflect.Type) reflect.Value {
+	switch typ {
+	case reflect.TypeOf((*context.Context)(nil)).Elem():
+		return reflect.ValueOf(context.Background())
+	case reflect.TypeOf((*PathLike)(nil)).Elem():
+		return reflect.ValueOf(PathLike("/plan"))
+	case reflect.TypeOf((*io.Reader)(nil)).Elem():
+		return reflect.ValueOf(strings.NewReader(planDoc))
+	case reflect.TypeOf((*io.Writer)(nil)).Elem():
+		return reflect.ValueOf(io.Discard)
+	case reflect.TypeOf(&Node{}):
+		n, err := ParseXML(strings.NewReader(planDoc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return reflect.ValueOf(n)
+	case reflect.TypeOf(time.Duration(0)):
+		return reflect.ValueOf(time.Millisecond)
+	}
+	switch typ.Kind() {
+	case reflect.Pointer:
+		return reflect.New(typ.Elem())
+	case reflect.String:
+		return reflect.ValueOf("plan.xml").Convert(typ)
+	case reflect.Slice:
+		if typ.Elem().Kind() == reflect.String {
+			return reflect.ValueOf([]string{"/plan"}).Convert(typ)
+		}
+	case reflect.Map:
+		if typ.Key().Kind() == reflect.String && typ.Elem().Kind() == reflect.String {
+			return reflect.ValueOf(map[string]string{"/plan/phase[1]/minGreen": "6"}).Convert(typ)
+		}
+	case reflect.Func:
+		// Callbacks accept whatever they are given
+		return reflect.MakeFunc(typ, func([]reflect.Value) []reflect.Value {
+			results := make([]reflect.Value, typ.NumOut())
+			for i := range results {
+				results[i] = reflect.Zero(typ.Out(i))
+				if typ.Out(i).Kind() == reflect.Bool {
+					results[i] = reflect.ValueOf(true)
+				}
+			}
+			return results
+		})
+	}
+	return reflect.Zero(typ)
+}
+
+// callWithOptions calls the method with plausible arguments and opts,
+// draining any iterator it returns, and returns the error it failed with
+func callWithOptions(t *testing.T, name string, method reflect.Value, opts ...RequestOption) error {
+	typ := method.Type()
+	args := make([]reflect.Value, typ.NumIn()-1)
+	var given []interface{}
+	if build, ok := conformanceArgs[name]; ok {
+		given = build()
+	}
+	for i := range args {
+		if given != nil {
+			args[i] = reflect.ValueOf(given[i])
+		} else {
+			args[i] = conformanceArg(t, typ.In(i))
+		}
+	}
+	variadic := typ.In(typ.NumIn() - 1).Elem()
+	for _, opt := range opts {
+		args = append(args, reflect.ValueOf(opt).Convert(variadic))
+	}
+
+	var err error
+	for _, result := range method.Call(args) {
+		if e, ok := result.Interface().(error); ok && e != nil {
+			err = e
+		}
+		if result.Kind() != reflect.Func {
+			continue
+		}
+		// An iterator sends its requests as it is ranged over
+		yield := result.Type().In(0)
+		result.Call([]reflect.Value{reflect.MakeFunc(yield, func(in []reflect.Value) []reflect.Value {
+			if e, ok := in[1].Interface().(error); ok && e != nil {
+				err = e
+			}
+			return []reflect.Value{reflect.ValueOf(false)}
+		})})
+	}
+	return err
+}
+
+func TestRequestOptionsConformance(t *testing.T) {
+	requestOption := reflect.TypeOf(RequestOption(nil))
+	clientType := reflect.TypeOf(&Client{})
+
+	for i := 0; i < clientType.NumMethod(); i++ {
+		m := clientType.Method(i)
+		if localMethods[m.Name] {
+			continue
+		}
+		t.Run(m.Name, func(t *testing.T) {
+			typ := m.Type
+			last := typ.In(typ.NumIn() - 1)
+			if !typ.IsVariadic() || !requestOption.ConvertibleTo(last.Elem()) {
+				t.Fatalf("%s does not take RequestOptions as its final variadic parameter", typ)
+			}
+
+			g := newFakeGateway(t)
+			g.load("plan.xml", "plan.xml", planDoc)
+			// Slow requests wait for the call to give up on them
+			var mu sync.Mutex
+			var headers []string
+			g.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+				mu.Lock()
+				headers = append(headers, r.Header.Get("X-Conformance"))
+				mu.Unlock()
+				if r.Header.Get("X-Conformance") != "slow" {
+					return false
+				}
+				select {
+				case <-r.Context().Done():
+				case <-time.After(5 * time.Second):
+				}
+				return true
+			}
+			c := g.client(conformanceOptions[m.Name]...)
+			if err := c.Authorize(); err != nil {
+				t.Fatal(err)
+			}
+			mu.Lock()
+			headers = nil
+			mu.Unlock()
+			method := reflect.ValueOf(c).MethodByName(m.Name)
+
+			callWithOptions(t, m.Name, method, RequestHeader("X-Conformance", "fast"))
+			mu.Lock()
+			sent := headers
+			headers = nil
+			mu.Unlock()
+			if len(sent) == 0 {
+				t.Fatal("no request sent")
+			}
+			for _, header := range sent {
+				if header != "fast" {
+					t.Errorf("request sent without the call's header")
+				}
+			}
+
+			start := time.Now()
+			err := callWithOptions(t, m.Name, method, RequestHeader("X-Conformance", "slow"), RequestTimeout(20*time.Millisecond))
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("returned after %s, want the call's timeout applied", elapsed)
+			}
+			mu.Lock()
+			sent = headers
+			mu.Unlock()
+			var opErr *OpError
+			if len(sent) > 0 && (!errors.As(err, &opErr) || opErr.Op != m.Name) {
+				t.Errorf("timed out with %v, want an *OpError naming %s", err, m.Name)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package xmlapi
+
+import (
+	"net/http"
+	"time"
+)
+
+const (
+	// defaultSkewTolerance is how long before expiry a token is replaced
+	defaultSkewTolerance = 30 * time.Second
+	// maxClockSkew is the skew beyond which the device clock is reported
+	maxClockSkew = 5 * time.Minute
+)
+
+// WithClockSkewTolerance sets how long before its expiry a token is
+// replaced, 30s by default. Expiry times are already corrected by the skew
+// measured from the gateway's Date header; raise d for devices whose clocks
+// drift between authorizations.
+func WithClockSkewTolerance(d time.Duration) Option {
+	return func(c *Client) {
+		c.skewTolerance = d
+	}
+}
+
+// observeClock records the skew between the server's clock, taken from a
+// Date header, and the local one, logging a warning when it is implausibly
+// large. It returns the skew in effect, server ahead of local when positive.
+func (c *Client) observeClock(date string) time.Duration {
+	serverTime, err := http.ParseTime(date)
+	if err != nil {
+		c.tokenMu.Lock()
+		defer c.tokenMu.Unlock()
+		return c.skew
+	}
+
+	skew := serverTime.Sub(time.Now()).Truncate(time.Second)
+	c.tokenMu.Lock()
+	c.skew = skew
+	c.tokenMu.Unlock()
+
+	if skew > maxClockSkew || skew < -maxClockSkew {
+		c.logger.Printf("Gateway clock differs from local clock by %s; adjusting token expiry", skew)
+	}
+	return skew
+}
+
+// expiring reports whether a token expiring at expires, on the local clock,
+// is due for replacement. The zero time never expires.
+func (c *Client) expiring(expires time.Time) bool {
+	if expires.IsZero() {
+		return false
+	}
+	return time.Until(expires) < c.skewTolerance
+}
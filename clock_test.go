@@ -0,0 +1,63 @@
+package xmlapi
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClockSkew(t *testing.T) {
+	for _, skew := range []time.Duration{10 * time.Minute, -10 * time.Minute, 0} {
+		t.Run(skew.String(), func(t *testing.T) {
+			g := newFakeGateway(t)
+			g.skew = skew
+			g.tokenTTL = 2 * time.Minute
+			g.load("dev", "plan.xml", planDoc)
+			logger := &recordLogger{}
+			c := g.client(WithLogger(logger), WithClockSkewTolerance(5*time.Second))
+
+			for i := 0; i < 3; i++ {
+				if _, err := c.ReadFile("dev", "plan.xml"); err != nil {
+					t.Fatalf("ReadFile: %v", err)
+				}
+			}
+
+			// Read on the gateway's clock the token would look expired, or
+			// valid for 12 minutes; corrected it expires in two
+			_, expires := c.tokenFor("dev")
+			if left := time.Until(expires); left < 2*time.Minute-5*time.Second || left > 2*time.Minute+5*time.Second {
+				t.Errorf("token expires in %s on the local clock, want about 2m", left)
+			}
+			if n := len(g.receivedAt("/authorize")); n != 1 {
+				t.Errorf("%d authorizations, want 1", n)
+			}
+
+			warned := false
+			for _, line := range logger.logged() {
+				warned = warned || strings.Contains(line, "clock")
+			}
+			if warned != (skew != 0) {
+				t.Errorf("clock warning logged = %v with skew %s: %q", warned, skew, logger.logged())
+			}
+		})
+	}
+}
+
+func TestClockSkewRenewsBeforeExpiry(t *testing.T) {
+	g := newFakeGateway(t)
+	g.skew = 10 * time.Minute
+	g.tokenTTL = 20 * time.Second
+	g.load("dev", "plan.xml", planDoc)
+	c := g.client()
+
+	// A token with less than the default 30s tolerance left is replaced at
+	// once, even though the gateway's clock makes it look fresh
+	for i := 0; i < 2; i++ {
+		if _, err := c.ReadFile("dev", "plan.xml"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(g.receivedAt("/authorize")); n != 2 {
+		t.Errorf("%d authorizations, want one per request", n)
+	}
+}
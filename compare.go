@@ -0,0 +1,167 @@
+package xmlapi
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// CompareOption configures CompareDevices. Every RequestOption is a CompareOption too.
+type CompareOption interface {
+	applyCompare(*compareConfig)
+}
+
+// compareOption is a CompareOption setting an option of CompareDevices
+type compareOption func(*compareConfig)
+
+func (f compareOption) applyCompare(cfg *compareConfig) {
+	f(cfg)
+}
+
+// compareConfig holds the options of a CompareDevices call
+type compareConfig struct {
+	progress func(done, total int, filename string)
+
+	// call holds the RequestOptions among the options
+	call []RequestOption
+}
+
+// CompareProgress calls fn after each file present on both devices is
+// compared, with the number compared so far and the total. Calls are
+// serialized but may come from different goroutines.
+func CompareProgress(fn func(done, total int, filename string)) CompareOption {
+	return compareOption(func(cfg *compareConfig) {
+		cfg.progress = fn
+	})
+}
+
+// FileDifference is a file whose content differs between two devices
+type FileDifference struct {
+	Filename string
+	// A and B summarize the file on each device
+	A, B *TreeStats
+	// Changes turn the file on device A into the one on device B; only set
+	// by deep comparisons
+	Changes []Change
+}
+
+// DeviceDiff is the outcome of CompareDevices. Every list is sorted by
+// file name.
+type DeviceDiff struct {
+	OnlyInA   []string
+	OnlyInB   []string
+	Identical []string
+	Differing []FileDifference
+}
+
+// Equal reports whether both devices hold the same files with the same content
+func (d *DeviceDiff) Equal() bool {
+	return len(d.OnlyInA) == 0 && len(d.OnlyInB) == 0 && len(d.Differing) == 0
+}
+
+// CompareDevices compares the files of two devices, as before a failover.
+// Files on both are compared by the content hash of TreeStats; in deep mode
+// those that differ are read from both devices and diffed, attaching the
+// changes. Files are compared with bounded concurrency.
+func (c *Client) CompareDevices(ctx context.Context, deviceA, deviceB string, deep bool, opts ...CompareOption) (_ *DeviceDiff, err error) {
+	ctx, op := startOp(ctx, "CompareDevices", nil, "", "", nil)
+	defer op.finish(&err)
+
+	var cfg compareConfig
+	for _, opt := range opts {
+		opt.applyCompare(&cfg)
+	}
+	ctx = withRequestOptions(ctx, cfg.call)
+
+	filesA, err := c.listFiles(ctx, deviceA)
+	if err != nil {
+		return nil, err
+	}
+	filesB, err := c.listFiles(ctx, deviceB)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &DeviceDiff{}
+	inB := make(map[string]bool, len(filesB))
+	for _, file := range filesB {
+		inB[file] = true
+	}
+	var common []string
+	for _, file := range filesA {
+		if inB[file] {
+			common = append(common, file)
+			delete(inB, file)
+		} else {
+			diff.OnlyInA = append(diff.OnlyInA, file)
+		}
+	}
+	diff.OnlyInB = sortedKeys(inB)
+	sort.Strings(diff.OnlyInA)
+	sort.Strings(common)
+
+	var mu sync.Mutex
+	done := 0
+	differing := make(map[string]FileDifference)
+	errs := runEach(common, defaultBulkConcurrency, func(file string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		difference, same, err := c.compareFile(ctx, deviceA, deviceB, file, deep)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if !same {
+			differing[file] = *difference
+		}
+		done++
+		if cfg.progress != nil {
+			cfg.progress(done, len(common), file)
+		}
+		return nil
+	})
+
+	for _, file := range common {
+		if err := errs[file]; err != nil {
+			return nil, err
+		}
+		if difference, ok := differing[file]; ok {
+			diff.Differing = append(diff.Differing, difference)
+		} else {
+			diff.Identical = append(diff.Identical, file)
+		}
+	}
+	return diff, nil
+}
+
+// compareFile compares a file present on both devices
+func (c *Client) compareFile(ctx context.Context, deviceA, deviceB, file string, deep bool) (*FileDifference, bool, error) {
+	a, err := c.treeStats(ctx, deviceA, file)
+	if err != nil {
+		return nil, false, err
+	}
+	b, err := c.treeStats(ctx, deviceB, file)
+	if err != nil {
+		return nil, false, err
+	}
+	if a.Hash == b.Hash {
+		return nil, true, nil
+	}
+
+	difference := &FileDifference{Filename: file, A: a, B: b}
+	if deep {
+		treeA, err := c.readFile(ctx, deviceA, file)
+		if err != nil {
+			return nil, false, err
+		}
+		treeB, err := c.readFile(ctx, deviceB, file)
+		if err != nil {
+			return nil, false, err
+		}
+		difference.Changes = Diff(treeA, treeB)
+	}
+	return difference, false, nil
+}
@@ -0,0 +1,124 @@
+package xmlapi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// compressedPrefix marks a value stored by WithValueCompression; the base64
+// of the gzipped value follows it
+const compressedPrefix = "gz:"
+
+// WithRequestCompression gzips request bodies of at least minSize bytes.
+// If the gateway rejects a compressed body with 415 Unsupported Media Type,
+// the request is re-sent uncompressed and the client stops compressing.
+func WithRequestCompression(minSize int) Option {
+	return func(c *Client) {
+		c.compression = &requestCompression{minSize: minSize}
+	}
+}
+
+// requestCompression is the request compression state of a client
+type requestCompression struct {
+	minSize int
+	// rejected is set once the gateway has refused a compressed body
+	rejected atomic.Bool
+}
+
+// compressBody returns body gzipped, or nil if it is not to be compressed
+func (c *Client) compressBody(body []byte) ([]byte, error) {
+	if c.compression == nil || len(body) == 0 || len(body) < c.compression.minSize {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(body); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// compressing reports whether a compressed body is sent as such
+func (c *Client) compressing(compressed []byte) bool {
+	return compressed != nil && !c.compression.rejected.Load()
+}
+
+// rejectCompression reports whether resp refuses a compressed body, and if
+// so stops compressing
+func (c *Client) rejectCompression(compressed []byte, resp *Response) bool {
+	if compressed == nil || resp == nil || resp.StatusCode != http.StatusUnsupportedMediaType {
+		return false
+	}
+	if !c.compression.rejected.Swap(true) {
+		c.logger.Printf("Gateway rejected a compressed request body; sending bodies uncompressed")
+	}
+	return true
+}
+
+// WithValueCompression stores node values of at least minSize bytes gzipped
+// and base64 encoded behind a "gz:" prefix, for the few nodes holding
+// large blobs, and expands them again when they are read. Values are only
+// stored compressed when that makes them smaller. Values written without
+// the option read back unchanged, so it can be turned on for existing
+// files; values stored compressed are expanded by every client, with the
+// option or without, so turning it off again keeps them readable. Trees read
+// through the client hold expanded values, so Diff and Flatten compare
+// those. Attributes are not compressed. Combined with WithFieldEncryption
+// values are compressed before they are encrypted.
+func WithValueCompression(minSize int) Option {
+	return func(c *Client) {
+		c.valueCompression = true
+		c.valueMinSize = minSize
+	}
+}
+
+// compressValue returns value as it is stored with WithValueCompression
+func (c *Client) compressValue(value string) (string, error) {
+	if !c.valueCompression || len(value) < c.valueMinSize || strings.HasPrefix(value, compressedPrefix) {
+		return value, nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := io.WriteString(zw, value); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	compressed := compressedPrefix + base64.StdEncoding.EncodeToString(buf.Bytes())
+	if len(compressed) >= len(value) {
+		return value, nil
+	}
+	return compressed, nil
+}
+
+// expandValue returns the value stored compressed, or value itself if it
+// is not a valid compressed value. Values are expanded whether or not the
+// client compresses its own writes.
+func (c *Client) expandValue(value string) string {
+	encoded, ok := strings.CutPrefix(value, compressedPrefix)
+	if !ok {
+		return value
+	}
+	compressed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return value
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return value
+	}
+	expanded, err := io.ReadAll(zr)
+	if err != nil {
+		return value
+	}
+	return string(expanded)
+}
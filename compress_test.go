@@ -0,0 +1,197 @@
+package xmlapi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+)
+
+// largePlan returns a plan document of roughly n bytes
+func largePlan(n int) string {
+	var b strings.Builder
+	b.WriteString("<plan>")
+	for i := 0; b.Len() < n; i++ {
+		b.WriteString("<phase><minGreen>5</minGreen></phase>")
+	}
+	b.WriteString("</plan>")
+	return b.String()
+}
+
+// gunzip decompresses data or fails the test
+func gunzip(t *testing.T, data []byte) []byte {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("not gzip: %v", err)
+	}
+	out, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestRequestCompression(t *testing.T) {
+	doc := largePlan(4096)
+	g := newFakeGateway(t)
+	c := g.client(WithRequestCompression(1024))
+
+	if _, err := c.UploadFile("dev", "plan.xml", strings.NewReader(doc), true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.UploadFile("dev", "small.xml", strings.NewReader(planDoc), true); err != nil {
+		t.Fatal(err)
+	}
+
+	uploads := g.receivedAt("/uploadFile")
+	if len(uploads) != 2 {
+		t.Fatalf("%d uploads, want 2", len(uploads))
+	}
+	large, small := uploads[0], uploads[1]
+	if large.Header.Get("Content-Encoding") != "gzip" || len(large.Raw) >= len(large.Body) {
+		t.Errorf("large body sent %d bytes for %d with encoding %q, want it gzipped", len(large.Raw), len(large.Body), large.Header.Get("Content-Encoding"))
+	}
+	if !bytes.Equal(gunzip(t, large.Raw), large.Body) {
+		t.Error("gzipped body does not expand to the JSON body")
+	}
+	if small.Header.Get("Content-Encoding") != "" || !bytes.Equal(small.Raw, small.Body) {
+		t.Error("body under the minimum size was compressed")
+	}
+	if got := mustXML(t, g.file("dev", "plan.xml")); got != doc {
+		t.Error("gateway stored a different document")
+	}
+}
+
+func TestRequestCompressionRejected(t *testing.T) {
+	doc := largePlan(4096)
+	g := newFakeGateway(t)
+	g.rejectGzip = true
+	logger := &recordLogger{}
+	c := g.client(WithRequestCompression(1024), WithLogger(logger), WithRequestSigning([]byte("secret"), ""))
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.UploadFile("dev", "plan.xml", strings.NewReader(doc), true); err != nil {
+			t.Fatalf("upload %d: %v", i, err)
+		}
+	}
+
+	// The first body is refused once and re-sent plain, later ones go plain
+	uploads := g.receivedAt("/uploadFile")
+	if len(uploads) != 4 {
+		t.Fatalf("%d uploads, want the refused one and three plain ones", len(uploads))
+	}
+	for i, req := range uploads {
+		gzipped := req.Header.Get("Content-Encoding") == "gzip"
+		if gzipped != (i == 0) {
+			t.Errorf("upload %d gzipped = %v", i, gzipped)
+		}
+	}
+	warnings := 0
+	for _, line := range logger.logged() {
+		if strings.Contains(line, "uncompressed") {
+			warnings++
+		}
+	}
+	if warnings != 1 {
+		t.Errorf("%d compression warnings, want one: %q", warnings, logger.logged())
+	}
+	checkSignatures(t, g, []byte("secret"), DefaultSigningHeader)
+}
+
+func TestRequestSigningCompressedGolden(t *testing.T) {
+	// {"content":"\u003cplan/\u003e"} gzipped without a timestamp
+	compressed, _ := hex.DecodeString("1f8b0800000000000203ab564acecf2b49cd2b51b2528a293530304e2ec849ccd3073353956a01676868d21f000000")
+	const query = "deviceid=dev&filename=plan.xml&overwrite=true"
+	const want = "c7fe6939e06d61ee979bb123c84608ed4c2abd0d74d38d02dc5a9079c05de5df"
+
+	if got := SignRequest([]byte("secret"), "POST", "/uploadFile", query, compressed); got != want {
+		t.Errorf("signature over the gzipped body %s, want %s", got, want)
+	}
+	if got := SignRequest([]byte("secret"), "POST", "/uploadFile", query, gunzip(t, compressed)); got == want {
+		t.Error("the plain body signs the same as the gzipped one")
+	}
+
+	// The client signs the bytes it sends
+	g := newFakeGateway(t)
+	c := g.client(WithRequestCompression(0), WithRequestSigning([]byte("secret"), ""))
+	if _, err := c.UploadFile("dev", "plan.xml", strings.NewReader("<plan/>"), true); err != nil {
+		t.Fatal(err)
+	}
+	upload := g.receivedAt("/uploadFile")[0]
+	if upload.Header.Get("Content-Encoding") != "gzip" || !bytes.Equal(upload.Body, gunzip(t, compressed)) {
+		t.Fatalf("sent %q with encoding %q", upload.Body, upload.Header.Get("Content-Encoding"))
+	}
+	if got := upload.Header.Get(DefaultSigningHeader); got != SignRequest([]byte("secret"), "POST", "/uploadFile", query, upload.Raw) {
+		t.Errorf("signature %s is not over the gzipped bytes sent", got)
+	}
+}
+
+func TestValueCompressionCrossMode(t *testing.T) {
+	blob := strings.Repeat("QUJDREVGR0g=", 200)
+	const small = "5"
+
+	for _, tc := range []struct {
+		name           string
+		writer, reader []Option
+		// compressed reports whether the blob is stored compressed
+		compressed bool
+	}{
+		{name: "plain to plain"},
+		{name: "plain to compressing", reader: []Option{WithValueCompression(100)}},
+		{name: "compressing to compressing", writer: []Option{WithValueCompression(100)}, reader: []Option{WithValueCompression(100)}, compressed: true},
+		{name: "compressing to plain", writer: []Option{WithValueCompression(100)}, compressed: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := newFakeGateway(t)
+			g.load("dev", "plan.xml", `<plan><blob/><small/></plan>`)
+			writer, reader := g.client(tc.writer...), g.client(tc.reader...)
+
+			if _, err := writer.UpdateNode("dev", "plan.xml", "/plan/blob", blob); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := writer.CreateNode("dev", "plan.xml", "/plan", "created", blob); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := writer.UpdateNode("dev", "plan.xml", "/plan/small", small); err != nil {
+				t.Fatal(err)
+			}
+
+			stored := g.file("dev", "plan.xml")
+			for _, n := range []*Node{&stored.Nodes[0], &stored.Nodes[2]} {
+				if got := strings.HasPrefix(n.Value, compressedPrefix); got != tc.compressed {
+					t.Errorf("<%s> stored compressed: %v, want %v", n.XMLName.Local, got, tc.compressed)
+				}
+			}
+			if stored.Nodes[1].Value != small {
+				t.Errorf("small value stored as %q, want it as written", stored.Nodes[1].Value)
+			}
+
+			// The reader sees the blob as written however it reads
+			want := blob
+			n, err := reader.ReadNode("dev", "plan.xml", "/plan/blob")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n.Value != want {
+				t.Errorf("ReadNode = %.20q…, want %.20q…", n.Value, want)
+			}
+			root, err := reader.ReadFile("dev", "plan.xml")
+			if err != nil {
+				t.Fatal(err)
+			}
+			flat := root.Flatten(FlattenOptions{})
+			if flat["/plan/blob"] != want || flat["/plan/created"] != want || flat["/plan/small"] != small {
+				t.Errorf("ReadFile flattened to %.40q…, want the blobs as %.20q…", flat, want)
+			}
+
+			expected := mustParse(t, `<plan><blob/><small>5</small><created/></plan>`)
+			expected.Nodes[0].Value, expected.Nodes[2].Value = want, want
+			if changes := Diff(expected, root); len(changes) != 0 {
+				t.Errorf("ReadFile differs from the values read: %+v", withoutNodes(changes))
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package xmlapi
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+)
+
+// ColumnSpec describes one column of ExportCSV
+type ColumnSpec struct {
+	// Header is the column's name in the header row
+	Header string
+	// Path selects the cell relative to the row element: a child path such
+	// as "minGreen" or "timing/max", an attribute such as "@id" or
+	// "timing/@unit", or "." for the row element's own value
+	Path string
+	// DeviceID fills the column with the device ID instead of using Path
+	DeviceID bool
+}
+
+// CSVOption configures ExportCSV. Every RequestOption is a CSVOption too.
+type CSVOption interface {
+	applyCSV(*csvConfig)
+}
+
+// csvOption is a CSVOption setting an option of ExportCSV
+type csvOption func(*csvConfig)
+
+func (f csvOption) applyCSV(cfg *csvConfig) {
+	f(cfg)
+}
+
+// csvConfig holds the options of an ExportCSV call
+type csvConfig struct {
+	strict bool
+
+	// call holds the RequestOptions among the options
+	call []RequestOption
+}
+
+// StrictCSV makes a missing cell an error instead of an empty string
+func StrictCSV() CSVOption {
+	return csvOption(func(cfg *csvConfig) {
+		cfg.strict = true
+	})
+}
+
+// ExportCSV reads an XML file and writes one CSV row per element matching
+// rowPattern (e.g. "/plan/phase"), with one column per ColumnSpec, preceded
+// by a header row. Missing cells are written as empty strings unless
+// StrictCSV is given.
+func (c *Client) ExportCSV(ctx context.Context, w io.Writer, deviceID, filename string, rowPattern string, columns []ColumnSpec, opts ...CSVOption) (err error) {
+	ctx, op := startOp(ctx, "ExportCSV", nil, deviceID, filename, nil)
+	defer op.finish(&err)
+
+	var cfg csvConfig
+	for _, opt := range opts {
+		opt.applyCSV(&cfg)
+	}
+	ctx = withRequestOptions(ctx, cfg.call)
+
+	pattern, err := parsePath(rowPattern)
+	if err != nil {
+		return err
+	}
+	cells := make([]parsedPath, len(columns))
+	for i, col := range columns {
+		if col.DeviceID {
+			continue
+		}
+		if cells[i], err = parseCellPath(col.Path); err != nil {
+			return fmt.Errorf("column %q: %w", col.Header, err)
+		}
+	}
+
+	root, err := c.readFile(ctx, deviceID, filename)
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	header := make([]string, len(columns))
+	for i, col := range columns {
+		header[i] = col.Header
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for r, row := range pattern.find(root) {
+		record := make([]string, len(columns))
+		for i, col := range columns {
+			if col.DeviceID {
+				record[i] = deviceID
+				continue
+			}
+			value, ok := cells[i].valueAt(row)
+			if !ok && cfg.strict {
+				return fmt.Errorf("row %d, column %q: %w", r+1, col.Header, ErrNotFound)
+			}
+			record[i] = value
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// parseCellPath parses a column path, where "." or "" is the row itself
+func parseCellPath(path string) (parsedPath, error) {
+	if path == "." {
+		path = ""
+	}
+	p, err := parsePath(path)
+	if err != nil {
+		return p, err
+	}
+	if p.Absolute {
+		return p, fmt.Errorf("path %q must be relative to the row", path)
+	}
+	return p, nil
+}
+
+// valueAt returns the value of the element or attribute p addresses relative to n
+func (p parsedPath) valueAt(n *Node) (string, bool) {
+	var attr *pathSegment
+	if len(p.Segments) > 0 && p.Segments[len(p.Segments)-1].Attr {
+		attr = &p.Segments[len(p.Segments)-1]
+		p.Segments = p.Segments[:len(p.Segments)-1]
+	}
+
+	nodes := p.find(n)
+	if len(nodes) == 0 {
+		return "", false
+	}
+	if attr != nil {
+		return nodes[0].Attr(attr.Local)
+	}
+	return nodes[0].Value, true
+}
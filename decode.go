@@ -0,0 +1,243 @@
+package xmlapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// maxDecodeRepairs bounds how many quoted numbers lenient decoding repairs
+// in one response
+const maxDecodeRepairs = 16
+
+// WithStrictDecoding rejects responses containing fields the client does not
+// know, to surface changes in the gateway's payloads early, e.g. in staging.
+// By default unknown fields are ignored.
+func WithStrictDecoding() Option {
+	return func(c *Client) {
+		c.strictDecoding = true
+	}
+}
+
+// WithAcceptXML asks for reads as XML, which some firmware serves more
+// faithfully than JSON, keeping comments and attributes. The resulting
+// *Node is the same whichever format the gateway answers with.
+func WithAcceptXML() Option {
+	return func(c *Client) {
+		c.acceptXML = true
+	}
+}
+
+// Decoders reported as the Decoder of MetricDecode
+const (
+	DecoderJSON = "json"
+	DecoderXML  = "xml"
+)
+
+// acceptHeader is sent with every request unless the caller sets its own
+const acceptHeader = "application/json, application/xml;q=0.8"
+
+// isXMLResponse reports whether a response is XML: by its content type, or
+// by its first character when it is labelled JSON or not at all, since some
+// firmware sends XML under a JSON content type
+func isXMLResponse(resp *Response) bool {
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err == nil {
+		if mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml") {
+			return true
+		}
+		if mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json") {
+			return false
+		}
+	}
+	return bytes.HasPrefix(bytes.TrimSpace(resp.Body), []byte("<"))
+}
+
+// decode unmarshals a response body into v with the decoder its format
+// calls for. A body that is not valid JSON, e.g. an HTML page from a proxy,
+// is reported as an *APIError describing it rather than as a JSON syntax
+// error. XML is parsed with ParseXML; for anything but a *Node, the tree is
+// converted to its map form and decoded from that like JSON.
+func (c *Client) decode(resp *Response, v interface{}) error {
+	decoder := DecoderJSON
+	if isXMLResponse(resp) {
+		decoder = DecoderXML
+	}
+	if resp.op != nil {
+		c.metric(Metric{Name: MetricDecode, Endpoint: resp.op.endpoint, DeviceID: resp.op.deviceID, Decoder: decoder})
+	}
+
+	if decoder == DecoderXML {
+		parsed, err := ParseXML(bytes.NewReader(resp.Body))
+		if err != nil {
+			return resp.op.wrap(&APIError{StatusCode: resp.StatusCode, Message: "invalid XML response: " + err.Error(), Body: resp.Body})
+		}
+		if node, ok := v.(*Node); ok {
+			*node = *parsed
+			return nil
+		}
+		data, err := json.Marshal(parsed.ToMap())
+		if err != nil {
+			return resp.op.wrap(err)
+		}
+		return resp.op.wrap(c.unmarshal(data, v))
+	}
+
+	if err := c.unmarshal(resp.Body, v); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) || len(bytes.TrimSpace(resp.Body)) == 0 {
+			err = &APIError{StatusCode: resp.StatusCode, Message: "invalid JSON response: " + errorSummary(resp.StatusCode, resp.Body), Body: resp.Body}
+		}
+		return resp.op.wrap(err)
+	}
+	return nil
+}
+
+// unmarshal decodes JSON into v. Field names match regardless of case in
+// both modes. Lenient decoding, the default, also accepts numbers sent as
+// strings (e.g. "line": "12") for numeric fields.
+func (c *Client) unmarshal(data []byte, v interface{}) error {
+	if c.strictDecoding {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		return dec.Decode(v)
+	}
+
+	for repairs := 0; ; repairs++ {
+		err := json.Unmarshal(data, v)
+		var typeErr *json.UnmarshalTypeError
+		if !errors.As(err, &typeErr) || typeErr.Value != "string" || !isNumericKind(typeErr.Type.Kind()) || repairs == maxDecodeRepairs {
+			return err
+		}
+
+		repaired, ok := unquoteNumbers(data, typeErr.Field)
+		if !ok {
+			return err
+		}
+		data = repaired
+	}
+}
+
+// isNumericKind reports whether k is an integer or floating-point kind
+func isNumericKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// unquoteNumbers rewrites the numeric strings found at field, a dotted path
+// as reported by json.UnmarshalTypeError, into numbers. Arrays along the
+// path have the indexed element rewritten, or every element when the path
+// carries no index. It reports whether anything changed.
+func unquoteNumbers(data []byte, field string) ([]byte, bool) {
+	if field == "" {
+		return nil, false
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, false
+	}
+
+	doc, changed := unquoteAt(doc, strings.Split(field, "."))
+	if !changed {
+		return nil, false
+	}
+	repaired, err := json.Marshal(doc)
+	if err != nil {
+		return nil, false
+	}
+	return repaired, true
+}
+
+// unquoteAt rewrites numeric strings at keys below v
+func unquoteAt(v interface{}, keys []string) (interface{}, bool) {
+	switch v := v.(type) {
+	case []interface{}:
+		// Newer Go versions include the element index in the field path
+		if len(keys) > 0 {
+			if i, err := strconv.Atoi(keys[0]); err == nil {
+				if i < 0 || i >= len(v) {
+					return v, false
+				}
+				var ok bool
+				if len(keys) == 1 {
+					v[i], ok = numberFromString(v[i])
+				} else {
+					v[i], ok = unquoteAt(v[i], keys[1:])
+				}
+				return v, ok
+			}
+		}
+		changed := false
+		for i := range v {
+			var ok bool
+			v[i], ok = unquoteAt(v[i], keys)
+			changed = changed || ok
+		}
+		return v, changed
+
+	case map[string]interface{}:
+		if len(keys) == 0 {
+			return v, false
+		}
+		changed := false
+		for key, child := range v {
+			// encoding/json matches keys case-insensitively, and so must we
+			if !strings.EqualFold(key, keys[0]) {
+				continue
+			}
+			var ok bool
+			if len(keys) == 1 {
+				v[key], ok = numberFromString(child)
+			} else {
+				v[key], ok = unquoteAt(child, keys[1:])
+			}
+			changed = changed || ok
+		}
+		return v, changed
+	}
+	return v, false
+}
+
+// numberFromString converts a numeric string, or array of them, to numbers
+func numberFromString(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case string:
+		s := strings.TrimSpace(v)
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return v, false
+		}
+		return json.Number(s), true
+	case []interface{}:
+		changed := false
+		for i := range v {
+			var ok bool
+			v[i], ok = numberFromString(v[i])
+			changed = changed || ok
+		}
+		return v, changed
+	}
+	return v, false
+}
+
+// hasKey reports whether a JSON object has the key, matched regardless of
+// case as decoding does
+func hasKey(object map[string]json.RawMessage, key string) bool {
+	for k := range object {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
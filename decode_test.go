@@ -0,0 +1,119 @@
+package xmlapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// decodePayload exercises the decoder with numeric, nested and string fields
+type decodePayload struct {
+	Count int
+	Ratio float64
+	Name  string
+	Items []decodeItem
+}
+
+// decodeItem is an array element of decodePayload
+type decodeItem struct {
+	Line int
+}
+
+func TestUnmarshalStrictAndLenient(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data string
+		want decodePayload
+		// lenient and strict report whether each mode accepts data
+		lenient, strict bool
+	}{
+		{name: "plain", data: `{"count":3,"ratio":0.5,"name":"a"}`, want: decodePayload{Count: 3, Ratio: 0.5, Name: "a"}, lenient: true, strict: true},
+		{name: "field case", data: `{"COUNT":3,"Name":"a"}`, want: decodePayload{Count: 3, Name: "a"}, lenient: true, strict: true},
+		{name: "quoted int", data: `{"count":"3"}`, want: decodePayload{Count: 3}, lenient: true},
+		{name: "quoted float", data: `{"ratio":" 0.5","count":"-2"}`, want: decodePayload{Count: -2, Ratio: 0.5}, lenient: true},
+		{name: "quoted in array", data: `{"items":[{"line":"1"},{"line":2},{"line":"3"}]}`, want: decodePayload{Items: []decodeItem{{1}, {2}, {3}}}, lenient: true},
+		{name: "not a number", data: `{"count":"three"}`},
+		{name: "number for a string", data: `{"name":3}`},
+		{name: "unknown field", data: `{"count":3,"firmware":"2.1"}`, want: decodePayload{Count: 3}, lenient: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, strict := range []bool{false, true} {
+				c := &Client{strictDecoding: strict}
+				var got decodePayload
+				err := c.unmarshal([]byte(tc.data), &got)
+				accepted := tc.lenient
+				if strict {
+					accepted = tc.strict
+				}
+				if (err == nil) != accepted {
+					t.Errorf("strict=%v: error %v, want accepted=%v", strict, err, accepted)
+					continue
+				}
+				if err == nil && !reflect.DeepEqual(got, tc.want) {
+					t.Errorf("strict=%v: decoded %+v, want %+v", strict, got, tc.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeReadPayloads(t *testing.T) {
+	node, _ := json.Marshal(&Node{XMLName: XMLName{Local: "plan"}, Value: "x"})
+	var extra map[string]interface{}
+	json.Unmarshal(node, &extra)
+	extra["Firmware"] = "2.1"
+	withExtra, _ := json.Marshal(extra)
+
+	for _, tc := range []struct {
+		name        string
+		contentType string
+		body        string
+		// lenient and strict report whether each mode accepts the body
+		lenient, strict bool
+	}{
+		{name: "known fields", contentType: "application/json", body: string(node), lenient: true, strict: true},
+		{name: "unknown field", contentType: "application/json", body: string(withExtra), lenient: true},
+		{name: "XML labelled JSON", contentType: "application/json", body: `<plan>x</plan>`, lenient: true, strict: true},
+		{name: "XML", contentType: "application/xml", body: `<plan>x</plan>`, lenient: true, strict: true},
+		{name: "HTML labelled JSON", contentType: "application/json", body: `{oops<html>`},
+		{name: "empty", contentType: "application/json"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, strict := range []bool{false, true} {
+				g := newFakeGateway(t)
+				g.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+					if r.URL.Path != "/read" {
+						return false
+					}
+					w.Header().Set("Content-Type", tc.contentType)
+					w.Write([]byte(tc.body))
+					return true
+				}
+				var opts []Option
+				if strict {
+					opts = append(opts, WithStrictDecoding())
+				}
+				c := g.client(opts...)
+
+				n, err := c.ReadNode("dev", "plan.xml", "/plan")
+				accepted := tc.lenient
+				if strict {
+					accepted = tc.strict
+				}
+				if (err == nil) != accepted {
+					t.Errorf("strict=%v: error %v, want accepted=%v", strict, err, accepted)
+					continue
+				}
+				if err == nil && (n.XMLName.Local != "plan" || n.Value != "x") {
+					t.Errorf("strict=%v: read %+v", strict, n)
+				}
+				var apiErr *APIError
+				if !tc.strict && !tc.lenient && !errors.As(err, &apiErr) {
+					t.Errorf("strict=%v: invalid body gave %v, want an *APIError", strict, err)
+				}
+			}
+		})
+	}
+}
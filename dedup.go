@@ -0,0 +1,88 @@
+package xmlapi
+
+import "context"
+
+// DedupOptions configures DeduplicateChildren
+type DedupOptions struct {
+	// KeyAttr, when set, makes children duplicates when they have the same
+	// value of this attribute; children without it are never duplicates.
+	// Otherwise children are duplicates when structurally identical.
+	KeyAttr string
+	// Apply deletes the duplicates found. Without it DeduplicateChildren
+	// is a dry run that only reports them.
+	Apply bool
+}
+
+// DedupReport is the outcome of DeduplicateChildren
+type DedupReport struct {
+	// Examined is the number of element children compared
+	Examined int
+	// Removed lists the paths of the duplicates, as they were before any
+	// was deleted; they are only deleted when Applied is set
+	Removed []string
+	Applied bool
+}
+
+// DeduplicateChildren finds element children of parentPath repeating an
+// earlier sibling and, with opts.Apply, deletes all but the first
+// occurrence. Structural equality is that of Diff: same tags, attributes,
+// values and descendants.
+func (c *Client) DeduplicateChildren(deviceID, filename string, parentPath PathLike, opts DedupOptions, reqOpts ...RequestOption) (_ *DedupReport, err error) {
+	ctx, op := startOp(context.Background(), "DeduplicateChildren", reqOpts, deviceID, filename, parentPath)
+	defer op.finish(&err)
+
+	parentStr, err := PathString(parentPath)
+	if err != nil {
+		return nil, err
+	}
+	parent, err := c.readNode(ctx, deviceID, filename, parentStr)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &DedupReport{}
+	paths := childPaths(parentStr, parent, true)
+	var kept []*Node
+	keys := make(map[string]bool)
+	for i := range parent.Nodes {
+		child := &parent.Nodes[i]
+		if child.Kind != NodeElement {
+			continue
+		}
+		report.Examined++
+
+		if opts.KeyAttr != "" {
+			key, ok := child.Attr(opts.KeyAttr)
+			if !ok {
+				continue
+			}
+			if keys[key] {
+				report.Removed = append(report.Removed, paths[i])
+			}
+			keys[key] = true
+			continue
+		}
+
+		duplicate := false
+		for _, k := range kept {
+			if child.XMLName == k.XMLName && nodesEqual(k, child) {
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			report.Removed = append(report.Removed, paths[i])
+		} else {
+			kept = append(kept, child)
+		}
+	}
+
+	if !opts.Apply || len(report.Removed) == 0 {
+		return report, nil
+	}
+	if _, err := c.deleteSiblings(ctx, deviceID, filename, report.Removed); err != nil {
+		return report, err
+	}
+	report.Applied = true
+	return report, nil
+}
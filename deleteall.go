@@ -0,0 +1,116 @@
+package xmlapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+)
+
+// DeleteAllOption configures DeleteAllFiles. Every RequestOption is a DeleteAllOption too.
+type DeleteAllOption interface {
+	applyDeleteAll(*deleteAllConfig)
+}
+
+// deleteAllOption is a DeleteAllOption setting an option of DeleteAllFiles
+type deleteAllOption func(*deleteAllConfig)
+
+func (f deleteAllOption) applyDeleteAll(cfg *deleteAllConfig) {
+	f(cfg)
+}
+
+// deleteAllConfig holds the options of a DeleteAllFiles call
+type deleteAllConfig struct {
+	protected   []string
+	concurrency int
+
+	// call holds the RequestOptions among the options
+	call []RequestOption
+}
+
+// ProtectFiles keeps the files whose names match any of the path.Match
+// patterns, e.g. "license*.xml"
+func ProtectFiles(patterns ...string) DeleteAllOption {
+	return deleteAllOption(func(cfg *deleteAllConfig) {
+		cfg.protected = append(cfg.protected, patterns...)
+	})
+}
+
+// DeleteConcurrency bounds how many files DeleteAllFiles deletes at once
+func DeleteConcurrency(n int) DeleteAllOption {
+	return deleteAllOption(func(cfg *deleteAllConfig) {
+		cfg.concurrency = n
+	})
+}
+
+// DeleteAllFiles deletes every file of a device, as when decommissioning
+// it. As a safeguard it returns ErrNotConfirmed unless confirm repeats
+// deviceID. Files are deleted with bounded concurrency; protected files are
+// reported in Skipped. A file already gone counts as deleted, so a partial
+// failure is resumed by calling DeleteAllFiles again.
+func (c *Client) DeleteAllFiles(ctx context.Context, deviceID string, confirm string, opts ...DeleteAllOption) (_ *BulkResult, err error) {
+	ctx, op := startOp(ctx, "DeleteAllFiles", nil, deviceID, "", nil)
+	defer op.finish(&err)
+
+	if confirm != deviceID || deviceID == "" {
+		return nil, fmt.Errorf("deleting all files of %q: %w", deviceID, ErrNotConfirmed)
+	}
+	var cfg deleteAllConfig
+	for _, opt := range opts {
+		opt.applyDeleteAll(&cfg)
+	}
+	ctx = withRequestOptions(ctx, cfg.call)
+	for _, pattern := range cfg.protected {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("protected pattern %q: %w", pattern, err)
+		}
+	}
+
+	files, err := c.listFiles(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BulkResult{Errors: make(map[string]error)}
+	var deleting []string
+	for _, file := range files {
+		if matchesAny(file, cfg.protected) {
+			result.Skipped = append(result.Skipped, file)
+		} else {
+			deleting = append(deleting, file)
+		}
+	}
+	sort.Strings(deleting)
+	sort.Strings(result.Skipped)
+
+	errs := runEach(deleting, cfg.concurrency, func(file string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		_, err := c.deleteFile(ctx, deviceID, file)
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		return err
+	})
+	for _, file := range deleting {
+		if errs[file] != nil {
+			result.Errors[file] = errs[file]
+		} else {
+			result.Applied = append(result.Applied, file)
+		}
+	}
+
+	return result, result.Err()
+}
+
+// matchesAny reports whether name matches any of the patterns
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package xmlapi
+
+import (
+	"context"
+	"fmt"
+)
+
+// MaxDeviceMetadataValue is the size limit in bytes the gateway enforces on
+// each device metadata value
+const MaxDeviceMetadataValue = 1024
+
+// deviceMetaResponse represents the response of GET /deviceMeta
+type deviceMetaResponse struct {
+	Meta map[string]string `json:"meta"`
+}
+
+// GetDeviceMetadata reads the key/value metadata of a device, such as its
+// location or maintenance contact
+func (c *Client) GetDeviceMetadata(deviceID string, opts ...RequestOption) (_ map[string]string, err error) {
+	ctx, op := startOp(context.Background(), "GetDeviceMetadata", opts, deviceID, "", nil)
+	defer op.finish(&err)
+
+	params := map[string]string{
+		"deviceid": deviceID,
+	}
+
+	resp, err := c.requestContext(ctx, "GET", "/deviceMeta", params, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result deviceMetaResponse
+	err = c.decode(resp, &result)
+	if err != nil {
+		return nil, err
+	}
+	if result.Meta == nil {
+		result.Meta = make(map[string]string)
+	}
+
+	return result.Meta, nil
+}
+
+// SetDeviceMetadata writes the metadata of a device. With merge the keys of
+// meta are added or changed and the others kept; without it meta replaces
+// the whole store. Values over MaxDeviceMetadataValue bytes are rejected
+// before anything is sent.
+func (c *Client) SetDeviceMetadata(deviceID string, meta map[string]string, merge bool, opts ...RequestOption) (err error) {
+	ctx, op := startOp(context.Background(), "SetDeviceMetadata", opts, deviceID, "", nil)
+	defer op.finish(&err)
+
+	for key, value := range meta {
+		if len(value) > MaxDeviceMetadataValue {
+			return fmt.Errorf("device metadata %q is %d bytes, over the limit of %d", key, len(value), MaxDeviceMetadataValue)
+		}
+	}
+
+	params := map[string]string{
+		"deviceid": deviceID,
+		"merge":    fmt.Sprintf("%t", merge),
+	}
+	body := map[string]interface{}{
+		"meta": meta,
+	}
+
+	_, err = c.statusRequestContext(ctx, "PUT", "/deviceMeta", params, body)
+	return err
+}
@@ -0,0 +1,311 @@
+package xmlapi
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ChangeType classifies a difference between two trees
+type ChangeType int
+
+const (
+	// ChangeAdded is an element present only in the new tree
+	ChangeAdded ChangeType = iota + 1
+	// ChangeRemoved is an element present only in the old tree
+	ChangeRemoved
+	// ChangeValueChanged is an element whose value differs
+	ChangeValueChanged
+	// ChangeAttrChanged is an attribute added, removed or modified
+	ChangeAttrChanged
+	// ChangeMoved is a keyed element whose position among its siblings changed
+	ChangeMoved
+)
+
+// String returns a readable name for the change type
+func (t ChangeType) String() string {
+	switch t {
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeValueChanged:
+		return "value changed"
+	case ChangeAttrChanged:
+		return "attribute changed"
+	case ChangeMoved:
+		return "moved"
+	}
+	return fmt.Sprintf("ChangeType(%d)", int(t))
+}
+
+// Change is a single difference reported by Diff.
+//
+// Path is the element's canonical path in the old tree, except for
+// ChangeAdded where it is the path in the new tree. Old and New hold the
+// values before and after; for ChangeAttrChanged they are the attribute
+// values (empty when absent) and Attr names the attribute, for ChangeMoved
+// they are the old and new paths.
+type Change struct {
+	Path string
+	Type ChangeType
+	Old  string
+	New  string
+	Attr string
+
+	// Node is the added or removed subtree; for ChangeAttrChanged it is the
+	// element in the new tree
+	Node *Node
+}
+
+// DiffOption configures Diff
+type DiffOption func(*diffConfig)
+
+// diffConfig holds the options of a Diff call
+type diffConfig struct {
+	keyAttr string
+}
+
+// MatchByAttr matches repeated siblings by the value of the named attribute
+// (e.g. "id") instead of by position. Siblings lacking the attribute are
+// still matched by position among themselves.
+func MatchByAttr(name string) DiffOption {
+	return func(cfg *diffConfig) {
+		cfg.keyAttr = name
+	}
+}
+
+// Diff compares two trees client-side and returns their differences in
+// document order. By default repeated siblings are matched by position.
+// Comments and node metadata are not compared.
+func Diff(a, b *Node, opts ...DiffOption) []Change {
+	var cfg diffConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	switch {
+	case a == nil && b == nil:
+		return nil
+	case a == nil:
+		return []Change{{Path: "/" + escapeSegment(b.XMLName.Local), Type: ChangeAdded, New: b.Value, Node: b}}
+	case b == nil:
+		return []Change{{Path: "/" + escapeSegment(a.XMLName.Local), Type: ChangeRemoved, Old: a.Value, Node: a}}
+	}
+
+	d := &differ{cfg: cfg}
+	pathA := "/" + escapeSegment(a.XMLName.Local)
+	pathB := "/" + escapeSegment(b.XMLName.Local)
+	if a.XMLName != b.XMLName {
+		d.add(Change{Path: pathA, Type: ChangeRemoved, Old: a.Value, Node: a})
+		d.add(Change{Path: pathB, Type: ChangeAdded, New: b.Value, Node: b})
+		return d.changes
+	}
+	d.diff(a, b, pathA, pathB)
+	return d.changes
+}
+
+// differ accumulates the changes of a Diff call
+type differ struct {
+	cfg     diffConfig
+	changes []Change
+}
+
+// add records a change
+func (d *differ) add(c Change) {
+	d.changes = append(d.changes, c)
+}
+
+// diff compares two matched elements and their descendants
+func (d *differ) diff(a, b *Node, pathA, pathB string) {
+	if a.Value != b.Value {
+		d.add(Change{Path: pathA, Type: ChangeValueChanged, Old: a.Value, New: b.Value})
+	}
+	d.diffAttrs(a, b, pathA)
+
+	childPathsA := childPaths(pathA, a, true)
+	childPathsB := childPaths(pathB, b, true)
+
+	// Group element children by tag, in order of first appearance
+	var tags []XMLName
+	groupsA := make(map[XMLName][]int)
+	groupsB := make(map[XMLName][]int)
+	for i := range a.Nodes {
+		if a.Nodes[i].Kind == NodeElement {
+			name := a.Nodes[i].XMLName
+			if _, ok := groupsA[name]; !ok {
+				tags = append(tags, name)
+			}
+			groupsA[name] = append(groupsA[name], i)
+		}
+	}
+	for i := range b.Nodes {
+		if b.Nodes[i].Kind == NodeElement {
+			name := b.Nodes[i].XMLName
+			if _, ok := groupsA[name]; !ok {
+				if _, ok := groupsB[name]; !ok {
+					tags = append(tags, name)
+				}
+			}
+			groupsB[name] = append(groupsB[name], i)
+		}
+	}
+
+	for _, tag := range tags {
+		pairs, removed, added := d.match(a, b, groupsA[tag], groupsB[tag])
+		for _, p := range pairs {
+			childA, childB := &a.Nodes[p[0]], &b.Nodes[p[1]]
+			if p[2] == 1 {
+				d.add(Change{Path: childPathsA[p[0]], Type: ChangeMoved, Old: childPathsA[p[0]], New: childPathsB[p[1]]})
+			}
+			d.diff(childA, childB, childPathsA[p[0]], childPathsB[p[1]])
+		}
+		for _, i := range removed {
+			d.add(Change{Path: childPathsA[i], Type: ChangeRemoved, Old: a.Nodes[i].Value, Node: &a.Nodes[i]})
+		}
+		for _, i := range added {
+			d.add(Change{Path: childPathsB[i], Type: ChangeAdded, New: b.Nodes[i].Value, Node: &b.Nodes[i]})
+		}
+	}
+}
+
+// match pairs the children of one tag group. Each pair holds the index in a,
+// the index in b, and 1 if a keyed child changed position.
+func (d *differ) match(a, b *Node, idxA, idxB []int) (pairs [][3]int, removed, added []int) {
+	var restA, restB []int
+	if key := d.cfg.keyAttr; key != "" {
+		posB := make(map[string]int)
+		keyedB := make(map[string]int)
+		for pos, i := range idxB {
+			if v, ok := b.Nodes[i].Attr(key); ok {
+				if _, dup := keyedB[v]; !dup {
+					keyedB[v] = i
+					posB[v] = pos
+					continue
+				}
+			}
+			restB = append(restB, i)
+		}
+
+		matched := make(map[int]bool)
+		var keyed [][3]int
+		var order []int
+		for _, i := range idxA {
+			v, ok := a.Nodes[i].Attr(key)
+			j, found := keyedB[v]
+			if !ok || !found || matched[j] {
+				if ok && !found {
+					removed = append(removed, i)
+				} else {
+					restA = append(restA, i)
+				}
+				continue
+			}
+			matched[j] = true
+			keyed = append(keyed, [3]int{i, j, 0})
+			order = append(order, posB[v])
+		}
+
+		// Children outside the longest run kept in the same relative order moved
+		stay := increasingRun(order)
+		for k := range keyed {
+			if !stay[k] {
+				keyed[k][2] = 1
+			}
+		}
+		pairs = append(pairs, keyed...)
+
+		for _, j := range keyedB {
+			if !matched[j] {
+				added = append(added, j)
+			}
+		}
+	} else {
+		restA, restB = idxA, idxB
+	}
+
+	// Match whatever is left by position
+	n := len(restA)
+	if len(restB) < n {
+		n = len(restB)
+	}
+	for k := 0; k < n; k++ {
+		pairs = append(pairs, [3]int{restA[k], restB[k], 0})
+	}
+	removed = append(removed, restA[n:]...)
+	added = append(added, restB[n:]...)
+	sort.Ints(removed)
+	sort.Ints(added)
+
+	return pairs, removed, added
+}
+
+// increasingRun marks the elements of a longest strictly increasing
+// subsequence of seq
+func increasingRun(seq []int) []bool {
+	// tails[k] is the index in seq ending the best run of length k+1
+	var tails []int
+	prev := make([]int, len(seq))
+	for i, v := range seq {
+		k := sort.Search(len(tails), func(k int) bool { return seq[tails[k]] >= v })
+		if k > 0 {
+			prev[i] = tails[k-1]
+		} else {
+			prev[i] = -1
+		}
+		if k == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[k] = i
+		}
+	}
+
+	stay := make([]bool, len(seq))
+	if len(tails) > 0 {
+		for i := tails[len(tails)-1]; i >= 0; i = prev[i] {
+			stay[i] = true
+		}
+	}
+	return stay
+}
+
+// diffAttrs compares the attributes of two matched elements
+func (d *differ) diffAttrs(a, b *Node, path string) {
+	attrsA := attrMap(a)
+	attrsB := attrMap(b)
+
+	var names []XMLName
+	for name := range attrsA {
+		names = append(names, name)
+	}
+	for name := range attrsB {
+		if _, ok := attrsA[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if names[i].Local != names[j].Local {
+			return names[i].Local < names[j].Local
+		}
+		return names[i].Space < names[j].Space
+	})
+
+	for _, name := range names {
+		oldValue, inA := attrsA[name]
+		newValue, inB := attrsB[name]
+		if inA && inB && oldValue == newValue {
+			continue
+		}
+		d.add(Change{Path: path, Type: ChangeAttrChanged, Attr: name.Local, Old: oldValue, New: newValue, Node: b})
+	}
+}
+
+// attrMap returns the attributes of n by name, without namespace declarations
+func attrMap(n *Node) map[XMLName]string {
+	attrs := make(map[XMLName]string, len(n.Attrs))
+	for _, attr := range n.Attrs {
+		if !isNamespaceDecl(attr.Name) {
+			attrs[attr.Name] = attr.Value
+		}
+	}
+	return attrs
+}
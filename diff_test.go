@@ -0,0 +1,138 @@
+package xmlapi
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mustParse parses an XML document or fails the test
+func mustParse(t testing.TB, doc string) *Node {
+	t.Helper()
+	n, err := ParseXML(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("ParseXML(%s): %v", doc, err)
+	}
+	return n
+}
+
+// withoutNodes returns changes with their Node fields cleared for comparison
+func withoutNodes(changes []Change) []Change {
+	var out []Change
+	for _, c := range changes {
+		c.Node = nil
+		out = append(out, c)
+	}
+	return out
+}
+
+func TestDiff(t *testing.T) {
+	a := mustParse(t, `<plan version="3"><phase id="1"><minGreen>5</minGreen></phase><phase id="2"><minGreen>7</minGreen></phase><name>x</name></plan>`)
+	b := mustParse(t, `<plan version="4" mode="m"><phase id="1"><minGreen>6</minGreen></phase><name>x</name><det>d</det></plan>`)
+
+	want := []Change{
+		{Path: "/plan", Type: ChangeAttrChanged, Attr: "mode", New: "m"},
+		{Path: "/plan", Type: ChangeAttrChanged, Attr: "version", Old: "3", New: "4"},
+		{Path: "/plan/phase[1]/minGreen", Type: ChangeValueChanged, Old: "5", New: "6"},
+		{Path: "/plan/phase[2]", Type: ChangeRemoved},
+		{Path: "/plan/det", Type: ChangeAdded, New: "d"},
+	}
+	changes := Diff(a, b)
+	if got := withoutNodes(changes); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Diff =\n%+v\nwant\n%+v", got, want)
+	}
+	if changes[3].Node != &a.Nodes[1] || changes[4].Node != &b.Nodes[2] {
+		t.Error("removed and added changes do not carry their subtrees")
+	}
+
+	if changes := Diff(a, a.Clone()); len(changes) != 0 {
+		t.Errorf("Diff of equal trees = %+v", changes)
+	}
+}
+
+func TestDiffMatchByAttr(t *testing.T) {
+	a := mustParse(t, `<plan><phase id="1"><g>5</g></phase><phase id="2"><g>7</g></phase><phase id="3"><g>9</g></phase></plan>`)
+	b := mustParse(t, `<plan><phase id="3"><g>9</g></phase><phase id="1"><g>5</g></phase><phase id="4"><g>1</g></phase></plan>`)
+
+	want := []Change{
+		{Path: "/plan/phase[1]", Type: ChangeMoved, Old: "/plan/phase[1]", New: "/plan/phase[2]"},
+		{Path: "/plan/phase[2]", Type: ChangeRemoved},
+		{Path: "/plan/phase[3]", Type: ChangeAdded},
+	}
+	if got := withoutNodes(Diff(a, b, MatchByAttr("id"))); !reflect.DeepEqual(got, want) {
+		t.Errorf("keyed Diff =\n%+v\nwant\n%+v", got, want)
+	}
+
+	// By position every phase looks edited in place
+	for _, c := range Diff(a, b) {
+		if c.Type == ChangeMoved || c.Type == ChangeAdded || c.Type == ChangeRemoved {
+			t.Errorf("positional Diff reported %+v", c)
+		}
+	}
+}
+
+func TestDiffMatchByAttrUnkeyedSiblings(t *testing.T) {
+	// Siblings without the key, and repeats of a key, fall back to position
+	a := mustParse(t, `<plan><phase id="1">a</phase><phase>b</phase><phase id="1">c</phase></plan>`)
+	b := mustParse(t, `<plan><phase>B</phase><phase id="1">a</phase><phase id="1">c</phase></plan>`)
+
+	want := []Change{
+		{Path: "/plan/phase[2]", Type: ChangeValueChanged, Old: "b", New: "B"},
+	}
+	if got := withoutNodes(Diff(a, b, MatchByAttr("id"))); !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestDiffRoots(t *testing.T) {
+	a := mustParse(t, `<plan/>`)
+	b := mustParse(t, `<schedule/>`)
+
+	for _, tc := range []struct {
+		name string
+		a, b *Node
+		want []Change
+	}{
+		{name: "both nil"},
+		{name: "added", b: b, want: []Change{{Path: "/schedule", Type: ChangeAdded}}},
+		{name: "removed", a: a, want: []Change{{Path: "/plan", Type: ChangeRemoved}}},
+		{name: "renamed", a: a, b: b, want: []Change{{Path: "/plan", Type: ChangeRemoved}, {Path: "/schedule", Type: ChangeAdded}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := withoutNodes(Diff(tc.a, tc.b)); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Diff = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSyncFile(t *testing.T) {
+	g := newFakeGateway(t)
+	g.load("dev", "plan.xml", `<plan version="3"><phase id="1"><minGreen>5</minGreen></phase><phase id="2"><minGreen>7</minGreen></phase><name>x</name></plan>`)
+	c := g.client()
+
+	desired := mustParse(t, `<plan version="4" mode="m"><phase id="1"><minGreen>6</minGreen></phase><name>x</name><det kind="loop"><zone>1</zone><!--spare--></det></plan>`)
+	changes, err := c.SyncFile("dev", "plan.xml", desired)
+	if err != nil {
+		t.Fatalf("SyncFile: %v", err)
+	}
+	if len(changes) != 5 {
+		t.Errorf("SyncFile applied %d changes, want 5", len(changes))
+	}
+	if got, want := mustXML(t, g.file("dev", "plan.xml")), mustXML(t, desired); got != want {
+		t.Errorf("file = %s\nwant %s", got, want)
+	}
+
+	g.reset()
+	changes, err = c.SyncFile("dev", "plan.xml", desired)
+	if err != nil || len(changes) != 0 {
+		t.Errorf("second SyncFile = %+v, %v, want no changes", changes, err)
+	}
+	if n := len(g.received()); n != 1 {
+		t.Errorf("second SyncFile sent %d requests, want only the read", n)
+	}
+
+	if _, err := c.SyncFile("dev", "plan.xml", mustParse(t, `<schedule/>`)); err == nil {
+		t.Error("SyncFile replaced the root element")
+	}
+}
@@ -0,0 +1,231 @@
+package xmlapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Failure dump files are named dumpPrefix, a sortable timestamp and a
+// sequence number, so rotation can remove the oldest by name
+const (
+	dumpPrefix = "xmlapi-failure-"
+	dumpSuffix = ".txt"
+	// maxDumpBody caps each body written to a dump
+	maxDumpBody = 4096
+)
+
+// redactedHeaders and redactedParams are written to dumps without their values
+var (
+	redactedHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "Proxy-Authorization", DefaultSigningHeader}
+	redactedParams  = map[string]bool{
+		"token":         true,
+		"access_token":  true,
+		"refresh_token": true,
+		"client_secret": true,
+		"password":      true,
+		"apikey":        true,
+	}
+)
+
+// WithFailureDump writes a diagnostics file to dir for every call that
+// ends in an error status or a transport failure, keeping the newest
+// maxFiles of them. A dump holds the request line, headers, query and body,
+// the response status, headers and body, and the timing of each attempt;
+// credentials are redacted and bodies truncated. Dumps are written in the
+// background, and failing to write one is only logged.
+func WithFailureDump(dir string, maxFiles int) Option {
+	return func(c *Client) {
+		c.failureDump = &failureDumper{dir: dir, maxFiles: maxFiles}
+	}
+}
+
+// failureDumper writes and rotates the dump files of a client
+type failureDumper struct {
+	dir      string
+	maxFiles int
+
+	// mu serializes writing and rotation
+	mu  sync.Mutex
+	seq int
+}
+
+// failureRecord gathers what a dump of one call needs while it runs
+type failureRecord struct {
+	start    time.Time
+	body     []byte
+	req      *http.Request
+	attempts []attemptRecord
+}
+
+// attemptRecord is the outcome of a single attempt of a call
+type attemptRecord struct {
+	duration time.Duration
+	status   int
+	err      error
+}
+
+// newFailureRecord starts recording a call, or returns nil when dumps are off
+func (c *Client) newFailureRecord(body []byte) *failureRecord {
+	if c.failureDump == nil {
+		return nil
+	}
+	return &failureRecord{start: time.Now(), body: body}
+}
+
+// capture wraps newRequest to remember the last request built
+func (r *failureRecord) capture(newRequest func(context.Context) (*http.Request, error)) func(context.Context) (*http.Request, error) {
+	if r == nil {
+		return newRequest
+	}
+	return func(ctx context.Context) (*http.Request, error) {
+		req, err := newRequest(ctx)
+		if err == nil {
+			r.req = req
+		}
+		return req, err
+	}
+}
+
+// attempt records the outcome of an attempt that started at start
+func (r *failureRecord) attempt(start time.Time, resp *Response, err error) {
+	if r == nil {
+		return
+	}
+	a := attemptRecord{duration: time.Since(start), err: err}
+	if resp != nil {
+		a.status = resp.StatusCode
+	}
+	r.attempts = append(r.attempts, a)
+}
+
+// finishFailureRecord dumps the call if it failed with an error status or a transport error
+func (c *Client) finishFailureRecord(r *failureRecord, resp *Response, err error) {
+	if r == nil || err == nil || r.req == nil {
+		return
+	}
+	var transportErr *TransportError
+	if !errors.As(err, &transportErr) && (resp == nil || resp.StatusCode < 400) {
+		return
+	}
+
+	contents := r.format(resp, err)
+	go func() {
+		if err := c.failureDump.write(contents); err != nil {
+			c.logger.Printf("Failed to write failure dump: %v", err)
+		}
+	}()
+}
+
+// format renders the dump of a failed call
+func (r *failureRecord) format(resp *Response, err error) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "time: %s\n", r.start.Format(time.RFC3339Nano))
+	fmt.Fprintf(&b, "elapsed: %s\n", time.Since(r.start))
+	fmt.Fprintf(&b, "error: %v\n", err)
+
+	b.WriteString("\nattempts:\n")
+	for i, a := range r.attempts {
+		fmt.Fprintf(&b, "  %d: %s", i+1, a.duration)
+		if a.status != 0 {
+			fmt.Fprintf(&b, " status %d", a.status)
+		}
+		if a.err != nil {
+			fmt.Fprintf(&b, " error: %v", a.err)
+		}
+		b.WriteString("\n")
+	}
+
+	u := *r.req.URL
+	u.User = nil
+	query := u.Query()
+	for key := range query {
+		if redactedParams[strings.ToLower(key)] {
+			query.Set(key, "REDACTED")
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	b.WriteString("\nrequest:\n")
+	fmt.Fprintf(&b, "%s %s\n", r.req.Method, u.String())
+	writeHeaders(&b, r.req.Header)
+	if len(r.body) > 0 {
+		b.WriteString("\n" + truncateValue(string(r.body), maxDumpBody) + "\n")
+	}
+
+	if resp != nil {
+		b.WriteString("\nresponse:\n")
+		fmt.Fprintf(&b, "%d %s\n", resp.StatusCode, http.StatusText(resp.StatusCode))
+		writeHeaders(&b, resp.Header)
+		if len(resp.Body) > 0 {
+			b.WriteString("\n" + truncateValue(string(resp.Body), maxDumpBody) + "\n")
+		}
+	}
+
+	return b.String()
+}
+
+// writeHeaders writes headers in sorted order, redacting credentials
+func writeHeaders(b *strings.Builder, header http.Header) {
+	redacted := header.Clone()
+	for _, name := range redactedHeaders {
+		if redacted.Get(name) != "" {
+			redacted.Set(name, "REDACTED")
+		}
+	}
+
+	names := make([]string, 0, len(redacted))
+	for name := range redacted {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range redacted[name] {
+			fmt.Fprintf(b, "%s: %s\n", name, value)
+		}
+	}
+}
+
+// write stores a dump and removes the oldest ones beyond maxFiles
+func (d *failureDumper) write(contents string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := os.MkdirAll(d.dir, 0o755); err != nil {
+		return err
+	}
+	d.seq++
+	name := fmt.Sprintf("%s%s-%04d%s", dumpPrefix, time.Now().UTC().Format("20060102T150405.000000000"), d.seq%10000, dumpSuffix)
+	if err := os.WriteFile(filepath.Join(d.dir, name), []byte(contents), 0o600); err != nil {
+		return err
+	}
+
+	if d.maxFiles <= 0 {
+		return nil
+	}
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return err
+	}
+	var dumps []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), dumpPrefix) && strings.HasSuffix(entry.Name(), dumpSuffix) {
+			dumps = append(dumps, entry.Name())
+		}
+	}
+	sort.Strings(dumps)
+	for len(dumps) > d.maxFiles {
+		if err := os.Remove(filepath.Join(d.dir, dumps[0])); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		dumps = dumps[1:]
+	}
+	return nil
+}
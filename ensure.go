@@ -0,0 +1,178 @@
+package xmlapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// EnsurePath creates whichever elements of the absolute path are missing,
+// parents first, and returns the paths of those it created. Existing
+// elements, including those another caller creates meanwhile, are left as
+// they are. The root element must exist, and a
+// missing element addressed by an index ("phase[3]") or a wildcard is an
+// error rather than a new sibling.
+func (c *Client) EnsurePath(deviceID, filename string, path PathLike, opts ...RequestOption) (_ []string, err error) {
+	ctx, op := startOp(context.Background(), "EnsurePath", opts, deviceID, filename, path)
+	defer op.finish(&err)
+
+	pathStr, err := PathString(path)
+	if err != nil {
+		return nil, err
+	}
+	created, _, _, err := c.ensurePath(ctx, deviceID, filename, pathStr, "")
+	return created, err
+}
+
+// SetValueAtPath sets the value of the element at path, creating it and
+// any missing parents as EnsurePath does
+func (c *Client) SetValueAtPath(deviceID, filename string, path PathLike, value string, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "SetValueAtPath", opts, deviceID, filename, path)
+	defer op.finish(&err)
+
+	pathStr, err := PathString(path)
+	if err != nil {
+		return "", err
+	}
+	_, leaf, status, err := c.ensurePath(ctx, deviceID, filename, pathStr, value)
+	if err != nil || leaf {
+		return status, err
+	}
+	return c.updateNode(ctx, deviceID, filename, pathStr, value)
+}
+
+// ensurePath implements EnsurePath; leafValue is the value of the last
+// element if it has to be created. leaf reports whether this call created
+// the last element, and status is that of the last creation.
+func (c *Client) ensurePath(ctx context.Context, deviceID, filename, path, leafValue string) (created []string, leaf bool, status string, err error) {
+	p, err := parsePath(path)
+	if err != nil {
+		return nil, false, "", err
+	}
+	if !p.Absolute || len(p.Segments) == 0 {
+		return nil, false, "", fmt.Errorf("invalid path %q: must name an element by an absolute path", path)
+	}
+	for _, seg := range p.Segments {
+		if seg.Attr {
+			return nil, false, "", fmt.Errorf("invalid path %q: must name an element", path)
+		}
+	}
+
+	exists, err := c.nodeExists(ctx, deviceID, filename, path)
+	if err != nil || exists {
+		return nil, false, "", err
+	}
+
+	// Find the deepest existing ancestor; everything below it is missing
+	first := len(p.Segments) - 1
+	for first > 0 {
+		exists, err := c.nodeExists(ctx, deviceID, filename, p.prefix(first).String())
+		if err != nil {
+			return nil, false, "", err
+		}
+		if exists {
+			break
+		}
+		first--
+	}
+	if first == 0 {
+		return nil, false, "", fmt.Errorf("root element of %q: %w", path, ErrNotFound)
+	}
+
+	for i := first; i < len(p.Segments); i++ {
+		seg := p.Segments[i]
+		if seg.Index > 0 || seg.Wildcard {
+			return created, false, status, fmt.Errorf("cannot create %q: indexed and wildcard segments are never created", p.prefix(i+1).String())
+		}
+
+		tag := seg.Local
+		if seg.Prefix != "" {
+			tag = seg.Prefix + ":" + seg.Local
+		}
+		value := ""
+		if i == len(p.Segments)-1 {
+			value = leafValue
+		}
+		status, err = c.createNode(ctx, deviceID, filename, p.prefix(i).String(), tag, value)
+		if errors.Is(err, ErrAlreadyExists) {
+			// Another caller created it first
+			continue
+		}
+		if err != nil {
+			return created, false, status, err
+		}
+		created = append(created, p.prefix(i+1).String())
+		leaf = i == len(p.Segments)-1
+	}
+	return created, leaf, status, nil
+}
+
+// prefix returns the path made of the first n segments
+func (p parsedPath) prefix(n int) parsedPath {
+	return parsedPath{Absolute: p.Absolute, Segments: p.Segments[:n]}
+}
+
+// existsResponse represents the response of /exists
+type existsResponse struct {
+	Exists bool `json:"exists"`
+}
+
+// nodeExists reports whether the element at path exists, asking the
+// gateway's /exists where available and otherwise reading the element
+// without its children
+func (c *Client) nodeExists(ctx context.Context, deviceID, filename, path string) (bool, error) {
+	params := map[string]string{
+		"deviceid": deviceID,
+		"filename": filename,
+		"path":     path,
+	}
+
+	resp, err := c.requestContext(ctx, "GET", "/exists", params, nil)
+	if err == nil {
+		var result existsResponse
+		if err := c.decode(resp, &result); err != nil {
+			return false, err
+		}
+		return result.Exists, nil
+	}
+	if !errors.Is(err, ErrUnsupportedByServer) {
+		return false, err
+	}
+
+	// Gateways that ignore depth return the whole subtree, which is slower
+	// but answers the same
+	params["depth"] = "0"
+	_, err = c.requestContext(ctx, "GET", "/read", params, nil)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GetOrCreateNode reads the element at path, creating it with defaultValue,
+// along with any missing parents, if it does not exist. The bool reports
+// whether this call created it. When another caller creates it first, the
+// conflict is resolved by reading theirs.
+func (c *Client) GetOrCreateNode(deviceID, filename string, path PathLike, defaultValue string, opts ...RequestOption) (_ *Node, _ bool, err error) {
+	ctx, op := startOp(context.Background(), "GetOrCreateNode", opts, deviceID, filename, path)
+	defer op.finish(&err)
+
+	pathStr, err := PathString(path)
+	if err != nil {
+		return nil, false, err
+	}
+	node, err := c.readNode(ctx, deviceID, filename, pathStr)
+	if !errors.Is(err, ErrNotFound) {
+		return node, false, err
+	}
+
+	_, leaf, _, err := c.ensurePath(ctx, deviceID, filename, pathStr, defaultValue)
+	if err != nil {
+		return nil, false, err
+	}
+	node, err = c.readNode(ctx, deviceID, filename, pathStr)
+	if err != nil {
+		return nil, false, err
+	}
+	return node, leaf, nil
+}
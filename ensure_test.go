@@ -0,0 +1,109 @@
+package xmlapi
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestGetOrCreateNode(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		doc         string
+		want        string
+		wantValue   string
+		wantCreated bool
+	}{
+		{
+			name: "creates the missing parents", doc: `<cfg/>`,
+			want: `<cfg><net><port>80</port></net></cfg>`, wantValue: "80", wantCreated: true,
+		},
+		{
+			name: "reads an existing node", doc: `<cfg><net><port>8080</port></net></cfg>`,
+			want: `<cfg><net><port>8080</port></net></cfg>`, wantValue: "8080",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := newFakeGateway(t)
+			g.uniqueCreate = true
+			g.load("dev", "cfg.xml", tc.doc)
+			c := g.client()
+
+			n, created, err := c.GetOrCreateNode("dev", "cfg.xml", "/cfg/net/port", "80")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n.Value != tc.wantValue || created != tc.wantCreated {
+				t.Errorf("GetOrCreateNode = %q, %v, want %q, %v", n.Value, created, tc.wantValue, tc.wantCreated)
+			}
+			if got := mustXML(t, g.file("dev", "cfg.xml")); got != tc.want {
+				t.Errorf("document %s\nwant %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestGetOrCreateNodeConflict(t *testing.T) {
+	g := newFakeGateway(t)
+	g.uniqueCreate = true
+	g.load("dev", "cfg.xml", `<cfg><net/></cfg>`)
+	// Another process creates the node just before this client does
+	var once sync.Once
+	g.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path == "/create" {
+			once.Do(func() {
+				g.mu.Lock()
+				defer g.mu.Unlock()
+				net := fakeFind(g.files["dev"]["cfg.xml"], "/cfg/net", nil)
+				net.Nodes = append(net.Nodes, Node{XMLName: XMLName{Local: "port"}, Value: "8080"})
+			})
+		}
+		return false
+	}
+	c := g.client()
+
+	n, created, err := c.GetOrCreateNode("dev", "cfg.xml", "/cfg/net/port", "80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Value != "8080" || created {
+		t.Errorf("GetOrCreateNode = %q, %v, want the other process's 8080, false", n.Value, created)
+	}
+	if got, want := mustXML(t, g.file("dev", "cfg.xml")), `<cfg><net><port>8080</port></net></cfg>`; got != want {
+		t.Errorf("document %s\nwant %s", got, want)
+	}
+}
+
+func TestGetOrCreateNodeRacingClients(t *testing.T) {
+	g := newFakeGateway(t)
+	g.uniqueCreate = true
+	g.load("dev", "cfg.xml", `<cfg/>`)
+	// Both clients find the node missing before either creates it
+	holdReads(g, 2)
+
+	var wg sync.WaitGroup
+	values := make([]string, 2)
+	created := make([]bool, 2)
+	for i := range values {
+		// Separate clients share nothing, as separate processes would not
+		c := g.client()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n, ok, err := c.GetOrCreateNode("dev", "cfg.xml", "/cfg/net/port", "80")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			values[i], created[i] = n.Value, ok
+		}()
+	}
+	wg.Wait()
+
+	if values[0] != "80" || values[1] != "80" || created[0] == created[1] {
+		t.Errorf("values %q, created %v, want both 80 and one creation", values, created)
+	}
+	if got, want := mustXML(t, g.file("dev", "cfg.xml")), `<cfg><net><port>80</port></net></cfg>`; got != want {
+		t.Errorf("document %s\nwant %s", got, want)
+	}
+}
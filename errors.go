@@ -0,0 +1,226 @@
+package xmlapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+var (
+	// ErrNotFound is returned when the requested file or node does not exist
+	ErrNotFound = errors.New("not found")
+
+	// ErrAttrNotFound is returned when a node exists but lacks the requested attribute.
+	// It wraps ErrNotFound so errors.Is(err, ErrNotFound) still holds.
+	ErrAttrNotFound = fmt.Errorf("attribute %w", ErrNotFound)
+
+	// ErrEmptyValue is returned by the typed Node accessors when the value is
+	// empty or only whitespace
+	ErrEmptyValue = errors.New("empty value")
+
+	// ErrTestFailed is returned when a "test" patch operation finds an unexpected value
+	ErrTestFailed = errors.New("test failed")
+
+	// ErrUnsupportedByServer is returned when the gateway does not implement an endpoint
+	ErrUnsupportedByServer = errors.New("unsupported by server")
+
+	// ErrInvalidPath is returned for a path argument that is neither a string
+	// nor a Path
+	ErrInvalidPath = errors.New("invalid path")
+
+	// ErrDecryptionFailed is returned when a value encrypted with
+	// WithFieldEncryption cannot be decrypted, usually because of a wrong key
+	ErrDecryptionFailed = errors.New("decryption failed")
+
+	// ErrMixedContent is returned by ParseXML for an element with text after
+	// one of its child nodes, which a Node cannot hold in order
+	ErrMixedContent = errors.New("mixed content")
+
+	// ErrInvalidSignature is returned when a webhook delivery's signature does not match its body
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+
+	// ErrLocked is returned when the gateway reports the file locked by another user
+	ErrLocked = errors.New("locked")
+
+	// ErrUnauthorized is returned when the gateway rejects the client's credentials
+	ErrUnauthorized = errors.New("unauthorized")
+
+	// ErrForbidden is returned when the credentials are valid but lack
+	// permission for the file or operation
+	ErrForbidden = errors.New("forbidden")
+
+	// ErrCredentialsUnavailable is returned when the CredentialsProvider cannot supply an API key
+	ErrCredentialsUnavailable = errors.New("credentials unavailable")
+
+	// ErrScopeDenied is returned when the gateway refuses to grant a requested scope
+	ErrScopeDenied = errors.New("scope denied")
+
+	// ErrConnectTimeout is returned when connecting to the gateway times out
+	ErrConnectTimeout = errors.New("connect timeout")
+
+	// ErrResponseTimeout is returned when the gateway does not send response headers in time
+	ErrResponseTimeout = errors.New("response timeout")
+
+	// ErrRetryBudgetExhausted is returned when a call runs out of its WithRetryBudget time
+	ErrRetryBudgetExhausted = errors.New("retry budget exhausted")
+
+	// ErrClientClosed is returned by requests made after Client.Close
+	ErrClientClosed = errors.New("client closed")
+
+	// ErrWaitTimeout is matched by the *WaitTimeoutError of WaitForValue
+	ErrWaitTimeout = errors.New("wait timed out")
+
+	// ErrJobFailed is returned when an asynchronous job ends in JobFailed
+	ErrJobFailed = errors.New("job failed")
+
+	// ErrJobCancelled is returned when an asynchronous job was cancelled
+	ErrJobCancelled = errors.New("job cancelled")
+
+	// ErrJobAlreadyFinished is returned when cancelling a job that has already finished
+	ErrJobAlreadyFinished = errors.New("job already finished")
+
+	// ErrAlreadyExists is returned when creating a node or file that another
+	// caller has created first
+	ErrAlreadyExists = errors.New("already exists")
+
+	// ErrInsufficientStorage is returned when a device lacks the flash storage
+	// an operation needs
+	ErrInsufficientStorage = errors.New("insufficient storage")
+
+	// ErrChecksumMismatch is returned when a copied file's content hash
+	// differs from the original's
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+
+	// ErrNotConfirmed is returned by destructive operations called without confirmation
+	ErrNotConfirmed = errors.New("not confirmed")
+)
+
+// APIError represents an error status returned by the API
+type APIError struct {
+	StatusCode int
+	Message    string
+	Body       []byte
+
+	// Code and Details are the machine-readable error code and context sent
+	// by newer firmware, empty otherwise
+	Code    string
+	Details map[string]interface{}
+
+	// routeMissing is set when a 404 carries no API error body, meaning the
+	// endpoint itself is unknown rather than the resource it addresses
+	routeMissing bool
+}
+
+// maxErrorMessage caps the length of a message taken from a non-JSON body
+const maxErrorMessage = 200
+
+// newAPIError builds an APIError from an error status response. JSON bodies
+// become the message as they are; anything else, such as a proxy's HTML
+// error page, is reduced to the status and a short sanitized excerpt.
+func newAPIError(statusCode int, header http.Header, body []byte) *APIError {
+	apiErr := &APIError{StatusCode: statusCode, Message: string(body), Body: body}
+	if !isJSONBody(header, body) {
+		apiErr.Message = errorSummary(statusCode, body)
+	}
+
+	var result APIResponse
+	decoded := json.Unmarshal(body, &result) == nil
+	if decoded {
+		apiErr.Code = result.Code
+		apiErr.Details = result.Details
+	}
+
+	if statusCode == http.StatusNotFound && (!decoded || result.Error == "") {
+		apiErr.routeMissing = true
+	}
+
+	return apiErr
+}
+
+// isJSONBody reports whether a response body is JSON, going by its content
+// type when it names a non-JSON one
+func isJSONBody(header http.Header, body []byte) bool {
+	if mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type")); err == nil {
+		if mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json") {
+			return false
+		}
+	}
+	return len(bytes.TrimSpace(body)) > 0 && json.Valid(body)
+}
+
+// errorSummary describes a non-JSON response by its status and an excerpt
+// of its text, with markup stripped, whitespace collapsed and control
+// characters removed
+func errorSummary(statusCode int, body []byte) string {
+	summary := fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode))
+
+	var text strings.Builder
+	inTag := false
+	for _, r := range string(body) {
+		switch {
+		case r == '<':
+			inTag = true
+		case r == '>' && inTag:
+			inTag = false
+			text.WriteByte(' ')
+		case inTag:
+		case unicode.IsSpace(r):
+			text.WriteByte(' ')
+		case unicode.IsPrint(r):
+			text.WriteRune(r)
+		}
+	}
+	excerpt := truncateValue(strings.Join(strings.Fields(text.String()), " "), maxErrorMessage)
+	if excerpt == "" {
+		return summary
+	}
+	return summary + ": " + excerpt
+}
+
+// Error implements the error interface
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// errorCodes maps the well-known error codes onto the package's sentinel errors
+var errorCodes = map[string]error{
+	"NOT_FOUND":       ErrNotFound,
+	"ATTR_NOT_FOUND":  ErrAttrNotFound,
+	"FILE_LOCKED":     ErrLocked,
+	"UNAUTHORIZED":    ErrUnauthorized,
+	"FORBIDDEN":       ErrForbidden,
+	"SCOPE_DENIED":    ErrScopeDenied,
+	"NOT_IMPLEMENTED": ErrUnsupportedByServer,
+	"JOB_FINISHED":    ErrJobAlreadyFinished,
+	"ALREADY_EXISTS":  ErrAlreadyExists,
+	"NO_SPACE":        ErrInsufficientStorage,
+}
+
+// Is maps the error code, or else the status code, onto the package's
+// sentinel errors
+func (e *APIError) Is(target error) bool {
+	if sentinel, ok := errorCodes[e.Code]; ok {
+		return errors.Is(sentinel, target)
+	}
+
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound && !e.routeMissing
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrAlreadyExists:
+		return e.StatusCode == http.StatusConflict
+	case ErrInsufficientStorage:
+		return e.StatusCode == http.StatusInsufficientStorage
+	case ErrUnsupportedByServer:
+		return e.routeMissing || e.StatusCode == http.StatusNotImplemented || e.StatusCode == http.StatusMethodNotAllowed
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package xmlapi
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestNonJSONErrorBodies(t *testing.T) {
+	const page = "<html><head><title>502 Bad Gateway</title></head>\n<body><center><h1>502 Bad Gateway</h1></center>\r\n<hr><center>nginx</center></body></html>\n"
+
+	for _, tc := range []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		message     string
+		is          error
+	}{
+		{
+			name: "HTML 502", status: http.StatusBadGateway, contentType: "text/html", body: page,
+			message: "502 Bad Gateway: 502 Bad Gateway 502 Bad Gateway nginx",
+		},
+		{
+			name: "plain text 403", status: http.StatusForbidden, contentType: "text/plain", body: "forbidden\tby\x00 policy\n",
+			message: "403 Forbidden: forbidden by policy", is: ErrForbidden,
+		},
+		{
+			name: "empty 500", status: http.StatusInternalServerError,
+			message: "500 Internal Server Error",
+		},
+		{
+			name: "empty 404", status: http.StatusNotFound,
+			message: "404 Not Found", is: ErrUnsupportedByServer,
+		},
+		{
+			name: "HTML 404", status: http.StatusNotFound, contentType: "text/html", body: "<p>no such page</p>",
+			message: "404 Not Found: no such page", is: ErrUnsupportedByServer,
+		},
+		{
+			name: "JSON labelled as text", status: http.StatusConflict, contentType: "text/plain", body: `{"error":"taken"}`,
+			message: `409 Conflict: {"error":"taken"}`, is: ErrAlreadyExists,
+		},
+		{
+			name: "long text", status: http.StatusServiceUnavailable, contentType: "text/plain", body: strings.Repeat("busy ", 100),
+			message: "503 Service Unavailable: " + strings.Repeat("busy ", 40)[:maxErrorMessage] + "...",
+		},
+		{
+			name: "JSON", status: http.StatusNotFound, contentType: "application/json", body: `{"error":"node not found","code":"NOT_FOUND"}`,
+			message: `{"error":"node not found","code":"NOT_FOUND"}`, is: ErrNotFound,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := newFakeGateway(t)
+			g.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+				if r.URL.Path != "/read" {
+					return false
+				}
+				if tc.contentType != "" {
+					w.Header().Set("Content-Type", tc.contentType)
+				}
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.body))
+				return true
+			}
+			c := g.client()
+
+			_, err := c.ReadNode("dev", "plan.xml", "/plan")
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("ReadNode = %v, want an *APIError", err)
+			}
+			if apiErr.StatusCode != tc.status || apiErr.Message != tc.message {
+				t.Errorf("APIError %d %q\nwant      %d %q", apiErr.StatusCode, apiErr.Message, tc.status, tc.message)
+			}
+			if string(apiErr.Body) != tc.body {
+				t.Errorf("Body %q, want the body as sent", apiErr.Body)
+			}
+			if tc.is != nil && !errors.Is(err, tc.is) {
+				t.Errorf("%v does not match %v", err, tc.is)
+			}
+			if tc.status == http.StatusNotFound && tc.is == ErrUnsupportedByServer && errors.Is(err, ErrNotFound) {
+				t.Errorf("a 404 without an API error matches ErrNotFound")
+			}
+		})
+	}
+}
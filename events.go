@@ -0,0 +1,333 @@
+package xmlapi
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Timing of SubscribeEvents connections
+const (
+	// eventsRetryDelay is the reconnect delay until the server sends a retry hint
+	eventsRetryDelay = 3 * time.Second
+	// eventsHeartbeatTimeout is how long a stream may stay silent, heartbeats
+	// included, before it is considered dead and reopened
+	eventsHeartbeatTimeout = 45 * time.Second
+)
+
+// EventFilter selects the node changes a subscription receives. Empty fields
+// match everything; filtering is done by the gateway.
+type EventFilter struct {
+	Filename   string
+	PathPrefix string
+}
+
+// NodeEvent is a single node change record from the event stream
+type NodeEvent struct {
+	// ID is the server's event ID, used to resume after a reconnect
+	ID string `json:"-"`
+	// Type is the SSE event name, e.g. "created", "updated" or "deleted"
+	Type     string `json:"-"`
+	Filename string `json:"filename"`
+	Path     string `json:"path"`
+	Value    string `json:"value"`
+	Revision int64  `json:"revision"`
+}
+
+// Subscription is an open event stream started by SubscribeEvents
+type Subscription struct {
+	events chan NodeEvent
+
+	mu  sync.Mutex
+	err error
+}
+
+// Events returns the channel of node changes. It is closed when the
+// subscription ends; Err then reports why.
+func (s *Subscription) Events() <-chan NodeEvent {
+	return s.events
+}
+
+// Err returns the error that ended the subscription, or nil while it is
+// running or if it ended because its context was cancelled
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// setErr records the error that ended the subscription
+func (s *Subscription) setErr(err error) {
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+}
+
+// SubscribeEvents opens the gateway's Server-Sent Events stream of node
+// changes for a device. The first connection is made before SubscribeEvents
+// returns. Dropped or silent connections are reopened, resuming after the
+// last received event; the subscription ends when ctx is cancelled, the
+// client is closed or the gateway refuses the stream.
+func (c *Client) SubscribeEvents(ctx context.Context, deviceID string, filter EventFilter, opts ...RequestOption) (_ *Subscription, err error) {
+	ctx, op := startOp(ctx, "SubscribeEvents", opts, deviceID, "", nil)
+	defer op.finish(&err)
+
+	params := map[string]string{
+		"deviceid": deviceID,
+	}
+	if filter.Filename != "" {
+		params["filename"] = filter.Filename
+	}
+	if filter.PathPrefix != "" {
+		params["path_prefix"] = filter.PathPrefix
+	}
+
+	if !c.startBackground() {
+		return nil, newOperation(ctx, "GET", "/events", params).wrap(ErrClientClosed)
+	}
+	ctx, cancel := c.withClose(ctx)
+
+	body, err := c.openEvents(ctx, params, "")
+	if err != nil {
+		cancel()
+		c.background.Done()
+		return nil, newOperation(ctx, "GET", "/events", params).wrap(err)
+	}
+
+	sub := &Subscription{events: make(chan NodeEvent)}
+	go func() {
+		defer c.background.Done()
+		defer cancel()
+		defer close(sub.events)
+
+		stream := &eventStream{c: c, retry: eventsRetryDelay}
+		for {
+			err := stream.read(ctx, body, sub.events)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				c.logger.Printf("Event stream interrupted: %v", err)
+			}
+
+			for {
+				if !sleepContext(ctx, stream.retry) {
+					return
+				}
+				body, err = c.openEvents(ctx, params, stream.lastID)
+				if err == nil {
+					break
+				}
+				var apiErr *APIError
+				if errors.As(err, &apiErr) {
+					sub.setErr(newOperation(ctx, "GET", "/events", params).wrap(err))
+					return
+				}
+			}
+		}
+	}()
+
+	return sub, nil
+}
+
+// openEvents connects to the event stream, resuming after lastID when set
+func (c *Client) openEvents(ctx context.Context, params map[string]string, lastID string) (io.ReadCloser, error) {
+	if err := c.usable(); err != nil {
+		return nil, err
+	}
+
+	url := c.endpointURL("/events")
+	params = c.namespaceParams(params, nil)
+
+	newRequest := func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := c.auth.setAuthorization(ctx, req, params["deviceid"]); err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "text/event-stream")
+		if lastID != "" {
+			req.Header.Set("Last-Event-ID", lastID)
+		}
+		for key, values := range withCallHeader(nil, requestConfig(ctx).header) {
+			req.Header[key] = values
+		}
+
+		q := req.URL.Query()
+		for key, value := range params {
+			q.Add(key, value)
+		}
+		req.URL.RawQuery = q.Encode()
+		c.sign(req, nil)
+
+		return req, nil
+	}
+
+	for attempt := 0; ; attempt++ {
+		// A RequestTimeout of the call bounds opening the stream, not
+		// reading it, so the stream's context outlives the timer
+		streamCtx, cancel := context.WithCancel(ctx)
+		var timer *time.Timer
+		if d := requestConfig(ctx).timeout; d > 0 {
+			timer = time.AfterFunc(d, cancel)
+		}
+		req, err := newRequest(streamCtx)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		resp, err := c.do(req)
+		if timer != nil && !timer.Stop() && ctx.Err() == nil {
+			if err == nil {
+				resp.Body.Close()
+			}
+			cancel()
+			return nil, &TransportError{URL: redactedURL(req), Timeout: true, Err: fmt.Errorf("%w: %w", ErrResponseTimeout, context.DeadlineExceeded)}
+		}
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		if resp.StatusCode < 400 {
+			return &streamBody{ReadCloser: resp.Body, cancel: cancel}, nil
+		}
+
+		respBody, err := readBody(ctx, resp.Body)
+		resp.Body.Close()
+		cancel()
+		if err != nil {
+			return nil, transportError(req, err)
+		}
+
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 && c.reauthAllowed("/events") {
+			if err := c.auth.refresh(ctx, params["deviceid"]); err != nil {
+				return nil, reauthFailed(err)
+			}
+			continue
+		}
+
+		c.logger.Printf("Request to %s failed with status: %d, response: %s", url, resp.StatusCode, respBody)
+		return nil, newAPIError(resp.StatusCode, resp.Header, respBody)
+	}
+}
+
+// streamBody is the body of an event stream, releasing the stream's
+// context when closed
+type streamBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close closes the body and releases the context
+func (b *streamBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// eventStream holds the parser state that survives reconnects
+type eventStream struct {
+	c      *Client
+	lastID string
+	retry  time.Duration
+}
+
+// read parses one connection's SSE stream and sends its events until the
+// stream ends, goes silent for longer than the heartbeat timeout, or ctx is
+// done. body is always closed.
+func (s *eventStream) read(ctx context.Context, body io.ReadCloser, events chan<- NodeEvent) error {
+	// Closing the body unblocks the scanner when the connection goes silent
+	var silent bool
+	var mu sync.Mutex
+	watchdog := time.AfterFunc(eventsHeartbeatTimeout, func() {
+		mu.Lock()
+		silent = true
+		mu.Unlock()
+		body.Close()
+	})
+	defer watchdog.Stop()
+	defer body.Close()
+
+	var id, event string
+	var data strings.Builder
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		watchdog.Reset(eventsHeartbeatTimeout)
+		line := scanner.Text()
+
+		if line == "" {
+			// A blank line dispatches the event gathered so far
+			if data.Len() > 0 {
+				if err := s.dispatch(ctx, id, event, data.String(), events); err != nil {
+					return err
+				}
+			}
+			event = ""
+			data.Reset()
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "":
+			// A comment, which the gateway sends as a heartbeat
+		case "id":
+			id = value
+		case "event":
+			event = value
+		case "data":
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+				s.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if silent {
+		return errors.New("no heartbeat received")
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
+
+// dispatch decodes and sends a complete event
+func (s *eventStream) dispatch(ctx context.Context, id, event, data string, events chan<- NodeEvent) error {
+	s.lastID = id
+
+	var e NodeEvent
+	if err := s.c.unmarshal([]byte(data), &e); err != nil {
+		s.c.logger.Printf("Skipping malformed event: %v", err)
+		return nil
+	}
+	e.ID = id
+	e.Type = event
+	if e.Type == "" {
+		e.Type = "message"
+	}
+
+	select {
+	case events <- e:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,126 @@
+package xmlapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+// JSONExportOptions controls how ExportFileJSON shapes the document
+type JSONExportOptions struct {
+	// AttrPrefix, when set, emits attributes as keys of the element itself
+	// with this prefix (e.g. "@" gives "@id") instead of under MapAttrsKey
+	AttrPrefix string
+	// ArrayTags lists tags that are always emitted as arrays, even when an
+	// element has only one child with that tag
+	ArrayTags []string
+	// InferTypes emits values as JSON numbers or booleans when they are the
+	// canonical spelling of one ("12", "1.5", "true"), so "007" stays a string
+	InferTypes bool
+	// Indent pretty-prints the output with this indentation
+	Indent string
+}
+
+// ExportFileJSON reads an XML file and returns it as idiomatic JSON built
+// with Node.ToMap, without a wrapper for the root element. Object keys are
+// sorted so the output is deterministic.
+func (c *Client) ExportFileJSON(deviceID, filename string, opts JSONExportOptions, reqOpts ...RequestOption) (_ []byte, err error) {
+	ctx, op := startOp(context.Background(), "ExportFileJSON", reqOpts, deviceID, filename, nil)
+	defer op.finish(&err)
+
+	var buf bytes.Buffer
+	if err := c.exportFileJSONTo(ctx, &buf, deviceID, filename, opts); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ExportFileJSONTo is like ExportFileJSON but encodes the document straight to w
+func (c *Client) ExportFileJSONTo(w io.Writer, deviceID, filename string, opts JSONExportOptions, reqOpts ...RequestOption) (err error) {
+	ctx, op := startOp(context.Background(), "ExportFileJSONTo", reqOpts, deviceID, filename, nil)
+	defer op.finish(&err)
+
+	return c.exportFileJSONTo(ctx, w, deviceID, filename, opts)
+}
+
+// exportFileJSONTo implements ExportFileJSONTo, carrying ctx
+func (c *Client) exportFileJSONTo(ctx context.Context, w io.Writer, deviceID, filename string, opts JSONExportOptions) error {
+	root, err := c.readNodeWith(ctx, deviceID, filename, "/")
+	if err != nil {
+		return err
+	}
+
+	arrays := make(map[string]bool, len(opts.ArrayTags))
+	for _, tag := range opts.ArrayTags {
+		arrays[tag] = true
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if opts.Indent != "" {
+		enc.SetIndent("", opts.Indent)
+	}
+	return enc.Encode(shapeJSON(root.ToMap(), opts, arrays))
+}
+
+// shapeJSON applies the export options to a map produced by ToMap
+func shapeJSON(m map[string]interface{}, opts JSONExportOptions, arrays map[string]bool) map[string]interface{} {
+	shaped := make(map[string]interface{}, len(m))
+	for key, value := range m {
+		if key == MapAttrsKey && opts.AttrPrefix != "" {
+			for name, attr := range value.(map[string]interface{}) {
+				shaped[opts.AttrPrefix+name] = shapeValue(attr, opts, arrays)
+			}
+			continue
+		}
+		if key == MapAttrsKey {
+			shaped[key] = value
+			continue
+		}
+
+		value = shapeValue(value, opts, arrays)
+		if _, isList := value.([]interface{}); arrays[key] && !isList {
+			value = []interface{}{value}
+		}
+		shaped[key] = value
+	}
+	return shaped
+}
+
+// shapeValue applies the export options to one value of a ToMap map
+func shapeValue(value interface{}, opts JSONExportOptions, arrays map[string]bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return shapeJSON(v, opts, arrays)
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = shapeValue(item, opts, arrays)
+		}
+		return list
+	case string:
+		if opts.InferTypes {
+			return inferType(v)
+		}
+	}
+	return value
+}
+
+// inferType returns s as a number or boolean when s is its canonical spelling
+func inferType(s string) interface{} {
+	switch s {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil && strconv.FormatInt(i, 10) == s {
+		return i
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && strconv.FormatFloat(f, 'f', -1, 64) == s {
+		return f
+	}
+	return s
+}
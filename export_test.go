@@ -0,0 +1,9 @@
+package xmlapi
+
+import "testing"
+
+// NewFakeGatewayClient starts a fake gateway for the tests of package
+// xmlapi_test and returns a client of it
+func NewFakeGatewayClient(t *testing.T) *Client {
+	return newFakeGateway(t).client()
+}
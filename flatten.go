@@ -0,0 +1,45 @@
+package xmlapi
+
+// FlattenOptions controls how Flatten maps a tree onto paths
+type FlattenOptions struct {
+	// Indexes adds a 1-based index to repeated sibling tags ("/plan/phase[2]").
+	// Without it repeated siblings share a key and the last one in document
+	// order wins.
+	Indexes bool
+	// IncludeEmpty emits leaf elements whose value is empty
+	IncludeEmpty bool
+	// Attributes emits every attribute under a "path/@name" key
+	Attributes bool
+}
+
+// Flatten returns the tree rooted at n as a map from canonical path to value.
+// Elements with children only appear when they carry a value of their own.
+// Comments and node metadata are ignored. Identical trees always flatten to identical maps.
+func (n *Node) Flatten(opts FlattenOptions) map[string]string {
+	values := make(map[string]string)
+	n.walk(opts.Indexes, func(path string, _ int, node *Node) error {
+		if node.Value != "" || (opts.IncludeEmpty && !hasElementChildren(node)) {
+			values[path] = node.Value
+		}
+		if opts.Attributes {
+			for _, attr := range node.Attrs {
+				if isNamespaceDecl(attr.Name) {
+					continue
+				}
+				values[path+"/@"+escapeSegment(attr.Name.Local)] = attr.Value
+			}
+		}
+		return nil
+	})
+	return values
+}
+
+// hasElementChildren reports whether n has at least one element child
+func hasElementChildren(n *Node) bool {
+	for i := range n.Nodes {
+		if n.Nodes[i].Kind == NodeElement {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package xmlapi
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const flattenDoc = `<plan id="p"><phase n="1"><minGreen>5</minGreen><note/></phase><phase n="2"><minGreen>7</minGreen></phase><!--c--><name>main</name></plan>`
+
+func TestFlatten(t *testing.T) {
+	root, err := ParseXML(strings.NewReader(flattenDoc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name string
+		opts FlattenOptions
+		want map[string]string
+	}{
+		{
+			name: "default",
+			want: map[string]string{
+				"/plan/phase/minGreen": "7",
+				"/plan/name":           "main",
+			},
+		},
+		{
+			name: "indexes",
+			opts: FlattenOptions{Indexes: true},
+			want: map[string]string{
+				"/plan/phase[1]/minGreen": "5",
+				"/plan/phase[2]/minGreen": "7",
+				"/plan/name":              "main",
+			},
+		},
+		{
+			name: "everything",
+			opts: FlattenOptions{Indexes: true, IncludeEmpty: true, Attributes: true},
+			want: map[string]string{
+				"/plan/@id":               "p",
+				"/plan/phase[1]/@n":       "1",
+				"/plan/phase[1]/minGreen": "5",
+				"/plan/phase[1]/note":     "",
+				"/plan/phase[2]/@n":       "2",
+				"/plan/phase[2]/minGreen": "7",
+				"/plan/name":              "main",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := root.Flatten(tc.opts)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Flatten = %v\nwant %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFlattenDeterministic(t *testing.T) {
+	a, err := ParseXML(strings.NewReader(flattenDoc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := a.Clone()
+	opts := FlattenOptions{Indexes: true, IncludeEmpty: true, Attributes: true}
+	first := a.Flatten(opts)
+	for i := 0; i < 20; i++ {
+		if got := b.Flatten(opts); !reflect.DeepEqual(got, first) {
+			t.Fatalf("flatten %d differs: %v, first %v", i, got, first)
+		}
+	}
+
+	// The indexed keys always address the element they came from
+	for path, value := range first {
+		if strings.Contains(path, "@") {
+			continue
+		}
+		if n, ok := a.Find(path); !ok || n.Value != value {
+			t.Errorf("Find(%q) does not give %q back", path, value)
+		}
+	}
+}
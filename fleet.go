@@ -0,0 +1,119 @@
+package xmlapi
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// FleetOption configures ForEachDevice
+type FleetOption func(*fleetConfig)
+
+// fleetConfig holds the options of a ForEachDevice call
+type fleetConfig struct {
+	maxFailures int
+}
+
+// FailFast stops starting new devices once n of them have failed. Devices
+// already running are allowed to finish.
+func FailFast(n int) FleetOption {
+	return func(cfg *fleetConfig) {
+		cfg.maxFailures = n
+	}
+}
+
+// FleetResult aggregates the outcome of ForEachDevice
+type FleetResult struct {
+	Succeeded int
+	Failed    int
+	// Skipped lists the devices not started because of cancellation or FailFast
+	Skipped []string
+
+	// Errors holds the error of every failed device
+	Errors map[string]error
+	// Durations holds how long fn took for every device that was started
+	Durations map[string]time.Duration
+	// Elapsed is the wall time of the whole run
+	Elapsed time.Duration
+}
+
+// Err returns nil if every device succeeded, otherwise an error of an
+// arbitrary failed device
+func (r *FleetResult) Err() error {
+	for _, err := range r.Errors {
+		return err
+	}
+	return nil
+}
+
+// ForEachDevice runs fn for every device with at most concurrency running
+// at once, and collects the outcome. It stops starting devices when ctx is
+// cancelled. Requests fn makes through client share the client's rate limit,
+// however many devices run concurrently.
+func ForEachDevice(ctx context.Context, client *Client, deviceIDs []string, concurrency int, fn func(ctx context.Context, deviceID string) error, opts ...FleetOption) *FleetResult {
+	var cfg fleetConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	result := &FleetResult{
+		Errors:    make(map[string]error),
+		Durations: make(map[string]time.Duration),
+	}
+	start := time.Now()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, concurrency)
+
+	stopped := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return ctx.Err() != nil || client.usable() != nil || (cfg.maxFailures > 0 && result.Failed >= cfg.maxFailures)
+	}
+
+	for i, deviceID := range deviceIDs {
+		acquired := false
+		select {
+		case slots <- struct{}{}:
+			acquired = true
+		case <-ctx.Done():
+		}
+		if stopped() {
+			if acquired {
+				<-slots
+			}
+			mu.Lock()
+			result.Skipped = append(result.Skipped, deviceIDs[i:]...)
+			mu.Unlock()
+			break
+		}
+
+		wg.Add(1)
+		go func(deviceID string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			began := time.Now()
+			err := fn(ctx, deviceID)
+			elapsed := time.Since(began)
+
+			mu.Lock()
+			defer mu.Unlock()
+			result.Durations[deviceID] = elapsed
+			if err != nil {
+				result.Failed++
+				result.Errors[deviceID] = err
+			} else {
+				result.Succeeded++
+			}
+		}(deviceID)
+	}
+
+	wg.Wait()
+	result.Elapsed = time.Since(start)
+	return result
+}
@@ -0,0 +1,51 @@
+package xmlapi
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// WithLegacyFormEncoding sends the parameters of POST, PUT and PATCH
+// requests as an application/x-www-form-urlencoded body instead of in the
+// query, as the oldest firmware requires. Other methods keep them in the
+// query, and requests with a structured JSON body are sent unchanged.
+func WithLegacyFormEncoding() Option {
+	return func(c *Client) {
+		c.legacyForm = true
+	}
+}
+
+// formEncoded reports whether a request's parameters go in a form body
+func (c *Client) formEncoded(method string, body interface{}) bool {
+	if !c.legacyForm {
+		return false
+	}
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return false
+	}
+	switch body.(type) {
+	case nil, map[string]string:
+		return true
+	}
+	return false
+}
+
+// formBody encodes params and multi, along with the fields of a map body,
+// as a form
+func formBody(params map[string]string, multi url.Values, body interface{}) []byte {
+	form := make(url.Values, len(params)+len(multi))
+	for key, value := range params {
+		form.Set(key, value)
+	}
+	for key, values := range multi {
+		form[key] = append(form[key], values...)
+	}
+	if fields, ok := body.(map[string]string); ok {
+		for key, value := range fields {
+			form.Set(key, value)
+		}
+	}
+	return []byte(form.Encode())
+}
@@ -0,0 +1,68 @@
+package xmlapi
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestLegacyFormEncoding(t *testing.T) {
+	g := newFakeGateway(t)
+	g.legacyForm = true
+	g.load("dev", "plan.xml", planDoc)
+
+	// The oldest firmware refuses parameters in the query of a write
+	_, err := g.client().UpdateNode("dev", "plan.xml", "/plan/phase[1]/minGreen", "6")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("query-encoded update = %v, want 400", err)
+	}
+
+	g.reset()
+	c := g.client(WithLegacyFormEncoding(), WithRequestSigning([]byte("secret"), ""))
+	if _, err := c.UpdateNode("dev", "plan.xml", "/plan/phase[1]/minGreen", "a&b=c"); err != nil {
+		t.Fatalf("UpdateNode: %v", err)
+	}
+	if _, err := c.CreateNode("dev", "plan.xml", "/plan", "name", "x y"); err != nil {
+		t.Fatalf("CreateNode: %v", err)
+	}
+	if _, err := c.SetAttribute("dev", "plan.xml", "/plan", "mode", "+1"); err != nil {
+		t.Fatalf("SetAttribute: %v", err)
+	}
+	if _, err := c.UploadFile("dev", "other.xml", strings.NewReader(`<other a="1"/>`), false); err != nil {
+		t.Fatalf("UploadFile: %v", err)
+	}
+	if _, err := c.DeleteNode("dev", "plan.xml", "/plan/phase[2]"); err != nil {
+		t.Fatalf("DeleteNode: %v", err)
+	}
+	if _, err := c.ReadNode("dev", "plan.xml", "/plan"); err != nil {
+		t.Fatalf("ReadNode: %v", err)
+	}
+
+	for _, req := range g.received() {
+		form := req.Method == http.MethodPost || req.Method == http.MethodPut
+		if req.Endpoint == "/authorize" {
+			form = false
+		}
+		isForm := strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded")
+		if isForm != form {
+			t.Errorf("%s %s form encoded = %v, want %v", req.Method, req.Endpoint, isForm, form)
+		}
+		if form && (len(req.Query) != 0 || req.Form.Get("deviceid") != "dev") {
+			t.Errorf("%s %s query %v form %v, want every parameter in the form", req.Method, req.Endpoint, req.Query, req.Form)
+		}
+	}
+	if got := g.receivedAt("/uploadFile")[0].Form.Get("content"); got != `<other a="1"/>` {
+		t.Errorf("upload content %q, want the body fields in the form", got)
+	}
+	checkSignatures(t, g, []byte("secret"), DefaultSigningHeader)
+
+	want := `<plan version="3" mode="+1"><phase id="1" mode="fixed"><minGreen>a&amp;b=c</minGreen></phase><name>x y</name></plan>`
+	if got := mustXML(t, g.file("dev", "plan.xml")); got != want {
+		t.Errorf("file %s\nwant %s", got, want)
+	}
+	if got := mustXML(t, g.file("dev", "other.xml")); got != `<other a="1"/>` {
+		t.Errorf("uploaded %s", got)
+	}
+}
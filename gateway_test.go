@@ -0,0 +1,992 @@
+package xmlapi
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testAPIKey is the API key the fake gateway accepts unless told otherwise
+const testAPIKey = "test-key"
+
+// fakeGateway is an in-memory gateway served over HTTP for tests. It keeps
+// files as Node trees, with values unescaped and ValueKind recording CDATA,
+// and answers in the gateway's JSON shapes. Endpoints can be disabled to
+// exercise fallbacks, and intercept can take over any request.
+type fakeGateway struct {
+	t   testing.TB
+	srv *httptest.Server
+
+	mu       sync.Mutex
+	files    map[string]map[string]*Node
+	keys     map[string]bool
+	tokens   map[string]string // token -> device it is bound to, "" for shared
+	issued   int
+	requests []fakeRequest
+	conns    int64          // connections accepted, updated atomically
+	sent     map[string]int // response body bytes by endpoint, intercepted responses aside
+
+	// prefix is where the API is served; requests outside it answer 404
+	prefix string
+	// disabled endpoints answer 404 without a body, as gateways without them do
+	disabled map[string]bool
+	// skew is how far the gateway's clock is ahead of the local one
+	skew time.Duration
+	// tokenTTL is the lifetime of issued tokens
+	tokenTTL time.Duration
+	// loose answers /read without honouring attr=, depth or fields
+	loose bool
+	// legacyForm rejects mutating requests that carry their parameters in
+	// the query instead of a form body
+	legacyForm bool
+	// noETag answers reads without an ETag
+	noETag bool
+	// rejectGzip answers compressed request bodies with 415
+	rejectGzip bool
+	// uniqueCreate answers /create with 409 when the parent already has a
+	// child of the tag, as gateways enforcing unique children do
+	uniqueCreate bool
+	// intercept, when set, sees every request first; returning true means it
+	// wrote the response
+	intercept func(w http.ResponseWriter, r *http.Request) bool
+}
+
+// fakeRequest is a request received by the fake gateway
+type fakeRequest struct {
+	Method string
+	// Endpoint is the URL path without the gateway's prefix
+	Endpoint string
+	Path     string
+	RawQuery string
+	Query    url.Values
+	Form     url.Values
+	Header   http.Header
+	// Raw is the body as sent, Body the body after any gzip decoding
+	Raw  []byte
+	Body []byte
+}
+
+// newFakeGateway starts a fake gateway accepting testAPIKey, closed when
+// the test ends
+func newFakeGateway(t testing.TB) *fakeGateway {
+	g := &fakeGateway{
+		t:        t,
+		files:    make(map[string]map[string]*Node),
+		keys:     map[string]bool{testAPIKey: true},
+		tokens:   make(map[string]string),
+		disabled: make(map[string]bool),
+		sent:     make(map[string]int),
+		tokenTTL: time.Hour,
+	}
+	g.srv = httptest.NewUnstartedServer(http.HandlerFunc(g.serve))
+	g.srv.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(&g.conns, 1)
+		}
+	}
+	g.srv.Start()
+	t.Cleanup(g.srv.Close)
+	return g
+}
+
+// URL returns the base URL of the gateway
+func (g *fakeGateway) URL() string {
+	return g.srv.URL
+}
+
+// connections returns how many connections the gateway has accepted
+func (g *fakeGateway) connections() int {
+	return int(atomic.LoadInt64(&g.conns))
+}
+
+// client returns a client of the gateway authorizing with testAPIKey. The
+// client is closed when the test ends.
+func (g *fakeGateway) client(opts ...Option) *Client {
+	opts = append([]Option{WithLogger(discardLogger{})}, opts...)
+	c := NewClient(testAPIKey, g.URL(), opts...)
+	g.t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// discardLogger drops the client's log output
+type discardLogger struct{}
+
+// Printf implements Logger
+func (discardLogger) Printf(string, ...interface{}) {}
+
+// recordLogger keeps the client's log output
+type recordLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+// Printf implements Logger
+func (l *recordLogger) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+// logged returns the lines logged so far
+func (l *recordLogger) logged() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.lines...)
+}
+
+// load stores the document doc as filename on deviceID
+func (g *fakeGateway) load(deviceID, filename, doc string) {
+	root, err := ParseXML(strings.NewReader(doc))
+	if err != nil {
+		g.t.Fatalf("load %s: %v", filename, err)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.store(deviceID, filename, root)
+}
+
+// file returns a copy of a stored file, nil if there is none
+func (g *fakeGateway) file(deviceID, filename string) *Node {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.files[deviceID][filename].Clone()
+}
+
+// received returns the requests received so far
+func (g *fakeGateway) received() []fakeRequest {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]fakeRequest(nil), g.requests...)
+}
+
+// receivedAt returns the requests received for endpoint
+func (g *fakeGateway) receivedAt(endpoint string) []fakeRequest {
+	var matched []fakeRequest
+	for _, req := range g.received() {
+		if req.Endpoint == endpoint {
+			matched = append(matched, req)
+		}
+	}
+	return matched
+}
+
+// reset forgets the requests received and bytes sent so far
+func (g *fakeGateway) reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.requests = nil
+	g.sent = make(map[string]int)
+}
+
+// bytesSent returns the response body bytes sent for endpoint
+func (g *fakeGateway) bytesSent(endpoint string) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.sent[endpoint]
+}
+
+// countingWriter counts the body bytes of a response
+type countingWriter struct {
+	http.ResponseWriter
+	n int
+}
+
+// Write implements http.ResponseWriter
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n += n
+	return n, err
+}
+
+// disable makes endpoint answer as a gateway without it does
+func (g *fakeGateway) disable(endpoints ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, endpoint := range endpoints {
+		g.disabled[endpoint] = true
+	}
+}
+
+// allowKey makes the gateway accept key
+func (g *fakeGateway) allowKey(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.keys[key] = true
+}
+
+// revokeKey stops the gateway accepting key and every token issued so far
+func (g *fakeGateway) revokeKey(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.keys, key)
+	g.tokens = make(map[string]string)
+}
+
+// revokeTokens invalidates every token issued so far
+func (g *fakeGateway) revokeTokens() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.tokens = make(map[string]string)
+}
+
+// validTokens returns the tokens the gateway currently accepts
+func (g *fakeGateway) validTokens() map[string]string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	tokens := make(map[string]string, len(g.tokens))
+	for token, deviceID := range g.tokens {
+		tokens[token] = deviceID
+	}
+	return tokens
+}
+
+// store stores root as a file; g.mu must be held
+func (g *fakeGateway) store(deviceID, filename string, root *Node) {
+	if g.files[deviceID] == nil {
+		g.files[deviceID] = make(map[string]*Node)
+	}
+	g.files[deviceID][filename] = root
+}
+
+// serve records and answers a request
+func (g *fakeGateway) serve(w http.ResponseWriter, r *http.Request) {
+	raw, _ := io.ReadAll(r.Body)
+	body := raw
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(strings.NewReader(string(raw)))
+		if err == nil {
+			body, err = io.ReadAll(zr)
+		}
+		if err != nil {
+			http.Error(w, "bad gzip body", http.StatusBadRequest)
+			return
+		}
+	}
+	form := url.Values{}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		form, _ = url.ParseQuery(string(body))
+	}
+
+	req := fakeRequest{
+		Method:   r.Method,
+		Endpoint: strings.TrimPrefix(r.URL.Path, g.prefix),
+		Path:     r.URL.Path,
+		RawQuery: r.URL.RawQuery,
+		Query:    r.URL.Query(),
+		Form:     form,
+		Header:   r.Header.Clone(),
+		Raw:      raw,
+		Body:     body,
+	}
+	g.mu.Lock()
+	g.requests = append(g.requests, req)
+	intercept := g.intercept
+	g.mu.Unlock()
+
+	// Handlers may read the body again
+	r.Body = io.NopCloser(strings.NewReader(string(body)))
+	if intercept != nil && intercept(w, r) {
+		return
+	}
+
+	counted := &countingWriter{ResponseWriter: w}
+	w = counted
+	defer func() {
+		g.mu.Lock()
+		g.sent[req.Endpoint] += counted.n
+		g.mu.Unlock()
+	}()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	w.Header().Set("Date", time.Now().Add(g.skew).UTC().Format(http.TimeFormat))
+
+	if r.Header.Get("Content-Encoding") == "gzip" && g.rejectGzip {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+	if g.disabled[req.Endpoint] || !strings.HasPrefix(r.URL.Path, g.prefix) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	params := req.Query
+	if len(form) > 0 {
+		params = url.Values{}
+		for key, values := range req.Query {
+			params[key] = values
+		}
+		for key, values := range form {
+			params[key] = append(params[key], values...)
+		}
+	} else if g.legacyForm && r.Method != http.MethodGet && r.Method != http.MethodDelete && req.Endpoint != "/authorize" {
+		g.fail(w, http.StatusBadRequest, "", "parameters must be form encoded")
+		return
+	}
+
+	if req.Endpoint == "/authorize" {
+		g.authorize(w, r, params)
+		return
+	}
+	if deviceID, ok := g.tokens[r.Header.Get("Authorization")]; !ok || (deviceID != "" && deviceID != params.Get("deviceid")) {
+		g.fail(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid token")
+		return
+	}
+
+	handler, ok := fakeEndpoints[r.Method+" "+req.Endpoint]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	handler(g, w, r, params, body)
+}
+
+// fakeHandler answers one endpoint; g.mu is held
+type fakeHandler func(g *fakeGateway, w http.ResponseWriter, r *http.Request, params url.Values, body []byte)
+
+// fakeEndpoints are the endpoints the fake gateway implements, by method and path
+var fakeEndpoints map[string]fakeHandler
+
+func init() {
+	fakeEndpoints = map[string]fakeHandler{
+		"POST /revoke":       (*fakeGateway).revoke,
+		"GET /listFile":      (*fakeGateway).listFile,
+		"POST /createFile":   (*fakeGateway).createFile,
+		"POST /uploadFile":   (*fakeGateway).uploadFile,
+		"DELETE /deleteFile": (*fakeGateway).deleteFile,
+		"POST /copyDevice":   (*fakeGateway).copyDevice,
+		"GET /read":          (*fakeGateway).read,
+		"GET /exists":        (*fakeGateway).exists,
+		"GET /children":      (*fakeGateway).children,
+		"GET /readBulk":      (*fakeGateway).readBulk,
+		"POST /create":       (*fakeGateway).create,
+		"POST /createBulk":   (*fakeGateway).createBulk,
+		"PUT /update":        (*fakeGateway).update,
+		"PUT /updateBulk":    (*fakeGateway).updateBulk,
+		"POST /upsert":       (*fakeGateway).upsert,
+		"DELETE /delete":     (*fakeGateway).delete,
+		"DELETE /deleteBulk": (*fakeGateway).deleteBulk,
+		"POST /sort":         (*fakeGateway).sortChildren,
+		"POST /reorder":      (*fakeGateway).reorder,
+		"PUT /replace":       (*fakeGateway).replace,
+	}
+}
+
+// writeJSON answers with v encoded as JSON
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// ok answers with the plain success response
+func (g *fakeGateway) ok(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, APIResponse{Status: "success"})
+}
+
+// fail answers with an error response carrying code
+func (g *fakeGateway) fail(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, APIResponse{Error: message, Code: code})
+}
+
+// authorize issues a token for a known API key
+func (g *fakeGateway) authorize(w http.ResponseWriter, r *http.Request, params url.Values) {
+	if !g.keys[r.Header.Get("Authorization")] {
+		g.fail(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid API key")
+		return
+	}
+	g.issued++
+	token := "token-" + strconv.Itoa(g.issued)
+	g.tokens[token] = params.Get("deviceid")
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"token":   token,
+		"expires": time.Now().Add(g.skew).Add(g.tokenTTL).UTC().Format(time.RFC3339),
+		"scopes":  strings.Fields(params.Get("scope")),
+	})
+}
+
+// revoke invalidates the token given
+func (g *fakeGateway) revoke(w http.ResponseWriter, r *http.Request, params url.Values, body []byte) {
+	delete(g.tokens, params.Get("token"))
+	g.ok(w)
+}
+
+// listFile lists the files of a device
+func (g *fakeGateway) listFile(w http.ResponseWriter, r *http.Request, params url.Values, body []byte) {
+	files := []string{}
+	for filename := range g.files[params.Get("deviceid")] {
+		files = append(files, filename)
+	}
+	sort.Strings(files)
+	writeJSON(w, http.StatusOK, FileList{Files: files})
+}
+
+// createFile creates a file holding an empty root element
+func (g *fakeGateway) createFile(w http.ResponseWriter, r *http.Request, params url.Values, body []byte) {
+	deviceID, filename := params.Get("deviceid"), params.Get("filename")
+	if g.files[deviceID][filename] != nil {
+		g.fail(w, http.StatusConflict, "ALREADY_EXISTS", "file exists")
+		return
+	}
+	g.store(deviceID, filename, &Node{XMLName: XMLName{Local: params.Get("rootname")}})
+	g.ok(w)
+}
+
+// uploadFile stores a whole document
+func (g *fakeGateway) uploadFile(w http.ResponseWriter, r *http.Request, params url.Values, body []byte) {
+	var upload struct {
+		Content string `json:"content"`
+	}
+	content := params.Get("content")
+	if json.Unmarshal(body, &upload) == nil && upload.Content != "" {
+		content = upload.Content
+	}
+	root, err := ParseXML(strings.NewReader(content))
+	if err != nil {
+		g.fail(w, http.StatusBadRequest, "", err.Error())
+		return
+	}
+	deviceID, filename := params.Get("deviceid"), params.Get("filename")
+	if g.files[deviceID][filename] != nil && params.Get("overwrite") != "true" {
+		g.fail(w, http.StatusConflict, "ALREADY_EXISTS", "file exists")
+		return
+	}
+	g.store(deviceID, filename, root)
+	g.ok(w)
+}
+
+// deleteFile deletes a file
+func (g *fakeGateway) deleteFile(w http.ResponseWriter, r *http.Request, params url.Values, body []byte) {
+	deviceID, filename := params.Get("deviceid"), params.Get("filename")
+	if g.files[deviceID][filename] == nil {
+		g.fail(w, http.StatusNotFound, "NOT_FOUND", "file not found")
+		return
+	}
+	delete(g.files[deviceID], filename)
+	g.ok(w)
+}
+
+// copyDevice copies a file to another device
+func (g *fakeGateway) copyDevice(w http.ResponseWriter, r *http.Request, params url.Values, body []byte) {
+	root := g.files[params.Get("deviceid")][params.Get("filename")]
+	if root == nil {
+		g.fail(w, http.StatusNotFound, "NOT_FOUND", "file not found")
+		return
+	}
+	target := params.Get("new_deviceid")
+	if g.files[target][params.Get("filename")] != nil && params.Get("overwrite") != "true" {
+		g.fail(w, http.StatusConflict, "ALREADY_EXISTS", "file exists")
+		return
+	}
+	g.store(target, params.Get("filename"), root.Clone())
+	g.ok(w)
+}
+
+// lookup returns the file and the element at the path parameter named
+// key, answering with an error and returning nil when either is missing
+func (g *fakeGateway) lookup(w http.ResponseWriter, params url.Values, key string) (*Node, *Node) {
+	root := g.files[params.Get("deviceid")][params.Get("filename")]
+	if root == nil {
+		g.fail(w, http.StatusNotFound, "NOT_FOUND", "file not found")
+		return nil, nil
+	}
+	n := fakeFind(root, params.Get(key), params)
+	if n == nil {
+		g.fail(w, http.StatusNotFound, "NOT_FOUND", "node not found")
+		return nil, nil
+	}
+	return root, n
+}
+
+// fakeFind returns the first element at path, resolving prefixes through
+// the xmlns: parameters of the request as well as the tree's declarations
+func fakeFind(root *Node, path string, params url.Values) *Node {
+	if path == "/" || path == "" {
+		return root
+	}
+	p, err := parsePath(path)
+	if err != nil || !p.Absolute || len(p.Segments) == 0 {
+		return nil
+	}
+	prefixes := make(map[string]string)
+	for key := range params {
+		if prefix, ok := strings.CutPrefix(key, "xmlns:"); ok {
+			prefixes[prefix] = params.Get(key)
+		}
+	}
+	current := []nodeMatch{{root, scopeFor(root, prefixes)}}
+	first := p.Segments[0]
+	if first.Attr || !first.matches(root, current[0].prefixes) || first.Index > 1 {
+		return nil
+	}
+	for _, seg := range p.Segments[1:] {
+		var next []nodeMatch
+		for _, m := range current {
+			next = append(next, seg.selectChildren(m)...)
+		}
+		if len(next) == 0 {
+			return nil
+		}
+		current = next
+	}
+	return current[0].node
+}
+
+// wire returns n as the gateway sends it, with text values escaped
+func wire(n *Node) *Node {
+	out := n.Clone()
+	stack := []*Node{out}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		node.RawValue = ""
+		if node.Kind == NodeElement && node.ValueKind == ValueText {
+			node.Value = escapeText(node.Value, false)
+		}
+		for i := range node.Nodes {
+			stack = append(stack, &node.Nodes[i])
+		}
+	}
+	return out
+}
+
+// writeNode answers with a node, honouring If-None-Match
+func (g *fakeGateway) writeNode(w http.ResponseWriter, r *http.Request, n *Node) {
+	data, _ := json.Marshal(wire(n))
+	if g.noETag {
+		writeJSONBytes(w, data)
+		return
+	}
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJSONBytes(w, data)
+}
+
+// writeJSONBytes answers with data, already encoded as JSON
+func writeJSONBytes(w http.ResponseWriter, data []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// read answers a node, an attribute with attr=, or the node without its
+// children with depth=0
+func (g *fakeGateway) read(w http.ResponseWriter, r *http.Request, params url.Values, body []byte) {
+	_, n := g.lookup(w, params, "path")
+	if n == nil {
+		return
+	}
+	if g.loose {
+		g.writeNode(w, r, n)
+		return
+	}
+	if name := params.Get("attr"); name != "" {
+		value, found := n.Attr(name)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"attr": name, "value": value, "found": found})
+		return
+	}
+	out := n.Clone()
+	if params.Get("depth") == "0" {
+		out.Nodes = nil
+	}
+	g.writeNode(w, r, out)
+}
+
+// exists reports whether an element exists
+func (g *fakeGateway) exists(w http.ResponseWriter, r *http.Request, params url.Values, body []byte) {
+	root := g.files[params.Get("deviceid")][params.Get("filename")]
+	if root == nil {
+		g.fail(w, http.StatusNotFound, "NOT_FOUND", "file not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"exists": fakeFind(root, params.Get("path"), params) != nil})
+}
+
+// children pages through the children of an element
+func (g *fakeGateway) children(w http.ResponseWriter, r *http.Request, params url.Values, body []byte) {
+	_, n := g.lookup(w, params, "path")
+	if n == nil {
+		return
+	}
+	start, _ := strconv.Atoi(params.Get("cursor"))
+	limit, err := strconv.Atoi(params.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = len(n.Nodes)
+	}
+	end := min(start+limit, len(n.Nodes))
+	page := childrenResponse{Nodes: []Node{}}
+	for i := start; i < end; i++ {
+		page.Nodes = append(page.Nodes, *wire(&n.Nodes[i]))
+	}
+	if end < len(n.Nodes) {
+		page.Next = strconv.Itoa(end)
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// readBulk answers several nodes in the order of their paths
+func (g *fakeGateway) readBulk(w http.ResponseWriter, r *http.Request, params url.Values, body []byte) {
+	root := g.files[params.Get("deviceid")][params.Get("filename")]
+	if root == nil {
+		g.fail(w, http.StatusNotFound, "NOT_FOUND", "file not found")
+		return
+	}
+	result := bulkReadResponse{Nodes: []Node{}}
+	for _, path := range params["path"] {
+		n := fakeFind(root, path, params)
+		if n == nil {
+			g.fail(w, http.StatusNotFound, "NOT_FOUND", "node not found: "+path)
+			return
+		}
+		result.Nodes = append(result.Nodes, *wire(n))
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// newElement returns the element a create request adds
+func newElement(params url.Values) Node {
+	n := Node{XMLName: XMLName{Space: params.Get("namespace"), Local: params.Get("tag")}, Value: params.Get("value")}
+	if params.Get("cdata") == "true" {
+		n.ValueKind = ValueCDATA
+	}
+	if prefix := params.Get("prefix"); prefix != "" {
+		n.Attrs = append(n.Attrs, Attr{Name: XMLName{Space: xmlnsPrefix, Local: prefix}, Value: n.XMLName.Space})
+	}
+	if params.Get("kind") == "comment" {
+		n = Node{Kind: NodeComment, Value: params.Get("value")}
+	}
+	return n
+}
+
+// create appends an element or comment to a parent
+func (g *fakeGateway) create(w http.ResponseWriter, r *http.Request, params url.Values, body []byte) {
+	_, parent := g.lookup(w, params, "parent_path")
+	if parent == nil {
+		return
+	}
+	if params.Get("tag") == "" && params.Get("kind") != "comment" {
+		g.fail(w, http.StatusBadRequest, "", "tag is required")
+		return
+	}
+	if g.uniqueCreate && firstChild(parent, params.Get("tag")) != nil {
+		g.fail(w, http.StatusConflict, "ALREADY_EXISTS", "node exists")
+		return
+	}
+	parent.Nodes = append(parent.Nodes, newElement(params))
+	g.ok(w)
+}
+
+// firstChild returns the first element child of n with the tag, or nil
+func firstChild(n *Node, tag string) *Node {
+	for i := range n.Nodes {
+		if n.Nodes[i].Kind == NodeElement && n.Nodes[i].XMLName.Local == tag {
+			return &n.Nodes[i]
+		}
+	}
+	return nil
+}
+
+// createBulk appends several elements, each parent evaluated after the
+// elements before it were added
+func (g *fakeGateway) createBulk(w http.ResponseWriter, r *http.Request, params url.Values, body []byte) {
+	root := g.files[params.Get("deviceid")][params.Get("filename")]
+	if root == nil {
+		g.fail(w, http.StatusNotFound, "NOT_FOUND", "file not found")
+		return
+	}
+	var request bulkCreateRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		g.fail(w, http.StatusBadRequest, "", err.Error())
+		return
+	}
+	work := root.Clone()
+	for _, spec := range request.Nodes {
+		parent := fakeFind(work, spec.ParentPath, params)
+		if parent == nil {
+			g.fail(w, http.StatusNotFound, "NOT_FOUND", "parent not found: "+spec.ParentPath)
+			return
+		}
+		n := Node{XMLName: XMLName{Local: spec.Tag}, Value: spec.Value}
+		names := make([]string, 0, len(spec.Attrs))
+		for name := range spec.Attrs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			n.Attrs = append(n.Attrs, Attr{Name: XMLName{Local: name}, Value: spec.Attrs[name]})
+		}
+		parent.Nodes = append(parent.Nodes, n)
+	}
+	g.store(params.Get("deviceid"), params.Get("filename"), work)
+	g.ok(w)
+}
+
+// update sets the value of an element, or one of its attributes with attr=
+func (g *fakeGateway) update(w http.ResponseWriter, r *http.Request, params url.Values, body []byte) {
+	_, n := g.lookup(w, params, "path")
+	if n == nil {
+		return
+	}
+	if name := params.Get("attr"); name != "" {
+		for i := range n.Attrs {
+			if n.Attrs[i].Name.Local == name {
+				n.Attrs[i].Value = params.Get("value")
+				g.ok(w)
+				return
+			}
+		}
+		n.Attrs = append(n.Attrs, Attr{Name: XMLName{Local: name}, Value: params.Get("value")})
+		g.ok(w)
+		return
+	}
+	n.Value = params.Get("value")
+	n.ValueKind = ValueText
+	if params.Get("cdata") == "true" {
+		n.ValueKind = ValueCDATA
+	}
+	g.ok(w)
+}
+
+// updateBulk sets several values, all or none with atomic=true
+func (g *fakeGateway) updateBulk(w http.ResponseWriter, r *http.Request, params url.Values, body []byte) {
+	root := g.files[params.Get("deviceid")][params.Get("filename")]
+	if root == nil {
+		g.fail(w, http.StatusNotFound, "NOT_FOUND", "file not found")
+		return
+	}
+	var request struct {
+		Values map[string]string `json:"values"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		g.fail(w, http.StatusBadRequest, "", err.Error())
+		return
+	}
+	failed := make(map[string]string)
+	for path := range request.Values {
+		if fakeFind(root, path, params) == nil {
+			failed[path] = "node not found"
+		}
+	}
+	if len(failed) > 0 && params.Get("atomic") == "true" {
+		writeJSON(w, http.StatusOK, bulkUpdateResponse{APIResponse: APIResponse{Error: "not applied"}, Failed: failed})
+		return
+	}
+	for path, value := range request.Values {
+		if n := fakeFind(root, path, params); n != nil {
+			n.Value, n.ValueKind = value, ValueText
+		}
+	}
+	writeJSON(w, http.StatusOK, bulkUpdateResponse{APIResponse: APIResponse{Status: "success"}, Failed: failed})
+}
+
+// upsert sets the value of the first tag child of a parent, adding one if
+// there is none
+func (g *fakeGateway) upsert(w http.ResponseWriter, r *http.Request, params url.Values, body []byte) {
+	_, parent := g.lookup(w, params, "parent_path")
+	if parent == nil {
+		return
+	}
+	if child := firstChild(parent, params.Get("tag")); child != nil {
+		child.Value, child.ValueKind = params.Get("value"), ValueText
+		g.ok(w)
+		return
+	}
+	parent.Nodes = append(parent.Nodes, newElement(params))
+	g.ok(w)
+}
+
+// delete removes an element, or one of its attributes with attr=
+func (g *fakeGateway) delete(w http.ResponseWriter, r *http.Request, params url.Values, body []byte) {
+	root, n := g.lookup(w, params, "path")
+	if n == nil {
+		return
+	}
+	if name := params.Get("attr"); name != "" {
+		for i := range n.Attrs {
+			if n.Attrs[i].Name.Local == name {
+				n.Attrs = append(n.Attrs[:i], n.Attrs[i+1:]...)
+				g.ok(w)
+				return
+			}
+		}
+		g.fail(w, http.StatusNotFound, "ATTR_NOT_FOUND", "attribute not found")
+		return
+	}
+	if err := removeNode(root, n); err != nil {
+		g.fail(w, http.StatusBadRequest, "", err.Error())
+		return
+	}
+	g.ok(w)
+}
+
+// deleteBulk removes several elements, each path evaluated after the
+// deletions before it
+func (g *fakeGateway) deleteBulk(w http.ResponseWriter, r *http.Request, params url.Values, body []byte) {
+	root := g.files[params.Get("deviceid")][params.Get("filename")]
+	if root == nil {
+		g.fail(w, http.StatusNotFound, "NOT_FOUND", "file not found")
+		return
+	}
+	work := root.Clone()
+	for _, path := range params["path"] {
+		n := fakeFind(work, path, params)
+		if n == nil {
+			g.fail(w, http.StatusNotFound, "NOT_FOUND", "node not found: "+path)
+			return
+		}
+		if err := removeNode(work, n); err != nil {
+			g.fail(w, http.StatusBadRequest, "", err.Error())
+			return
+		}
+	}
+	g.store(params.Get("deviceid"), params.Get("filename"), work)
+	g.ok(w)
+}
+
+// removeNode removes n from the tree rooted at root
+func removeNode(root, n *Node) error {
+	if n == root {
+		return fmt.Errorf("cannot delete the root element")
+	}
+	stack := []*Node{root}
+	for len(stack) > 0 {
+		parent := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for i := range parent.Nodes {
+			if &parent.Nodes[i] == n {
+				parent.Nodes = append(parent.Nodes[:i], parent.Nodes[i+1:]...)
+				return nil
+			}
+			stack = append(stack, &parent.Nodes[i])
+		}
+	}
+	return fmt.Errorf("node not in tree")
+}
+
+// mustXML renders n as a compact XML document for comparisons
+func mustXML(t testing.TB, n *Node) string {
+	t.Helper()
+	var b strings.Builder
+	if err := n.ToXML(&b, MarshalOptions{}); err != nil {
+		t.Fatalf("ToXML: %v", err)
+	}
+	return b.String()
+}
+
+// sortChildren stably sorts the element children of a node, leaving
+// comments in place
+func (g *fakeGateway) sortChildren(w http.ResponseWriter, r *http.Request, params url.Values, body []byte) {
+	_, n := g.lookup(w, params, "parent_path")
+	if n == nil {
+		return
+	}
+	// sortValue is what a child is ordered by: present values first,
+	// numbers before text
+	type sortValue struct {
+		missing bool
+		text    bool
+		number  float64
+		value   string
+	}
+	valueOf := func(child *Node) sortValue {
+		v, ok := child.Value, true
+		switch params.Get("key") {
+		case "tag":
+			return sortValue{text: true, value: child.XMLName.Local}
+		case "value":
+			return sortValue{text: true, value: child.Value}
+		case "attr":
+			v, ok = child.Attr(params.Get("attr"))
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return sortValue{missing: !ok, text: err != nil, number: f, value: v}
+	}
+	less := func(a, b sortValue) bool {
+		switch {
+		case a.missing != b.missing:
+			return b.missing
+		case a.text != b.text:
+			return b.text
+		case !a.text && a.number != b.number:
+			return a.number < b.number
+		}
+		return a.value < b.value
+	}
+
+	var slots []int
+	var elements []Node
+	for i := range n.Nodes {
+		if n.Nodes[i].Kind == NodeElement {
+			slots = append(slots, i)
+			elements = append(elements, n.Nodes[i])
+		}
+	}
+	desc := params.Get("order") == "desc"
+	sort.SliceStable(elements, func(i, j int) bool {
+		if desc {
+			return less(valueOf(&elements[j]), valueOf(&elements[i]))
+		}
+		return less(valueOf(&elements[i]), valueOf(&elements[j]))
+	})
+	for k, i := range slots {
+		n.Nodes[i] = elements[k]
+	}
+	g.ok(w)
+}
+
+// reorder moves the children of a node to the positions given by order
+func (g *fakeGateway) reorder(w http.ResponseWriter, r *http.Request, params url.Values, body []byte) {
+	_, n := g.lookup(w, params, "parent_path")
+	if n == nil {
+		return
+	}
+	order := params["order"]
+	if len(order) != len(n.Nodes) {
+		g.fail(w, http.StatusBadRequest, "", "order does not name every child")
+		return
+	}
+	reordered := make([]Node, len(order))
+	for i, from := range order {
+		k, err := strconv.Atoi(from)
+		if err != nil || k < 0 || k >= len(n.Nodes) {
+			g.fail(w, http.StatusBadRequest, "", "bad position "+from)
+			return
+		}
+		reordered[i] = n.Nodes[k]
+	}
+	n.Nodes = reordered
+	g.ok(w)
+}
+
+// replace replaces a node with the XML fragment in the body
+func (g *fakeGateway) replace(w http.ResponseWriter, r *http.Request, params url.Values, body []byte) {
+	_, n := g.lookup(w, params, "path")
+	if n == nil {
+		return
+	}
+	replacement, err := ParseXML(strings.NewReader(string(body)))
+	if err != nil {
+		g.fail(w, http.StatusBadRequest, "", err.Error())
+		return
+	}
+	*n = *replacement
+	g.ok(w)
+}
@@ -2,19 +2,103 @@ package xmlapi
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"sync"
+	"time"
 )
 
 // Client represents the API client
 type Client struct {
-	apiKey  string
-	token   string
-	baseURL string
+	apiKey      string
+	baseURL     string
+	credentials CredentialsProvider
+	auth        authProvider
+	httpClient  *http.Client
+	transport   *http.Transport
+
+	logger        Logger
+	skewTolerance time.Duration
+
+	debug            bool
+	timeout          time.Duration
+	endpointTimeouts map[string]time.Duration
+
+	strictDecoding bool
+	acceptXML      bool
+	legacyForm     bool
+	softDelete     bool
+	inFileTags     bool
+
+	limiter     *rateLimiter
+	cache       *readCache
+	metrics     func(Metric)
+	failureDump *failureDumper
+	slow        *slowRequests
+
+	requestStats func(RequestStats)
+	compression  *requestCompression
+	encryption   *fieldCipher
+
+	valueCompression bool
+	valueMinSize     int
+
+	maxRetries  int
+	retryAll    bool
+	backoff     BackoffStrategy
+	retryBudget time.Duration
+
+	// perDevice selects device-bound tokens, cached in deviceTokens
+	perDevice bool
+
+	signingSecret []byte
+	signingHeader string
+
+	namespaces map[string]string
+	prefix     apiPrefix
+
+	// upserts serializes this client's client-side upserts of the same node
+	upserts pathLocks
+
+	// configErr reports conflicting options; every request fails with it
+	configErr error
+
+	// tokenMu guards the fields below; it is never held across a request
+	tokenMu      sync.Mutex
+	token        string
+	issued       time.Time
+	expires      time.Time
+	scopes       []string
+	granted      []string
+	skew         time.Duration
+	deviceTokens map[string]cachedToken
+
+	// authMu guards authCalls, the authorizations in progress by device
+	authMu    sync.Mutex
+	authCalls map[string]*authCall
+
+	// tokenChanged wakes the background refresher when a token is replaced
+	tokenChanged chan struct{}
+
+	// noAutoReauth disables re-authorizing after a 401, see WithAutoReauth
+	noAutoReauth bool
+
+	backgroundRefresh bool
+	closeOnce         sync.Once
+	closed            chan struct{}
+	closeCtx          context.Context
+	cancelClose       context.CancelFunc
+
+	// background counts the goroutines Close waits for; backgroundMu orders
+	// their registration with Close
+	backgroundMu sync.Mutex
+	background   sync.WaitGroup
 }
 
 // XMLName represents the name of an XML element
@@ -23,57 +107,214 @@ type XMLName struct {
 	Local string `json:"Local"`
 }
 
+// Attr represents an attribute of an XML element
+type Attr struct {
+	Name  XMLName `json:"Name"`
+	Value string  `json:"Value"`
+}
+
 // Node represents a node in the XML structure
 type Node struct {
-	XMLName XMLName `json:"XMLName"`
-	Value   string  `json:"Value"`
-	Nodes   []Node  `json:"Nodes"`
+	Kind    NodeKind `json:"Kind,omitempty"`
+	XMLName XMLName  `json:"XMLName"`
+	Attrs   []Attr   `json:"Attrs,omitempty"`
+	Value   string   `json:"Value"`
+	Nodes   []Node   `json:"Nodes"`
+
+	// RawValue is the text exactly as stored by the gateway, still escaped for
+	// ValueText nodes; Value holds the unescaped text. It is empty for values
+	// the client decrypted or expanded.
+	RawValue  string    `json:"RawValue,omitempty"`
+	ValueKind ValueKind `json:"ValueKind,omitempty"`
+
+	// Meta is only set by reads made with WithNodeMeta. It is not content:
+	// Diff, Flatten, ToMap and the XML marshalers ignore it.
+	Meta *NodeMeta `json:"Meta,omitempty"`
+}
+
+// Attr returns the value of the named attribute and whether it is present
+func (n *Node) Attr(name string) (string, bool) {
+	if n == nil {
+		return "", false
+	}
+	for _, attr := range n.Attrs {
+		if attr.Name.Local == name {
+			return attr.Value, true
+		}
+	}
+	return "", false
 }
 
 // APIResponse represents a general API response
 type APIResponse struct {
 	Status string `json:"status"`
 	Error  string `json:"error"`
+
+	// Code and Details are sent by newer firmware, e.g. "FILE_LOCKED" with
+	// {"lockedBy": "tech-laptop"}
+	Code    string                 `json:"code,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// err returns the error an APIResponse reports. Without a code it is a plain
+// error with the message, as older firmware reports it; with one it is an
+// *APIError carrying the code and details.
+func (r *APIResponse) err(statusCode int) error {
+	if r.Code == "" {
+		return errors.New(r.Error)
+	}
+	return &APIError{StatusCode: statusCode, Message: r.Error, Code: r.Code, Details: r.Details}
 }
 
 // FileList represents the response structure for the listFile endpoint
 type FileList struct {
 	Files []string `json:"files"`
+	// Next is the cursor of the following page when the gateway pages the list
+	Next string `json:"next,omitempty"`
 }
 
 // AuthorizationResponse represents the response structure for the authorize endpoint
 type AuthorizationResponse struct {
-	Expires string `json:"expires"`
-	Token   string `json:"token"`
+	Expires string   `json:"expires"`
+	Token   string   `json:"token"`
+	Scopes  []string `json:"scopes"`
 }
 
 // Response wraps the API response and status code
 type Response struct {
 	StatusCode int
+	Header     http.Header
 	Body       []byte
+
+	// op is the operation that produced the response
+	op *operation
 }
 
-// NewClient creates a new XMLAPI client
-func NewClient(apiKey, baseURL string) *Client {
-	return &Client{apiKey: apiKey, baseURL: baseURL}
+// NewClient creates a new XMLAPI client. Conflicting options are reported
+// by the first request.
+func NewClient(apiKey, baseURL string, opts ...Option) *Client {
+	c := &Client{
+		apiKey:        apiKey,
+		baseURL:       baseURL,
+		credentials:   staticCredentials(apiKey),
+		transport:     newTransport(),
+		logger:        log.Default(),
+		skewTolerance: defaultSkewTolerance,
+		backoff:       defaultBackoff(),
+		tokenChanged:  make(chan struct{}, 1),
+		closed:        make(chan struct{}),
+	}
+	c.closeCtx, c.cancelClose = context.WithCancel(context.Background())
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.httpClient = &http.Client{Transport: c.transport}
+	if c.auth == nil {
+		c.auth = &keyTokenAuth{c}
+	}
+	if _, ok := c.auth.(*basicAuth); ok && apiKey != "" {
+		c.configErr = errors.New("xmlapi: basic auth cannot be combined with an API key")
+	}
+	if c.backgroundRefresh && c.configErr == nil {
+		c.background.Add(1)
+		go c.refreshLoop()
+	}
+	return c
 }
 
-// request is a helper function to make an HTTP request
-func (c *Client) request(method, endpoint string, params map[string]string, body interface{}) (*Response, error) {
-	url := fmt.Sprintf("%s%s", c.baseURL, endpoint)
+// requestContext is a helper function to make an HTTP request, carrying
+// ctx and the call options in it to the HTTP request and any re-authorization
+func (c *Client) requestContext(ctx context.Context, method, endpoint string, params map[string]string, body interface{}) (*Response, error) {
+	return c.requestHeader(ctx, method, endpoint, params, body, nil)
+}
 
-	var jsonBody []byte
-	var err error
-	if body != nil {
-		jsonBody, err = json.Marshal(body)
-		if err != nil {
-			return nil, err
+// requestHeader is like requestContext but also sends the given headers.
+// Errors are annotated with the operation; so is the response, for errors
+// found while decoding it.
+func (c *Client) requestHeader(ctx context.Context, method, endpoint string, params map[string]string, body interface{}, header http.Header) (*Response, error) {
+	return c.call(ctx, method, endpoint, params, nil, body, header)
+}
+
+// requestMulti is like requestContext but also sends the repeated
+// parameters in multi, e.g. path=/a&path=/b
+func (c *Client) requestMulti(ctx context.Context, method, endpoint string, params map[string]string, multi url.Values, body interface{}) (*Response, error) {
+	return c.call(ctx, method, endpoint, params, multi, body, nil)
+}
+
+// call implements requestHeader and requestMulti
+func (c *Client) call(ctx context.Context, method, endpoint string, params map[string]string, multi url.Values, body interface{}, header http.Header) (*Response, error) {
+	op := newOperation(ctx, method, endpoint, params)
+	callCtx, cancel := c.withClose(ctx)
+	defer cancel()
+	cfg := requestConfig(ctx)
+	if cfg.timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		callCtx, cancelTimeout = context.WithTimeout(callCtx, cfg.timeout)
+		defer cancelTimeout()
+	}
+	header = withCallHeader(header, cfg.header)
+	resp, err := c.doRequest(callCtx, method, endpoint, params, multi, body, header)
+	err = c.closedErr(ctx, err)
+	if resp != nil {
+		resp.op = op
+	}
+	if err != nil {
+		return resp, op.wrap(err)
+	}
+	return resp, nil
+}
+
+// doRequest implements call
+func (c *Client) doRequest(ctx context.Context, method, endpoint string, params map[string]string, multi url.Values, body interface{}, header http.Header) (resp *Response, err error) {
+	if err := c.usable(); err != nil {
+		return nil, err
+	}
+
+	// The retry budget bounds every attempt, re-authorization and backoff
+	// sleep of this call
+	callCtx := ctx
+	if c.retryBudget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.retryBudget)
+		defer cancel()
+	}
+
+	url := c.endpointURL(endpoint)
+	params = c.namespaceParams(params, multi)
+	deviceID := params["deviceid"]
+
+	// Anything but a read may change files, whether or not it succeeds
+	if c.cache != nil && method != "GET" {
+		defer c.cache.invalidateWrite(endpoint, params)
+	}
+
+	// Bodies are JSON unless given raw, with their own content type, or
+	// carrying the parameters as a legacy form
+	var payload []byte
+	contentType := "application/json"
+	query, queryMulti := params, multi
+	switch b := body.(type) {
+	case rawBody:
+		payload, contentType = b.data, b.contentType
+	default:
+		if c.formEncoded(method, body) {
+			payload, contentType = formBody(params, multi, body), "application/x-www-form-urlencoded"
+			query, queryMulti = nil, nil
+		} else if body != nil {
+			payload, err = json.Marshal(body)
+			if err != nil {
+				return nil, err
+			}
 		}
 	}
+	compressed, err := c.compressBody(payload)
+	if err != nil {
+		return nil, err
+	}
 
 	// Function to create a new request
-	newRequest := func() (*http.Request, error) {
-		req, err := http.NewRequest(method, url, nil)
+	newRequest := func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, method, url, nil)
 		if err != nil {
 			return nil, err
 		}
@@ -81,133 +322,265 @@ func (c *Client) request(method, endpoint string, params map[string]string, body
 		// Set headers
 		if endpoint == "/authorize" {
 			req.Header.Set("Authorization", c.apiKey)
+		} else if endpoint == "/revoke" {
+			// A token is revoked with itself, never a newly authorized one
+			req.Header.Set("Authorization", params["token"])
 		} else {
-			req.Header.Set("Authorization", c.token)
+			if err := c.auth.setAuthorization(ctx, req, deviceID); err != nil {
+				return nil, err
+			}
+			// Authorizing may have detected the API prefix
+			if current := c.endpointURL(endpoint); current != req.URL.String() {
+				req.URL, err = req.URL.Parse(current)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Accept", acceptHeader)
+		for key, values := range header {
+			req.Header[key] = values
 		}
-		req.Header.Set("Content-Type", "application/json")
 
 		// Add query parameters
 		q := req.URL.Query()
-		for key, value := range params {
+		for key, value := range query {
 			q.Add(key, value)
 		}
+		for key, values := range queryMulti {
+			for _, value := range values {
+				q.Add(key, value)
+			}
+		}
 		req.URL.RawQuery = q.Encode()
 
 		// Add body if present
-		if body != nil {
-			req.Body = io.NopCloser(bytes.NewBuffer(jsonBody))
+		var sent []byte
+		if payload != nil {
+			sent = payload
+			if c.compressing(compressed) {
+				sent = compressed
+				req.Header.Set("Content-Encoding", "gzip")
+			}
+			req.Body = io.NopCloser(bytes.NewReader(sent))
+			req.ContentLength = int64(len(sent))
+			req.GetBody = func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(sent)), nil
+			}
 		}
 
+		c.sign(req, sent)
+
 		return req, nil
 	}
 
-	// First request attempt
-	req, err := newRequest()
+	record := c.newFailureRecord(payload)
+	newRequest = record.capture(newRequest)
+	callStart := time.Now()
+	attempts := 0
+	defer func() {
+		c.finishFailureRecord(record, resp, err)
+		c.observeDuration(endpoint, deviceID, callStart, attempts, resp)
+		captureResponse(ctx, resp, attempts)
+	}()
+
+	redialed, reauthed := false, false
+	for attempt := 1; ; attempt++ {
+		attempts = attempt
+		start := time.Now()
+		resp, err = c.send(ctx, newRequest, url, endpoint, deviceID, attempt, &reauthed)
+		if c.rejectCompression(compressed, resp) {
+			resp, err = c.send(ctx, newRequest, url, endpoint, deviceID, attempt, &reauthed)
+		}
+		// A read whose connection the gateway dropped while idle gets one
+		// immediate retry, even with retries disabled
+		if !redialed && ctx.Err() == nil && safeMethod(method) && connectionDropped(err) {
+			redialed = true
+			record.attempt(start, resp, err)
+			start = time.Now()
+			resp, err = c.send(ctx, newRequest, url, endpoint, deviceID, attempt, &reauthed)
+		}
+		record.attempt(start, resp, err)
+		if err != nil && ctx.Err() != nil && callCtx.Err() == nil {
+			return resp, budgetExhausted(attempt, err)
+		}
+		if err == nil || attempt > c.maxRetries || !c.shouldRetry(method, err) {
+			return resp, err
+		}
+
+		delay := c.backoff.NextDelay(attempt)
+		if deadline, ok := ctx.Deadline(); ok && c.retryBudget > 0 && time.Until(deadline) < delay && callCtx.Err() == nil {
+			return resp, budgetExhausted(attempt, err)
+		}
+		if !sleepContext(ctx, delay) {
+			if callCtx.Err() == nil {
+				return resp, budgetExhausted(attempt, err)
+			}
+			return resp, err
+		}
+	}
+}
+
+// budgetExhausted wraps the last error of a call that ran out of retry budget
+func budgetExhausted(attempts int, err error) error {
+	return fmt.Errorf("%w after %d attempts: %w", ErrRetryBudgetExhausted, attempts, err)
+}
+
+// send performs one attempt of a request, re-authorizing and repeating it
+// if the token is rejected and the call has not re-authorized yet, as
+// recorded in reauthed
+func (c *Client) send(ctx context.Context, newRequest func(context.Context) (*http.Request, error), url, endpoint, deviceID string, attempt int, reauthed *bool) (result *Response, err error) {
+	stats := c.newAttemptStats(endpoint, deviceID, attempt)
+	defer func() {
+		c.reportAttemptStats(stats, result, err)
+	}()
+
+	if c.limiter != nil {
+		if err := c.limiter.wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	parent := ctx
+	timeout := c.timeoutFor(ctx, endpoint)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	req, err := newRequest(ctx)
 	if err != nil {
 		return nil, err
 	}
+	req = stats.trace(req)
+	if c.debug {
+		c.logger.Printf("%s %s (timeout %s)", req.Method, url, formatTimeout(timeout))
+	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
-		return nil, err
+		return nil, attemptTimeout(parent, req, err)
 	}
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
 		if err != nil {
-			log.Println("Error closing body:", err)
+			c.logger.Printf("Error closing body: %v", err)
 		}
 	}(resp.Body)
 
-	respBody, err := io.ReadAll(resp.Body)
+	respBody, err := readBody(ctx, resp.Body)
 	if err != nil {
-		return nil, err
+		return nil, attemptTimeout(parent, req, transportError(req, err))
 	}
+	stats.received(respBody)
 
 	// Check if the response status code is 401 (Unauthorized)
-	if resp.StatusCode == http.StatusUnauthorized {
-		// Obtain a new token using the Authorize method
-		err := c.Authorize()
+	if resp.StatusCode == http.StatusUnauthorized && c.reauthAllowed(endpoint) && !*reauthed {
+		*reauthed = true
+
+		// Obtain a new token, evicting the rejected one
+		err := c.auth.refresh(ctx, deviceID)
 		if err != nil {
-			return nil, err
+			return nil, reauthFailed(err)
 		}
 
 		// Retry the request with the new token
-		req, err = newRequest()
+		req, err = newRequest(ctx)
 		if err != nil {
 			return nil, err
 		}
-		req.Header.Set("Authorization", c.token)
-		resp, err = client.Do(req)
+		req = stats.trace(req)
+		resp, err = c.do(req)
 		if err != nil {
-			return nil, err
+			return nil, attemptTimeout(parent, req, err)
 		}
 		defer func(Body io.ReadCloser) {
 			err := Body.Close()
 			if err != nil {
-				log.Println("Error closing body:", err)
+				c.logger.Printf("Error closing body: %v", err)
 			}
 		}(resp.Body)
 
-		respBody, err = io.ReadAll(resp.Body)
+		respBody, err = readBody(ctx, resp.Body)
 		if err != nil {
-			return nil, err
+			return nil, attemptTimeout(parent, req, transportError(req, err))
 		}
+		stats.received(respBody)
 	}
 
 	if resp.StatusCode >= 400 {
-		log.Printf("Request to %s failed with status: %d, response: %s", url, resp.StatusCode, respBody)
-		return &Response{StatusCode: resp.StatusCode, Body: respBody}, errors.New(string(respBody))
+		c.logger.Printf("Request to %s failed with status: %d, response: %s", url, resp.StatusCode, respBody)
+		return &Response{StatusCode: resp.StatusCode, Header: resp.Header, Body: respBody}, newAPIError(resp.StatusCode, resp.Header, respBody)
 	}
 
-	return &Response{StatusCode: resp.StatusCode, Body: respBody}, nil
+	return &Response{StatusCode: resp.StatusCode, Header: resp.Header, Body: respBody}, nil
 }
 
-// Authorize authorizes the client and obtains a token
-func (c *Client) Authorize() error {
-	url := fmt.Sprintf("%s%s", c.baseURL, "/authorize")
-	req, err := http.NewRequest("GET", url, nil)
+// statusRequestContext makes a request whose response is a plain
+// APIResponse and returns its status
+func (c *Client) statusRequestContext(ctx context.Context, method, endpoint string, params map[string]string, body interface{}) (string, error) {
+	resp, err := c.requestContext(ctx, method, endpoint, params, body)
 	if err != nil {
-		return err
+		return "", err
 	}
+	return c.status(resp)
+}
 
-	req.Header.Set("Authorization", c.apiKey)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// status decodes a plain APIResponse and returns its status
+func (c *Client) status(resp *Response) (string, error) {
+	var result APIResponse
+	err := c.decode(resp, &result)
 	if err != nil {
-		return err
+		return "", err
 	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			log.Println("Error closing body:", err)
-		}
-	}(resp.Body)
 
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return err
+	if result.Error != "" {
+		return "", resp.op.wrap(result.err(resp.StatusCode))
 	}
 
-	if resp.StatusCode >= 400 {
-		log.Printf("Authorization request failed with status: %d, response: %s", resp.StatusCode, respBody)
-		return errors.New(string(respBody))
+	return result.Status, nil
+}
+
+// CopyDevice copies a device. When the gateway runs the copy as a job,
+// CopyDevice waits for it and returns the job's final status.
+func (c *Client) CopyDevice(deviceID, newDeviceID, filename string, overwrite bool, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "CopyDevice", opts, deviceID, filename, nil)
+	defer op.finish(&err)
+
+	status, job, err := c.copyDevice(ctx, deviceID, newDeviceID, filename, overwrite)
+	if err != nil || job == nil {
+		return status, err
 	}
 
-	var result AuthorizationResponse
-	err = json.Unmarshal(respBody, &result)
+	job, err = c.WaitForJob(ctx, job.ID, defaultJobPoll)
 	if err != nil {
-		return err
+		return "", err
 	}
+	return job.Status, nil
+}
+
+// CopyDeviceAsync copies a device without waiting for a job the gateway
+// runs the copy as. If the gateway copied synchronously, the returned job
+// is already JobCompleted and has no ID.
+func (c *Client) CopyDeviceAsync(deviceID, newDeviceID, filename string, overwrite bool, opts ...RequestOption) (_ *Job, err error) {
+	ctx, op := startOp(context.Background(), "CopyDeviceAsync", opts, deviceID, filename, nil)
+	defer op.finish(&err)
 
-	c.token = result.Token
-	return nil
+	status, job, err := c.copyDevice(ctx, deviceID, newDeviceID, filename, overwrite)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		job = &Job{DeviceID: deviceID, Operation: "copyDevice", State: JobCompleted, Progress: 100, Status: status}
+	}
+	return job, nil
 }
 
-// CopyDevice copies a device
-func (c *Client) CopyDevice(deviceID, newDeviceID, filename string, overwrite bool) (string, error) {
+// copyDevice implements CopyDevice and CopyDeviceAsync, returning either
+// the final status or the job the gateway started
+func (c *Client) copyDevice(ctx context.Context, deviceID, newDeviceID, filename string, overwrite bool) (string, *Job, error) {
 	params := map[string]string{
 		"deviceid":     deviceID,
 		"new_deviceid": newDeviceID,
@@ -215,173 +588,452 @@ func (c *Client) CopyDevice(deviceID, newDeviceID, filename string, overwrite bo
 		"overwrite":    fmt.Sprintf("%t", overwrite),
 	}
 
-	resp, err := c.request("POST", "/copyDevice", params, nil)
-	if err != nil {
-		return "", err
-	}
-
-	var result APIResponse
-	err = json.Unmarshal(resp.Body, &result)
+	resp, err := c.requestContext(ctx, "POST", "/copyDevice", params, nil)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
-	if result.Error != "" {
-		return "", errors.New(result.Error)
+	job, err := c.jobFromResponse(resp)
+	if err != nil || job != nil {
+		return "", job, err
 	}
 
-	return result.Status, nil
+	status, err := c.status(resp)
+	return status, nil, err
 }
 
 // CreateFile creates a new XML file
-func (c *Client) CreateFile(deviceID, filename, rootName string) (string, error) {
+func (c *Client) CreateFile(deviceID, filename, rootName string, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "CreateFile", opts, deviceID, filename, nil)
+	defer op.finish(&err)
+
+	return c.createFile(ctx, deviceID, filename, rootName)
+}
+
+// createFile implements CreateFile, carrying ctx
+func (c *Client) createFile(ctx context.Context, deviceID, filename, rootName string) (string, error) {
 	params := map[string]string{
 		"deviceid": deviceID,
 		"filename": filename,
 		"rootname": rootName,
 	}
 
-	resp, err := c.request("POST", "/createFile", params, nil)
+	return c.statusRequestContext(ctx, "POST", "/createFile", params, nil)
+}
+
+// CreateNode creates a new node in the XML file
+func (c *Client) CreateNode(deviceID, filename string, parentPath PathLike, tag, value string, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "CreateNode", opts, deviceID, filename, parentPath)
+	defer op.finish(&err)
+
+	parentStr, err := PathString(parentPath)
 	if err != nil {
 		return "", err
 	}
+	return c.createNode(ctx, deviceID, filename, parentStr, tag, value)
+}
 
-	var result APIResponse
-	err = json.Unmarshal(resp.Body, &result)
+// createNode implements CreateNode, carrying ctx
+func (c *Client) createNode(ctx context.Context, deviceID, filename, parentPath, tag, value string) (string, error) {
+	value, err := c.encodeValue(ctx, childValuePath(parentPath, tag), value)
 	if err != nil {
 		return "", err
 	}
-
-	if result.Error != "" {
-		return "", errors.New(result.Error)
+	params := map[string]string{
+		"deviceid":    deviceID,
+		"filename":    filename,
+		"parent_path": parentPath,
+		"tag":         tag,
+		"value":       value,
 	}
 
-	return result.Status, nil
+	return c.statusRequestContext(ctx, "POST", "/create", params, nil)
 }
 
-// CreateNode creates a new node in the XML file
-func (c *Client) CreateNode(deviceID, filename, parentPath, tag, value string) (string, error) {
+// CreateNodeCDATA creates a new node whose value the server wraps in a CDATA section
+func (c *Client) CreateNodeCDATA(deviceID, filename string, parentPath PathLike, tag, value string, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "CreateNodeCDATA", opts, deviceID, filename, parentPath)
+	defer op.finish(&err)
+
+	parentStr, err := PathString(parentPath)
+	if err != nil {
+		return "", err
+	}
+	value, err = c.encodeValue(ctx, childValuePath(parentStr, tag), value)
+	if err != nil {
+		return "", err
+	}
 	params := map[string]string{
 		"deviceid":    deviceID,
 		"filename":    filename,
-		"parent_path": parentPath,
+		"parent_path": parentStr,
 		"tag":         tag,
 		"value":       value,
+		"cdata":       "true",
 	}
 
-	resp, err := c.request("POST", "/create", params, nil)
+	return c.statusRequestContext(ctx, "POST", "/create", params, nil)
+}
+
+// CreateNodeNS creates a new namespaced node in the XML file. If a prefix is
+// registered for space with WithNamespace the element is created with that
+// prefix, otherwise space becomes the element's default namespace.
+func (c *Client) CreateNodeNS(deviceID, filename string, parentPath PathLike, space, local, value string, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "CreateNodeNS", opts, deviceID, filename, parentPath)
+	defer op.finish(&err)
+
+	parentStr, err := PathString(parentPath)
 	if err != nil {
 		return "", err
 	}
-
-	var result APIResponse
-	err = json.Unmarshal(resp.Body, &result)
+	value, err = c.encodeValue(ctx, childValuePath(parentStr, local), value)
 	if err != nil {
 		return "", err
 	}
+	params := map[string]string{
+		"deviceid":    deviceID,
+		"filename":    filename,
+		"parent_path": parentStr,
+		"namespace":   space,
+		"tag":         local,
+		"value":       value,
+	}
+	if prefix, ok := c.prefixFor(space); ok {
+		params["prefix"] = prefix
+	}
 
-	if result.Error != "" {
-		return "", errors.New(result.Error)
+	return c.statusRequestContext(ctx, "POST", "/create", params, nil)
+}
+
+// CreateComment creates a new comment node in the XML file
+func (c *Client) CreateComment(deviceID, filename string, parentPath PathLike, text string, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "CreateComment", opts, deviceID, filename, parentPath)
+	defer op.finish(&err)
+
+	parentStr, err := PathString(parentPath)
+	if err != nil {
+		return "", err
+	}
+	params := map[string]string{
+		"deviceid":    deviceID,
+		"filename":    filename,
+		"parent_path": parentStr,
+		"kind":        "comment",
+		"value":       text,
 	}
 
-	return result.Status, nil
+	return c.statusRequestContext(ctx, "POST", "/create", params, nil)
 }
 
 // DeleteNode deletes a node in the XML file
-func (c *Client) DeleteNode(deviceID, filename, path string) (string, error) {
+func (c *Client) DeleteNode(deviceID, filename string, path PathLike, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "DeleteNode", opts, deviceID, filename, path)
+	defer op.finish(&err)
+
+	pathStr, err := PathString(path)
+	if err != nil {
+		return "", err
+	}
+	return c.deleteNode(ctx, deviceID, filename, pathStr)
+}
+
+// deleteNode implements DeleteNode, carrying ctx
+func (c *Client) deleteNode(ctx context.Context, deviceID, filename, path string) (string, error) {
 	params := map[string]string{
 		"deviceid": deviceID,
 		"filename": filename,
 		"path":     path,
 	}
 
-	resp, err := c.request("DELETE", "/delete", params, nil)
+	return c.statusRequestContext(ctx, "DELETE", "/delete", params, nil)
+}
+
+// DeleteFile deletes an XML file. With WithSoftDeleteDefault it is moved to
+// the trash instead, unless Permanent is passed.
+func (c *Client) DeleteFile(deviceID, filename string, opts ...DeleteOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "DeleteFile", nil, deviceID, filename, nil)
+	defer op.finish(&err)
+
+	cfg := deleteConfig{trash: c.softDelete}
+	for _, opt := range opts {
+		opt.applyDelete(&cfg)
+	}
+	ctx = withRequestOptions(ctx, cfg.call)
+	if cfg.trash {
+		return c.trashFile(ctx, deviceID, filename)
+	}
+	return c.deleteFile(ctx, deviceID, filename)
+}
+
+// deleteFile implements DeleteFile, carrying ctx
+func (c *Client) deleteFile(ctx context.Context, deviceID, filename string) (string, error) {
+	params := map[string]string{
+		"deviceid": deviceID,
+		"filename": filename,
+	}
+
+	return c.statusRequestContext(ctx, "DELETE", "/deleteFile", params, nil)
+}
+
+// ListFiles lists all XML files for a device
+func (c *Client) ListFiles(deviceID string, opts ...RequestOption) (_ []string, err error) {
+	ctx, op := startOp(context.Background(), "ListFiles", opts, deviceID, "", nil)
+	defer op.finish(&err)
+
+	return c.listFiles(ctx, deviceID)
+}
+
+// listFiles implements ListFiles, carrying ctx
+func (c *Client) listFiles(ctx context.Context, deviceID string) ([]string, error) {
+	params := map[string]string{
+		"deviceid": deviceID,
+	}
+
+	resp, err := c.requestContext(ctx, "GET", "/listFile", params, nil)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	var result APIResponse
-	err = json.Unmarshal(resp.Body, &result)
+	var result FileList
+	err = c.decode(resp, &result)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	if result.Error != "" {
-		return "", errors.New(result.Error)
+	return result.Files, nil
+}
+
+// ReadNode reads a node from the XML file
+func (c *Client) ReadNode(deviceID, filename string, path PathLike, opts ...RequestOption) (_ *Node, err error) {
+	ctx, op := startOp(context.Background(), "ReadNode", opts, deviceID, filename, path)
+	defer op.finish(&err)
+
+	pathStr, err := PathString(path)
+	if err != nil {
+		return nil, err
 	}
+	return c.readNodeWith(ctx, deviceID, filename, pathStr)
+}
 
-	return result.Status, nil
+// readNode implements ReadNode, carrying ctx and serving from the read cache
+func (c *Client) readNode(ctx context.Context, deviceID, filename, path string) (*Node, error) {
+	if c.cache == nil {
+		node, _, err := c.fetchNode(ctx, deviceID, filename, path, "", false)
+		return node, err
+	}
+
+	key := cacheKey{deviceID, filename, path}
+	cached, etag, fresh := c.cache.get(key)
+	if fresh {
+		c.metric(Metric{Name: MetricCacheHit, Endpoint: "/read", DeviceID: deviceID})
+		return cached, nil
+	}
+
+	// An expired entry with an ETag is revalidated rather than read again
+	node, newETag, err := c.fetchNode(ctx, deviceID, filename, path, etag, false)
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		c.metric(Metric{Name: MetricCacheRevalidated, Endpoint: "/read", DeviceID: deviceID})
+		c.cache.put(key, cached, etag)
+		return cached, nil
+	}
+
+	c.metric(Metric{Name: MetricCacheMiss, Endpoint: "/read", DeviceID: deviceID})
+	c.cache.put(key, node, newETag)
+	return node, nil
 }
 
-// DeleteFile deletes an XML file
-func (c *Client) DeleteFile(deviceID, filename string) (string, error) {
+// fetchNode reads a node from the gateway along with its ETag. With a
+// non-empty etag the read is conditional, and a nil node means the node is
+// unchanged. meta asks for the node metadata.
+func (c *Client) fetchNode(ctx context.Context, deviceID, filename, path, etag string, meta bool) (*Node, string, error) {
 	params := map[string]string{
 		"deviceid": deviceID,
 		"filename": filename,
+		"path":     path,
+	}
+	if meta {
+		params["meta"] = "true"
 	}
 
-	resp, err := c.request("DELETE", "/deleteFile", params, nil)
-	if err != nil {
-		return "", err
+	header := make(http.Header)
+	if etag != "" {
+		header.Set("If-None-Match", etag)
+	}
+	if c.acceptXML {
+		header.Set("Accept", "application/xml")
 	}
 
-	var result APIResponse
-	err = json.Unmarshal(resp.Body, &result)
+	resp, err := c.requestHeader(ctx, "GET", "/read", params, nil, header)
 	if err != nil {
-		return "", err
+		return nil, "", err
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, etag, nil
 	}
 
-	if result.Error != "" {
-		return "", errors.New(result.Error)
+	var node Node
+	err = c.decode(resp, &node)
+	if err != nil {
+		return nil, "", err
+	}
+	// Values parsed from XML are already unescaped
+	if !isXMLResponse(resp) {
+		node.normalizeValues()
+	}
+	if err := c.decodeNode(ctx, path, &node); err != nil {
+		return nil, "", err
 	}
 
-	return result.Status, nil
+	return &node, resp.Header.Get("ETag"), nil
 }
 
-// ListFiles lists all XML files for a device
-func (c *Client) ListFiles(deviceID string) ([]string, error) {
+// ReadFile reads the whole XML file as a tree rooted at its root element
+func (c *Client) ReadFile(deviceID, filename string, opts ...RequestOption) (_ *Node, err error) {
+	ctx, op := startOp(context.Background(), "ReadFile", opts, deviceID, filename, nil)
+	defer op.finish(&err)
+
+	return c.readNodeWith(ctx, deviceID, filename, "/")
+}
+
+// readFile implements ReadFile, carrying ctx
+func (c *Client) readFile(ctx context.Context, deviceID, filename string) (*Node, error) {
+	return c.readNode(ctx, deviceID, filename, "/")
+}
+
+// attributeResponse represents the response of /read when called with attr=
+type attributeResponse struct {
+	Attr  *string `json:"attr"`
+	Value string  `json:"value"`
+	Found *bool   `json:"found"`
+}
+
+// GetAttribute reads a single attribute of a node in the XML file
+func (c *Client) GetAttribute(deviceID, filename string, path PathLike, name string, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "GetAttribute", opts, deviceID, filename, path)
+	defer op.finish(&err)
+
+	pathStr, err := PathString(path)
+	if err != nil {
+		return "", err
+	}
 	params := map[string]string{
 		"deviceid": deviceID,
+		"filename": filename,
+		"path":     pathStr,
+		"attr":     name,
+		"fields":   "XMLName,Attrs",
 	}
 
-	resp, err := c.request("GET", "/listFile", params, nil)
+	resp, err := c.requestContext(ctx, "GET", "/read", params, nil)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	var result FileList
-	err = json.Unmarshal(resp.Body, &result)
+	// Servers that understand attr= answer with the attribute alone; older
+	// ones ignore it and return the node, without its value if they honour
+	// the field mask. The shape is told apart first so that strict decoding
+	// does not reject either.
+	var shape map[string]json.RawMessage
+	err = c.decode(resp, &shape)
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+	if hasKey(shape, "attr") {
+		var result attributeResponse
+		err = c.decode(resp, &result)
+		if err != nil {
+			return "", err
+		}
+		if result.Found != nil && !*result.Found {
+			return "", resp.op.wrap(ErrAttrNotFound)
+		}
+		return result.Value, nil
 	}
 
-	return result.Files, nil
+	var node Node
+	err = c.decode(resp, &node)
+	if err != nil {
+		return "", err
+	}
+
+	value, ok := node.Attr(name)
+	if !ok {
+		return "", resp.op.wrap(ErrAttrNotFound)
+	}
+
+	return value, nil
 }
 
-// ReadNode reads a node from the XML file
-func (c *Client) ReadNode(deviceID, filename, path string) (*Node, error) {
+// SetAttribute sets an attribute on a node in the XML file, creating it if needed
+func (c *Client) SetAttribute(deviceID, filename string, path PathLike, name, value string, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "SetAttribute", opts, deviceID, filename, path)
+	defer op.finish(&err)
+
+	pathStr, err := PathString(path)
+	if err != nil {
+		return "", err
+	}
+	return c.setAttribute(ctx, deviceID, filename, pathStr, name, value)
+}
+
+// setAttribute implements SetAttribute, carrying ctx
+func (c *Client) setAttribute(ctx context.Context, deviceID, filename, path, name, value string) (string, error) {
 	params := map[string]string{
 		"deviceid": deviceID,
 		"filename": filename,
 		"path":     path,
+		"attr":     name,
+		"value":    value,
 	}
 
-	resp, err := c.request("GET", "/read", params, nil)
+	return c.statusRequestContext(ctx, "PUT", "/update", params, nil)
+}
+
+// DeleteAttribute removes an attribute from a node in the XML file
+func (c *Client) DeleteAttribute(deviceID, filename string, path PathLike, name string, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "DeleteAttribute", opts, deviceID, filename, path)
+	defer op.finish(&err)
+
+	pathStr, err := PathString(path)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
+	return c.deleteAttribute(ctx, deviceID, filename, pathStr, name)
+}
 
-	var node Node
-	err = json.Unmarshal(resp.Body, &node)
-	if err != nil {
-		return nil, err
+// deleteAttribute implements DeleteAttribute, carrying ctx
+func (c *Client) deleteAttribute(ctx context.Context, deviceID, filename, path, name string) (string, error) {
+	params := map[string]string{
+		"deviceid": deviceID,
+		"filename": filename,
+		"path":     path,
+		"attr":     name,
 	}
 
-	return &node, nil
+	return c.statusRequestContext(ctx, "DELETE", "/delete", params, nil)
 }
 
 // UpdateNode updates a node in the XML file
-func (c *Client) UpdateNode(deviceID, filename, path, value string) (string, error) {
+func (c *Client) UpdateNode(deviceID, filename string, path PathLike, value string, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "UpdateNode", opts, deviceID, filename, path)
+	defer op.finish(&err)
+
+	pathStr, err := PathString(path)
+	if err != nil {
+		return "", err
+	}
+	return c.updateNode(ctx, deviceID, filename, pathStr, value)
+}
+
+// updateNode implements UpdateNode, carrying ctx
+func (c *Client) updateNode(ctx context.Context, deviceID, filename, path, value string) (string, error) {
+	value, err := c.encodeValue(ctx, path, value)
+	if err != nil {
+		return "", err
+	}
 	params := map[string]string{
 		"deviceid": deviceID,
 		"filename": filename,
@@ -389,20 +1041,29 @@ func (c *Client) UpdateNode(deviceID, filename, path, value string) (string, err
 		"value":    value,
 	}
 
-	resp, err := c.request("PUT", "/update", params, nil)
+	return c.statusRequestContext(ctx, "PUT", "/update", params, nil)
+}
+
+// UpdateNodeCDATA updates a node in the XML file, storing the value in a CDATA section
+func (c *Client) UpdateNodeCDATA(deviceID, filename string, path PathLike, value string, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "UpdateNodeCDATA", opts, deviceID, filename, path)
+	defer op.finish(&err)
+
+	pathStr, err := PathString(path)
 	if err != nil {
 		return "", err
 	}
-
-	var result APIResponse
-	err = json.Unmarshal(resp.Body, &result)
+	value, err = c.encodeValue(ctx, pathStr, value)
 	if err != nil {
 		return "", err
 	}
-
-	if result.Error != "" {
-		return "", errors.New(result.Error)
+	params := map[string]string{
+		"deviceid": deviceID,
+		"filename": filename,
+		"path":     pathStr,
+		"value":    value,
+		"cdata":    "true",
 	}
 
-	return result.Status, nil
+	return c.statusRequestContext(ctx, "PUT", "/update", params, nil)
 }
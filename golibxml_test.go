@@ -0,0 +1,195 @@
+package xmlapi
+
+import (
+	"errors"
+	"testing"
+)
+
+const planDoc = `<plan version="3"><phase id="1" mode="fixed"><minGreen>5</minGreen></phase><phase id="2"><minGreen>7</minGreen></phase></plan>`
+
+func TestNodeRoundTrip(t *testing.T) {
+	g := newFakeGateway(t)
+	c := g.client()
+
+	if _, err := c.CreateFile("dev", "plan.xml", "plan"); err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+	if _, err := c.CreateNode("dev", "plan.xml", "/plan", "phase", ""); err != nil {
+		t.Fatalf("CreateNode: %v", err)
+	}
+	if _, err := c.CreateNode("dev", "plan.xml", Root().Join("plan", "phase"), "minGreen", "5"); err != nil {
+		t.Fatalf("CreateNode with a Path: %v", err)
+	}
+	if _, err := c.UpdateNode("dev", "plan.xml", "/plan/phase/minGreen", "6"); err != nil {
+		t.Fatalf("UpdateNode: %v", err)
+	}
+
+	n, err := c.ReadNode("dev", "plan.xml", "/plan/phase/minGreen")
+	if err != nil {
+		t.Fatalf("ReadNode: %v", err)
+	}
+	if n.Value != "6" {
+		t.Errorf("value = %q, want 6", n.Value)
+	}
+
+	if _, err := c.DeleteNode("dev", "plan.xml", "/plan/phase"); err != nil {
+		t.Fatalf("DeleteNode: %v", err)
+	}
+	if _, err := c.ReadNode("dev", "plan.xml", "/plan/phase"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("reading a deleted node: %v, want ErrNotFound", err)
+	}
+	if _, err := c.ReadNode("dev", "plan.xml", 42); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("reading an int path: %v, want ErrInvalidPath", err)
+	}
+}
+
+func TestGetAttribute(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		loose bool
+		opts  []Option
+	}{
+		{name: "attr parameter"},
+		{name: "node fallback", loose: true},
+		{name: "attr parameter strict", opts: []Option{WithStrictDecoding()}},
+		{name: "node fallback strict", loose: true, opts: []Option{WithStrictDecoding()}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := newFakeGateway(t)
+			g.loose = tc.loose
+			g.load("dev", "plan.xml", planDoc)
+			c := g.client(tc.opts...)
+
+			value, err := c.GetAttribute("dev", "plan.xml", "/plan/phase[2]", "id")
+			if err != nil || value != "2" {
+				t.Errorf("GetAttribute = %q, %v, want 2", value, err)
+			}
+
+			_, err = c.GetAttribute("dev", "plan.xml", "/plan/phase[2]", "mode")
+			if !errors.Is(err, ErrAttrNotFound) || !errors.Is(err, ErrNotFound) {
+				t.Errorf("missing attribute: %v, want ErrAttrNotFound matching ErrNotFound", err)
+			}
+
+			_, err = c.GetAttribute("dev", "plan.xml", "/plan/phase[3]", "id")
+			if !errors.Is(err, ErrNotFound) || errors.Is(err, ErrAttrNotFound) {
+				t.Errorf("missing node: %v, want ErrNotFound but not ErrAttrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestGetAttributeUsesAttrParameter(t *testing.T) {
+	g := newFakeGateway(t)
+	g.load("dev", "plan.xml", planDoc)
+	c := g.client()
+
+	if _, err := c.GetAttribute("dev", "plan.xml", "/plan", "version"); err != nil {
+		t.Fatal(err)
+	}
+	reads := g.receivedAt("/read")
+	if len(reads) != 1 {
+		t.Fatalf("%d reads, want 1", len(reads))
+	}
+	if got := reads[0].Query.Get("attr"); got != "version" {
+		t.Errorf("attr = %q, want version", got)
+	}
+	if got := reads[0].Query.Get("fields"); got != "XMLName,Attrs" {
+		t.Errorf("fields = %q, want the value-excluding mask", got)
+	}
+}
+
+func TestSetAndDeleteAttribute(t *testing.T) {
+	g := newFakeGateway(t)
+	g.load("dev", "plan.xml", planDoc)
+	c := g.client()
+
+	if _, err := c.SetAttribute("dev", "plan.xml", "/plan/phase[1]", "mode", "actuated"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.DeleteAttribute("dev", "plan.xml", "/plan", "version"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.DeleteAttribute("dev", "plan.xml", "/plan", "version"); !errors.Is(err, ErrAttrNotFound) {
+		t.Errorf("deleting a missing attribute: %v, want ErrAttrNotFound", err)
+	}
+
+	want := `<plan><phase id="1" mode="actuated"><minGreen>5</minGreen></phase><phase id="2"><minGreen>7</minGreen></phase></plan>`
+	if got := mustXML(t, g.file("dev", "plan.xml")); got != want {
+		t.Errorf("file = %s\nwant %s", got, want)
+	}
+}
+
+func TestValueRoundTrip(t *testing.T) {
+	const payload = `<script>if (a < b && c > d) alert("x&amp;y")</script>`
+
+	g := newFakeGateway(t)
+	g.load("dev", "page.xml", `<page><body/><head/></page>`)
+	c := g.client()
+
+	if _, err := c.UpdateNode("dev", "page.xml", "/page/body", payload); err != nil {
+		t.Fatal(err)
+	}
+	n, err := c.ReadNode("dev", "page.xml", "/page/body")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Value != payload || n.ValueKind != ValueText {
+		t.Fatalf("read %q (%v), want %q as text", n.Value, n.ValueKind, payload)
+	}
+	if n.RawValue != escapeText(payload, false) {
+		t.Errorf("RawValue = %q, want the escaped text", n.RawValue)
+	}
+
+	// Writing the value read back must not escape it a second time
+	if _, err := c.UpdateNode("dev", "page.xml", "/page/body", n.Value); err != nil {
+		t.Fatal(err)
+	}
+	again, err := c.ReadNode("dev", "page.xml", "/page/body")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Value != payload {
+		t.Errorf("after writing it back: %q, want %q", again.Value, payload)
+	}
+}
+
+func TestCDATARoundTrip(t *testing.T) {
+	const payload = `<script>x = a[b[0]]; if (x]]>0) {}</script>`
+
+	g := newFakeGateway(t)
+	g.load("dev", "page.xml", `<page><head/></page>`)
+	c := g.client()
+
+	if _, err := c.CreateNodeCDATA("dev", "page.xml", "/page", "body", payload); err != nil {
+		t.Fatal(err)
+	}
+	creates := g.receivedAt("/create")
+	if len(creates) != 1 || creates[0].Query.Get("cdata") != "true" {
+		t.Fatalf("create requests %+v, want one with cdata=true", creates)
+	}
+
+	n, err := c.ReadNode("dev", "page.xml", "/page/body")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Value != payload || n.RawValue != payload || n.ValueKind != ValueCDATA {
+		t.Fatalf("read %q, raw %q (%v), want %q verbatim as CDATA", n.Value, n.RawValue, n.ValueKind, payload)
+	}
+
+	if _, err := c.UpdateNodeCDATA("dev", "page.xml", "/page/head", payload); err != nil {
+		t.Fatal(err)
+	}
+	head, err := c.ReadNode("dev", "page.xml", "/page/head")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Value != payload || head.ValueKind != ValueCDATA {
+		t.Errorf("updated head %q (%v), want %q as CDATA", head.Value, head.ValueKind, payload)
+	}
+
+	// The document renders the CDATA section, split around its terminator
+	want := `<page><head><![CDATA[<script>x = a[b[0]]; if (x]]]]><![CDATA[>0) {}</script>]]></head><body><![CDATA[<script>x = a[b[0]]; if (x]]]]><![CDATA[>0) {}</script>]]></body></page>`
+	if got := mustXML(t, g.file("dev", "page.xml")); got != want {
+		t.Errorf("document %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,87 @@
+package xmlapi
+
+import (
+	"context"
+	"net/url"
+)
+
+// DeviceGroup is a named set of devices, such as the intersections of a
+// corridor. Groups are either kept by the gateway under /groups or built
+// client-side with StaticGroup.
+type DeviceGroup struct {
+	Name      string   `json:"name"`
+	DeviceIDs []string `json:"deviceids"`
+}
+
+// StaticGroup returns an unnamed group of the given devices, for use with
+// ForEachGroup on gateways without /groups
+func StaticGroup(deviceIDs ...string) DeviceGroup {
+	return DeviceGroup{DeviceIDs: append([]string(nil), deviceIDs...)}
+}
+
+// groupList represents the response of listing groups
+type groupList struct {
+	Groups []DeviceGroup `json:"groups"`
+}
+
+// CreateGroup creates a group on the gateway
+func (c *Client) CreateGroup(group DeviceGroup, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "CreateGroup", opts, "", "", nil)
+	defer op.finish(&err)
+
+	return c.statusRequestContext(ctx, "POST", "/groups", nil, group)
+}
+
+// ListGroups lists the groups kept by the gateway
+func (c *Client) ListGroups(opts ...RequestOption) (_ []DeviceGroup, err error) {
+	ctx, op := startOp(context.Background(), "ListGroups", opts, "", "", nil)
+	defer op.finish(&err)
+
+	resp, err := c.requestContext(ctx, "GET", "/groups", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result groupList
+	err = c.decode(resp, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Groups, nil
+}
+
+// AddToGroup adds devices to a group on the gateway
+func (c *Client) AddToGroup(name string, deviceIDs []string, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "AddToGroup", opts, "", "", nil)
+	defer op.finish(&err)
+
+	return c.groupMembers(ctx, "POST", name, deviceIDs)
+}
+
+// RemoveFromGroup removes devices from a group on the gateway
+func (c *Client) RemoveFromGroup(name string, deviceIDs []string, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "RemoveFromGroup", opts, "", "", nil)
+	defer op.finish(&err)
+
+	return c.groupMembers(ctx, "DELETE", name, deviceIDs)
+}
+
+// groupMembers implements AddToGroup and RemoveFromGroup
+func (c *Client) groupMembers(ctx context.Context, method, name string, deviceIDs []string) (string, error) {
+	params := map[string]string{
+		"name": name,
+	}
+	multi := url.Values{"member": deviceIDs}
+
+	resp, err := c.requestMulti(ctx, method, "/groups/members", params, multi, nil)
+	if err != nil {
+		return "", err
+	}
+	return c.status(resp)
+}
+
+// ForEachGroup runs ForEachDevice for the devices of group
+func ForEachGroup(ctx context.Context, client *Client, group DeviceGroup, concurrency int, fn func(ctx context.Context, deviceID string) error, opts ...FleetOption) *FleetResult {
+	return ForEachDevice(ctx, client, group.DeviceIDs, concurrency, fn, opts...)
+}
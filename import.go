@@ -0,0 +1,139 @@
+package xmlapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// JSONImportOption configures ImportFileJSON. Every RequestOption is a JSONImportOption too.
+type JSONImportOption interface {
+	applyJSONImport(*jsonImportConfig)
+}
+
+// jsonImportOption is a JSONImportOption setting an option of ImportFileJSON
+type jsonImportOption func(*jsonImportConfig)
+
+func (f jsonImportOption) applyJSONImport(cfg *jsonImportConfig) {
+	f(cfg)
+}
+
+// jsonImportConfig holds the options of an ImportFileJSON call
+type jsonImportConfig struct {
+	attrPrefix string
+	skipNulls  bool
+	strategy   WriteStrategy
+
+	// call holds the RequestOptions among the options
+	call []RequestOption
+}
+
+// ImportAttrPrefix turns object keys starting with prefix (e.g. "@id") into
+// attributes, pairing with JSONExportOptions.AttrPrefix. Without it only the
+// MapAttrsKey object yields attributes.
+func ImportAttrPrefix(prefix string) JSONImportOption {
+	return jsonImportOption(func(cfg *jsonImportConfig) {
+		cfg.attrPrefix = prefix
+	})
+}
+
+// ImportSkipNulls omits keys whose value is null instead of creating empty elements
+func ImportSkipNulls() JSONImportOption {
+	return jsonImportOption(func(cfg *jsonImportConfig) {
+		cfg.skipNulls = true
+	})
+}
+
+// ImportWriteStrategy selects the WriteFile strategy used to store the file;
+// the default is Replace
+func ImportWriteStrategy(strategy WriteStrategy) JSONImportOption {
+	return jsonImportOption(func(cfg *jsonImportConfig) {
+		cfg.strategy = strategy
+	})
+}
+
+// ImportFileJSON creates or replaces an XML file from a JSON object in the
+// nested map form of Node.ToMap, under a root element named rootName.
+//
+// JSON cannot say whether an array of one item is a single child or a
+// repeated group, and it makes no difference here: every array item becomes
+// one child element. Scalars become element values, numbers keep their JSON
+// spelling, and null becomes an empty element unless ImportSkipNulls is
+// given. Conversion failures are returned as a *MapError naming the JSON path.
+func (c *Client) ImportFileJSON(ctx context.Context, deviceID, filename string, r io.Reader, rootName string, opts ...JSONImportOption) (_ string, err error) {
+	ctx, op := startOp(ctx, "ImportFileJSON", nil, deviceID, filename, nil)
+	defer op.finish(&err)
+
+	var cfg jsonImportConfig
+	for _, opt := range opts {
+		opt.applyJSONImport(&cfg)
+	}
+	ctx = withRequestOptions(ctx, cfg.call)
+
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return "", fmt.Errorf("import file json: %w", err)
+	}
+	m, ok := doc.(map[string]interface{})
+	if !ok {
+		return "", &MapError{Path: "$", Err: errors.New("document must be a JSON object")}
+	}
+
+	root, err := NodeFromMap(XMLName{Local: rootName}, cfg.prepare(m))
+	if err != nil {
+		return "", err
+	}
+
+	return c.WriteFile(ctx, deviceID, filename, root, cfg.strategy)
+}
+
+// prepare rewrites prefixed attribute keys and nulls in the decoded JSON
+// into the form NodeFromMap expects
+func (cfg *jsonImportConfig) prepare(m map[string]interface{}) map[string]interface{} {
+	if cfg.attrPrefix == "" && !cfg.skipNulls {
+		return m
+	}
+
+	prepared := make(map[string]interface{}, len(m))
+	var attrs map[string]interface{}
+	for key, value := range m {
+		if value == nil && cfg.skipNulls {
+			continue
+		}
+		if cfg.attrPrefix != "" && strings.HasPrefix(key, cfg.attrPrefix) && key != MapTextKey {
+			if attrs == nil {
+				attrs = make(map[string]interface{})
+			}
+			attrs[strings.TrimPrefix(key, cfg.attrPrefix)] = value
+			continue
+		}
+		prepared[key] = cfg.prepareValue(value)
+	}
+	if attrs != nil {
+		prepared[MapAttrsKey] = attrs
+	}
+	return prepared
+}
+
+// prepareValue applies prepare to nested objects
+func (cfg *jsonImportConfig) prepareValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return cfg.prepare(v)
+	case []interface{}:
+		list := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			if item == nil && cfg.skipNulls {
+				continue
+			}
+			list = append(list, cfg.prepareValue(item))
+		}
+		return list
+	}
+	return value
+}
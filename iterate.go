@@ -0,0 +1,140 @@
+package xmlapi
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"strconv"
+)
+
+// iterPageSize is how many items the iterators ask for per page
+const iterPageSize = 100
+
+// page is one page of a paged listing; next is the cursor of the following
+// page, "" after the last
+type page[T any] struct {
+	items []T
+	next  string
+	err   error
+}
+
+// paginate yields the items of the pages fetch returns, starting with the
+// empty cursor. The next page is fetched while the current one is being
+// consumed. An error is yielded once, annotated with op, and ends the
+// sequence; so does the caller breaking out, which cancels the page in
+// flight.
+func paginate[T any](ctx context.Context, op *operation, fetch func(ctx context.Context, cursor string) ([]T, string, error)) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		prefetch := func(cursor string) <-chan page[T] {
+			ch := make(chan page[T], 1)
+			go func() {
+				items, next, err := fetch(ctx, cursor)
+				ch <- page[T]{items, next, err}
+			}()
+			return ch
+		}
+
+		pending := prefetch("")
+		for pending != nil {
+			p := <-pending
+			if p.err != nil {
+				var zero T
+				yield(zero, op.wrap(p.err))
+				return
+			}
+			pending = nil
+			if p.next != "" {
+				pending = prefetch(p.next)
+			}
+			for _, item := range p.items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Files iterates over the files of a device, fetching the list a page at a
+// time from gateways that page it. Errors are yielded as the second value
+// and end the iteration.
+func (c *Client) Files(ctx context.Context, deviceID string, opts ...RequestOption) iter.Seq2[string, error] {
+	ctx, op := startOp(ctx, "Files", opts, deviceID, "", nil)
+	return paginate(ctx, op, func(ctx context.Context, cursor string) ([]string, string, error) {
+		params := map[string]string{
+			"deviceid": deviceID,
+			"limit":    strconv.Itoa(iterPageSize),
+		}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+
+		resp, err := c.requestContext(ctx, "GET", "/listFile", params, nil)
+		if err != nil {
+			return nil, "", err
+		}
+		var result FileList
+		if err := c.decode(resp, &result); err != nil {
+			return nil, "", err
+		}
+		return result.Files, result.Next, nil
+	})
+}
+
+// childrenResponse represents the response of /children
+type childrenResponse struct {
+	Nodes []Node `json:"nodes"`
+	Next  string `json:"next"`
+}
+
+// Children iterates over the children of the element at path, comments
+// included, fetching them a page at a time from the gateway's /children.
+// Where that is unavailable the element is read whole. Errors are yielded
+// as the second value and end the iteration.
+func (c *Client) Children(ctx context.Context, deviceID, filename string, path PathLike, opts ...RequestOption) iter.Seq2[Node, error] {
+	ctx, op := startOp(ctx, "Children", opts, deviceID, filename, path)
+	pathStr, err := PathString(path)
+	if err != nil {
+		err = op.wrap(err)
+		return func(yield func(Node, error) bool) { yield(Node{}, err) }
+	}
+	return paginate(ctx, op, func(ctx context.Context, cursor string) ([]Node, string, error) {
+		params := map[string]string{
+			"deviceid": deviceID,
+			"filename": filename,
+			"path":     pathStr,
+			"limit":    strconv.Itoa(iterPageSize),
+		}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+
+		resp, err := c.requestContext(ctx, "GET", "/children", params, nil)
+		if err == nil {
+			var result childrenResponse
+			if err := c.decode(resp, &result); err != nil {
+				return nil, "", err
+			}
+			for i := range result.Nodes {
+				result.Nodes[i].normalizeValues()
+				local := escapeSegment(result.Nodes[i].XMLName.Local)
+				if err := c.decodeNode(ctx, childValuePath(pathStr, local), &result.Nodes[i]); err != nil {
+					return nil, "", err
+				}
+			}
+			return result.Nodes, result.Next, nil
+		}
+		if !errors.Is(err, ErrUnsupportedByServer) || cursor != "" {
+			return nil, "", err
+		}
+
+		node, err := c.readNode(ctx, deviceID, filename, pathStr)
+		if err != nil {
+			return nil, "", err
+		}
+		return node.Nodes, "", nil
+	})
+}
@@ -0,0 +1,118 @@
+package xmlapi
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Shape of the slow paged listing of BenchmarkPaginate
+const (
+	benchPages       = 10
+	benchPageLatency = 5 * time.Millisecond
+	benchPageWork    = 5 * time.Millisecond
+)
+
+// pagedListing makes g answer /listFile a page of iterPageSize files at a
+// time, each after latency
+func pagedListing(g *fakeGateway, pages int, latency time.Duration) {
+	g.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/listFile" {
+			return false
+		}
+		time.Sleep(latency)
+		n, _ := strconv.Atoi(r.URL.Query().Get("cursor"))
+		result := FileList{Files: make([]string, iterPageSize)}
+		for i := range result.Files {
+			result.Files[i] = "file" + strconv.Itoa(n*iterPageSize+i) + ".xml"
+		}
+		if n+1 < pages {
+			result.Next = strconv.Itoa(n + 1)
+		}
+		writeJSON(w, http.StatusOK, result)
+		return true
+	}
+}
+
+func BenchmarkPaginate(b *testing.B) {
+	g := newFakeGateway(b)
+	pagedListing(g, benchPages, benchPageLatency)
+	c := g.client()
+	if err := c.Authorize(); err != nil {
+		b.Fatal(err)
+	}
+
+	fetch := func(ctx context.Context, cursor string) ([]string, string, error) {
+		params := map[string]string{"deviceid": "dev", "limit": strconv.Itoa(iterPageSize)}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		resp, err := c.requestContext(ctx, "GET", "/listFile", params, nil)
+		if err != nil {
+			return nil, "", err
+		}
+		var result FileList
+		if err := c.decode(resp, &result); err != nil {
+			return nil, "", err
+		}
+		return result.Files, result.Next, nil
+	}
+	// consume stands for the caller's work on each page
+	consume := func(i int) {
+		if i%iterPageSize == iterPageSize-1 {
+			time.Sleep(benchPageWork)
+		}
+	}
+
+	for _, bc := range []struct {
+		name string
+		list func(ctx context.Context) (int, error)
+	}{
+		{
+			name: "prefetch",
+			list: func(ctx context.Context) (int, error) {
+				n := 0
+				for _, err := range paginate(ctx, nil, fetch) {
+					if err != nil {
+						return n, err
+					}
+					consume(n)
+					n++
+				}
+				return n, nil
+			},
+		},
+		{
+			name: "sequential",
+			list: func(ctx context.Context) (int, error) {
+				n := 0
+				for cursor, first := "", true; first || cursor != ""; first = false {
+					files, next, err := fetch(ctx, cursor)
+					if err != nil {
+						return n, err
+					}
+					for range files {
+						consume(n)
+						n++
+					}
+					cursor = next
+				}
+				return n, nil
+			},
+		},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				n, err := bc.list(context.Background())
+				if err != nil {
+					b.Fatal(err)
+				}
+				if n != benchPages*iterPageSize {
+					b.Fatalf("listed %d files, want %d", n, benchPages*iterPageSize)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package xmlapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// defaultJobPoll is how often CopyDevice polls a job it waits for
+const defaultJobPoll = time.Second
+
+// JobState is the lifecycle state of an asynchronous gateway job
+type JobState string
+
+// Job states reported by the gateway
+const (
+	JobQueued    JobState = "queued"
+	JobRunning   JobState = "running"
+	JobCompleted JobState = "completed"
+	JobFailed    JobState = "failed"
+	JobCancelled JobState = "cancelled"
+)
+
+// Job is a long-running operation the gateway performs in the background,
+// such as copying a large file
+type Job struct {
+	ID        string   `json:"id"`
+	DeviceID  string   `json:"deviceid"`
+	Operation string   `json:"operation"`
+	State     JobState `json:"state"`
+	// Progress is the completed share of the work in percent
+	Progress float64 `json:"progress"`
+	// Status is the final status of a completed job, Error the reason a job failed
+	Status    string    `json:"status"`
+	Error     string    `json:"error"`
+	Submitted time.Time `json:"submitted"`
+}
+
+// jobAccepted represents the 202 response of an operation run as a job
+type jobAccepted struct {
+	JobID string `json:"job_id"`
+}
+
+// jobFromResponse returns the job a response started, or nil if the
+// operation already finished
+func (c *Client) jobFromResponse(resp *Response) (*Job, error) {
+	if resp.StatusCode != http.StatusAccepted {
+		return nil, nil
+	}
+	var accepted jobAccepted
+	if err := c.decode(resp, &accepted); err != nil {
+		return nil, err
+	}
+	if accepted.JobID == "" {
+		return nil, nil
+	}
+	return &Job{ID: accepted.JobID, State: JobQueued}, nil
+}
+
+// JobStatus returns the current state of a job
+func (c *Client) JobStatus(jobID string, opts ...RequestOption) (_ *Job, err error) {
+	ctx, op := startOp(context.Background(), "JobStatus", opts, "", "", nil)
+	defer op.finish(&err)
+
+	return c.jobStatus(ctx, jobID)
+}
+
+// jobStatus implements JobStatus, carrying ctx
+func (c *Client) jobStatus(ctx context.Context, jobID string) (*Job, error) {
+	params := map[string]string{
+		"id": jobID,
+	}
+
+	resp, err := c.requestContext(ctx, "GET", "/job", params, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var job Job
+	err = c.decode(resp, &job)
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// WaitForJob polls a job every poll interval until it completes, fails or
+// is cancelled. A failed job is returned along with an error matching
+// ErrJobFailed, a cancelled one with ErrJobCancelled; if ctx ends first, the
+// last state seen is returned with ctx's error.
+func (c *Client) WaitForJob(ctx context.Context, jobID string, poll time.Duration, opts ...RequestOption) (_ *Job, err error) {
+	ctx, op := startOp(ctx, "WaitForJob", opts, "", "", nil)
+	defer op.finish(&err)
+
+	if poll <= 0 {
+		poll = defaultJobPoll
+	}
+	for {
+		job, err := c.jobStatus(ctx, jobID)
+		if err != nil {
+			return nil, err
+		}
+		switch job.State {
+		case JobCompleted:
+			return job, nil
+		case JobFailed:
+			return job, fmt.Errorf("job %s: %w: %s", jobID, ErrJobFailed, job.Error)
+		case JobCancelled:
+			return job, fmt.Errorf("job %s: %w", jobID, ErrJobCancelled)
+		}
+		if !sleepContext(ctx, poll) {
+			return job, ctx.Err()
+		}
+	}
+}
+
+// CancelJob aborts a queued or running job. A job that has already
+// finished cannot be cancelled, which is reported as ErrJobAlreadyFinished.
+func (c *Client) CancelJob(jobID string, opts ...RequestOption) (err error) {
+	ctx, op := startOp(context.Background(), "CancelJob", opts, "", "", nil)
+	defer op.finish(&err)
+
+	params := map[string]string{
+		"id": jobID,
+	}
+
+	_, err = c.statusRequestContext(ctx, "DELETE", "/job", params, nil)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict && !errors.Is(err, ErrJobAlreadyFinished) {
+		return fmt.Errorf("%w: %w", ErrJobAlreadyFinished, err)
+	}
+	return err
+}
+
+// JobFilter selects the jobs ListJobs returns. Empty fields match every job.
+type JobFilter struct {
+	States         []JobState
+	SubmittedAfter time.Time
+}
+
+// jobList represents the response of /jobs
+type jobList struct {
+	Jobs []Job `json:"jobs"`
+}
+
+// ListJobs lists the jobs of a device known to the gateway
+func (c *Client) ListJobs(deviceID string, filter JobFilter, opts ...RequestOption) (_ []Job, err error) {
+	ctx, op := startOp(context.Background(), "ListJobs", opts, deviceID, "", nil)
+	defer op.finish(&err)
+
+	params := map[string]string{
+		"deviceid": deviceID,
+	}
+	if !filter.SubmittedAfter.IsZero() {
+		params["submitted_after"] = filter.SubmittedAfter.UTC().Format(time.RFC3339)
+	}
+	multi := make(url.Values)
+	for _, state := range filter.States {
+		multi.Add("state", string(state))
+	}
+
+	resp, err := c.requestMulti(ctx, "GET", "/jobs", params, multi, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result jobList
+	err = c.decode(resp, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Jobs, nil
+}
@@ -0,0 +1,13 @@
+package xmlapi
+
+// Logger receives the client's warnings. *log.Logger satisfies it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// WithLogger sends the client's warnings to l instead of the standard logger
+func WithLogger(l Logger) Option {
+	return func(c *Client) {
+		c.logger = l
+	}
+}
@@ -0,0 +1,243 @@
+package xmlapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Keys with a special meaning in the nested map form of a tree
+const (
+	// MapAttrsKey holds an element's attributes as a map of name to value
+	MapAttrsKey = "@attrs"
+	// MapTextKey holds the value of an element that also has children or attributes
+	MapTextKey = "#text"
+)
+
+// MapError reports the location in a nested map that could not be converted
+type MapError struct {
+	// Path is the location in JSON path notation, e.g. "$.phase[1].minGreen"
+	Path string
+	Err  error
+}
+
+// Error implements the error interface
+func (e *MapError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *MapError) Unwrap() error {
+	return e.Err
+}
+
+// ToMap converts the content of n into nested maps, for templates and JSON
+// tooling. The convention is:
+//
+//   - each element child appears under its local name
+//   - a child without children or attributes becomes its string value
+//   - any other child becomes a nested map built by the same rules
+//   - tags repeated among siblings become a []interface{} in document order
+//   - attributes are kept under MapAttrsKey as a map[string]interface{}
+//   - the value of an element with children or attributes is kept under MapTextKey
+//
+// Namespaces and comments are dropped. NodeFromMap reverses the conversion.
+func (n *Node) ToMap() map[string]interface{} {
+	m := make(map[string]interface{})
+	if n == nil {
+		return m
+	}
+
+	if len(n.Attrs) > 0 {
+		attrs := make(map[string]interface{}, len(n.Attrs))
+		for _, attr := range n.Attrs {
+			if !isNamespaceDecl(attr.Name) {
+				attrs[attr.Name.Local] = attr.Value
+			}
+		}
+		if len(attrs) > 0 {
+			m[MapAttrsKey] = attrs
+		}
+	}
+	if n.Value != "" {
+		m[MapTextKey] = n.Value
+	}
+
+	counts := make(map[string]int)
+	for i := range n.Nodes {
+		if n.Nodes[i].Kind == NodeElement {
+			counts[n.Nodes[i].XMLName.Local]++
+		}
+	}
+
+	for i := range n.Nodes {
+		child := &n.Nodes[i]
+		if child.Kind != NodeElement {
+			continue
+		}
+
+		var value interface{}
+		if len(child.Attrs) == 0 && !hasElementChildren(child) {
+			value = child.Value
+		} else {
+			value = child.ToMap()
+		}
+
+		name := child.XMLName.Local
+		if counts[name] > 1 {
+			list, _ := m[name].([]interface{})
+			m[name] = append(list, value)
+		} else {
+			m[name] = value
+		}
+	}
+
+	return m
+}
+
+// NodeFromMap builds a tree named name from the nested map form produced by
+// ToMap. Keys must be valid XML names, and children are created in sorted key
+// order since maps carry no order. Besides strings, leaf values may be
+// numbers, booleans, json.Number or nil, which are formatted canonically.
+// Conversion failures are reported as a *MapError.
+func NodeFromMap(name XMLName, m map[string]interface{}) (*Node, error) {
+	node := &Node{XMLName: name}
+	if err := fillFromMap(node, m, "$"); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// fillFromMap adds the attributes, value and children described by m to node
+func fillFromMap(node *Node, m map[string]interface{}, path string) error {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := m[key]
+		keyPath := path + "." + key
+
+		switch key {
+		case MapAttrsKey:
+			attrs, err := attrsFromMap(value, keyPath)
+			if err != nil {
+				return err
+			}
+			node.Attrs = append(node.Attrs, attrs...)
+			continue
+
+		case MapTextKey:
+			text, err := mapScalar(value, keyPath)
+			if err != nil {
+				return err
+			}
+			node.Value = text
+			continue
+		}
+
+		if !isValidName(key) {
+			return &MapError{Path: keyPath, Err: fmt.Errorf("invalid element name %q", key)}
+		}
+
+		if list, ok := value.([]interface{}); ok {
+			for i, item := range list {
+				if _, nested := item.([]interface{}); nested {
+					return &MapError{Path: fmt.Sprintf("%s[%d]", keyPath, i), Err: errors.New("nested arrays are not supported")}
+				}
+				child, err := nodeFromMapValue(key, item, fmt.Sprintf("%s[%d]", keyPath, i))
+				if err != nil {
+					return err
+				}
+				node.Nodes = append(node.Nodes, *child)
+			}
+			continue
+		}
+
+		child, err := nodeFromMapValue(key, value, keyPath)
+		if err != nil {
+			return err
+		}
+		node.Nodes = append(node.Nodes, *child)
+	}
+
+	return nil
+}
+
+// nodeFromMapValue builds a single child element from a map value
+func nodeFromMapValue(name string, value interface{}, path string) (*Node, error) {
+	child := &Node{XMLName: XMLName{Local: name}}
+	if m, ok := value.(map[string]interface{}); ok {
+		if err := fillFromMap(child, m, path); err != nil {
+			return nil, err
+		}
+		return child, nil
+	}
+
+	text, err := mapScalar(value, path)
+	if err != nil {
+		return nil, err
+	}
+	child.Value = text
+	return child, nil
+}
+
+// attrsFromMap converts the value stored under MapAttrsKey
+func attrsFromMap(value interface{}, path string) ([]Attr, error) {
+	values := make(map[string]string)
+	switch v := value.(type) {
+	case map[string]string:
+		for name, value := range v {
+			values[name] = value
+		}
+	case map[string]interface{}:
+		for name, value := range v {
+			text, err := mapScalar(value, path+"."+name)
+			if err != nil {
+				return nil, err
+			}
+			values[name] = text
+		}
+	default:
+		return nil, &MapError{Path: path, Err: fmt.Errorf("attributes must be a map, got %T", value)}
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	attrs := make([]Attr, len(names))
+	for i, name := range names {
+		attrs[i] = Attr{Name: XMLName{Local: name}, Value: values[name]}
+	}
+	return attrs, nil
+}
+
+// mapScalar formats a leaf value of the nested map form
+func mapScalar(value interface{}, path string) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case json.Number:
+		return v.String(), nil
+	}
+	return "", &MapError{Path: path, Err: fmt.Errorf("unsupported value type %T", value)}
+}
@@ -0,0 +1,95 @@
+package xmlapi
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestToMap(t *testing.T) {
+	root, err := ParseXML(strings.NewReader(`<plan><name>main</name><phase id="1"><minGreen>5</minGreen></phase><phase id="2">x<minGreen>7</minGreen></phase><detector>d1</detector><detector>d2</detector><!--c--></plan>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"name": "main",
+		"phase": []interface{}{
+			map[string]interface{}{MapAttrsKey: map[string]interface{}{"id": "1"}, "minGreen": "5"},
+			map[string]interface{}{MapAttrsKey: map[string]interface{}{"id": "2"}, MapTextKey: "x", "minGreen": "7"},
+		},
+		"detector": []interface{}{"d1", "d2"},
+	}
+	if got := root.ToMap(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ToMap = %#v\nwant %#v", got, want)
+	}
+}
+
+func TestNodeFromMapRoundTrip(t *testing.T) {
+	for _, doc := range []string{
+		`<plan><a>1</a><b>2</b></plan>`,
+		`<plan><phase id="1"><minGreen>5</minGreen></phase><phase id="2"><minGreen>7</minGreen><minGreen>8</minGreen></phase></plan>`,
+		`<plan><list>1</list><list>2</list><list>3</list><single><only>x</only></single></plan>`,
+		`<plan mode="m">text<child>c</child></plan>`,
+	} {
+		root, err := ParseXML(strings.NewReader(doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := root.ToMap()
+
+		// Maps also survive a trip through JSON tooling
+		data, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded map[string]interface{}
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatal(err)
+		}
+
+		rebuilt, err := NodeFromMap(root.XMLName, decoded)
+		if err != nil {
+			t.Fatalf("NodeFromMap(%s): %v", doc, err)
+		}
+		if got := rebuilt.ToMap(); !reflect.DeepEqual(got, m) {
+			t.Errorf("round trip of %s:\n got %#v\nwant %#v", doc, got, m)
+		}
+		// Keys are sorted and the documents above are written in key order
+		if got := mustXML(t, rebuilt); got != doc {
+			t.Errorf("rebuilt %s\nwant %s", got, doc)
+		}
+	}
+}
+
+func TestNodeFromMapScalars(t *testing.T) {
+	n, err := NodeFromMap(XMLName{Local: "cfg"}, map[string]interface{}{
+		"count":   3,
+		"ratio":   0.5,
+		"enabled": true,
+		"size":    json.Number("12"),
+		"none":    nil,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<cfg><count>3</count><enabled>true</enabled><none/><ratio>0.5</ratio><size>12</size></cfg>`
+	if got := mustXML(t, n); got != want {
+		t.Errorf("NodeFromMap = %s\nwant %s", got, want)
+	}
+}
+
+func TestNodeFromMapErrors(t *testing.T) {
+	for _, m := range []map[string]interface{}{
+		{"bad name": "x"},
+		{"list": []interface{}{[]interface{}{"nested"}}},
+		{"value": struct{}{}},
+	} {
+		_, err := NodeFromMap(XMLName{Local: "cfg"}, m)
+		var mapErr *MapError
+		if !errors.As(err, &mapErr) {
+			t.Errorf("NodeFromMap(%v) = %v, want a *MapError", m, err)
+		}
+	}
+}
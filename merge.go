@@ -0,0 +1,378 @@
+package xmlapi
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MergeStrategy decides how Merge resolves conflicting changes
+type MergeStrategy int
+
+const (
+	// Manual leaves conflicting paths at their base state and reports them
+	Manual MergeStrategy = iota
+	// OursWins resolves every conflict in favour of ours
+	OursWins
+	// TheirsWins resolves every conflict in favour of theirs
+	TheirsWins
+)
+
+// ConflictType classifies a merge conflict
+type ConflictType int
+
+const (
+	// ConflictBothChanged is a value or attribute changed differently on both sides
+	ConflictBothChanged ConflictType = iota + 1
+	// ConflictBothAdded is an element added differently at the same position on both sides
+	ConflictBothAdded
+	// ConflictDeleteModify is an element removed on one side and modified on the other
+	ConflictDeleteModify
+)
+
+// String returns a readable name for the conflict type
+func (t ConflictType) String() string {
+	switch t {
+	case ConflictBothChanged:
+		return "both changed"
+	case ConflictBothAdded:
+		return "both added"
+	case ConflictDeleteModify:
+		return "delete/modify"
+	}
+	return fmt.Sprintf("ConflictType(%d)", int(t))
+}
+
+// Conflict is a path both sides of a merge changed incompatibly. Base, Ours
+// and Theirs hold the value (or attribute value, when Attr is set) on each
+// side, empty where the element or attribute is absent.
+type Conflict struct {
+	Path   string
+	Attr   string
+	Type   ConflictType
+	Base   string
+	Ours   string
+	Theirs string
+}
+
+// Merge performs a three-way merge of two trees derived from base, built on
+// the positional Diff of each side against base. Changes made on only one
+// side are applied; conflicting ones are resolved according to strategy.
+// The conflicts are returned for every strategy; with OursWins and
+// TheirsWins they have already been resolved in the merged tree.
+func Merge(base, ours, theirs *Node, strategy MergeStrategy) (*Node, []Conflict, error) {
+	if base == nil || ours == nil || theirs == nil {
+		return nil, nil, errors.New("merge needs a base, ours and theirs tree")
+	}
+	if base.XMLName != ours.XMLName || base.XMLName != theirs.XMLName {
+		return nil, nil, fmt.Errorf("cannot merge trees with different root elements")
+	}
+
+	sideOurs := indexChanges(Diff(base, ours))
+	sideTheirs := indexChanges(Diff(base, theirs))
+
+	m := &merger{result: base.Clone(), strategy: strategy}
+	for _, key := range unionKeys(sideOurs, sideTheirs) {
+		m.mergeKey(key, sideOurs, sideTheirs)
+	}
+	if err := m.apply(); err != nil {
+		return nil, m.conflicts, err
+	}
+
+	return m.result, m.conflicts, nil
+}
+
+// indexChanges keys the changes of one side by what they touch
+func indexChanges(changes []Change) map[string]Change {
+	indexed := make(map[string]Change, len(changes))
+	for _, c := range changes {
+		indexed[changeKey(c)] = c
+	}
+	return indexed
+}
+
+// changeKey identifies the thing a change touches, so the two sides' changes
+// to it can be compared
+func changeKey(c Change) string {
+	switch c.Type {
+	case ChangeAttrChanged:
+		return "a" + c.Path + "/@" + c.Attr
+	case ChangeAdded:
+		return "n" + c.Path
+	case ChangeRemoved:
+		return "r" + c.Path
+	}
+	return "v" + c.Path
+}
+
+// unionKeys returns the keys of both maps in sorted order
+func unionKeys(a, b map[string]Change) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// merger accumulates the outcome of a Merge call
+type merger struct {
+	result    *Node
+	strategy  MergeStrategy
+	conflicts []Conflict
+
+	chosen []Change
+}
+
+// mergeKey decides which side's change to a key, if any, is applied
+func (m *merger) mergeKey(key string, ours, theirs map[string]Change) {
+	o, inOurs := ours[key]
+	t, inTheirs := theirs[key]
+
+	// A removal conflicts with any change the other side makes inside it
+	if inOurs && o.Type == ChangeRemoved {
+		if c, ok := modifiedWithin(o.Path, theirs); ok {
+			m.conflict(Conflict{Path: o.Path, Type: ConflictDeleteModify, Base: o.Old, Theirs: c.New}, &o, nil)
+			return
+		}
+	}
+	if inTheirs && t.Type == ChangeRemoved {
+		if c, ok := modifiedWithin(t.Path, ours); ok {
+			m.conflict(Conflict{Path: t.Path, Type: ConflictDeleteModify, Base: t.Old, Ours: c.New}, nil, &t)
+			return
+		}
+	}
+
+	// Changes inside an element the other side removed are part of the
+	// delete/modify conflict reported above, and only survive if they win it
+	if inOurs && !inTheirs {
+		if _, removed := removedAbove(o.Path, theirs); !removed || m.strategy == OursWins {
+			m.chosen = append(m.chosen, o)
+		}
+		return
+	}
+	if inTheirs && !inOurs {
+		if _, removed := removedAbove(t.Path, ours); !removed || m.strategy == TheirsWins {
+			m.chosen = append(m.chosen, t)
+		}
+		return
+	}
+
+	switch o.Type {
+	case ChangeRemoved:
+		m.chosen = append(m.chosen, o)
+	case ChangeAdded:
+		if nodesEqual(o.Node, t.Node) {
+			m.chosen = append(m.chosen, o)
+			return
+		}
+		m.conflict(Conflict{Path: o.Path, Type: ConflictBothAdded, Ours: o.New, Theirs: t.New}, &o, &t)
+	default:
+		if o.New == t.New {
+			m.chosen = append(m.chosen, o)
+			return
+		}
+		m.conflict(Conflict{Path: o.Path, Attr: o.Attr, Type: ConflictBothChanged, Base: o.Old, Ours: o.New, Theirs: t.New}, &o, &t)
+	}
+}
+
+// conflict records a conflict and applies the winning side, if any
+func (m *merger) conflict(c Conflict, ours, theirs *Change) {
+	m.conflicts = append(m.conflicts, c)
+	var winner *Change
+	switch m.strategy {
+	case OursWins:
+		winner = ours
+	case TheirsWins:
+		winner = theirs
+	}
+	if winner != nil {
+		m.chosen = append(m.chosen, *winner)
+	}
+}
+
+// modifiedWithin returns a change, other than a removal, at or below path
+func modifiedWithin(path string, changes map[string]Change) (Change, bool) {
+	var found []Change
+	for _, c := range changes {
+		if c.Type != ChangeRemoved && isWithin(c.Path, path) {
+			found = append(found, c)
+		}
+	}
+	if len(found) == 0 {
+		return Change{}, false
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Path < found[j].Path })
+	return found[0], true
+}
+
+// removedAbove returns a removal of path or one of its ancestors
+func removedAbove(path string, changes map[string]Change) (Change, bool) {
+	for _, c := range changes {
+		if c.Type == ChangeRemoved && isWithin(path, c.Path) {
+			return c, true
+		}
+	}
+	return Change{}, false
+}
+
+// isWithin reports whether path is ancestor or equal to, or a descendant of,
+// root. Unindexed and [1] segments address the same element.
+func isWithin(path, root string) bool {
+	path, root = normalizeIndexes(path), normalizeIndexes(root)
+	return path == root || strings.HasPrefix(path, root+"/")
+}
+
+// normalizeIndexes adds an explicit [1] to unindexed path segments
+func normalizeIndexes(path string) string {
+	p, err := parsePath(path)
+	if err != nil {
+		return path
+	}
+	var b strings.Builder
+	for _, seg := range p.Segments {
+		b.WriteString("/")
+		if seg.Attr {
+			b.WriteString("@" + escapeSegment(seg.Local))
+			continue
+		}
+		if seg.Prefix != "" {
+			b.WriteString(escapeSegment(seg.Prefix) + ":")
+		}
+		b.WriteString(escapeSegment(seg.Local))
+		index := seg.Index
+		if index == 0 {
+			index = 1
+		}
+		fmt.Fprintf(&b, "[%d]", index)
+	}
+	return b.String()
+}
+
+// comparePaths orders two paths segment by segment, comparing indexes
+// numerically so that "[10]" sorts after "[9]"
+func comparePaths(a, b string) int {
+	pa, errA := parsePath(a)
+	pb, errB := parsePath(b)
+	if errA != nil || errB != nil {
+		return strings.Compare(a, b)
+	}
+	for i := 0; i < len(pa.Segments) && i < len(pb.Segments); i++ {
+		sa, sb := pa.Segments[i], pb.Segments[i]
+		if c := strings.Compare(sa.Local, sb.Local); c != 0 {
+			return c
+		}
+		ia, ib := sa.Index, sb.Index
+		if ia == 0 {
+			ia = 1
+		}
+		if ib == 0 {
+			ib = 1
+		}
+		if ia != ib {
+			if ia < ib {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(pa.Segments) - len(pb.Segments)
+}
+
+// apply performs the chosen changes on the result tree: values and
+// attributes first, then additions in document order, then removals from the
+// end so earlier positions stay valid
+func (m *merger) apply() error {
+	var additions, removals []Change
+	for _, c := range m.chosen {
+		switch c.Type {
+		case ChangeValueChanged:
+			if node, ok := m.result.Find(c.Path); ok {
+				node.Value = c.New
+			}
+		case ChangeAttrChanged:
+			if node, ok := m.result.Find(c.Path); ok {
+				_, keep := c.Node.Attr(c.Attr)
+				node.setAttr(c.Attr, c.New, keep)
+			}
+		case ChangeAdded:
+			additions = append(additions, c)
+		case ChangeRemoved:
+			removals = append(removals, c)
+		}
+	}
+
+	sort.SliceStable(additions, func(i, j int) bool {
+		return comparePaths(additions[i].Path, additions[j].Path) < 0
+	})
+	for _, c := range additions {
+		parent, ok := m.result.Find(parentPath(c.Path))
+		if !ok {
+			return fmt.Errorf("merge: parent of %s not found", c.Path)
+		}
+		parent.Nodes = append(parent.Nodes, *c.Node.Clone())
+	}
+
+	sort.SliceStable(removals, func(i, j int) bool {
+		return comparePaths(removals[i].Path, removals[j].Path) > 0
+	})
+	for _, c := range removals {
+		m.result.removeAt(c.Path)
+	}
+
+	return nil
+}
+
+// setAttr sets or, when keep is false, removes an attribute
+func (n *Node) setAttr(name, value string, keep bool) {
+	for i := range n.Attrs {
+		if n.Attrs[i].Name.Local == name {
+			if keep {
+				n.Attrs[i].Value = value
+			} else {
+				n.Attrs = append(n.Attrs[:i], n.Attrs[i+1:]...)
+			}
+			return
+		}
+	}
+	if keep {
+		n.Attrs = append(n.Attrs, Attr{Name: XMLName{Local: name}, Value: value})
+	}
+}
+
+// removeAt removes the element at path from the tree rooted at n
+func (n *Node) removeAt(path string) bool {
+	parent, ok := n.Find(parentPath(path))
+	if !ok {
+		return false
+	}
+	p, err := parsePath(path)
+	if err != nil || len(p.Segments) == 0 {
+		return false
+	}
+	seg := p.Segments[len(p.Segments)-1]
+
+	count := 0
+	for i := range parent.Nodes {
+		if !seg.matches(&parent.Nodes[i], nil) {
+			continue
+		}
+		count++
+		if seg.Index == 0 || seg.Index == count {
+			parent.Nodes = append(parent.Nodes[:i], parent.Nodes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// nodesEqual reports whether two trees are structurally identical
+func nodesEqual(a, b *Node) bool {
+	return len(Diff(a, b)) == 0
+}
@@ -0,0 +1,134 @@
+package xmlapi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	const base = `<plan version="3"><phase id="1"><minGreen>5</minGreen></phase><phase id="2"><minGreen>7</minGreen></phase></plan>`
+
+	for _, tc := range []struct {
+		name         string
+		ours, theirs string
+		conflicts    []Conflict
+		// want holds the merged document for Manual, OursWins and TheirsWins
+		want [3]string
+	}{
+		{
+			name:   "independent changes",
+			ours:   `<plan version="3"><phase id="1"><minGreen>6</minGreen></phase><phase id="2"><minGreen>7</minGreen></phase></plan>`,
+			theirs: `<plan version="4"><phase id="1"><minGreen>5</minGreen></phase><phase id="2"><minGreen>7</minGreen></phase><name>n</name></plan>`,
+			want: [3]string{
+				`<plan version="4"><phase id="1"><minGreen>6</minGreen></phase><phase id="2"><minGreen>7</minGreen></phase><name>n</name></plan>`,
+				`<plan version="4"><phase id="1"><minGreen>6</minGreen></phase><phase id="2"><minGreen>7</minGreen></phase><name>n</name></plan>`,
+				`<plan version="4"><phase id="1"><minGreen>6</minGreen></phase><phase id="2"><minGreen>7</minGreen></phase><name>n</name></plan>`,
+			},
+		},
+		{
+			name:   "both changed the same way",
+			ours:   `<plan version="3"><phase id="1"><minGreen>6</minGreen></phase><phase id="2"><minGreen>7</minGreen></phase><name>n</name></plan>`,
+			theirs: `<plan version="3"><phase id="1"><minGreen>6</minGreen></phase><phase id="2"><minGreen>7</minGreen></phase><name>n</name></plan>`,
+			want: [3]string{
+				`<plan version="3"><phase id="1"><minGreen>6</minGreen></phase><phase id="2"><minGreen>7</minGreen></phase><name>n</name></plan>`,
+				`<plan version="3"><phase id="1"><minGreen>6</minGreen></phase><phase id="2"><minGreen>7</minGreen></phase><name>n</name></plan>`,
+				`<plan version="3"><phase id="1"><minGreen>6</minGreen></phase><phase id="2"><minGreen>7</minGreen></phase><name>n</name></plan>`,
+			},
+		},
+		{
+			name:   "both changed a value differently",
+			ours:   `<plan version="3"><phase id="1"><minGreen>6</minGreen></phase><phase id="2"><minGreen>7</minGreen></phase></plan>`,
+			theirs: `<plan version="3"><phase id="1"><minGreen>8</minGreen></phase><phase id="2"><minGreen>7</minGreen></phase></plan>`,
+			conflicts: []Conflict{
+				{Path: "/plan/phase[1]/minGreen", Type: ConflictBothChanged, Base: "5", Ours: "6", Theirs: "8"},
+			},
+			want: [3]string{
+				base,
+				`<plan version="3"><phase id="1"><minGreen>6</minGreen></phase><phase id="2"><minGreen>7</minGreen></phase></plan>`,
+				`<plan version="3"><phase id="1"><minGreen>8</minGreen></phase><phase id="2"><minGreen>7</minGreen></phase></plan>`,
+			},
+		},
+		{
+			name:   "both changed an attribute differently",
+			ours:   `<plan version="4"><phase id="1"><minGreen>5</minGreen></phase><phase id="2"><minGreen>7</minGreen></phase></plan>`,
+			theirs: `<plan><phase id="1"><minGreen>5</minGreen></phase><phase id="2"><minGreen>7</minGreen></phase></plan>`,
+			conflicts: []Conflict{
+				{Path: "/plan", Attr: "version", Type: ConflictBothChanged, Base: "3", Ours: "4"},
+			},
+			want: [3]string{
+				base,
+				`<plan version="4"><phase id="1"><minGreen>5</minGreen></phase><phase id="2"><minGreen>7</minGreen></phase></plan>`,
+				`<plan><phase id="1"><minGreen>5</minGreen></phase><phase id="2"><minGreen>7</minGreen></phase></plan>`,
+			},
+		},
+		{
+			name:   "both added",
+			ours:   `<plan version="3"><phase id="1"><minGreen>5</minGreen></phase><phase id="2"><minGreen>7</minGreen></phase><name>a</name></plan>`,
+			theirs: `<plan version="3"><phase id="1"><minGreen>5</minGreen></phase><phase id="2"><minGreen>7</minGreen></phase><name>b</name></plan>`,
+			conflicts: []Conflict{
+				{Path: "/plan/name", Type: ConflictBothAdded, Ours: "a", Theirs: "b"},
+			},
+			want: [3]string{
+				base,
+				`<plan version="3"><phase id="1"><minGreen>5</minGreen></phase><phase id="2"><minGreen>7</minGreen></phase><name>a</name></plan>`,
+				`<plan version="3"><phase id="1"><minGreen>5</minGreen></phase><phase id="2"><minGreen>7</minGreen></phase><name>b</name></plan>`,
+			},
+		},
+		{
+			name:   "delete and modify",
+			ours:   `<plan version="3"><phase id="1"><minGreen>5</minGreen></phase></plan>`,
+			theirs: `<plan version="3"><phase id="1"><minGreen>5</minGreen></phase><phase id="2"><minGreen>9</minGreen></phase></plan>`,
+			conflicts: []Conflict{
+				{Path: "/plan/phase[2]", Type: ConflictDeleteModify, Theirs: "9"},
+			},
+			want: [3]string{
+				base,
+				`<plan version="3"><phase id="1"><minGreen>5</minGreen></phase></plan>`,
+				`<plan version="3"><phase id="1"><minGreen>5</minGreen></phase><phase id="2"><minGreen>9</minGreen></phase></plan>`,
+			},
+		},
+		{
+			name:   "modify and delete",
+			ours:   `<plan version="3"><phase id="1"><minGreen>5</minGreen></phase><phase id="2" mode="x"><minGreen>7</minGreen></phase></plan>`,
+			theirs: `<plan version="3"><phase id="1"><minGreen>5</minGreen></phase></plan>`,
+			conflicts: []Conflict{
+				{Path: "/plan/phase[2]", Type: ConflictDeleteModify, Ours: "x"},
+			},
+			want: [3]string{
+				base,
+				`<plan version="3"><phase id="1"><minGreen>5</minGreen></phase><phase id="2" mode="x"><minGreen>7</minGreen></phase></plan>`,
+				`<plan version="3"><phase id="1"><minGreen>5</minGreen></phase></plan>`,
+			},
+		},
+	} {
+		for strategy, want := range tc.want {
+			strategy := MergeStrategy(strategy)
+			t.Run(tc.name+"/"+[]string{"manual", "ours", "theirs"}[strategy], func(t *testing.T) {
+				b := mustParse(t, base)
+				merged, conflicts, err := Merge(b, mustParse(t, tc.ours), mustParse(t, tc.theirs), strategy)
+				if err != nil {
+					t.Fatalf("Merge: %v", err)
+				}
+				if got := mustXML(t, merged); got != want {
+					t.Errorf("merged %s\nwant   %s", got, want)
+				}
+				if !reflect.DeepEqual(conflicts, tc.conflicts) {
+					t.Errorf("conflicts %+v\nwant      %+v", conflicts, tc.conflicts)
+				}
+				if got := mustXML(t, b); got != base {
+					t.Errorf("Merge modified the base tree: %s", got)
+				}
+			})
+		}
+	}
+}
+
+func TestMergeErrors(t *testing.T) {
+	plan := mustParse(t, `<plan/>`)
+	if _, _, err := Merge(plan, nil, plan, Manual); err == nil {
+		t.Error("Merge without ours succeeded")
+	}
+	if _, _, err := Merge(plan, plan, mustParse(t, `<schedule/>`), Manual); err == nil {
+		t.Error("Merge of different roots succeeded")
+	}
+}
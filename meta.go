@@ -0,0 +1,35 @@
+package xmlapi
+
+import (
+	"context"
+	"time"
+)
+
+// NodeMeta is the gateway's bookkeeping of an element, returned when it is
+// read with WithNodeMeta
+type NodeMeta struct {
+	Created    time.Time `json:"Created"`
+	Modified   time.Time `json:"Modified"`
+	ModifiedBy string    `json:"ModifiedBy"`
+	Revision   int       `json:"Revision"`
+}
+
+// WithNodeMeta asks the gateway for the timestamps, last writer and
+// revision of every element read, stored in Node.Meta. Such reads bypass
+// the read cache.
+func WithNodeMeta() RequestOption {
+	return func(cfg *callConfig) {
+		cfg.meta = true
+	}
+}
+
+// readNodeWith is readNode honoring the options ctx carries
+func (c *Client) readNodeWith(ctx context.Context, deviceID, filename, path string) (*Node, error) {
+	cfg := requestConfig(ctx)
+	if !cfg.meta && cfg.capture == nil {
+		return c.readNode(ctx, deviceID, filename, path)
+	}
+
+	node, _, err := c.fetchNode(ctx, deviceID, filename, path, "", cfg.meta)
+	return node, err
+}
@@ -0,0 +1,49 @@
+package xmlapi
+
+import "time"
+
+// Metric names reported to the WithMetrics hook
+const (
+	// MetricCacheHit is a read served from the read cache
+	MetricCacheHit = "cache_hit"
+	// MetricCacheMiss is a read the read cache could not serve
+	MetricCacheMiss = "cache_miss"
+	// MetricCacheRevalidated is an expired cached read the gateway confirmed unchanged
+	MetricCacheRevalidated = "cache_revalidated"
+	// MetricSlowRequest is a call slower than WithSlowRequestThreshold
+	MetricSlowRequest = "slow_request"
+	// MetricDecode is a response body decoded, with the decoder used
+	MetricDecode = "decode"
+)
+
+// Metric is a single event reported to the WithMetrics hook
+type Metric struct {
+	Name     string
+	Endpoint string
+	DeviceID string
+
+	// Duration, Attempts and Bytes describe the call for MetricSlowRequest:
+	// its time including retries, its number of attempts and the size of
+	// its response body
+	Duration time.Duration
+	Attempts int
+	Bytes    int
+
+	// Decoder is DecoderJSON or DecoderXML for MetricDecode
+	Decoder string
+}
+
+// WithMetrics calls fn for every metric event of the client. fn is called
+// synchronously from the goroutine making the request and must be fast.
+func WithMetrics(fn func(Metric)) Option {
+	return func(c *Client) {
+		c.metrics = fn
+	}
+}
+
+// metric reports m to the metrics hook, if any
+func (c *Client) metric(m Metric) {
+	if c.metrics != nil {
+		c.metrics(m)
+	}
+}
@@ -0,0 +1,210 @@
+package xmlapi
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+)
+
+// OverwritePolicy decides what MirrorDevice does with files the
+// destination already has
+type OverwritePolicy int
+
+const (
+	// OverwriteIfDifferent replaces destination files whose content differs
+	// and leaves identical ones, so a re-run only copies what is missing
+	OverwriteIfDifferent OverwritePolicy = iota
+	// OverwriteNever leaves every existing destination file alone
+	OverwriteNever
+	// OverwriteAlways copies every file whether or not the destination has it
+	OverwriteAlways
+)
+
+// MirrorOptions configures MirrorDevice
+type MirrorOptions struct {
+	// Include limits the mirror to files matching any of these path.Match
+	// patterns; empty includes every file
+	Include []string
+	// Exclude skips files matching any of these patterns, even if included
+	Exclude []string
+	// Overwrite is the policy for files the destination already has
+	Overwrite OverwritePolicy
+	// Concurrency bounds the files copied at once
+	Concurrency int
+	// SkipVerify skips comparing the content hash of each copy with its source
+	SkipVerify bool
+}
+
+// MirrorStatus is what MirrorDevice did with one file
+type MirrorStatus string
+
+// Mirror statuses
+const (
+	MirrorCopied    MirrorStatus = "copied"
+	MirrorIdentical MirrorStatus = "identical"
+	MirrorSkipped   MirrorStatus = "skipped"
+	MirrorExcluded  MirrorStatus = "excluded"
+	MirrorFailed    MirrorStatus = "failed"
+)
+
+// MirrorFile is the outcome of mirroring one file
+type MirrorFile struct {
+	Filename string
+	Status   MirrorStatus
+	// Err is set for MirrorFailed
+	Err error
+}
+
+// MirrorReport is the outcome of MirrorDevice
+type MirrorReport struct {
+	// Files lists every source file in sorted order
+	Files    []MirrorFile
+	Duration time.Duration
+}
+
+// Err returns nil if no file failed, otherwise the error of the first
+// failed file
+func (r *MirrorReport) Err() error {
+	failed := 0
+	var first *MirrorFile
+	for i := range r.Files {
+		if r.Files[i].Status == MirrorFailed {
+			if first == nil {
+				first = &r.Files[i]
+			}
+			failed++
+		}
+	}
+	if first == nil {
+		return nil
+	}
+	return fmt.Errorf("%d of %d files failed to mirror, first %s: %w", failed, len(r.Files), first.Filename, first.Err)
+}
+
+// MirrorDevice copies the files of srcDeviceID to dstDeviceID, as when
+// replacing a controller, and verifies each copy by its content hash (see
+// TreeStats). Files are copied with bounded concurrency and share the
+// client's rate limit. With the default OverwriteIfDifferent policy files
+// already mirrored are left alone, so an interrupted mirror resumes by
+// running it again. The report is returned either way; the error is that
+// of MirrorReport.Err.
+func (c *Client) MirrorDevice(ctx context.Context, srcDeviceID, dstDeviceID string, opts MirrorOptions, reqOpts ...RequestOption) (_ *MirrorReport, err error) {
+	ctx, op := startOp(ctx, "MirrorDevice", reqOpts, srcDeviceID, "", nil)
+	defer op.finish(&err)
+
+	start := time.Now()
+	for _, pattern := range append(append([]string(nil), opts.Include...), opts.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("mirror pattern %q: %w", pattern, err)
+		}
+	}
+
+	srcFiles, err := c.listFiles(ctx, srcDeviceID)
+	if err != nil {
+		return nil, err
+	}
+	dstFiles, err := c.listFiles(ctx, dstDeviceID)
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]bool, len(dstFiles))
+	for _, file := range dstFiles {
+		existing[file] = true
+	}
+	sort.Strings(srcFiles)
+
+	report := &MirrorReport{Files: make([]MirrorFile, len(srcFiles))}
+	index := make(map[string]int, len(srcFiles))
+	var mirroring []string
+	for i, file := range srcFiles {
+		index[file] = i
+		report.Files[i] = MirrorFile{Filename: file}
+		if (len(opts.Include) > 0 && !matchesAny(file, opts.Include)) || matchesAny(file, opts.Exclude) {
+			report.Files[i].Status = MirrorExcluded
+			continue
+		}
+		mirroring = append(mirroring, file)
+	}
+
+	// Each file has its own entry in report.Files, so the workers need no lock
+	runEach(mirroring, opts.Concurrency, func(file string) error {
+		entry := &report.Files[index[file]]
+		entry.Status, entry.Err = c.mirrorFile(ctx, srcDeviceID, dstDeviceID, file, existing[file], opts)
+		if entry.Err != nil {
+			entry.Status = MirrorFailed
+		}
+		return entry.Err
+	})
+
+	report.Duration = time.Since(start)
+	return report, report.Err()
+}
+
+// mirrorFile mirrors one file; exists reports whether the destination has it
+func (c *Client) mirrorFile(ctx context.Context, srcDeviceID, dstDeviceID, file string, exists bool, opts MirrorOptions) (MirrorStatus, error) {
+	if err := ctx.Err(); err != nil {
+		return MirrorFailed, err
+	}
+
+	var srcHash string
+	if exists {
+		switch opts.Overwrite {
+		case OverwriteNever:
+			return MirrorSkipped, nil
+		case OverwriteIfDifferent:
+			same, hash, err := c.sameContent(ctx, srcDeviceID, dstDeviceID, file)
+			if err != nil {
+				return MirrorFailed, err
+			}
+			if same {
+				return MirrorIdentical, nil
+			}
+			srcHash = hash
+		}
+	}
+
+	_, job, err := c.copyDevice(ctx, srcDeviceID, dstDeviceID, file, exists)
+	if err != nil {
+		return MirrorFailed, err
+	}
+	if job != nil {
+		if _, err := c.WaitForJob(ctx, job.ID, defaultJobPoll); err != nil {
+			return MirrorFailed, err
+		}
+	}
+
+	if opts.SkipVerify {
+		return MirrorCopied, nil
+	}
+	if srcHash == "" {
+		stats, err := c.treeStats(ctx, srcDeviceID, file)
+		if err != nil {
+			return MirrorFailed, err
+		}
+		srcHash = stats.Hash
+	}
+	stats, err := c.treeStats(ctx, dstDeviceID, file)
+	if err != nil {
+		return MirrorFailed, err
+	}
+	if stats.Hash != srcHash {
+		return MirrorFailed, fmt.Errorf("%s on %s: %w", file, dstDeviceID, ErrChecksumMismatch)
+	}
+	return MirrorCopied, nil
+}
+
+// sameContent reports whether a file has the same content hash on both
+// devices, along with the hash on deviceA
+func (c *Client) sameContent(ctx context.Context, deviceA, deviceB, file string) (bool, string, error) {
+	a, err := c.treeStats(ctx, deviceA, file)
+	if err != nil {
+		return false, "", err
+	}
+	b, err := c.treeStats(ctx, deviceB, file)
+	if err != nil {
+		return false, "", err
+	}
+	return a.Hash == b.Hash, a.Hash, nil
+}
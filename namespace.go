@@ -0,0 +1,71 @@
+package xmlapi
+
+import "net/url"
+
+// pathParams lists the request parameters that carry node paths
+var pathParams = []string{"path", "parent_path"}
+
+// namespaceParams returns params extended with an "xmlns:<prefix>" entry for
+// every registered prefix used by a path parameter, single or repeated. The
+// caller's map is left untouched.
+func (c *Client) namespaceParams(params map[string]string, multi url.Values) map[string]string {
+	if len(c.namespaces) == 0 {
+		return params
+	}
+
+	var paths []string
+	for _, key := range pathParams {
+		paths = append(paths, params[key])
+		paths = append(paths, multi[key]...)
+	}
+
+	var extended map[string]string
+	for _, path := range paths {
+		for _, prefix := range pathPrefixes(path) {
+			uri, ok := c.namespaces[prefix]
+			if !ok {
+				continue
+			}
+			if extended == nil {
+				extended = make(map[string]string, len(params)+1)
+				for k, v := range params {
+					extended[k] = v
+				}
+			}
+			extended["xmlns:"+prefix] = uri
+		}
+	}
+
+	if extended == nil {
+		return params
+	}
+	return extended
+}
+
+// prefixFor returns the registered prefix for a namespace URI, preferring the
+// lexically smallest when several prefixes share it
+func (c *Client) prefixFor(uri string) (string, bool) {
+	found := ""
+	for prefix, u := range c.namespaces {
+		if u == uri && (found == "" || prefix < found) {
+			found = prefix
+		}
+	}
+	return found, found != ""
+}
+
+// pathPrefixes returns the namespace prefixes used by the segments of path
+func pathPrefixes(path string) []string {
+	p, err := parsePath(path)
+	if err != nil {
+		return nil
+	}
+
+	var prefixes []string
+	for _, seg := range p.Segments {
+		if seg.Prefix != "" {
+			prefixes = append(prefixes, seg.Prefix)
+		}
+	}
+	return prefixes
+}
@@ -0,0 +1,78 @@
+package xmlapi
+
+import (
+	"testing"
+)
+
+func TestCreateNodeNSDefaultNamespace(t *testing.T) {
+	g := newFakeGateway(t)
+	g.load("dev", "plan.xml", `<plan/>`)
+	c := g.client()
+
+	if _, err := c.CreateNodeNS("dev", "plan.xml", "/plan", "urn:example:timing", "phase", "1"); err != nil {
+		t.Fatal(err)
+	}
+	create := g.receivedAt("/create")[0]
+	if create.Query.Get("namespace") != "urn:example:timing" || create.Query.Get("tag") != "phase" || create.Query.Has("prefix") {
+		t.Errorf("create query %v, want namespace and tag without a prefix", create.Query)
+	}
+
+	n, err := c.ReadNode("dev", "plan.xml", "/plan/phase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.XMLName != (XMLName{Space: "urn:example:timing", Local: "phase"}) {
+		t.Errorf("name %+v, want phase in urn:example:timing", n.XMLName)
+	}
+	if got, want := mustXML(t, g.file("dev", "plan.xml")), `<plan><phase xmlns="urn:example:timing">1</phase></plan>`; got != want {
+		t.Errorf("document %s\nwant %s", got, want)
+	}
+}
+
+func TestCreateNodeNSPrefixed(t *testing.T) {
+	g := newFakeGateway(t)
+	g.load("dev", "plan.xml", `<plan/>`)
+	c := g.client(WithNamespace("ntcip", "urn:ntcip"))
+
+	if _, err := c.CreateNodeNS("dev", "plan.xml", "/plan", "urn:ntcip", "phase", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := g.receivedAt("/create")[0].Query.Get("prefix"); got != "ntcip" {
+		t.Errorf("prefix = %q, want the registered ntcip", got)
+	}
+
+	// Prefixed paths carry the registered mapping
+	if _, err := c.UpdateNode("dev", "plan.xml", "/plan/ntcip:phase", "2"); err != nil {
+		t.Fatal(err)
+	}
+	update := g.receivedAt("/update")[0]
+	if got := update.Query.Get("xmlns:ntcip"); got != "urn:ntcip" {
+		t.Errorf("xmlns:ntcip = %q, want urn:ntcip", got)
+	}
+
+	n, err := c.ReadNode("dev", "plan.xml", Root().Join("plan").JoinNS("ntcip", "phase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Value != "2" || n.XMLName.Space != "urn:ntcip" {
+		t.Errorf("read %q in %q, want 2 in urn:ntcip", n.Value, n.XMLName.Space)
+	}
+	if got, want := mustXML(t, g.file("dev", "plan.xml")), `<plan><ntcip:phase xmlns:ntcip="urn:ntcip">2</ntcip:phase></plan>`; got != want {
+		t.Errorf("document %s\nwant %s", got, want)
+	}
+}
+
+func TestNamespaceParamsOnlyForUsedPrefixes(t *testing.T) {
+	g := newFakeGateway(t)
+	g.load("dev", "plan.xml", `<plan><phase>1</phase></plan>`)
+	c := g.client(WithNamespace("ntcip", "urn:ntcip"), WithNamespace("other", "urn:other"))
+
+	if _, err := c.ReadNodes("dev", "plan.xml", []string{"/plan/phase"}); err != nil {
+		t.Fatal(err)
+	}
+	for key := range g.receivedAt("/readBulk")[0].Query {
+		if key == "xmlns:ntcip" || key == "xmlns:other" {
+			t.Errorf("unprefixed paths sent %s", key)
+		}
+	}
+}
@@ -0,0 +1,500 @@
+package xmlapi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// NDJSONLine is one line of ExportNDJSON, describing a single element:
+//
+//	{"path":"/plan/phase[2]/minGreen[1]","value":"5","attrs":{"unit":"s"}}
+//
+// Path is the root's name followed by one indexed segment per level, so
+// every element below the root has "[n]" even when it has no siblings of
+// its tag. Attrs maps local names to values and is omitted when the
+// element has none; namespace declarations, namespaces and comments are
+// not exported.
+type NDJSONLine struct {
+	Path  string            `json:"path"`
+	Value string            `json:"value"`
+	Attrs map[string]string `json:"attrs,omitempty"`
+}
+
+// ExportNDJSON writes one NDJSONLine per element of a file to w, in
+// document order, and returns how many it wrote. The root element is read
+// without its children, which are then read a page at a time with
+// Children, so memory is bounded by the largest child of the root rather
+// than the file. Gateways that cannot read partially send the whole
+// document instead.
+func (c *Client) ExportNDJSON(ctx context.Context, w io.Writer, deviceID, filename string, opts ...RequestOption) (_ int, err error) {
+	ctx, op := startOp(ctx, "ExportNDJSON", opts, deviceID, filename, nil)
+	defer op.finish(&err)
+
+	params := map[string]string{
+		"deviceid": deviceID,
+		"filename": filename,
+		"path":     "/",
+		"depth":    "0",
+	}
+	resp, err := c.requestContext(ctx, "GET", "/read", params, nil)
+	if err != nil {
+		return 0, err
+	}
+	var root Node
+	if err := c.decode(resp, &root); err != nil {
+		return 0, err
+	}
+	if !isXMLResponse(resp) {
+		root.normalizeValues()
+	}
+	if err := c.decodeNode(ctx, "/", &root); err != nil {
+		return 0, err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	count := 0
+	rootPath := "/" + escapeSegment(root.XMLName.Local)
+
+	// A gateway that ignores depth has sent every element already
+	if len(root.Nodes) > 0 {
+		err := exportNDJSON(enc, rootPath, &root, &count)
+		return count, err
+	}
+
+	if err := enc.Encode(ndjsonLine(rootPath, &root)); err != nil {
+		return count, err
+	}
+	count++
+	seen := make(map[string]int)
+	for child, err := range c.Children(ctx, deviceID, filename, rootPath) {
+		if err != nil {
+			return count, err
+		}
+		if child.Kind != NodeElement {
+			continue
+		}
+		if err := exportNDJSON(enc, indexedChildPath(rootPath, &child, seen), &child, &count); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// exportNDJSON writes the lines of the subtree at n, found at path
+func exportNDJSON(enc *json.Encoder, path string, n *Node, count *int) error {
+	if err := enc.Encode(ndjsonLine(path, n)); err != nil {
+		return err
+	}
+	*count++
+
+	seen := make(map[string]int)
+	for i := range n.Nodes {
+		child := &n.Nodes[i]
+		if child.Kind != NodeElement {
+			continue
+		}
+		if err := exportNDJSON(enc, indexedChildPath(path, child, seen), child, count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexedChildPath returns the path of the next child of parent, counting
+// the children of each tag seen so far in seen
+func indexedChildPath(parent string, child *Node, seen map[string]int) string {
+	seen[child.XMLName.Local]++
+	return parent + "/" + escapeSegment(child.XMLName.Local) + "[" + strconv.Itoa(seen[child.XMLName.Local]) + "]"
+}
+
+// ndjsonLine describes the element n found at path
+func ndjsonLine(path string, n *Node) NDJSONLine {
+	line := NDJSONLine{Path: path, Value: n.Value}
+	for _, attr := range n.Attrs {
+		if isNamespaceDecl(attr.Name) {
+			continue
+		}
+		if line.Attrs == nil {
+			line.Attrs = make(map[string]string, len(n.Attrs))
+		}
+		line.Attrs[attr.Name.Local] = attr.Value
+	}
+	return line
+}
+
+// The ImportOptions defaults
+const (
+	defaultImportChunkSize = 100
+	defaultImportWindow    = 1000
+)
+
+// ImportOptions configures ImportNDJSON
+type ImportOptions struct {
+	// Strict stops the import at the first line that cannot be imported
+	// instead of reporting it and going on
+	Strict bool
+	// Overwrite replaces an existing file; otherwise it is an error
+	Overwrite bool
+	// ChunkSize is how many elements are created per batch request, 100
+	// when 0
+	ChunkSize int
+	// Window is how many lines may be held back waiting for their parent or
+	// an earlier sibling, 1000 when 0
+	Window int
+}
+
+// LineError is a line ImportNDJSON could not import
+type LineError struct {
+	Line int
+	Err  error
+}
+
+// Error implements the error interface
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// ImportReport is the outcome of ImportNDJSON
+type ImportReport struct {
+	// Lines is the number of non-empty lines read
+	Lines int
+	// Created is the number of elements created, the root included
+	Created int
+	// Errors lists the lines that were not imported, in line order
+	Errors []*LineError
+}
+
+// bulkCreateNode is one element of a /createBulk request
+type bulkCreateNode struct {
+	ParentPath string            `json:"parent_path"`
+	Tag        string            `json:"tag"`
+	Value      string            `json:"value"`
+	Attrs      map[string]string `json:"attrs,omitempty"`
+
+	// path is where the element ends up
+	path string
+}
+
+// bulkCreateRequest represents the body of /createBulk
+type bulkCreateRequest struct {
+	Nodes []bulkCreateNode `json:"nodes"`
+}
+
+// ndjsonEntry is a parsed import line
+type ndjsonEntry struct {
+	line int
+	// path is the element's path with every segment below the root
+	// indexed, parent that of its parent, "" for the root
+	path, parent string
+	tag          string
+	index        int
+	data         NDJSONLine
+}
+
+// ndjsonImport is the state of an ImportNDJSON call
+type ndjsonImport struct {
+	c                  *Client
+	ctx                context.Context
+	deviceID, filename string
+	opts               ImportOptions
+	report             *ImportReport
+
+	// children counts the children created per tag, by the path of every
+	// element created so far
+	children map[string]map[string]int
+	// pending holds the lines waiting for their parent, oldest first
+	pending []*ndjsonEntry
+	batch   []bulkCreateNode
+	noBulk  bool
+}
+
+// ImportNDJSON creates a file from lines in the form of ExportNDJSON. Lines
+// whose parent or earlier siblings come later are held back until those
+// are imported, within ImportOptions.Window lines. Elements are created in
+// chunks through the gateway's /createBulk where available, and one by one
+// otherwise. Lines that are malformed, duplicate or never find their parent
+// are listed in the report, unless Strict is set, which returns the first
+// as a *LineError. A gateway failure ends the import with its error; the
+// report is returned either way.
+func (c *Client) ImportNDJSON(ctx context.Context, deviceID, filename string, r io.Reader, opts ImportOptions, reqOpts ...RequestOption) (_ *ImportReport, err error) {
+	ctx, op := startOp(ctx, "ImportNDJSON", reqOpts, deviceID, filename, nil)
+	defer op.finish(&err)
+
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = defaultImportChunkSize
+	}
+	if opts.Window <= 0 {
+		opts.Window = defaultImportWindow
+	}
+	imp := &ndjsonImport{
+		c:        c,
+		ctx:      ctx,
+		deviceID: deviceID,
+		filename: filename,
+		opts:     opts,
+		report:   &ImportReport{},
+		children: make(map[string]map[string]int),
+	}
+
+	br := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		text, readErr := br.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return imp.report, readErr
+		}
+		if len(bytes.TrimSpace(text)) > 0 {
+			imp.report.Lines++
+			entry, err := parseNDJSONLine(line, text)
+			if err != nil {
+				err = imp.reject(line, err)
+			} else {
+				err = imp.add(entry)
+			}
+			if err != nil {
+				return imp.report, err
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+	}
+
+	for _, entry := range imp.pending {
+		if err := imp.reject(entry.line, fmt.Errorf("%s: parent or earlier sibling missing", entry.path)); err != nil {
+			return imp.report, err
+		}
+	}
+	imp.pending = nil
+	sort.SliceStable(imp.report.Errors, func(i, j int) bool {
+		return imp.report.Errors[i].Line < imp.report.Errors[j].Line
+	})
+	if err := imp.flush(); err != nil {
+		return imp.report, err
+	}
+	return imp.report, nil
+}
+
+// parseNDJSONLine parses and checks one import line
+func parseNDJSONLine(line int, text []byte) (*ndjsonEntry, error) {
+	var data NDJSONLine
+	if err := json.Unmarshal(text, &data); err != nil {
+		return nil, err
+	}
+	p, err := parsePath(data.Path)
+	if err != nil {
+		return nil, err
+	}
+	if !p.Absolute || len(p.Segments) == 0 {
+		return nil, fmt.Errorf("%q is not an absolute element path", data.Path)
+	}
+	for i := range p.Segments {
+		seg := &p.Segments[i]
+		if seg.Attr || seg.Wildcard {
+			return nil, fmt.Errorf("%q is not an element path", data.Path)
+		}
+		// The root is never indexed, unindexed elements below it are first
+		if i == 0 && seg.Index > 1 {
+			return nil, fmt.Errorf("%q: the root element cannot repeat", data.Path)
+		}
+		if i == 0 {
+			seg.Index = 0
+		} else if seg.Index == 0 {
+			seg.Index = 1
+		}
+	}
+
+	last := p.Segments[len(p.Segments)-1]
+	entry := &ndjsonEntry{line: line, path: p.String(), tag: last.Local, index: last.Index, data: data}
+	if last.Prefix != "" {
+		entry.tag = last.Prefix + ":" + last.Local
+	}
+	if len(p.Segments) > 1 {
+		entry.parent = p.prefix(len(p.Segments) - 1).String()
+	}
+	return entry, nil
+}
+
+// reject reports a line that cannot be imported, returning it as the error
+// of the import when Strict is set
+func (imp *ndjsonImport) reject(line int, err error) error {
+	lineErr := &LineError{Line: line, Err: err}
+	imp.report.Errors = append(imp.report.Errors, lineErr)
+	if imp.opts.Strict {
+		return lineErr
+	}
+	return nil
+}
+
+// placeable reports whether the parent and earlier siblings of entry have
+// been created
+func (imp *ndjsonImport) placeable(entry *ndjsonEntry) bool {
+	if entry.parent == "" {
+		return len(imp.children) == 0
+	}
+	siblings, ok := imp.children[entry.parent]
+	return ok && siblings[entry.tag] == entry.index-1
+}
+
+// add creates entry, or holds it back until it is placeable
+func (imp *ndjsonImport) add(entry *ndjsonEntry) error {
+	if !imp.placeable(entry) {
+		if err := imp.duplicate(entry); err != nil {
+			return imp.reject(entry.line, err)
+		}
+		imp.pending = append(imp.pending, entry)
+		if len(imp.pending) <= imp.opts.Window {
+			return nil
+		}
+		oldest := imp.pending[0]
+		imp.pending = imp.pending[1:]
+		return imp.reject(oldest.line, fmt.Errorf("%s: parent or earlier sibling not found within %d lines", oldest.path, imp.opts.Window))
+	}
+
+	if err := imp.place(entry); err != nil {
+		return err
+	}
+	// Creating entry may have made held back lines placeable
+	for i := 0; i < len(imp.pending); i++ {
+		held := imp.pending[i]
+		dupErr := imp.duplicate(held)
+		if dupErr == nil && !imp.placeable(held) {
+			continue
+		}
+		imp.pending = append(imp.pending[:i], imp.pending[i+1:]...)
+		if dupErr != nil {
+			if err := imp.reject(held.line, dupErr); err != nil {
+				return err
+			}
+		} else if err := imp.place(held); err != nil {
+			return err
+		}
+		i = -1
+	}
+	return nil
+}
+
+// duplicate returns an error if entry names an element that was already
+// created
+func (imp *ndjsonImport) duplicate(entry *ndjsonEntry) error {
+	if entry.parent == "" {
+		if len(imp.children) > 0 {
+			return fmt.Errorf("%s: second root element", entry.path)
+		}
+		return nil
+	}
+	if siblings, ok := imp.children[entry.parent]; ok && siblings[entry.tag] >= entry.index {
+		return fmt.Errorf("%s: duplicate element", entry.path)
+	}
+	return nil
+}
+
+// place creates the root at once and queues every other element for the
+// next batch
+func (imp *ndjsonImport) place(entry *ndjsonEntry) error {
+	imp.children[entry.path] = make(map[string]int)
+	if entry.parent != "" {
+		imp.children[entry.parent][entry.tag]++
+		imp.batch = append(imp.batch, bulkCreateNode{
+			ParentPath: entry.parent,
+			Tag:        entry.tag,
+			Value:      entry.data.Value,
+			Attrs:      entry.data.Attrs,
+			path:       entry.path,
+		})
+		if len(imp.batch) >= imp.opts.ChunkSize {
+			return imp.flush()
+		}
+		return nil
+	}
+
+	c, ctx := imp.c, imp.ctx
+	if imp.opts.Overwrite {
+		if _, err := c.deleteFile(ctx, imp.deviceID, imp.filename); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+	if _, err := c.createFile(ctx, imp.deviceID, imp.filename, entry.tag); err != nil {
+		return err
+	}
+	imp.report.Created++
+	if entry.data.Value != "" {
+		if _, err := c.updateNode(ctx, imp.deviceID, imp.filename, entry.path, entry.data.Value); err != nil {
+			return err
+		}
+	}
+	return imp.setAttrs(entry.path, entry.data.Attrs)
+}
+
+// flush creates the queued elements
+func (imp *ndjsonImport) flush() error {
+	if len(imp.batch) == 0 {
+		return nil
+	}
+	c, ctx := imp.c, imp.ctx
+	if !imp.noBulk {
+		params := map[string]string{
+			"deviceid": imp.deviceID,
+			"filename": imp.filename,
+		}
+		nodes := make([]bulkCreateNode, len(imp.batch))
+		for i, n := range imp.batch {
+			value, err := c.encodeValue(ctx, n.path, n.Value)
+			if err != nil {
+				return err
+			}
+			nodes[i] = n
+			nodes[i].Value = value
+		}
+		_, err := c.statusRequestContext(ctx, "POST", "/createBulk", params, bulkCreateRequest{Nodes: nodes})
+		if err == nil {
+			imp.report.Created += len(imp.batch)
+			imp.batch = imp.batch[:0]
+			return nil
+		}
+		if !errors.Is(err, ErrUnsupportedByServer) {
+			return err
+		}
+		imp.noBulk = true
+	}
+
+	for len(imp.batch) > 0 {
+		n := imp.batch[0]
+		if _, err := c.createNode(ctx, imp.deviceID, imp.filename, n.ParentPath, n.Tag, n.Value); err != nil {
+			return err
+		}
+		imp.report.Created++
+		imp.batch = imp.batch[1:]
+		if err := imp.setAttrs(n.path, n.Attrs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setAttrs sets the attributes of the element at path in name order
+func (imp *ndjsonImport) setAttrs(path string, attrs map[string]string) error {
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := imp.c.setAttribute(imp.ctx, imp.deviceID, imp.filename, path, name, attrs[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package xmlapi
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+)
+
+const ndjsonDoc = `<plan xmlns:t="urn:timing" version="3">` +
+	`<phase id="1" mode="fixed"><minGreen>5</minGreen><!--fallback--><maxGreen>30</maxGreen></phase>` +
+	`<note><![CDATA[a < b & "c"]]></note>` +
+	`<phase id="2"><minGreen>7</minGreen><minGreen>8</minGreen></phase>` +
+	`<detector name="Zürich"/>` +
+	`</plan>`
+
+func TestExportNDJSONGolden(t *testing.T) {
+	want, err := os.ReadFile("testdata/plan.ndjson")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		loose bool
+	}{
+		{name: "paged children"},
+		// A gateway ignoring depth sends the whole document at once
+		{name: "whole document", loose: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := newFakeGateway(t)
+			g.loose = tc.loose
+			g.load("dev", "plan.xml", ndjsonDoc)
+			c := g.client()
+
+			var out bytes.Buffer
+			n, err := c.ExportNDJSON(context.Background(), &out, "dev", "plan.xml")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != 9 {
+				t.Errorf("ExportNDJSON = %d, want 9 elements", n)
+			}
+			if !bytes.Equal(out.Bytes(), want) {
+				t.Errorf("exported\n%s\nwant testdata/plan.ndjson\n%s", out.Bytes(), want)
+			}
+		})
+	}
+}
+
+func TestNDJSONRoundTrip(t *testing.T) {
+	const doc = `<plan version="3">` +
+		`<phase id="1" mode="fixed"><minGreen>5</minGreen><maxGreen>30</maxGreen></phase>` +
+		`<note>a &lt; b &amp; "c"</note>` +
+		`<phase id="2"><minGreen>7</minGreen><minGreen>8</minGreen></phase>` +
+		`<detector name="Zürich"/>` +
+		`</plan>`
+
+	for _, tc := range []struct {
+		name     string
+		disabled []string
+		opts     ImportOptions
+		reverse  bool
+		// endpoint and requests are where the elements below the root are
+		// created, and in how many requests
+		endpoint string
+		requests int
+	}{
+		{name: "bulk create", endpoint: "/createBulk", requests: 1},
+		{name: "small chunks", opts: ImportOptions{ChunkSize: 2}, endpoint: "/createBulk", requests: 4},
+		{name: "one by one", disabled: []string{"/createBulk"}, endpoint: "/create", requests: 8},
+		{name: "children first", reverse: true, endpoint: "/createBulk", requests: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := newFakeGateway(t)
+			g.load("dev", "plan.xml", doc)
+			g.disable(tc.disabled...)
+			c := g.client()
+
+			var exported bytes.Buffer
+			if _, err := c.ExportNDJSON(context.Background(), &exported, "dev", "plan.xml"); err != nil {
+				t.Fatal(err)
+			}
+			lines := bytes.SplitAfter(exported.Bytes(), []byte("\n"))
+			if tc.reverse {
+				for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+					lines[i], lines[j] = lines[j], lines[i]
+				}
+			}
+
+			report, err := c.ImportNDJSON(context.Background(), "dev", "copy.xml", bytes.NewReader(bytes.Join(lines, []byte("\n"))), tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Created != 9 || len(report.Errors) != 0 {
+				t.Errorf("report %+v, want 9 elements created without errors", report)
+			}
+			if n := len(g.receivedAt(tc.endpoint)); n != tc.requests {
+				t.Errorf("%d requests to %s, want %d", n, tc.endpoint, tc.requests)
+			}
+
+			original, err := c.ReadFile("dev", "plan.xml")
+			if err != nil {
+				t.Fatal(err)
+			}
+			imported, err := c.ReadFile("dev", "copy.xml")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if changes := Diff(original, imported); len(changes) != 0 {
+				t.Errorf("imported file differs: %+v\noriginal %s\nimported %s", changes, mustXML(t, original), mustXML(t, imported))
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package xmlapi
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxDumpValue is the number of characters of a value shown by Dump
+const maxDumpValue = 60
+
+// ValueKind describes how the text of a node is stored on the gateway
+type ValueKind int
+
+const (
+	// ValueText is ordinary character data, stored escaped
+	ValueText ValueKind = iota
+	// ValueCDATA is stored verbatim inside a CDATA section
+	ValueCDATA
+)
+
+// String returns the wire name of the value kind
+func (k ValueKind) String() string {
+	switch k {
+	case ValueText:
+		return "text"
+	case ValueCDATA:
+		return "cdata"
+	}
+	return fmt.Sprintf("ValueKind(%d)", int(k))
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (k ValueKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (k *ValueKind) UnmarshalText(text []byte) error {
+	switch strings.ToLower(string(text)) {
+	case "", "text":
+		*k = ValueText
+	case "cdata":
+		*k = ValueCDATA
+	default:
+		return fmt.Errorf("unknown value kind %q", text)
+	}
+	return nil
+}
+
+// NodeKind distinguishes elements from the other node types kept in a tree
+type NodeKind int
+
+const (
+	// NodeElement is an XML element
+	NodeElement NodeKind = iota
+	// NodeComment is an XML comment; its text is held in Value
+	NodeComment
+)
+
+// String returns the wire name of the node kind
+func (k NodeKind) String() string {
+	switch k {
+	case NodeElement:
+		return "element"
+	case NodeComment:
+		return "comment"
+	}
+	return fmt.Sprintf("NodeKind(%d)", int(k))
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (k NodeKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (k *NodeKind) UnmarshalText(text []byte) error {
+	switch strings.ToLower(string(text)) {
+	case "", "element":
+		*k = NodeElement
+	case "comment":
+		*k = NodeComment
+	default:
+		return fmt.Errorf("unknown node kind %q", text)
+	}
+	return nil
+}
+
+// normalizeValues fills RawValue with the text exactly as the gateway stored it
+// and turns Value into the unescaped text, so that writing Value back does not
+// escape it a second time
+func (n *Node) normalizeValues() {
+	stack := []*Node{n}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if node.RawValue == "" {
+			node.RawValue = node.Value
+		}
+		if node.Kind == NodeElement && node.ValueKind == ValueText {
+			node.Value = unescapeText(node.RawValue)
+		} else {
+			node.Value = node.RawValue
+		}
+
+		for i := range node.Nodes {
+			stack = append(stack, &node.Nodes[i])
+		}
+	}
+}
+
+// unescapeText resolves the entity and character references in escaped
+// character data, returning s unchanged if it is not valid escaped text
+func unescapeText(s string) string {
+	if !strings.ContainsRune(s, '&') {
+		return s
+	}
+
+	var v struct {
+		Text string `xml:",chardata"`
+	}
+	if err := xml.Unmarshal([]byte("<v>"+s+"</v>"), &v); err != nil {
+		return s
+	}
+
+	return v.Text
+}
+
+// String renders the tree as indented text, one node per line
+func (n *Node) String() string {
+	var b strings.Builder
+	n.Dump(&b, 0)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// Dump writes the tree to w as indented text, one node per line, in the form
+// `phase[id=3] = "12"`. Levels below maxDepth are summarised by their child
+// count; maxDepth <= 0 renders the whole tree. Values longer than 60
+// characters are truncated.
+func (n *Node) Dump(w io.Writer, maxDepth int) error {
+	bw := bufio.NewWriter(w)
+	if n == nil {
+		bw.WriteString("<nil>\n")
+		return bw.Flush()
+	}
+
+	type entry struct {
+		node  *Node
+		depth int
+	}
+	stack := []entry{{n, 0}}
+	for len(stack) > 0 {
+		e := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		bw.WriteString(strings.Repeat("  ", e.depth))
+		if e.node.Kind == NodeComment {
+			bw.WriteString("<!--" + truncateValue(e.node.Value, maxDumpValue) + "-->\n")
+			continue
+		}
+
+		bw.WriteString(e.node.XMLName.Local)
+		if len(e.node.Attrs) > 0 {
+			attrs := make([]string, len(e.node.Attrs))
+			for i, attr := range e.node.Attrs {
+				value := attr.Value
+				if value == "" || strings.ContainsAny(value, " \t\n\"[]=") {
+					value = strconv.Quote(value)
+				}
+				attrs[i] = attr.Name.Local + "=" + value
+			}
+			bw.WriteString("[" + strings.Join(attrs, " ") + "]")
+		}
+		if e.node.Value != "" {
+			bw.WriteString(" = " + strconv.Quote(truncateValue(e.node.Value, maxDumpValue)))
+		}
+
+		if maxDepth > 0 && e.depth+1 >= maxDepth && len(e.node.Nodes) > 0 {
+			fmt.Fprintf(bw, " (%d children)\n", len(e.node.Nodes))
+			continue
+		}
+		bw.WriteString("\n")
+
+		// Push in reverse so children come out in document order
+		for i := len(e.node.Nodes) - 1; i >= 0; i-- {
+			stack = append(stack, entry{&e.node.Nodes[i], e.depth + 1})
+		}
+	}
+
+	return bw.Flush()
+}
+
+// truncateValue shortens long values for display
+func truncateValue(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "..."
+}
+
+// Clone returns a deep copy of the tree rooted at n
+func (n *Node) Clone() *Node {
+	if n == nil {
+		return nil
+	}
+	c := *n
+	if n.Meta != nil {
+		meta := *n.Meta
+		c.Meta = &meta
+	}
+	if n.Attrs != nil {
+		c.Attrs = append([]Attr(nil), n.Attrs...)
+	}
+	if n.Nodes != nil {
+		c.Nodes = make([]Node, len(n.Nodes))
+		for i := range n.Nodes {
+			c.Nodes[i] = *n.Nodes[i].Clone()
+		}
+	}
+	return &c
+}
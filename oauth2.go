@@ -0,0 +1,194 @@
+package xmlapi
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// oauth2RefreshMargin is how long before expiry an OAuth2 token is replaced
+const oauth2RefreshMargin = 30 * time.Second
+
+// maxOAuth2Response caps the size of a token endpoint response
+const maxOAuth2Response = 1 << 20
+
+// WithOAuth2 authenticates with bearer tokens from an OAuth2 token endpoint
+// using the client-credentials grant, instead of the authorize endpoint.
+// Tokens are cached and fetched again shortly before they expire.
+func WithOAuth2(tokenURL, clientID, clientSecret string, scopes []string) Option {
+	return func(c *Client) {
+		c.auth = &oauth2Auth{
+			c:            c,
+			tokenURL:     tokenURL,
+			clientID:     clientID,
+			clientSecret: clientSecret,
+			scopes:       append([]string(nil), scopes...),
+		}
+	}
+}
+
+// oauth2Auth is the OAuth2 client-credentials scheme
+type oauth2Auth struct {
+	c            *Client
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	scopes       []string
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+	// fetching is the token request in progress, if any
+	fetching *authCall
+}
+
+// oauth2TokenResponse represents the response of an OAuth2 token endpoint
+type oauth2TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Error       string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+// setAuthorization implements authProvider. Tokens are per client, so
+// deviceID is ignored.
+func (a *oauth2Auth) setAuthorization(ctx context.Context, req *http.Request, deviceID string) error {
+	a.mu.Lock()
+	token, expires := a.token, a.expires
+	a.mu.Unlock()
+
+	if token == "" || (!expires.IsZero() && time.Until(expires) < oauth2RefreshMargin) {
+		if err := a.refresh(ctx, deviceID); err != nil {
+			return err
+		}
+		a.mu.Lock()
+		token = a.token
+		a.mu.Unlock()
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// refreshable implements authProvider
+func (a *oauth2Auth) refreshable() bool {
+	return true
+}
+
+// refresh implements authProvider by fetching a new token. Concurrent
+// callers wait for a single token request instead of each making one.
+func (a *oauth2Auth) refresh(ctx context.Context, deviceID string) error {
+	a.mu.Lock()
+	if call := a.fetching; call != nil {
+		a.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	call := &authCall{done: make(chan struct{})}
+	a.fetching = call
+	a.mu.Unlock()
+
+	call.err = a.fetchToken(ctx)
+
+	a.mu.Lock()
+	a.fetching = nil
+	a.mu.Unlock()
+	close(call.done)
+	return call.err
+}
+
+// fetchToken requests a new token from the token endpoint. The request
+// stands in for /authorize, so it takes that endpoint's timeout.
+func (a *oauth2Auth) fetchToken(ctx context.Context) error {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(a.scopes) > 0 {
+		form.Set("scope", strings.Join(a.scopes, " "))
+	}
+
+	parent := ctx
+	if timeout := a.c.timeoutFor(ctx, "/authorize"); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", a.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(url.QueryEscape(a.clientID), url.QueryEscape(a.clientSecret))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	for key, values := range withCallHeader(nil, requestConfig(ctx).header) {
+		req.Header[key] = values
+	}
+
+	resp, err := a.c.do(req)
+	if err != nil {
+		return attemptTimeout(parent, req, err)
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			a.c.logger.Printf("Error closing body: %v", err)
+		}
+	}(resp.Body)
+
+	respBody, err := readBody(ctx, io.LimitReader(resp.Body, maxOAuth2Response+1))
+	if err != nil {
+		return attemptTimeout(parent, req, transportError(req, err))
+	}
+	if len(respBody) > maxOAuth2Response {
+		return &APIError{
+			StatusCode: resp.StatusCode,
+			Message:    fmt.Sprintf("oauth2: token response exceeds %d bytes", maxOAuth2Response),
+		}
+	}
+
+	if resp.StatusCode >= 400 {
+		a.c.logger.Printf("OAuth2 token request failed with status: %d, response: %s", resp.StatusCode, respBody)
+		return newAPIError(resp.StatusCode, resp.Header, respBody)
+	}
+
+	var result oauth2TokenResponse
+	err = a.c.decode(&Response{StatusCode: resp.StatusCode, Header: resp.Header, Body: respBody}, &result)
+	if err != nil {
+		return err
+	}
+	if result.Error != "" {
+		return &APIError{
+			StatusCode: resp.StatusCode,
+			Message:    fmt.Sprintf("oauth2: %s: %s", result.Error, result.Description),
+			Body:       respBody,
+			Code:       result.Error,
+		}
+	}
+	if result.AccessToken == "" {
+		return &APIError{
+			StatusCode: resp.StatusCode,
+			Message:    "oauth2: token endpoint returned no access token",
+			Body:       respBody,
+		}
+	}
+
+	var expires time.Time
+	if result.ExpiresIn > 0 {
+		expires = time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
+	}
+
+	a.mu.Lock()
+	a.token = result.AccessToken
+	a.expires = expires
+	a.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,198 @@
+package xmlapi
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// oauth2Token is the token the fake token endpoint issues
+const oauth2Token = "oauth2-token"
+
+// tokenEndpoint makes g serve an OAuth2 token endpoint at /token, answering
+// with respond, or issuing oauth2Token when respond is nil
+func (g *fakeGateway) tokenEndpoint(respond func(w http.ResponseWriter, r *http.Request)) {
+	g.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/token" {
+			return false
+		}
+		if respond != nil {
+			respond(w, r)
+			return true
+		}
+		g.mu.Lock()
+		g.tokens["Bearer "+oauth2Token] = ""
+		g.mu.Unlock()
+		writeJSON(w, http.StatusOK, oauth2TokenResponse{AccessToken: oauth2Token, TokenType: "Bearer", ExpiresIn: 3600})
+		return true
+	}
+}
+
+// oauth2Client returns a client of g authenticating at g's token endpoint
+func (g *fakeGateway) oauth2Client(opts ...Option) *Client {
+	opts = append([]Option{WithOAuth2(g.URL()+"/token", "id", "secret", nil)}, opts...)
+	return g.client(opts...)
+}
+
+func TestOAuth2RefreshOnce(t *testing.T) {
+	const callers = 16
+
+	g := newFakeGateway(t)
+	g.load("dev", "plan.xml", planDoc)
+	g.tokenEndpoint(nil)
+	// A slow token endpoint keeps every caller waiting on it
+	serve := g.intercept
+	g.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path == "/token" {
+			time.Sleep(20 * time.Millisecond)
+		}
+		return serve(w, r)
+	}
+	c := g.oauth2Client()
+
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.ReadNode("dev", "plan.xml", "/plan"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := len(g.receivedAt("/token")); n != 1 {
+		t.Errorf("%d token requests, want 1", n)
+	}
+	for _, read := range g.receivedAt("/read") {
+		if got := read.Header.Get("Authorization"); got != "Bearer "+oauth2Token {
+			t.Errorf("read with Authorization %q, want the issued token", got)
+		}
+	}
+}
+
+func TestOAuth2TokenRequestHeader(t *testing.T) {
+	g := newFakeGateway(t)
+	g.load("dev", "plan.xml", planDoc)
+	g.tokenEndpoint(nil)
+	c := g.oauth2Client()
+
+	_, err := c.ReadNode("dev", "plan.xml", "/plan", RequestHeader("X-Request-Id", "abc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens := g.receivedAt("/token")
+	if len(tokens) != 1 {
+		t.Fatalf("%d token requests, want 1", len(tokens))
+	}
+	if got := tokens[0].Header.Get("X-Request-Id"); got != "abc" {
+		t.Errorf("token request X-Request-Id %q, want %q", got, "abc")
+	}
+	if _, _, ok := (&http.Request{Header: tokens[0].Header}).BasicAuth(); !ok {
+		t.Error("token request lost its client credentials")
+	}
+}
+
+func TestOAuth2TokenErrors(t *testing.T) {
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	tests := []struct {
+		name     string
+		respond  func(w http.ResponseWriter, r *http.Request)
+		tokenURL string
+		opts     []Option
+		// timeout is set when the error is a timed-out TransportError
+		timeout   bool
+		transport bool
+		code      string
+	}{
+		{
+			name: "oversized response",
+			respond: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"access_token":"` + strings.Repeat("x", maxOAuth2Response) + `"}`))
+			},
+		},
+		{
+			name: "error response",
+			respond: func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(w, http.StatusOK, oauth2TokenResponse{Error: "invalid_scope", Description: "unknown scope"})
+			},
+			code: "invalid_scope",
+		},
+		{
+			name: "no access token",
+			respond: func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(w, http.StatusOK, oauth2TokenResponse{TokenType: "Bearer"})
+			},
+		},
+		{
+			name: "refused credentials",
+			respond: func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(w, http.StatusUnauthorized, oauth2TokenResponse{Error: "invalid_client"})
+			},
+		},
+		{
+			name:      "connection refused",
+			tokenURL:  closed.URL + "/token",
+			transport: true,
+		},
+		{
+			name: "token request timeout",
+			respond: func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-r.Context().Done():
+				case <-time.After(5 * time.Second):
+				}
+			},
+			opts:      []Option{WithEndpointTimeout("/authorize", 50*time.Millisecond)},
+			transport: true,
+			timeout:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newFakeGateway(t)
+			g.load("dev", "plan.xml", planDoc)
+			if tt.respond != nil {
+				g.tokenEndpoint(tt.respond)
+			}
+			tokenURL := tt.tokenURL
+			if tokenURL == "" {
+				tokenURL = g.URL() + "/token"
+			}
+			c := g.client(append(tt.opts, WithOAuth2(tokenURL, "id", "secret", nil))...)
+
+			_, err := c.ReadNode("dev", "plan.xml", "/plan")
+			if err == nil {
+				t.Fatal("read succeeded without a token")
+			}
+			var transportErr *TransportError
+			var apiErr *APIError
+			switch {
+			case tt.transport:
+				if !errors.As(err, &transportErr) {
+					t.Fatalf("error %T %v, want a *TransportError", err, err)
+				}
+				if transportErr.Timeout != tt.timeout {
+					t.Errorf("Timeout %v, want %v", transportErr.Timeout, tt.timeout)
+				}
+			case !errors.As(err, &apiErr):
+				t.Fatalf("error %T %v, want an *APIError", err, err)
+			case apiErr.Code != tt.code:
+				t.Errorf("Code %q, want %q", apiErr.Code, tt.code)
+			}
+			if n := len(g.receivedAt("/read")); n != 0 {
+				t.Errorf("%d reads sent without a token, want 0", n)
+			}
+		})
+	}
+}
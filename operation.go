@@ -0,0 +1,140 @@
+package xmlapi
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// identifyingParams are the request parameters shown in an OpError; the
+// values of all others are redacted
+var identifyingParams = map[string]bool{
+	"deviceid":    true,
+	"filename":    true,
+	"path":        true,
+	"parent_path": true,
+}
+
+// OpError annotates an error with the call that failed. Unwrap reaches the
+// underlying error, so errors.Is and errors.As see through it.
+type OpError struct {
+	// Op is the method of Client that failed, e.g. "UpdateNode"
+	Op string
+	// Request is the HTTP method and endpoint of the request that failed,
+	// e.g. "PUT /update", or empty if the call failed before sending one
+	Request  string
+	DeviceID string
+	Filename string
+	Path     string
+	// Params lists the names of the other parameters sent; their values
+	// are left out since they may be sensitive
+	Params []string
+	Err    error
+}
+
+// Error implements the error interface
+func (e *OpError) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Op)
+	if e.DeviceID != "" {
+		b.WriteString(" device=" + e.DeviceID)
+	}
+	if e.Filename != "" {
+		b.WriteString(" file=" + e.Filename)
+	}
+	if e.Path != "" {
+		b.WriteString(" path=" + e.Path)
+	}
+	for _, name := range e.Params {
+		b.WriteString(" " + name + "=...")
+	}
+	b.WriteString(": ")
+	b.WriteString(e.Err.Error())
+	return b.String()
+}
+
+// Unwrap returns the underlying error
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// operation describes a call, or one of its requests, for annotating its
+// errors
+type operation struct {
+	op       string
+	request  string
+	endpoint string
+	deviceID string
+	filename string
+	path     string
+	params   []string
+}
+
+// startOp begins a call of the Client method name, on deviceID, filename
+// and path where the method takes them. The returned context carries opts
+// and names the method, so errors of the requests made for the call are
+// annotated with it; errors the call fails with before sending a request
+// are annotated by the operation's finish method, deferred by name. A call
+// made by another method keeps that method's name.
+func startOp(ctx context.Context, name string, opts []RequestOption, deviceID, filename string, path PathLike) (context.Context, *operation) {
+	ctx = withRequestOptions(ctx, opts)
+	cfg := requestConfig(ctx)
+	if cfg.method == "" {
+		cfg.method = name
+		ctx = context.WithValue(ctx, callConfigKey{}, cfg)
+	}
+	op := &operation{op: cfg.method, deviceID: deviceID, filename: filename}
+	op.path, _ = PathString(path)
+	return ctx, op
+}
+
+// finish annotates the error *err a call failed with, unless a request
+// already did
+func (op *operation) finish(err *error) {
+	*err = op.wrap(*err)
+}
+
+// newOperation describes a request to endpoint with params, made for the
+// method ctx names or else annotated with the request itself
+func newOperation(ctx context.Context, method, endpoint string, params map[string]string) *operation {
+	op := &operation{
+		op:       requestConfig(ctx).method,
+		request:  method + " " + endpoint,
+		endpoint: endpoint,
+		deviceID: params["deviceid"],
+		filename: params["filename"],
+		path:     params["path"],
+	}
+	if op.op == "" {
+		op.op = op.request
+	}
+	if op.path == "" {
+		op.path = params["parent_path"]
+	}
+	for name := range params {
+		if !identifyingParams[name] {
+			op.params = append(op.params, name)
+		}
+	}
+	sort.Strings(op.params)
+	return op
+}
+
+// wrap annotates err with the operation. Errors already annotated, and any
+// error when op is nil, are returned as they are.
+func (op *operation) wrap(err error) error {
+	var opErr *OpError
+	if op == nil || err == nil || errors.As(err, &opErr) {
+		return err
+	}
+	return &OpError{
+		Op:       op.op,
+		Request:  op.request,
+		DeviceID: op.deviceID,
+		Filename: op.filename,
+		Path:     op.path,
+		Params:   op.params,
+		Err:      err,
+	}
+}
@@ -0,0 +1,166 @@
+package xmlapi
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestOpError(t *testing.T) {
+	g := newFakeGateway(t)
+	g.load("dev", "plan.xml", planDoc)
+	c := g.client()
+	encrypting := g.client(WithFieldEncryption(make([]byte, 32), []string{"/plan/phase/minGreen"}))
+	g.mu.Lock()
+	g.files["dev"]["plan.xml"].Nodes[0].Nodes[0].Value = encryptedPrefix + "garbled"
+	g.mu.Unlock()
+
+	for _, tc := range []struct {
+		name string
+		call func() error
+		// op is the method reported, request the request that failed,
+		// empty when the call failed before sending one
+		op, request, path string
+		is                error
+		// as, if set, is the target errors.As must match instead of is
+		as interface{}
+		// local is set for failures found by the client, not the gateway
+		local bool
+		// nested is set for calls describing the failed step in their own
+		// message around the annotated error
+		nested bool
+	}{
+		{
+			name: "read",
+			call: func() error { _, err := c.ReadNode("dev", "plan.xml", "/plan/missing"); return err },
+			op:   "ReadNode", request: "GET /read", path: "/plan/missing", is: ErrNotFound,
+		},
+		{
+			name: "update",
+			call: func() error { _, err := c.UpdateNode("dev", "plan.xml", "/plan/missing", "hunter2"); return err },
+			op:   "UpdateNode", request: "PUT /update", path: "/plan/missing", is: ErrNotFound,
+		},
+		{
+			name: "create under a parent",
+			call: func() error {
+				_, err := c.CreateNode("dev", "plan.xml", "/plan/missing", "phase", "hunter2")
+				return err
+			},
+			op: "CreateNode", request: "POST /create", path: "/plan/missing", is: ErrNotFound,
+		},
+		{
+			name: "typed update",
+			call: func() error { _, err := c.UpdateNodeInt("dev", "plan.xml", "/plan/missing", 6); return err },
+			op:   "UpdateNodeInt", request: "PUT /update", path: "/plan/missing", is: ErrNotFound,
+		},
+		{
+			name: "request of a composite call",
+			call: func() error {
+				_, err := c.ApplyPatch(context.Background(), "dev", "plan.xml", []PatchOp{{Op: PatchReplace, Path: "/plan/missing", Value: "hunter2"}})
+				return err
+			},
+			op: "ApplyPatch", request: "GET /read", path: "/plan/missing", is: ErrNotFound, nested: true,
+		},
+		{
+			name: "attribute",
+			call: func() error { _, err := c.GetAttribute("dev", "plan.xml", "/plan", "missing"); return err },
+			op:   "GetAttribute", request: "GET /read", path: "/plan", is: ErrAttrNotFound, local: true,
+		},
+		{
+			name: "invalid path",
+			call: func() error { _, err := c.ReadNode("dev", "plan.xml", 42); return err },
+			op:   "ReadNode", is: ErrInvalidPath, local: true,
+		},
+		{
+			name: "malformed upload",
+			call: func() error {
+				_, err := c.UploadFile("dev", "plan.xml", strings.NewReader("<plan><phase></plan>"), true)
+				return err
+			},
+			op: "UploadFile", as: new(XMLError), local: true,
+		},
+		{
+			name: "undecryptable value",
+			call: func() error { _, err := encrypting.ReadNode("dev", "plan.xml", "/plan/phase[1]/minGreen"); return err },
+			op:   "ReadNode", path: "/plan/phase[1]/minGreen", is: ErrDecryptionFailed, local: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.call()
+			var opErr *OpError
+			if !errors.As(err, &opErr) {
+				t.Fatalf("error %v, want an *OpError", err)
+			}
+			if opErr.Op != tc.op || opErr.Request != tc.request || opErr.DeviceID != "dev" || opErr.Filename != "plan.xml" || opErr.Path != tc.path {
+				t.Errorf("OpError %+v, want %s (%q) on dev plan.xml %s", opErr, tc.op, tc.request, tc.path)
+			}
+			if tc.as != nil {
+				if !errors.As(err, tc.as) {
+					t.Errorf("%v does not unwrap to %T", err, tc.as)
+				}
+			} else if !errors.Is(err, tc.is) {
+				t.Errorf("%v does not match %v", err, tc.is)
+			}
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) && !tc.local {
+				t.Errorf("%v does not unwrap to an *APIError", err)
+			}
+			if errors.As(opErr.Err, new(*OpError)) {
+				t.Errorf("%v is annotated twice", err)
+			}
+
+			msg := err.Error()
+			prefix := tc.op + " device=dev file=plan.xml"
+			if tc.path != "" {
+				prefix += " path=" + tc.path
+			}
+			if !strings.HasPrefix(msg, prefix) && !(tc.nested && strings.Contains(msg, ": "+prefix)) {
+				t.Errorf("message %q does not lead with the operation", msg)
+			}
+			if strings.Contains(msg, "hunter2") {
+				t.Errorf("message %q leaks a parameter value", msg)
+			}
+			for _, name := range opErr.Params {
+				if identifyingParams[name] || !strings.Contains(msg, " "+name+"=...") {
+					t.Errorf("parameter %s misreported in %q", name, msg)
+				}
+			}
+		})
+	}
+}
+
+func TestOpErrorTransport(t *testing.T) {
+	g := newFakeGateway(t)
+	c := g.client()
+	if err := c.Authorize(); err != nil {
+		t.Fatal(err)
+	}
+	g.srv.Close()
+
+	_, err := c.ListFiles("dev")
+	var opErr *OpError
+	var transportErr *TransportError
+	if !errors.As(err, &opErr) || !errors.As(err, &transportErr) {
+		t.Fatalf("error %v, want an *OpError wrapping a *TransportError", err)
+	}
+	if opErr.Op != "ListFiles" || opErr.Request != "GET /listFile" || opErr.DeviceID != "dev" {
+		t.Errorf("OpError %+v", opErr)
+	}
+}
+
+func TestOpErrorUnauthorized(t *testing.T) {
+	g := newFakeGateway(t)
+	g.load("dev", "plan.xml", planDoc)
+	c := g.client()
+	if _, err := c.ReadFile("dev", "plan.xml"); err != nil {
+		t.Fatal(err)
+	}
+	g.revokeKey(testAPIKey)
+
+	_, err := c.ReadFile("dev", "plan.xml")
+	var opErr *OpError
+	if !errors.As(err, &opErr) || !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("error %v, want an *OpError matching ErrUnauthorized", err)
+	}
+}
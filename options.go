@@ -0,0 +1,54 @@
+package xmlapi
+
+// Option configures optional behaviour of a Client
+type Option func(*Client)
+
+// WithNamespace registers a prefix for a namespace URI. Paths containing
+// segments with the prefix (e.g. "/ntcip:plan/ntcip:phase") are sent together
+// with the mapping, and CreateNodeNS uses the prefix for elements in that
+// namespace.
+func WithNamespace(prefix, uri string) Option {
+	return func(c *Client) {
+		if c.namespaces == nil {
+			c.namespaces = make(map[string]string)
+		}
+		c.namespaces[prefix] = uri
+	}
+}
+
+// WithScopes requests a token limited to the given scopes (e.g. "read-only"
+// or "single-device:<id>") on every authorization, including automatic
+// re-authorization
+func WithScopes(scopes ...string) Option {
+	return func(c *Client) {
+		c.scopes = append([]string(nil), scopes...)
+	}
+}
+
+// WithPerDeviceTokens authorizes separately for each device, for gateways
+// that issue tokens bound to a single device ID. Tokens are cached per
+// device and requests without a device ID use the shared token.
+func WithPerDeviceTokens() Option {
+	return func(c *Client) {
+		c.perDevice = true
+	}
+}
+
+// WithCredentialsProvider fetches the API key from p at each authorization
+// instead of using the key given to NewClient. Failures to fetch it match
+// ErrCredentialsUnavailable, unlike a key the gateway rejects.
+func WithCredentialsProvider(p CredentialsProvider) Option {
+	return func(c *Client) {
+		c.credentials = p
+	}
+}
+
+// WithBasicAuth authenticates every request with HTTP Basic credentials,
+// for units that predate the token scheme. The authorize flow is disabled
+// and a 401 fails at once with an error matching ErrUnauthorized. It cannot
+// be combined with an API key; pass an empty key to NewClient.
+func WithBasicAuth(username, password string) Option {
+	return func(c *Client) {
+		c.auth = &basicAuth{username: username, password: password}
+	}
+}
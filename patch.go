@@ -0,0 +1,239 @@
+package xmlapi
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// PatchOpKind names a patch operation
+type PatchOpKind string
+
+// Patch operations, modelled on JSON Patch
+const (
+	PatchAdd     PatchOpKind = "add"
+	PatchRemove  PatchOpKind = "remove"
+	PatchReplace PatchOpKind = "replace"
+	PatchMove    PatchOpKind = "move"
+	PatchCopy    PatchOpKind = "copy"
+	PatchTest    PatchOpKind = "test"
+)
+
+// PatchOp is a single declarative change to a file.
+//
+//   - add creates the element named by the last segment of Path under its
+//     parent, with Value, or the whole subtree in Node when set
+//   - remove deletes the element at Path
+//   - replace sets the value of the element at Path to Value
+//   - move and copy recreate the element at From under the parent of Path,
+//     named after Path's last segment; move then deletes From
+//   - test checks that the element at Path has the value Value
+type PatchOp struct {
+	Op    PatchOpKind `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value string      `json:"value,omitempty"`
+	Node  *Node       `json:"node,omitempty"`
+}
+
+// PatchOpResult reports the outcome of one operation
+type PatchOpResult struct {
+	Op      PatchOp
+	Applied bool
+	Skipped bool
+	Err     error
+}
+
+// PatchResult reports the outcome of ApplyPatch
+type PatchResult struct {
+	Results []PatchOpResult
+
+	// Inverse undoes the applied operations when passed to ApplyPatch.
+	// Removed elements are re-added as the last child of their parent,
+	// so sibling order is not restored.
+	Inverse []PatchOp
+}
+
+// PatchOption configures ApplyPatch. Every RequestOption is a PatchOption too.
+type PatchOption interface {
+	applyPatch(*patchConfig)
+}
+
+// patchOption is a PatchOption setting an option of ApplyPatch
+type patchOption func(*patchConfig)
+
+func (f patchOption) applyPatch(cfg *patchConfig) {
+	f(cfg)
+}
+
+// patchConfig holds the options of an ApplyPatch call
+type patchConfig struct {
+	continueOnError bool
+
+	// call holds the RequestOptions among the options
+	call []RequestOption
+}
+
+// ContinueOnError keeps applying operations after one fails
+func ContinueOnError() PatchOption {
+	return patchOption(func(cfg *patchConfig) {
+		cfg.continueOnError = true
+	})
+}
+
+// ApplyPatch applies the operations of patch to the XML file in order. By
+// default it stops at the first failed operation, marking the rest
+// skipped. The returned error is the first failure; the result is returned
+// either way and carries the inverse of what was applied.
+func (c *Client) ApplyPatch(ctx context.Context, deviceID, filename string, patch []PatchOp, opts ...PatchOption) (_ *PatchResult, err error) {
+	ctx, op := startOp(ctx, "ApplyPatch", nil, deviceID, filename, nil)
+	defer op.finish(&err)
+
+	var cfg patchConfig
+	for _, opt := range opts {
+		opt.applyPatch(&cfg)
+	}
+	ctx = withRequestOptions(ctx, cfg.call)
+
+	result := &PatchResult{Results: make([]PatchOpResult, len(patch))}
+	var firstErr error
+	var inverse [][]PatchOp
+	for i, op := range patch {
+		result.Results[i].Op = op
+		if firstErr != nil && !cfg.continueOnError {
+			result.Results[i].Skipped = true
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			result.Results[i].Err = err
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		undo, err := c.applyPatchOp(ctx, deviceID, filename, op)
+		if err != nil {
+			result.Results[i].Err = err
+			if firstErr == nil {
+				firstErr = fmt.Errorf("patch operation %d (%s %s): %w", i, op.Op, op.Path, err)
+			}
+			continue
+		}
+		result.Results[i].Applied = true
+		inverse = append(inverse, undo)
+	}
+
+	for i := len(inverse) - 1; i >= 0; i-- {
+		result.Inverse = append(result.Inverse, inverse[i]...)
+	}
+
+	return result, firstErr
+}
+
+// applyPatchOp performs one operation and returns the operations undoing it.
+// Nodes are read from the gateway, never the read cache, so tests and the
+// undo operations see the values actually stored.
+func (c *Client) applyPatchOp(ctx context.Context, deviceID, filename string, op PatchOp) ([]PatchOp, error) {
+	switch op.Op {
+	case PatchAdd:
+		node := op.Node
+		if node == nil {
+			tag, err := lastSegment(op.Path)
+			if err != nil {
+				return nil, err
+			}
+			node = &Node{XMLName: XMLName{Local: tag}, Value: op.Value}
+		}
+		created, err := c.addSubtree(ctx, deviceID, filename, parentPath(op.Path), node)
+		if err != nil {
+			return nil, err
+		}
+		return []PatchOp{{Op: PatchRemove, Path: created}}, nil
+
+	case PatchRemove:
+		old, _, err := c.fetchNode(ctx, deviceID, filename, op.Path, "", false)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := c.deleteNode(ctx, deviceID, filename, op.Path); err != nil {
+			return nil, err
+		}
+		return []PatchOp{{Op: PatchAdd, Path: op.Path, Node: old}}, nil
+
+	case PatchReplace:
+		old, _, err := c.fetchNode(ctx, deviceID, filename, op.Path, "", false)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := c.updateNode(ctx, deviceID, filename, op.Path, op.Value); err != nil {
+			return nil, err
+		}
+		return []PatchOp{{Op: PatchReplace, Path: op.Path, Value: old.Value}}, nil
+
+	case PatchMove, PatchCopy:
+		source, _, err := c.fetchNode(ctx, deviceID, filename, op.From, "", false)
+		if err != nil {
+			return nil, err
+		}
+		tag, err := lastSegment(op.Path)
+		if err != nil {
+			return nil, err
+		}
+		source.XMLName.Local = tag
+		created, err := c.addSubtree(ctx, deviceID, filename, parentPath(op.Path), source)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == PatchCopy {
+			return []PatchOp{{Op: PatchRemove, Path: created}}, nil
+		}
+		if _, err := c.deleteNode(ctx, deviceID, filename, op.From); err != nil {
+			return nil, err
+		}
+		return []PatchOp{{Op: PatchMove, From: created, Path: op.From}}, nil
+
+	case PatchTest:
+		node, _, err := c.fetchNode(ctx, deviceID, filename, op.Path, "", false)
+		if err != nil {
+			return nil, err
+		}
+		if node.Value != op.Value {
+			return nil, fmt.Errorf("%w: %s is %q, want %q", ErrTestFailed, op.Path, node.Value, op.Value)
+		}
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("unknown patch operation %q", op.Op)
+}
+
+// addSubtree creates n as the last child of parent and returns its path
+func (c *Client) addSubtree(ctx context.Context, deviceID, filename, parent string, n *Node) (string, error) {
+	if err := c.createSubtree(ctx, deviceID, filename, parent, n); err != nil {
+		return "", err
+	}
+
+	siblings, _, err := c.fetchNode(ctx, deviceID, filename, parent, "", false)
+	if err != nil {
+		return "", err
+	}
+	count := 0
+	for i := range siblings.Nodes {
+		if siblings.Nodes[i].Kind == NodeElement && siblings.Nodes[i].XMLName.Local == n.XMLName.Local {
+			count++
+		}
+	}
+	return parent + "/" + escapeSegment(n.XMLName.Local) + "[" + strconv.Itoa(count) + "]", nil
+}
+
+// lastSegment returns the tag name addressed by the last segment of path
+func lastSegment(path string) (string, error) {
+	p, err := parsePath(path)
+	if err != nil {
+		return "", err
+	}
+	if len(p.Segments) == 0 || p.Segments[len(p.Segments)-1].Attr || p.Segments[len(p.Segments)-1].Wildcard {
+		return "", fmt.Errorf("path %q does not name an element", path)
+	}
+	return p.Segments[len(p.Segments)-1].Local, nil
+}
@@ -0,0 +1,44 @@
+package xmlapi
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestApplyPatchBypassesReadCache(t *testing.T) {
+	g := newFakeGateway(t)
+	g.load("dev", "plan.xml", planDoc)
+	c := g.client(WithReadCache(time.Minute, 0))
+	for _, path := range []string{"/plan/phase[1]/minGreen", "/plan/phase[2]"} {
+		if _, err := c.ReadNode("dev", "plan.xml", path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Another client changes what the cache holds
+	g.mu.Lock()
+	root := g.files["dev"]["plan.xml"]
+	root.Nodes[0].Nodes[0].Value = "6"
+	root.Nodes[1].Nodes = append(root.Nodes[1].Nodes, Node{XMLName: XMLName{Local: "maxGreen"}, Value: "30"})
+	g.mu.Unlock()
+
+	result, err := c.ApplyPatch(context.Background(), "dev", "plan.xml", []PatchOp{
+		{Op: PatchTest, Path: "/plan/phase[1]/minGreen", Value: "6"},
+		{Op: PatchReplace, Path: "/plan/phase[1]/minGreen", Value: "8"},
+		{Op: PatchRemove, Path: "/plan/phase[2]"},
+	})
+	if err != nil {
+		t.Fatalf("ApplyPatch against the stored values: %v", err)
+	}
+
+	if len(result.Inverse) != 2 {
+		t.Fatalf("inverse %+v, want 2 operations", result.Inverse)
+	}
+	if undo := result.Inverse[0]; undo.Op != PatchAdd || undo.Node == nil || len(undo.Node.Nodes) != 2 {
+		t.Errorf("inverse of the remove %+v, want the phase with both children stored", undo)
+	}
+	if undo := result.Inverse[1]; undo.Op != PatchReplace || undo.Value != "6" {
+		t.Errorf("inverse of the replace %+v, want the stored value 6", undo)
+	}
+}
@@ -0,0 +1,406 @@
+package xmlapi
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Node paths address elements by their tag names, e.g. "/plan/phase[2]/minGreen":
+//
+//   - "/" separates segments; a leading "/" makes the path absolute, so its
+//     first segment names the root element, otherwise the path is relative
+//     to the children of the node it is applied to
+//   - a segment is a tag name, optionally namespace-prefixed ("ntcip:phase"),
+//     or "*" matching any element
+//   - "[n]" selects the n-th (1-based) matching sibling
+//   - a final "@name" segment addresses an attribute
+//   - "\" escapes the next character, so tags may contain "/[]@*:\" literally
+
+// Path is a node path assembled from unescaped parts, so tag names are
+// escaped correctly however they are spelled. Paths are immutable; every
+// method returns a new Path. Client methods take a Path wherever they take
+// a path string.
+type Path struct {
+	p parsedPath
+}
+
+// PathLike is a path argument of the client methods: a string in the path
+// syntax, a Path or a *Path. Other types are rejected with an error
+// matching ErrInvalidPath.
+type PathLike interface{}
+
+// PathString returns the path syntax of a PathLike
+func PathString(p PathLike) (string, error) {
+	switch v := p.(type) {
+	case string:
+		return v, nil
+	case Path:
+		return v.String(), nil
+	case *Path:
+		if v != nil {
+			return v.String(), nil
+		}
+	}
+	return "", fmt.Errorf("%w: %T is not a string or Path", ErrInvalidPath, p)
+}
+
+// Root returns the absolute path "/" that the root element is joined to
+func Root() Path {
+	return Path{parsedPath{Absolute: true}}
+}
+
+// ParsePath parses a path written in the path syntax
+func ParsePath(s string) (Path, error) {
+	p, err := parsePath(s)
+	if err != nil {
+		return Path{}, err
+	}
+	return Path{p}, nil
+}
+
+// with returns a copy of the path with seg appended
+func (p Path) with(seg pathSegment) Path {
+	segments := make([]pathSegment, len(p.p.Segments), len(p.p.Segments)+1)
+	copy(segments, p.p.Segments)
+	return Path{parsedPath{Absolute: p.p.Absolute, Segments: append(segments, seg)}}
+}
+
+// Join appends one segment per tag name. Names are taken literally, so any
+// character the path syntax treats specially is escaped.
+func (p Path) Join(names ...string) Path {
+	for _, name := range names {
+		p = p.with(pathSegment{Local: name})
+	}
+	return p
+}
+
+// JoinNS appends a namespace-prefixed segment
+func (p Path) JoinNS(prefix, local string) Path {
+	return p.with(pathSegment{Prefix: prefix, Local: local})
+}
+
+// Any appends a wildcard segment matching any element
+func (p Path) Any() Path {
+	return p.with(pathSegment{Local: "*", Wildcard: true})
+}
+
+// Index selects the i-th (1-based) sibling for the last segment
+func (p Path) Index(i int) Path {
+	if len(p.p.Segments) == 0 {
+		return p
+	}
+	segments := append([]pathSegment(nil), p.p.Segments...)
+	segments[len(segments)-1].Index = i
+	return Path{parsedPath{Absolute: p.p.Absolute, Segments: segments}}
+}
+
+// Attr appends an attribute segment
+func (p Path) Attr(name string) Path {
+	return p.with(pathSegment{Local: name, Attr: true})
+}
+
+// String renders the path in the path syntax
+func (p Path) String() string {
+	return p.p.String()
+}
+
+// String renders the parsed path in the path syntax
+func (p parsedPath) String() string {
+	var b strings.Builder
+	if p.Absolute {
+		b.WriteString("/")
+	}
+	for i, seg := range p.Segments {
+		if i > 0 {
+			b.WriteString("/")
+		}
+		if seg.Attr {
+			b.WriteString("@")
+		}
+		if seg.Prefix != "" {
+			b.WriteString(escapeSegment(seg.Prefix) + ":")
+		}
+		if seg.Wildcard {
+			b.WriteString("*")
+		} else {
+			b.WriteString(escapeSegment(seg.Local))
+		}
+		if seg.Index > 0 {
+			b.WriteString("[" + strconv.Itoa(seg.Index) + "]")
+		}
+	}
+	return b.String()
+}
+
+// pathSegment is one parsed step of a node path
+type pathSegment struct {
+	Prefix   string
+	Local    string
+	Index    int // 1-based, 0 when absent
+	Wildcard bool
+	Attr     bool
+}
+
+// parsedPath is the parsed form of a node path
+type parsedPath struct {
+	Absolute bool
+	Segments []pathSegment
+}
+
+// parsePath parses a node path
+func parsePath(s string) (parsedPath, error) {
+	var p parsedPath
+	if strings.HasPrefix(s, "/") {
+		p.Absolute = true
+		s = s[1:]
+	}
+	if s == "" {
+		return p, nil
+	}
+
+	for _, raw := range splitPath(s) {
+		seg, err := parseSegment(raw)
+		if err != nil {
+			return parsedPath{}, fmt.Errorf("invalid path %q: %w", s, err)
+		}
+		p.Segments = append(p.Segments, seg)
+	}
+
+	for i, seg := range p.Segments {
+		if seg.Attr && i != len(p.Segments)-1 {
+			return parsedPath{}, fmt.Errorf("invalid path %q: attribute segment must be last", s)
+		}
+	}
+
+	return p, nil
+}
+
+// splitPath splits s on unescaped "/"
+func splitPath(s string) []string {
+	var segments []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '/':
+			segments = append(segments, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(segments, s[start:])
+}
+
+// parseSegment parses a single path segment
+func parseSegment(raw string) (pathSegment, error) {
+	var seg pathSegment
+	if raw == "" {
+		return seg, errors.New("empty segment")
+	}
+
+	if raw[0] == '@' {
+		seg.Attr = true
+		raw = raw[1:]
+	}
+
+	var name strings.Builder
+	var prefix string
+	hasPrefix := false
+	i := 0
+	for ; i < len(raw); i++ {
+		c := raw[i]
+		if c == '\\' {
+			if i+1 == len(raw) {
+				return seg, errors.New("trailing escape")
+			}
+			i++
+			name.WriteByte(raw[i])
+			continue
+		}
+		if c == '[' {
+			break
+		}
+		if c == ']' || c == '@' {
+			return seg, fmt.Errorf("unexpected %q", c)
+		}
+		if c == ':' && !hasPrefix {
+			prefix = name.String()
+			name.Reset()
+			hasPrefix = true
+			continue
+		}
+		name.WriteByte(c)
+	}
+
+	seg.Prefix = prefix
+	seg.Local = name.String()
+	if seg.Local == "" || (hasPrefix && prefix == "") {
+		return seg, fmt.Errorf("missing name in segment %q", raw)
+	}
+	if seg.Local == "*" && !strings.Contains(raw, `\*`) {
+		seg.Wildcard = true
+	}
+
+	if rest := raw[i:]; rest != "" {
+		if seg.Attr {
+			return seg, errors.New("attribute segment cannot be indexed")
+		}
+		if rest[len(rest)-1] != ']' {
+			return seg, fmt.Errorf("unterminated index in segment %q", raw)
+		}
+		index, err := strconv.Atoi(rest[1 : len(rest)-1])
+		if err != nil || index < 1 {
+			return seg, fmt.Errorf("invalid index in segment %q", raw)
+		}
+		seg.Index = index
+	}
+
+	return seg, nil
+}
+
+// escapeSegment escapes the characters of a tag name that the path syntax
+// treats specially
+func escapeSegment(name string) string {
+	if !strings.ContainsAny(name, `/[]@*:\`) {
+		return name
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if strings.IndexByte(`/[]@*:\`, name[i]) >= 0 {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(name[i])
+	}
+	return b.String()
+}
+
+// nodeMatch is a candidate node along with the namespace prefixes in scope
+type nodeMatch struct {
+	node     *Node
+	prefixes map[string]string // prefix -> URI
+}
+
+// scopeFor returns the prefix bindings in effect inside n
+func scopeFor(n *Node, parent map[string]string) map[string]string {
+	scope := parent
+	copied := false
+	for _, attr := range n.Attrs {
+		if attr.Name.Space != xmlnsPrefix {
+			continue
+		}
+		if !copied {
+			scope = make(map[string]string, len(parent)+1)
+			for k, v := range parent {
+				scope[k] = v
+			}
+			copied = true
+		}
+		scope[attr.Name.Local] = attr.Value
+	}
+	return scope
+}
+
+// matches reports whether n is selected by the name test of seg
+func (seg pathSegment) matches(n *Node, prefixes map[string]string) bool {
+	if n.Kind != NodeElement {
+		return false
+	}
+	if seg.Wildcard {
+		return true
+	}
+	if n.XMLName.Local != seg.Local {
+		return false
+	}
+	if seg.Prefix == "" {
+		return true
+	}
+	return n.XMLName.Space == seg.Prefix || (prefixes[seg.Prefix] != "" && n.XMLName.Space == prefixes[seg.Prefix])
+}
+
+// selectChildren returns the children of parent selected by seg
+func (seg pathSegment) selectChildren(parent nodeMatch) []nodeMatch {
+	var selected []nodeMatch
+	count := 0
+	for i := range parent.node.Nodes {
+		child := &parent.node.Nodes[i]
+		if !seg.matches(child, parent.prefixes) {
+			continue
+		}
+		count++
+		if seg.Index == 0 || seg.Index == count {
+			selected = append(selected, nodeMatch{child, scopeFor(child, parent.prefixes)})
+		}
+		if seg.Index != 0 && count == seg.Index {
+			break
+		}
+	}
+	return selected
+}
+
+// find returns every element of the tree rooted at n addressed by p
+func (p parsedPath) find(n *Node) []*Node {
+	if n == nil {
+		return nil
+	}
+
+	segments := p.Segments
+	current := []nodeMatch{{n, scopeFor(n, nil)}}
+	if p.Absolute {
+		if len(segments) == 0 {
+			return []*Node{n}
+		}
+		seg := segments[0]
+		if seg.Attr || !seg.matches(n, current[0].prefixes) || seg.Index > 1 {
+			return nil
+		}
+		segments = segments[1:]
+	}
+
+	for _, seg := range segments {
+		if seg.Attr {
+			return nil
+		}
+		var next []nodeMatch
+		for _, m := range current {
+			next = append(next, seg.selectChildren(m)...)
+		}
+		current = next
+		if len(current) == 0 {
+			return nil
+		}
+	}
+
+	nodes := make([]*Node, len(current))
+	for i, m := range current {
+		nodes[i] = m.node
+	}
+	return nodes
+}
+
+// Find returns the first element addressed by path, evaluated purely
+// client-side against the tree rooted at n. See the package's path syntax;
+// an absolute path's first segment must match n itself.
+func (n *Node) Find(path string) (*Node, bool) {
+	p, err := parsePath(path)
+	if err != nil {
+		return nil, false
+	}
+	nodes := p.find(n)
+	if len(nodes) == 0 {
+		return nil, false
+	}
+	return nodes[0], true
+}
+
+// FindAll returns every element matching pattern in document order.
+// Wildcard segments and unindexed repeated tags can match many elements.
+func (n *Node) FindAll(pattern string) []*Node {
+	p, err := parsePath(pattern)
+	if err != nil {
+		return nil
+	}
+	return p.find(n)
+}
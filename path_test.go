@@ -0,0 +1,120 @@
+package xmlapi
+
+import (
+	"strings"
+	"testing"
+)
+
+const findDoc = `<plan xmlns:ntcip="urn:ntcip">
+	<phase id="1"><minGreen>5</minGreen></phase>
+	<phase id="2"><minGreen>7</minGreen><maxGreen>30</maxGreen></phase>
+	<ntcip:phase id="3"><minGreen>9</minGreen></ntcip:phase>
+	<overlap><minGreen>11</minGreen></overlap>
+</plan>`
+
+func TestFind(t *testing.T) {
+	root, err := ParseXML(strings.NewReader(findDoc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		path  string
+		value string
+		found bool
+	}{
+		{"/plan/phase/minGreen", "5", true},
+		{"/plan/phase[1]/minGreen", "5", true},
+		{"/plan/phase[2]/minGreen", "7", true},
+		{"/plan/phase[2]/maxGreen", "30", true},
+		{"/plan/phase[3]", "", true},
+		{"/plan/phase[4]", "", false},
+		{"/plan/ntcip:phase/minGreen", "9", true},
+		{"/plan/ntcip:phase[2]", "", false},
+		{"/plan/*[4]/minGreen", "11", true},
+		{"/other/phase", "", false},
+		{"/plan/phase/maxGreen", "30", true},
+		{"/plan/phase[1]/maxGreen", "", false},
+		{"/plan/phase[", "", false},
+	} {
+		n, ok := root.Find(tc.path)
+		if ok != tc.found {
+			t.Errorf("Find(%q) found = %v, want %v", tc.path, ok, tc.found)
+			continue
+		}
+		if ok && n.Value != tc.value {
+			t.Errorf("Find(%q) = %q, want %q", tc.path, n.Value, tc.value)
+		}
+	}
+}
+
+func TestFindAll(t *testing.T) {
+	root, err := ParseXML(strings.NewReader(findDoc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		pattern string
+		values  []string
+	}{
+		{"/plan/phase/minGreen", []string{"5", "7", "9"}},
+		{"/plan/*/minGreen", []string{"5", "7", "9", "11"}},
+		{"/plan/ntcip:phase/minGreen", []string{"9"}},
+		{"/plan/phase[2]/*", []string{"7", "30"}},
+		{"/plan/nothing", nil},
+	} {
+		var values []string
+		for _, n := range root.FindAll(tc.pattern) {
+			values = append(values, n.Value)
+		}
+		if strings.Join(values, ",") != strings.Join(tc.values, ",") {
+			t.Errorf("FindAll(%q) = %v, want %v", tc.pattern, values, tc.values)
+		}
+	}
+}
+
+func TestPathBuilderSharesFindSyntax(t *testing.T) {
+	root, err := ParseXML(strings.NewReader(`<plan><a:b>x</a:b><renamed/></plan>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root.Nodes[1].XMLName.Local = "we/ird[1]"
+
+	for _, tc := range []struct {
+		path Path
+		want string
+	}{
+		{Root().Join("plan").JoinNS("a", "b"), "/plan/a:b"},
+		{Root().Join("plan", "we/ird[1]"), `/plan/we\/ird\[1\]`},
+		{Root().Join("plan").Any().Index(2), "/plan/*[2]"},
+		{Root().Join("plan", "phase").Attr("id"), "/plan/phase/@id"},
+	} {
+		if got := tc.path.String(); got != tc.want {
+			t.Errorf("path %q, want %q", got, tc.want)
+		}
+		parsed, err := ParsePath(tc.want)
+		if err != nil || parsed.String() != tc.want {
+			t.Errorf("ParsePath(%q) = %q, %v", tc.want, parsed.String(), err)
+		}
+	}
+
+	// A name with path syntax in it is found through its escaped segment
+	if n, ok := root.Find(Root().Join("plan", "we/ird[1]").String()); !ok || n != &root.Nodes[1] {
+		t.Errorf("escaped segment did not find the element")
+	}
+}
+
+func TestPathString(t *testing.T) {
+	p := Root().Join("plan", "phase").Index(2)
+	for _, arg := range []PathLike{"/plan/phase[2]", p, &p} {
+		got, err := PathString(arg)
+		if err != nil || got != "/plan/phase[2]" {
+			t.Errorf("PathString(%v) = %q, %v", arg, got, err)
+		}
+	}
+	var nilPath *Path
+	for _, arg := range []PathLike{nil, 3, nilPath} {
+		if _, err := PathString(arg); err == nil {
+			t.Errorf("PathString(%#v) succeeded", arg)
+		}
+	}
+}
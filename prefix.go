@@ -0,0 +1,75 @@
+package xmlapi
+
+import (
+	"strings"
+	"sync"
+)
+
+// detectedAPIPrefix is where newer gateways serve the API
+const detectedAPIPrefix = "/api/v2"
+
+// WithAPIPrefix serves every endpoint under prefix, e.g. "/api/v2", for
+// gateways that do not serve the API at the root. Leading and trailing
+// slashes, on the prefix and on the base URL, do not matter.
+func WithAPIPrefix(prefix string) Option {
+	return func(c *Client) {
+		c.prefix.set(prefix)
+	}
+}
+
+// WithAPIPrefixDetection probes for the API under "/api/v2" when the
+// gateway answers the first authorization with 404, and keeps using that
+// prefix if the probe succeeds
+func WithAPIPrefixDetection() Option {
+	return func(c *Client) {
+		c.prefix.detect = true
+	}
+}
+
+// apiPrefix is the path prefix of the API, which detection may change
+type apiPrefix struct {
+	detect bool
+
+	mu     sync.Mutex
+	value  string
+	probed bool
+}
+
+// set replaces the prefix, normalized to a leading but no trailing slash
+func (p *apiPrefix) set(prefix string) {
+	prefix = strings.Trim(prefix, "/")
+	if prefix != "" {
+		prefix = "/" + prefix
+	}
+	p.mu.Lock()
+	p.value = prefix
+	p.mu.Unlock()
+}
+
+// get returns the current prefix
+func (p *apiPrefix) get() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.value
+}
+
+// probe switches to detectedAPIPrefix, reporting whether it did. It does
+// so at most once, and only while no prefix is in use.
+func (p *apiPrefix) probe() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.detect || p.probed || p.value != "" {
+		return false
+	}
+	p.probed = true
+	p.value = detectedAPIPrefix
+	return true
+}
+
+// endpointURL returns the URL of an API endpoint such as "/read"
+func (c *Client) endpointURL(endpoint string) string {
+	if !strings.HasPrefix(endpoint, "/") {
+		endpoint = "/" + endpoint
+	}
+	return strings.TrimRight(c.baseURL, "/") + c.prefix.get() + endpoint
+}
@@ -0,0 +1,92 @@
+package xmlapi
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// paths returns the URL paths the gateway received, in order
+func paths(g *fakeGateway) []string {
+	var out []string
+	for _, req := range g.received() {
+		out = append(out, req.Path)
+	}
+	return out
+}
+
+func TestAPIPrefix(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		served string
+		base   string
+		opts   []Option
+		want   []string
+	}{
+		{
+			name: "unprefixed server",
+			want: []string{"/authorize", "/read"},
+		},
+		{
+			name: "configured prefix", served: "/api/v2", base: "/", opts: []Option{WithAPIPrefix("api/v2/")},
+			want: []string{"/api/v2/authorize", "/api/v2/read"},
+		},
+		{
+			name: "prefix in the base URL", served: "/api/v2", base: "/api/v2/",
+			want: []string{"/api/v2/authorize", "/api/v2/read"},
+		},
+		{
+			name: "detected prefix", served: "/api/v2", opts: []Option{WithAPIPrefixDetection()},
+			want: []string{"/authorize", "/api/v2/authorize", "/api/v2/read"},
+		},
+		{
+			name: "detection on an unprefixed server", opts: []Option{WithAPIPrefixDetection()},
+			want: []string{"/authorize", "/read"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := newFakeGateway(t)
+			g.prefix = tc.served
+			g.load("dev", "plan.xml", planDoc)
+			c := NewClient(testAPIKey, g.URL()+tc.base, append([]Option{WithLogger(discardLogger{})}, tc.opts...)...)
+			defer c.Close()
+
+			if _, err := c.ReadFile("dev", "plan.xml"); err != nil {
+				t.Fatalf("ReadFile: %v", err)
+			}
+			if got := paths(g); strings.Join(got, " ") != strings.Join(tc.want, " ") {
+				t.Errorf("requested %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAPIPrefixNotDetected(t *testing.T) {
+	g := newFakeGateway(t)
+	g.prefix = "/elsewhere"
+	c := g.client(WithAPIPrefixDetection())
+
+	for i := 0; i < 2; i++ {
+		if err := c.Authorize(); !errors.Is(err, ErrUnsupportedByServer) {
+			t.Errorf("Authorize = %v, want ErrUnsupportedByServer", err)
+		}
+	}
+	// The prefix is probed once, then the root is used again
+	want := []string{"/authorize", "/api/v2/authorize", "/authorize"}
+	if got := paths(g); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("requested %q, want %q", got, want)
+	}
+	if got := c.endpointURL("/read"); got != g.URL()+"/read" {
+		t.Errorf("endpoint URL %s after a failed probe", got)
+	}
+
+	// Without detection a prefixed server is not found at all
+	g = newFakeGateway(t)
+	g.prefix = "/api/v2"
+	if err := g.client().Authorize(); !errors.Is(err, ErrUnsupportedByServer) {
+		t.Errorf("Authorize = %v, want ErrUnsupportedByServer", err)
+	}
+	if n := len(g.received()); n != 1 {
+		t.Errorf("%d requests, want no probe", n)
+	}
+}
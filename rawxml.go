@@ -0,0 +1,96 @@
+package xmlapi
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// rawBody is a request body sent as it is instead of as JSON
+type rawBody struct {
+	contentType string
+	data        []byte
+}
+
+// fragmentRoot wraps a fragment so that it can be checked like a document
+const fragmentRoot = "<fragment>"
+
+// checkFragment checks that fragment is well-formed XML content: any number
+// of elements, text and comments, with tags closed and properly nested
+func checkFragment(fragment []byte) error {
+	r := io.MultiReader(
+		bytes.NewReader([]byte(fragmentRoot)),
+		bytes.NewReader(fragment),
+		bytes.NewReader([]byte("</fragment>")),
+	)
+	errs := ValidateWellFormed(r)
+	if len(errs) == 0 {
+		return nil
+	}
+	xmlErr := errs[0]
+	if xmlErr.Line == 1 && xmlErr.Column > len(fragmentRoot) {
+		xmlErr.Column -= len(fragmentRoot)
+	}
+	return fmt.Errorf("fragment is not well-formed: %w", xmlErr)
+}
+
+// AppendRawXML appends an XML fragment as it is to the children of the
+// node at parentPath. The fragment is checked to be well-formed before it
+// is sent; the first error is returned as an XMLError.
+func (c *Client) AppendRawXML(deviceID, filename string, parentPath PathLike, fragment []byte, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "AppendRawXML", opts, deviceID, filename, parentPath)
+	defer op.finish(&err)
+
+	parentStr, err := PathString(parentPath)
+	if err != nil {
+		return "", err
+	}
+	return c.appendRawXML(ctx, deviceID, filename, parentStr, fragment)
+}
+
+// appendRawXML implements AppendRawXML, carrying ctx
+func (c *Client) appendRawXML(ctx context.Context, deviceID, filename, parentPath string, fragment []byte) (string, error) {
+	if err := checkFragment(fragment); err != nil {
+		return "", err
+	}
+
+	params := map[string]string{
+		"deviceid":    deviceID,
+		"filename":    filename,
+		"parent_path": parentPath,
+	}
+
+	return c.statusRequestContext(ctx, "POST", "/appendXml", params, rawBody{"application/xml", fragment})
+}
+
+// ReadRawXML reads the node at path as serialized XML, returned exactly as
+// the gateway sent it
+func (c *Client) ReadRawXML(deviceID, filename string, path PathLike, opts ...RequestOption) (_ []byte, err error) {
+	ctx, op := startOp(context.Background(), "ReadRawXML", opts, deviceID, filename, path)
+	defer op.finish(&err)
+
+	pathStr, err := PathString(path)
+	if err != nil {
+		return nil, err
+	}
+	return c.readRawXML(ctx, deviceID, filename, pathStr)
+}
+
+// readRawXML implements ReadRawXML, carrying ctx
+func (c *Client) readRawXML(ctx context.Context, deviceID, filename, path string) ([]byte, error) {
+	params := map[string]string{
+		"deviceid": deviceID,
+		"filename": filename,
+		"path":     path,
+	}
+
+	header := http.Header{"Accept": {"application/xml"}}
+	resp, err := c.requestHeader(ctx, "GET", "/readXml", params, nil, header)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
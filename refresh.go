@@ -0,0 +1,135 @@
+package xmlapi
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	// refreshAt is the fraction of a token's lifetime after which the
+	// background refresher replaces it
+	refreshAt = 0.8
+	// refreshRetryDelay is the wait after a failed background refresh
+	refreshRetryDelay = 10 * time.Second
+)
+
+// WithBackgroundRefresh re-authorizes on a timer at 80% of the token's
+// lifetime, so requests do not pay for a refresh. Only the shared token is
+// refreshed; it must have been obtained once, e.g. by Authorize. Call Close
+// to stop the refresher.
+func WithBackgroundRefresh() Option {
+	return func(c *Client) {
+		c.backgroundRefresh = true
+	}
+}
+
+// Close cancels the requests in flight, stops the background refresher and
+// the goroutines of WatchFile and SubscribeEvents, waits for them to exit,
+// and closes idle connections. Requests made afterwards, and those it
+// cancelled, fail with ErrClientClosed. Close is idempotent and safe to
+// call concurrently with requests.
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() {
+		c.backgroundMu.Lock()
+		close(c.closed)
+		c.cancelClose()
+		c.backgroundMu.Unlock()
+
+		c.background.Wait()
+		c.httpClient.CloseIdleConnections()
+	})
+	return nil
+}
+
+// startBackground registers a goroutine Close waits for, which must call
+// c.background.Done when it exits. It returns false once the client is closed.
+func (c *Client) startBackground() bool {
+	c.backgroundMu.Lock()
+	defer c.backgroundMu.Unlock()
+	if c.closeCtx.Err() != nil {
+		return false
+	}
+	c.background.Add(1)
+	return true
+}
+
+// withClose returns a copy of ctx that is also cancelled by Close
+func (c *Client) withClose(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(c.closeCtx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// closedErr replaces the cancellation Close caused in a call made with ctx
+// by ErrClientClosed
+func (c *Client) closedErr(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() == nil && c.closeCtx.Err() != nil && errors.Is(err, context.Canceled) {
+		return ErrClientClosed
+	}
+	return err
+}
+
+// usable returns the error requests fail with before reaching the network
+func (c *Client) usable() error {
+	if c.configErr != nil {
+		return c.configErr
+	}
+	select {
+	case <-c.closed:
+		return ErrClientClosed
+	default:
+		return nil
+	}
+}
+
+// refreshLoop runs the background refresher until the client is closed
+func (c *Client) refreshLoop() {
+	defer c.background.Done()
+
+	for {
+		c.tokenMu.Lock()
+		token, issued, expires := c.token, c.issued, c.expires
+		c.tokenMu.Unlock()
+
+		// Without a token or a known expiry there is nothing to schedule
+		// until a token is obtained
+		var due <-chan time.Time
+		var timer *time.Timer
+		if token != "" && !expires.IsZero() {
+			lifetime := expires.Sub(issued)
+			timer = time.NewTimer(time.Until(issued.Add(time.Duration(float64(lifetime) * refreshAt))))
+			due = timer.C
+		}
+
+		fired := false
+		select {
+		case <-c.closed:
+			return
+		case <-c.tokenChanged:
+		case <-due:
+			fired = true
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if !fired {
+			continue
+		}
+
+		if err := c.auth.refresh(c.closeCtx, ""); err != nil {
+			if c.closeCtx.Err() != nil {
+				return
+			}
+			c.logger.Printf("Background token refresh failed: %v", err)
+			select {
+			case <-c.closed:
+				return
+			case <-time.After(refreshRetryDelay):
+			}
+		}
+	}
+}
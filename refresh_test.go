@@ -0,0 +1,86 @@
+package xmlapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCloseReleasesResources(t *testing.T) {
+	g := newFakeGateway(t)
+	g.load("dev", "plan.xml", planDoc)
+	// Watches report revision 1 and then poll until cancelled, as do child
+	// listings once they arrive
+	arrived := make(chan struct{}, 1)
+	g.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		switch {
+		case r.URL.Path == "/watch" && !r.URL.Query().Has("since"):
+			writeJSON(w, http.StatusOK, watchResponse{Revision: 1})
+		case r.URL.Path == "/watch", r.URL.Path == "/children":
+			if r.URL.Path == "/children" {
+				arrived <- struct{}{}
+			}
+			<-r.Context().Done()
+		default:
+			return false
+		}
+		return true
+	}
+	baseline := runtime.NumGoroutine()
+	c := g.client(WithBackgroundRefresh())
+
+	if _, err := c.ReadNode("dev", "plan.xml", "/plan"); err != nil {
+		t.Fatal(err)
+	}
+	events, err := c.WatchFile(context.Background(), "dev", "plan.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inFlight := make(chan error, 1)
+	go func() {
+		for _, err := range c.Children(context.Background(), "dev", "plan.xml", "/plan") {
+			if err != nil {
+				inFlight <- err
+				return
+			}
+		}
+		inFlight <- nil
+	}()
+	<-arrived
+	// This connection stays idle until Close
+	if _, err := c.ReadNode("dev", "plan.xml", "/plan"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	select {
+	case err := <-inFlight:
+		if !errors.Is(err, ErrClientClosed) {
+			t.Errorf("request in flight failed with %v, want ErrClientClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("request in flight not cancelled by Close")
+	}
+	if _, open := <-events; open {
+		t.Error("watch channel still open after Close")
+	}
+	if n := settledGoroutines(baseline); n > baseline {
+		t.Errorf("%d goroutines after Close, want at most the %d before the client", n, baseline)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+	g.reset()
+	if _, err := c.ReadNode("dev", "plan.xml", "/plan"); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("ReadNode after Close: %v, want ErrClientClosed", err)
+	}
+	if n := len(g.received()); n != 0 {
+		t.Errorf("%d requests after Close, want none", n)
+	}
+}
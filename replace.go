@@ -0,0 +1,148 @@
+package xmlapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Steps of the client-side ReplaceSubtree fallback, reported by ReplaceError
+const (
+	ReplaceStepCreate = "create"
+	ReplaceStepVerify = "verify"
+	ReplaceStepDelete = "delete"
+)
+
+// ReplaceError reports the step at which a client-side ReplaceSubtree
+// stopped. NewPath is where the replacement copy was created, empty if the
+// create step itself failed; after a verify or delete failure both the old
+// element and the copy exist.
+type ReplaceError struct {
+	Step    string
+	Path    string
+	NewPath string
+	Err     error
+}
+
+// Error implements the error interface
+func (e *ReplaceError) Error() string {
+	if e.NewPath == "" {
+		return fmt.Sprintf("replace %s: %s: %v", e.Path, e.Step, e.Err)
+	}
+	return fmt.Sprintf("replace %s: %s (copy at %s): %v", e.Path, e.Step, e.NewPath, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *ReplaceError) Unwrap() error {
+	return e.Err
+}
+
+// ReplaceOption configures ReplaceSubtree. Every RequestOption is a ReplaceOption too.
+type ReplaceOption interface {
+	applyReplace(*replaceConfig)
+}
+
+// replaceOption is a ReplaceOption setting an option of ReplaceSubtree
+type replaceOption func(*replaceConfig)
+
+func (f replaceOption) applyReplace(cfg *replaceConfig) {
+	f(cfg)
+}
+
+// replaceConfig holds the options of a ReplaceSubtree call
+type replaceConfig struct {
+	allowRename bool
+
+	// call holds the RequestOptions among the options
+	call []RequestOption
+}
+
+// AllowRename lets ReplaceSubtree replace an element with one of another tag
+func AllowRename() ReplaceOption {
+	return replaceOption(func(cfg *replaceConfig) {
+		cfg.allowRename = true
+	})
+}
+
+// ReplaceSubtree replaces the element at path, with all its descendants, by
+// replacement. The gateway's atomic /replace is used where available.
+// Otherwise the replacement is created as a new sibling, verified by
+// reading it back and the old element deleted, so readers never see it
+// half-updated; the replacement then follows the old element's siblings of
+// the same tag. A failure of the fallback is a *ReplaceError.
+func (c *Client) ReplaceSubtree(ctx context.Context, deviceID, filename string, path PathLike, replacement *Node, opts ...ReplaceOption) (_ string, err error) {
+	ctx, op := startOp(ctx, "ReplaceSubtree", nil, deviceID, filename, path)
+	defer op.finish(&err)
+
+	pathStr, err := PathString(path)
+	if err != nil {
+		return "", err
+	}
+	var cfg replaceConfig
+	for _, opt := range opts {
+		opt.applyReplace(&cfg)
+	}
+	ctx = withRequestOptions(ctx, cfg.call)
+	if replacement == nil || replacement.Kind != NodeElement {
+		return "", errors.New("replace subtree: replacement must be an element")
+	}
+
+	target, err := c.readNode(ctx, deviceID, filename, pathStr)
+	if err != nil {
+		return "", err
+	}
+	if !cfg.allowRename && target.XMLName.Local != replacement.XMLName.Local {
+		return "", fmt.Errorf("replace subtree: replacement <%s> does not match <%s> at %s", replacement.XMLName.Local, target.XMLName.Local, pathStr)
+	}
+
+	var fragment bytes.Buffer
+	if err := replacement.ToXML(&fragment, MarshalOptions{}); err != nil {
+		return "", err
+	}
+	params := map[string]string{
+		"deviceid": deviceID,
+		"filename": filename,
+		"path":     pathStr,
+	}
+	status, err := c.statusRequestContext(ctx, "PUT", "/replace", params, rawBody{"application/xml", fragment.Bytes()})
+	if !errors.Is(err, ErrUnsupportedByServer) {
+		return status, err
+	}
+
+	parent := parentPath(pathStr)
+	if parent == "/" {
+		return "", errors.New("replace subtree: the root element can only be replaced by the gateway")
+	}
+	if err := c.createSubtree(ctx, deviceID, filename, parent, replacement); err != nil {
+		return "", &ReplaceError{Step: ReplaceStepCreate, Path: pathStr, Err: err}
+	}
+
+	// The copy is the last of its name under parent
+	siblings, err := c.readNode(ctx, deviceID, filename, parent)
+	if err != nil {
+		return "", &ReplaceError{Step: ReplaceStepVerify, Path: pathStr, Err: err}
+	}
+	count := 0
+	for i := range siblings.Nodes {
+		if siblings.Nodes[i].Kind == NodeElement && siblings.Nodes[i].XMLName.Local == replacement.XMLName.Local {
+			count++
+		}
+	}
+	newPath := parent + "/" + escapeSegment(replacement.XMLName.Local) + "[" + strconv.Itoa(count) + "]"
+
+	created, err := c.readNode(ctx, deviceID, filename, newPath)
+	if err != nil {
+		return "", &ReplaceError{Step: ReplaceStepVerify, Path: pathStr, NewPath: newPath, Err: err}
+	}
+	if !nodesEqual(created, replacement) {
+		return "", &ReplaceError{Step: ReplaceStepVerify, Path: pathStr, NewPath: newPath, Err: errors.New("copy differs from the replacement")}
+	}
+
+	status, err = c.deleteNode(ctx, deviceID, filename, pathStr)
+	if err != nil {
+		return "", &ReplaceError{Step: ReplaceStepDelete, Path: pathStr, NewPath: newPath, Err: err}
+	}
+	return status, nil
+}
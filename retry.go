@@ -0,0 +1,184 @@
+package xmlapi
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// BackoffStrategy decides how long to wait before retrying a request
+type BackoffStrategy interface {
+	// NextDelay returns the wait before retry number attempt, starting at 1
+	NextDelay(attempt int) time.Duration
+}
+
+// ExponentialBackoff doubles the delay ceiling with every attempt, starting
+// at Base and capped at Max, and waits a uniformly random time up to the
+// ceiling ("full jitter") so clients retrying together spread out
+type ExponentialBackoff struct {
+	Base time.Duration
+	Max  time.Duration
+
+	// Rand returns a random number in [0, n); math/rand's Int63n if nil.
+	// Tests can inject a deterministic source.
+	Rand func(n int64) int64
+}
+
+// NextDelay implements BackoffStrategy
+func (b ExponentialBackoff) NextDelay(attempt int) time.Duration {
+	ceiling := b.Base
+	for i := 1; i < attempt && i < 32; i++ {
+		if b.Max > 0 && ceiling >= b.Max {
+			break
+		}
+		ceiling *= 2
+	}
+	if b.Max > 0 && ceiling > b.Max {
+		ceiling = b.Max
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+
+	random := b.Rand
+	if random == nil {
+		random = rand.Int63n
+	}
+	return time.Duration(random(int64(ceiling) + 1))
+}
+
+// ConstantBackoff waits the same time before every retry
+type ConstantBackoff time.Duration
+
+// NextDelay implements BackoffStrategy
+func (b ConstantBackoff) NextDelay(attempt int) time.Duration {
+	return time.Duration(b)
+}
+
+// FibonacciBackoff grows the delay along the Fibonacci sequence in units of
+// Base (1, 1, 2, 3, 5, ... times Base), capped at Max
+type FibonacciBackoff struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+// NextDelay implements BackoffStrategy
+func (b FibonacciBackoff) NextDelay(attempt int) time.Duration {
+	prev, cur := time.Duration(0), b.Base
+	for i := 1; i < attempt; i++ {
+		prev, cur = cur, prev+cur
+		if b.Max > 0 && cur >= b.Max {
+			return b.Max
+		}
+	}
+	return cur
+}
+
+// defaultBackoff is exponential with full jitter from 200ms up to 10s
+func defaultBackoff() BackoffStrategy {
+	return ExponentialBackoff{Base: 200 * time.Millisecond, Max: 10 * time.Second}
+}
+
+// WithRetries retries requests up to n times when the gateway cannot be
+// reached or answers 429, 502, 503 or 504, waiting as decided by the
+// backoff strategy. Only GET, HEAD, OPTIONS and PUT requests are retried,
+// and any request turned away with 429; see WithNonIdempotentRetries.
+// Requests are not retried by default, except that a read whose connection
+// the gateway reset is repeated once right away.
+func WithRetries(n int) Option {
+	return func(c *Client) {
+		c.maxRetries = n
+	}
+}
+
+// WithNonIdempotentRetries lets WithRetries repeat POST and DELETE requests
+// too. A request that failed in transit or with 502, 503 or 504 may still
+// have been applied, so a repeated create can add a second node and a
+// repeated delete of an indexed path can remove the next sibling.
+func WithNonIdempotentRetries() Option {
+	return func(c *Client) {
+		c.retryAll = true
+	}
+}
+
+// WithBackoff sets the wait between retries; the default is exponential
+// with full jitter
+func WithBackoff(strategy BackoffStrategy) Option {
+	return func(c *Client) {
+		c.backoff = strategy
+	}
+}
+
+// retryable reports whether a failed attempt may succeed if repeated:
+// transport failures and the gateway's overload and gateway statuses are
+// retried, other errors are not
+func retryable(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	var transportErr *TransportError
+	return errors.As(err, &transportErr)
+}
+
+// shouldRetry reports whether a failed attempt of a request of the method
+// is repeated
+func (c *Client) shouldRetry(method string, err error) bool {
+	if !retryable(err) {
+		return false
+	}
+	if idempotent(method) || c.retryAll {
+		return true
+	}
+	// The gateway applies nothing it answers with 429
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests
+}
+
+// safeMethod reports whether a request of the method only reads, so it can
+// be repeated even if the gateway may have processed it already
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead
+}
+
+// idempotent reports whether repeating a request of the method has the
+// same effect as sending it once. The gateway's PUT endpoints set values;
+// POST creates and DELETE may address a node by index, so repeating them
+// can create or delete a second node.
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut:
+		return true
+	}
+	return false
+}
+
+// connectionDropped reports whether an attempt failed because the gateway
+// closed the connection, typically an idle keep-alive connection it reset
+func connectionDropped(err error) bool {
+	var transportErr *TransportError
+	if !errors.As(err, &transportErr) {
+		return false
+	}
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		strings.Contains(err.Error(), "server closed idle connection")
+}
+
+// WithRetryBudget limits the total time of a call across all its attempts,
+// re-authorizations and backoff waits. When the budget runs out, the last
+// error is returned wrapped with ErrRetryBudgetExhausted and the attempt
+// count; a caller's context that ends sooner still takes precedence.
+func WithRetryBudget(maxElapsed time.Duration) Option {
+	return func(c *Client) {
+		c.retryBudget = maxElapsed
+	}
+}
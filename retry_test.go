@@ -0,0 +1,265 @@
+package xmlapi
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestExponentialBackoffJitter(t *testing.T) {
+	var ceilings []int64
+	maxJitter := func(n int64) int64 {
+		ceilings = append(ceilings, n-1)
+		return n - 1
+	}
+	b := ExponentialBackoff{Base: 100 * time.Millisecond, Max: time.Second, Rand: maxJitter}
+
+	var delays []time.Duration
+	for attempt := 1; attempt <= 6; attempt++ {
+		delays = append(delays, b.NextDelay(attempt))
+	}
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	if !reflect.DeepEqual(delays, want) {
+		t.Errorf("delays at full jitter %v, want %v", delays, want)
+	}
+	for i, ceiling := range ceilings {
+		if time.Duration(ceiling) != want[i] {
+			t.Errorf("attempt %d drew from [0, %s], want [0, %s]", i+1, time.Duration(ceiling), want[i])
+		}
+	}
+
+	b.Rand = func(n int64) int64 { return n / 2 }
+	if got := b.NextDelay(3); got != 200*time.Millisecond {
+		t.Errorf("delay at half jitter %s, want 200ms", got)
+	}
+	b.Rand = func(n int64) int64 { return 0 }
+	if got := b.NextDelay(40); got != 0 {
+		t.Errorf("delay at no jitter %s, want 0", got)
+	}
+
+	// The default source stays within the ceiling
+	b.Rand = nil
+	for i := 0; i < 100; i++ {
+		if got := b.NextDelay(2); got < 0 || got > 200*time.Millisecond {
+			t.Fatalf("random delay %s outside [0, 200ms]", got)
+		}
+	}
+}
+
+func TestBackoffSequences(t *testing.T) {
+	var constant, fibonacci []time.Duration
+	for attempt := 1; attempt <= 7; attempt++ {
+		constant = append(constant, ConstantBackoff(50*time.Millisecond).NextDelay(attempt))
+		fibonacci = append(fibonacci, FibonacciBackoff{Base: time.Second, Max: 6 * time.Second}.NextDelay(attempt))
+	}
+	s := time.Second
+	if want := []time.Duration{1 * s, 1 * s, 2 * s, 3 * s, 5 * s, 6 * s, 6 * s}; !reflect.DeepEqual(fibonacci, want) {
+		t.Errorf("Fibonacci delays %v, want %v", fibonacci, want)
+	}
+	for _, d := range constant {
+		if d != 50*time.Millisecond {
+			t.Errorf("constant delays %v", constant)
+			break
+		}
+	}
+}
+
+// recordBackoff waits no time and records the attempts it was asked about
+type recordBackoff struct {
+	mu       sync.Mutex
+	attempts []int
+}
+
+// NextDelay implements BackoffStrategy
+func (b *recordBackoff) NextDelay(attempt int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.attempts = append(b.attempts, attempt)
+	return 0
+}
+
+// failFirst makes the gateway answer the first n requests to endpoint with status
+func failFirst(g *fakeGateway, endpoint string, n int, status int) {
+	var mu sync.Mutex
+	g.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path != endpoint || n == 0 {
+			return false
+		}
+		n--
+		writeJSON(w, status, APIResponse{Error: http.StatusText(status)})
+		return true
+	}
+}
+
+func TestRetries(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		endpoint string
+		status   int
+		failures int
+		opts     []Option
+		call     func(c *Client) error
+		attempts int
+		wantErr  bool
+	}{
+		{
+			name: "GET retried", endpoint: "/read", status: http.StatusServiceUnavailable, failures: 2,
+			call:     func(c *Client) error { _, err := c.ReadNode("dev", "plan.xml", "/plan"); return err },
+			attempts: 3,
+		},
+		{
+			name: "PUT retried", endpoint: "/update", status: http.StatusBadGateway, failures: 1,
+			call: func(c *Client) error {
+				_, err := c.UpdateNode("dev", "plan.xml", "/plan/phase[1]/minGreen", "6")
+				return err
+			},
+			attempts: 2,
+		},
+		{
+			name: "POST not retried", endpoint: "/create", status: http.StatusServiceUnavailable, failures: 1,
+			call:     func(c *Client) error { _, err := c.CreateNode("dev", "plan.xml", "/plan", "phase", ""); return err },
+			attempts: 1, wantErr: true,
+		},
+		{
+			name: "DELETE not retried", endpoint: "/delete", status: http.StatusGatewayTimeout, failures: 1,
+			call:     func(c *Client) error { _, err := c.DeleteNode("dev", "plan.xml", "/plan/phase[2]"); return err },
+			attempts: 1, wantErr: true,
+		},
+		{
+			name: "POST retried when opted in", endpoint: "/create", status: http.StatusServiceUnavailable, failures: 1,
+			opts:     []Option{WithNonIdempotentRetries()},
+			call:     func(c *Client) error { _, err := c.CreateNode("dev", "plan.xml", "/plan", "phase", ""); return err },
+			attempts: 2,
+		},
+		{
+			name: "POST retried after 429", endpoint: "/create", status: http.StatusTooManyRequests, failures: 1,
+			call:     func(c *Client) error { _, err := c.CreateNode("dev", "plan.xml", "/plan", "phase", ""); return err },
+			attempts: 2,
+		},
+		{
+			name: "500 not retried", endpoint: "/read", status: http.StatusInternalServerError, failures: 1,
+			call:     func(c *Client) error { _, err := c.ReadNode("dev", "plan.xml", "/plan"); return err },
+			attempts: 1, wantErr: true,
+		},
+		{
+			name: "retries exhausted", endpoint: "/read", status: http.StatusServiceUnavailable, failures: 5,
+			call:     func(c *Client) error { _, err := c.ReadNode("dev", "plan.xml", "/plan"); return err },
+			attempts: 3, wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := newFakeGateway(t)
+			g.load("dev", "plan.xml", planDoc)
+			failFirst(g, tc.endpoint, tc.failures, tc.status)
+			backoff := &recordBackoff{}
+			c := g.client(append([]Option{WithRetries(2), WithBackoff(backoff)}, tc.opts...)...)
+
+			err := tc.call(c)
+			var apiErr *APIError
+			if tc.wantErr && (!errors.As(err, &apiErr) || apiErr.StatusCode != tc.status) {
+				t.Errorf("error %v, want the %d response", err, tc.status)
+			} else if !tc.wantErr && err != nil {
+				t.Errorf("error %v, want success", err)
+			}
+			if n := len(g.receivedAt(tc.endpoint)); n != tc.attempts {
+				t.Errorf("%d attempts, want %d", n, tc.attempts)
+			}
+			var wantBackoff []int
+			for attempt := 1; attempt < tc.attempts; attempt++ {
+				wantBackoff = append(wantBackoff, attempt)
+			}
+			if !reflect.DeepEqual(backoff.attempts, wantBackoff) {
+				t.Errorf("backoff asked about attempts %v, want %v", backoff.attempts, wantBackoff)
+			}
+		})
+	}
+}
+
+func TestNoRetriesByDefault(t *testing.T) {
+	g := newFakeGateway(t)
+	g.load("dev", "plan.xml", planDoc)
+	failFirst(g, "/read", 1, http.StatusServiceUnavailable)
+	c := g.client()
+
+	if _, err := c.ReadNode("dev", "plan.xml", "/plan"); err == nil {
+		t.Error("ReadNode succeeded without retries")
+	}
+	if n := len(g.receivedAt("/read")); n != 1 {
+		t.Errorf("%d attempts, want 1", n)
+	}
+}
+
+// dropFirst makes the gateway close the connections of the first n requests
+// to endpoint after sending the response headers, cutting the body short
+func dropFirst(g *fakeGateway, endpoint string, n int) {
+	var mu sync.Mutex
+	g.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path != endpoint || n == 0 {
+			return false
+		}
+		n--
+		conn, buf, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			g.t.Error(err)
+			return false
+		}
+		buf.WriteString("HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: 100\r\n\r\n{\"status\":")
+		buf.Flush()
+		conn.Close()
+		return true
+	}
+}
+
+func TestDroppedConnectionRedialed(t *testing.T) {
+	read := func(c *Client) error { _, err := c.ReadNode("dev", "plan.xml", "/plan"); return err }
+	update := func(c *Client) error {
+		_, err := c.UpdateNode("dev", "plan.xml", "/plan/phase[1]/minGreen", "6")
+		return err
+	}
+
+	for _, tc := range []struct {
+		name     string
+		endpoint string
+		drops    int
+		opts     []Option
+		call     func(c *Client) error
+		attempts int
+		// backoff is the attempts the backoff was asked about
+		backoff []int
+		wantErr bool
+	}{
+		{name: "GET redialed without retries", endpoint: "/read", drops: 1, call: read, attempts: 2},
+		{name: "GET redialed once", endpoint: "/read", drops: 2, call: read, attempts: 2, wantErr: true},
+		{name: "GET redialed before backoff", endpoint: "/read", drops: 2, opts: []Option{WithRetries(1)}, call: read, attempts: 3, backoff: []int{1}},
+		{name: "PUT not redialed", endpoint: "/update", drops: 1, call: update, attempts: 1, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := newFakeGateway(t)
+			g.load("dev", "plan.xml", planDoc)
+			dropFirst(g, tc.endpoint, tc.drops)
+			backoff := &recordBackoff{}
+			c := g.client(append([]Option{WithBackoff(backoff)}, tc.opts...)...)
+
+			err := tc.call(c)
+			var transportErr *TransportError
+			if tc.wantErr && !errors.As(err, &transportErr) {
+				t.Errorf("error %v, want a *TransportError", err)
+			} else if !tc.wantErr && err != nil {
+				t.Errorf("error %v, want success", err)
+			}
+			if n := len(g.receivedAt(tc.endpoint)); n != tc.attempts {
+				t.Errorf("%d attempts, want %d", n, tc.attempts)
+			}
+			if !reflect.DeepEqual(backoff.attempts, tc.backoff) {
+				t.Errorf("backoff asked about attempts %v, want %v", backoff.attempts, tc.backoff)
+			}
+		})
+	}
+}
@@ -0,0 +1,341 @@
+package xmlapi
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxEnumValues is the most distinct values a string element or attribute
+// may have to be inferred as an enumeration
+const maxEnumValues = 8
+
+// ValueType is the type InferSchema observed for values
+type ValueType string
+
+// Value types, from the most to the least specific
+const (
+	// TypeEmpty is a value that was always empty
+	TypeEmpty  ValueType = "empty"
+	TypeBool   ValueType = "bool"
+	TypeInt    ValueType = "int"
+	TypeFloat  ValueType = "float"
+	TypeEnum   ValueType = "enum"
+	TypeString ValueType = "string"
+)
+
+// Schema describes the structure of an XML file as inferred by InferSchema.
+// It marshals to JSON for storage.
+type Schema struct {
+	Root string `json:"root"`
+	// Elements describes every element by its unindexed path, e.g.
+	// "/plan/phase/minGreen"
+	Elements map[string]*ElementSchema `json:"elements"`
+}
+
+// ElementSchema describes the elements found at one path
+type ElementSchema struct {
+	// Occurrences is how many elements were seen at the path
+	Occurrences int `json:"occurrences"`
+	// MinPerParent and MaxPerParent bound how many appeared under one parent
+	MinPerParent int  `json:"min_per_parent"`
+	MaxPerParent int  `json:"max_per_parent"`
+	Repeats      bool `json:"repeats"`
+
+	Value ValueSchema `json:"value"`
+	// Attrs describes the attributes seen, by local name
+	Attrs map[string]*AttrSchema `json:"attrs,omitempty"`
+	// Children lists the tags of the element children seen, in first-seen order
+	Children []string `json:"children,omitempty"`
+
+	// parents counts the parents that reported a count while inferring
+	parents int
+}
+
+// AttrSchema describes an attribute seen on an element
+type AttrSchema struct {
+	Occurrences int `json:"occurrences"`
+	// Required is set when every element at the path carried the attribute
+	Required bool        `json:"required"`
+	Value    ValueSchema `json:"value"`
+}
+
+// ValueSchema describes the values seen for an element or attribute
+type ValueSchema struct {
+	Type ValueType `json:"type"`
+	// Empty is set when empty values occurred besides the typed ones
+	Empty bool `json:"empty,omitempty"`
+	// Enum lists the allowed values when Type is TypeEnum
+	Enum []string `json:"enum,omitempty"`
+
+	// distinct gathers the distinct values while inferring
+	distinct map[string]bool
+	count    int
+}
+
+// InferSchema describes the structure of the tree rooted at root:
+// occurrence counts, repetition, value types and attributes per element
+// path. Element values are inferred as bool, int, float, an enumeration of
+// up to eight repeated strings, or string.
+func InferSchema(root *Node) *Schema {
+	s := &Schema{Elements: make(map[string]*ElementSchema)}
+	if root == nil || root.Kind != NodeElement {
+		return s
+	}
+	s.Root = root.XMLName.Local
+
+	s.element("/"+escapeSegment(root.XMLName.Local), 1).observe(root)
+	root.walk(false, func(path string, _ int, n *Node) error {
+		e := s.Elements[path]
+
+		perTag := make(map[string]int)
+		for i := range n.Nodes {
+			child := &n.Nodes[i]
+			if child.Kind != NodeElement {
+				continue
+			}
+			if perTag[child.XMLName.Local] == 0 && !containsString(e.Children, child.XMLName.Local) {
+				e.Children = append(e.Children, child.XMLName.Local)
+			}
+			perTag[child.XMLName.Local]++
+		}
+		for _, tag := range e.Children {
+			count := perTag[tag]
+			childSchema := s.element(path+"/"+escapeSegment(tag), count)
+			for i := range n.Nodes {
+				if n.Nodes[i].Kind == NodeElement && n.Nodes[i].XMLName.Local == tag {
+					childSchema.observe(&n.Nodes[i])
+				}
+			}
+		}
+		return nil
+	})
+
+	for path, e := range s.Elements {
+		// A tag first seen under a later parent was absent from the earlier ones
+		for _, tag := range e.Children {
+			if child := s.Elements[path+"/"+escapeSegment(tag)]; child.parents < e.Occurrences {
+				child.MinPerParent = 0
+			}
+		}
+		e.Value.finish()
+		for _, attr := range e.Attrs {
+			attr.Required = attr.Occurrences == e.Occurrences
+			attr.Value.finish()
+		}
+	}
+	return s
+}
+
+// element returns the schema of path, recording that one parent held count
+// elements there
+func (s *Schema) element(path string, count int) *ElementSchema {
+	e, ok := s.Elements[path]
+	if !ok {
+		e = &ElementSchema{MinPerParent: count, MaxPerParent: count}
+		s.Elements[path] = e
+	}
+	e.parents++
+	if count < e.MinPerParent {
+		e.MinPerParent = count
+	}
+	if count > e.MaxPerParent {
+		e.MaxPerParent = count
+	}
+	e.Repeats = e.MaxPerParent > 1
+	return e
+}
+
+// observe records an element found at the schema's path
+func (e *ElementSchema) observe(n *Node) {
+	e.Occurrences++
+	e.Value.observe(n.Value)
+	for _, attr := range n.Attrs {
+		if isNamespaceDecl(attr.Name) {
+			continue
+		}
+		if e.Attrs == nil {
+			e.Attrs = make(map[string]*AttrSchema)
+		}
+		a, ok := e.Attrs[attr.Name.Local]
+		if !ok {
+			a = &AttrSchema{}
+			e.Attrs[attr.Name.Local] = a
+		}
+		a.Occurrences++
+		a.Value.observe(attr.Value)
+	}
+}
+
+// valueType returns the most specific type of a single non-empty value
+func valueType(value string) ValueType {
+	value = strings.TrimSpace(value)
+	if value == "true" || value == "false" {
+		return TypeBool
+	}
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return TypeInt
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return TypeFloat
+	}
+	return TypeString
+}
+
+// observe records a value
+func (v *ValueSchema) observe(value string) {
+	if strings.TrimSpace(value) == "" {
+		v.Empty = true
+		return
+	}
+	v.count++
+	if v.distinct == nil {
+		v.distinct = make(map[string]bool)
+	}
+	v.distinct[value] = true
+
+	t := valueType(value)
+	switch {
+	case v.Type == "" || v.Type == t:
+		v.Type = t
+	case (v.Type == TypeInt && t == TypeFloat) || (v.Type == TypeFloat && t == TypeInt):
+		v.Type = TypeFloat
+	default:
+		v.Type = TypeString
+	}
+}
+
+// finish settles the type once every value has been observed
+func (v *ValueSchema) finish() {
+	switch {
+	case v.Type == "":
+		v.Type = TypeEmpty
+		v.Empty = false
+	case v.Type == TypeString && len(v.distinct) <= maxEnumValues && v.count > len(v.distinct):
+		v.Type = TypeEnum
+		v.Enum = sortedKeys(v.distinct)
+	}
+	v.distinct = nil
+	v.count = 0
+}
+
+// check reports why value does not fit the schema, or "" if it does
+func (v *ValueSchema) check(value string) string {
+	if strings.TrimSpace(value) == "" {
+		if v.Empty || v.Type == TypeEmpty {
+			return ""
+		}
+		return fmt.Sprintf("empty value, expected %s", v.Type)
+	}
+
+	switch v.Type {
+	case TypeEmpty:
+		return fmt.Sprintf("unexpected value %q", truncateValue(value, 40))
+	case TypeBool, TypeInt:
+		if valueType(value) != v.Type {
+			return fmt.Sprintf("value %q is not %s", truncateValue(value, 40), v.Type)
+		}
+	case TypeFloat:
+		if t := valueType(value); t != TypeFloat && t != TypeInt {
+			return fmt.Sprintf("value %q is not %s", truncateValue(value, 40), v.Type)
+		}
+	case TypeEnum:
+		if !containsString(v.Enum, value) {
+			return fmt.Sprintf("value %q is not one of %s", truncateValue(value, 40), strings.Join(v.Enum, ", "))
+		}
+	}
+	return ""
+}
+
+// Validate checks the tree rooted at node against the schema and returns
+// every violation: unknown elements and attributes, missing or repeated
+// elements, missing required attributes and values of the wrong type. An
+// element is required when every parent seen by InferSchema held one; how
+// many a repeating element had is not enforced.
+func (s *Schema) Validate(node *Node) []ValidationError {
+	if node == nil || node.Kind != NodeElement {
+		return []ValidationError{{Message: "no root element"}}
+	}
+	if node.XMLName.Local != s.Root {
+		return []ValidationError{{Path: "/" + escapeSegment(node.XMLName.Local), Message: fmt.Sprintf("root element is <%s>, expected <%s>", node.XMLName.Local, s.Root)}}
+	}
+
+	var errs []ValidationError
+	rootPath := "/" + escapeSegment(node.XMLName.Local)
+	s.validateElement(rootPath, rootPath, node, &errs)
+	return errs
+}
+
+// validateElement checks the element n found at the schema path; path is
+// its indexed path for reports
+func (s *Schema) validateElement(schemaPath, path string, n *Node, errs *[]ValidationError) {
+	e := s.Elements[schemaPath]
+
+	if msg := e.Value.check(n.Value); msg != "" {
+		*errs = append(*errs, ValidationError{Path: path, Message: msg})
+	}
+
+	seen := make(map[string]bool)
+	for _, attr := range n.Attrs {
+		if isNamespaceDecl(attr.Name) {
+			continue
+		}
+		seen[attr.Name.Local] = true
+		a, ok := e.Attrs[attr.Name.Local]
+		if !ok {
+			*errs = append(*errs, ValidationError{Path: path, Message: fmt.Sprintf("unexpected attribute %q", attr.Name.Local)})
+			continue
+		}
+		if msg := a.Value.check(attr.Value); msg != "" {
+			*errs = append(*errs, ValidationError{Path: path, Message: fmt.Sprintf("attribute %q: %s", attr.Name.Local, msg)})
+		}
+	}
+	names := make([]string, 0, len(e.Attrs))
+	for name := range e.Attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if e.Attrs[name].Required && !seen[name] {
+			*errs = append(*errs, ValidationError{Path: path, Message: fmt.Sprintf("missing attribute %q", name)})
+		}
+	}
+
+	counts := make(map[string]int)
+	paths := childPaths(path, n, true)
+	for i := range n.Nodes {
+		child := &n.Nodes[i]
+		if child.Kind != NodeElement {
+			continue
+		}
+		counts[child.XMLName.Local]++
+		childSchemaPath := schemaPath + "/" + escapeSegment(child.XMLName.Local)
+		if _, ok := s.Elements[childSchemaPath]; !ok {
+			*errs = append(*errs, ValidationError{Path: paths[i], Message: fmt.Sprintf("unexpected element <%s>", child.XMLName.Local)})
+			continue
+		}
+		s.validateElement(childSchemaPath, paths[i], child, errs)
+	}
+
+	for _, tag := range e.Children {
+		child := s.Elements[schemaPath+"/"+escapeSegment(tag)]
+		count := counts[tag]
+		switch {
+		case count == 0 && child.MinPerParent > 0:
+			*errs = append(*errs, ValidationError{Path: path, Message: fmt.Sprintf("missing element <%s>", tag)})
+		case count > 1 && !child.Repeats:
+			*errs = append(*errs, ValidationError{Path: path, Message: fmt.Sprintf("<%s> must not repeat, found %d", tag, count)})
+		}
+	}
+}
+
+// containsString reports whether list holds s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package xmlapi
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSignRequestGolden(t *testing.T) {
+	for _, tc := range []struct {
+		secret              string
+		method, path, query string
+		body                string
+		want                string
+	}{
+		{
+			secret: "secret", method: "GET", path: "/read",
+			query: "deviceid=dev&filename=plan.xml&path=%2Fplan",
+			want:  "10dc89e81e4ca596ee88bf3b4394dd81223ec96c8480e9b3c242fdc19e69852b",
+		},
+		{
+			secret: "secret", method: "POST", path: "/create",
+			body: "deviceid=dev&filename=plan.xml&parent_path=%2Fplan&tag=phase&value=",
+			want: "6241dea6aaee0606a28305640bf1876c8277e3511964469df05d621b0b43f12b",
+		},
+		{
+			method: "DELETE", path: "/deleteFile",
+			want: "e20cfcb46aca7508e92740f445bb33046a280cc7334c6cdca327456e3f1d6228",
+		},
+	} {
+		if got := SignRequest([]byte(tc.secret), tc.method, tc.path, tc.query, []byte(tc.body)); got != tc.want {
+			t.Errorf("SignRequest(%s %s) = %s, want %s", tc.method, tc.path, got, tc.want)
+		}
+	}
+}
+
+// checkSignatures verifies the signature of every request the gateway received
+func checkSignatures(t *testing.T, g *fakeGateway, secret []byte, header string) int {
+	t.Helper()
+	requests := g.received()
+	for _, req := range requests {
+		want := SignRequest(secret, req.Method, req.Endpoint, req.Query.Encode(), req.Raw)
+		if got := req.Header.Get(header); got != want {
+			t.Errorf("%s %s signed %q, want %q", req.Method, req.Endpoint, got, want)
+		}
+	}
+	return len(requests)
+}
+
+func TestRequestSigning(t *testing.T) {
+	secret := []byte("s3cret")
+
+	g := newFakeGateway(t)
+	g.load("dev", "plan.xml", planDoc)
+
+	// The first read is turned away so the retry is signed too
+	var reads int32
+	g.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path == "/read" && atomic.AddInt32(&reads, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return true
+		}
+		return false
+	}
+	c := g.client(WithRequestSigning(secret, ""), WithRetries(1), WithBackoff(ConstantBackoff(0)))
+
+	if _, err := c.ReadNode("dev", "plan.xml", "/plan/phase[1]"); err != nil {
+		t.Fatalf("ReadNode: %v", err)
+	}
+	if _, err := c.CreateNode("dev", "plan.xml", "/plan", "phase", "a b&c"); err != nil {
+		t.Fatalf("CreateNode: %v", err)
+	}
+	if _, err := c.DeleteFile("dev", "plan.xml"); err != nil {
+		t.Fatalf("DeleteFile: %v", err)
+	}
+
+	if n := checkSignatures(t, g, secret, DefaultSigningHeader); n != 5 {
+		t.Errorf("%d requests, want authorize, two reads, create and delete", n)
+	}
+
+	g.reset()
+	c = g.client(WithRequestSigning(secret, "X-Custom-Sig"))
+	if _, err := c.ListFiles("dev"); err != nil {
+		t.Fatal(err)
+	}
+	for _, req := range g.received() {
+		if req.Header.Get(DefaultSigningHeader) != "" {
+			t.Errorf("%s signed in the default header", req.Endpoint)
+		}
+	}
+	checkSignatures(t, g, secret, "X-Custom-Sig")
+}
@@ -0,0 +1,58 @@
+package xmlapi
+
+import (
+	"sync"
+	"time"
+)
+
+// slowWarningInterval is how often each endpoint may warn about slow calls
+const slowWarningInterval = time.Minute
+
+// WithSlowRequestThreshold warns about calls, retries included, that take
+// longer than d. The warning is logged and reported to the WithMetrics hook
+// as MetricSlowRequest with the endpoint, device, duration, attempt count
+// and response size. Each endpoint warns at most once a minute, so a
+// gateway-wide slowdown does not flood the log.
+func WithSlowRequestThreshold(d time.Duration) Option {
+	return func(c *Client) {
+		c.slow = &slowRequests{threshold: d, warned: make(map[string]time.Time)}
+	}
+}
+
+// slowRequests tracks the slow-call warnings of a client
+type slowRequests struct {
+	threshold time.Duration
+
+	mu     sync.Mutex
+	warned map[string]time.Time // endpoint -> last warning
+}
+
+// allow reports whether endpoint may warn now, recording the warning if so
+func (s *slowRequests) allow(endpoint string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if last, ok := s.warned[endpoint]; ok && now.Sub(last) < slowWarningInterval {
+		return false
+	}
+	s.warned[endpoint] = now
+	return true
+}
+
+// observeDuration warns if a call that started at start was slow
+func (c *Client) observeDuration(endpoint, deviceID string, start time.Time, attempts int, resp *Response) {
+	if c.slow == nil {
+		return
+	}
+	now := time.Now()
+	elapsed := now.Sub(start)
+	if elapsed <= c.slow.threshold || !c.slow.allow(endpoint, now) {
+		return
+	}
+
+	size := 0
+	if resp != nil {
+		size = len(resp.Body)
+	}
+	c.logger.Printf("Slow request: endpoint=%s deviceid=%s duration=%s attempts=%d bytes=%d", endpoint, deviceID, elapsed, attempts, size)
+	c.metric(Metric{Name: MetricSlowRequest, Endpoint: endpoint, DeviceID: deviceID, Duration: elapsed, Attempts: attempts, Bytes: size})
+}
@@ -0,0 +1,94 @@
+package xmlapi
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const sortDoc = `<doc><list><item k="2">b</item><!--c--><item k="1">a</item><item k="2">a2</item><item>z</item><item k="10">c</item></list></doc>`
+
+func TestSortChildren(t *testing.T) {
+	for _, mode := range []struct {
+		name     string
+		disabled []string
+		want     string
+	}{
+		{name: "gateway sort", want: "/sort"},
+		{name: "reorder", disabled: []string{"/sort"}, want: "/reorder"},
+		{name: "replace", disabled: []string{"/sort", "/reorder"}, want: "/replace"},
+		{name: "create and delete", disabled: []string{"/sort", "/reorder", "/replace"}, want: "/delete"},
+	} {
+		for _, tc := range []struct {
+			name      string
+			key       SortKey
+			ascending bool
+			want      string
+		}{
+			{
+				name: "attr ascending", key: SortByAttr("k"), ascending: true,
+				want: `<doc><list><item k="1">a</item><!--c--><item k="2">b</item><item k="2">a2</item><item k="10">c</item><item>z</item></list></doc>`,
+			},
+			{
+				name: "attr descending",
+				key:  SortByAttr("k"),
+				want: `<doc><list><item>z</item><!--c--><item k="10">c</item><item k="2">b</item><item k="2">a2</item><item k="1">a</item></list></doc>`,
+			},
+			{
+				name: "tag keeps the document order", key: SortByTag(), ascending: true,
+				want: sortDoc,
+			},
+			{
+				name: "value descending",
+				key:  SortByValue(),
+				want: `<doc><list><item>z</item><!--c--><item k="10">c</item><item k="2">b</item><item k="2">a2</item><item k="1">a</item></list></doc>`,
+			},
+		} {
+			t.Run(mode.name+"/"+tc.name, func(t *testing.T) {
+				g := newFakeGateway(t)
+				g.load("dev", "doc.xml", sortDoc)
+				g.disable(mode.disabled...)
+				c := g.client()
+
+				if _, err := c.SortChildren("dev", "doc.xml", "/doc/list", tc.key, tc.ascending); err != nil {
+					t.Fatal(err)
+				}
+				if got := mustXML(t, g.file("dev", "doc.xml")); got != tc.want {
+					t.Errorf("document %s\nwant %s", got, tc.want)
+				}
+				if len(g.receivedAt(mode.want)) == 0 {
+					t.Errorf("no request to %s", mode.want)
+				}
+			})
+		}
+	}
+}
+
+func TestReorderChildrenRejectsBadOrders(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		order []int
+	}{
+		{name: "too few", order: []int{0, 1}},
+		{name: "repeated", order: []int{0, 0, 1, 2, 3, 4}},
+		{name: "out of range", order: []int{0, 1, 2, 3, 4, 6}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := newFakeGateway(t)
+			g.load("dev", "doc.xml", sortDoc)
+			c := g.client()
+
+			_, err := c.ReorderChildren("dev", "doc.xml", "/doc/list", tc.order)
+			var opErr *OpError
+			if !errors.As(err, &opErr) || opErr.Op != "ReorderChildren" || !strings.HasPrefix(opErr.Err.Error(), "reorder:") {
+				t.Errorf("ReorderChildren(%v) = %v, want an annotated reorder error", tc.order, err)
+			}
+			if n := len(g.receivedAt("/reorder")); n != 0 {
+				t.Errorf("%d reorder requests, want none", n)
+			}
+			if got := mustXML(t, g.file("dev", "doc.xml")); got != sortDoc {
+				t.Errorf("document changed to %s", got)
+			}
+		})
+	}
+}
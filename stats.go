@@ -0,0 +1,124 @@
+package xmlapi
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+)
+
+// RequestStats describes a single attempt of a request, for capacity
+// planning. The phase timings are zero when the phase did not happen, e.g.
+// DNS and Connect on a reused connection.
+type RequestStats struct {
+	Method   string
+	Endpoint string
+	DeviceID string
+	// Attempt is 1 for the first attempt of a call and counts its retries
+	Attempt    int
+	StatusCode int
+	// Err is the error the attempt failed with, if any
+	Err error
+
+	// BytesSent is the size of the request body and BytesReceived that of
+	// the response body. A request re-sent after re-authorization counts
+	// toward the same attempt.
+	BytesSent     int64
+	BytesReceived int64
+
+	// Duration is the time from sending the request to reading the whole response
+	Duration time.Duration
+	DNS      time.Duration
+	Connect  time.Duration
+	TLS      time.Duration
+	// TTFB is the time from sending the request to the first response byte
+	TTFB time.Duration
+	// Reused reports whether an idle connection was reused
+	Reused bool
+}
+
+// WithRequestStats calls fn once for every attempt of every request with
+// its sizes and timings. fn is called synchronously from the goroutine
+// making the request and must be fast; aggregating is left to it.
+func WithRequestStats(fn func(RequestStats)) Option {
+	return func(c *Client) {
+		c.requestStats = fn
+	}
+}
+
+// attemptStats collects the RequestStats of an attempt while it runs
+type attemptStats struct {
+	RequestStats
+	start                         time.Time
+	dnsStart, connStart, tlsStart time.Time
+}
+
+// newAttemptStats starts collecting an attempt, or returns nil when stats are off
+func (c *Client) newAttemptStats(endpoint, deviceID string, attempt int) *attemptStats {
+	if c.requestStats == nil {
+		return nil
+	}
+	return &attemptStats{RequestStats: RequestStats{Endpoint: endpoint, DeviceID: deviceID, Attempt: attempt}}
+}
+
+// trace returns req instrumented to record its timings and body size
+func (s *attemptStats) trace(req *http.Request) *http.Request {
+	if s == nil {
+		return req
+	}
+	s.Method = req.Method
+	s.start = time.Now()
+	s.DNS, s.Connect, s.TLS, s.TTFB, s.Reused = 0, 0, 0, 0, false
+
+	trace := &httptrace.ClientTrace{
+		GotConn:              func(info httptrace.GotConnInfo) { s.Reused = info.Reused },
+		DNSStart:             func(httptrace.DNSStartInfo) { s.dnsStart = time.Now() },
+		DNSDone:              func(httptrace.DNSDoneInfo) { s.DNS = time.Since(s.dnsStart) },
+		ConnectStart:         func(string, string) { s.connStart = time.Now() },
+		ConnectDone:          func(string, string, error) { s.Connect = time.Since(s.connStart) },
+		TLSHandshakeStart:    func() { s.tlsStart = time.Now() },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { s.TLS = time.Since(s.tlsStart) },
+		GotFirstResponseByte: func() { s.TTFB = time.Since(s.start) },
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	if req.Body != nil {
+		req.Body = &countingBody{ReadCloser: req.Body, n: &s.BytesSent}
+	}
+	return req
+}
+
+// received records a response body that was read in full
+func (s *attemptStats) received(body []byte) {
+	if s != nil {
+		s.BytesReceived += int64(len(body))
+	}
+}
+
+// reportAttemptStats completes s with the attempt's outcome and reports it
+func (c *Client) reportAttemptStats(s *attemptStats, resp *Response, err error) {
+	if s == nil {
+		return
+	}
+	if !s.start.IsZero() {
+		s.Duration = time.Since(s.start)
+	}
+	if resp != nil {
+		s.StatusCode = resp.StatusCode
+	}
+	s.Err = err
+	c.requestStats(s.RequestStats)
+}
+
+// countingBody counts the bytes read from a request body
+type countingBody struct {
+	io.ReadCloser
+	n *int64
+}
+
+// Read implements io.Reader
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	*b.n += int64(n)
+	return n, err
+}
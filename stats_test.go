@@ -0,0 +1,116 @@
+package xmlapi
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// statsRecorder collects the RequestStats reported by a client
+type statsRecorder struct {
+	mu    sync.Mutex
+	stats []RequestStats
+}
+
+// record is the WithRequestStats callback
+func (r *statsRecorder) record(s RequestStats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stats = append(r.stats, s)
+}
+
+// take returns and forgets the stats reported so far
+func (r *statsRecorder) take() []RequestStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := r.stats
+	r.stats = nil
+	return stats
+}
+
+// rawBytes returns the total request body bytes received for endpoint
+func rawBytes(g *fakeGateway, endpoint string) int64 {
+	var n int64
+	for _, req := range g.receivedAt(endpoint) {
+		n += int64(len(req.Raw))
+	}
+	return n
+}
+
+func TestRequestStatsBytes(t *testing.T) {
+	g := newFakeGateway(t)
+	g.load("dev", "plan.xml", planDoc)
+	rec := &statsRecorder{}
+	c := g.client(WithRequestStats(rec.record))
+
+	if _, err := c.UploadFile("dev", "plan.xml", strings.NewReader(planDoc), true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ReadFile("dev", "plan.xml"); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := rec.take()
+	if len(stats) != 2 {
+		t.Fatalf("%d stats, want one per request: %+v", len(stats), stats)
+	}
+	upload, read := stats[0], stats[1]
+	if upload.Method != "POST" || upload.Endpoint != "/uploadFile" || upload.DeviceID != "dev" || upload.Attempt != 1 || upload.StatusCode != http.StatusOK || upload.Err != nil {
+		t.Errorf("upload stats %+v", upload)
+	}
+	if want := rawBytes(g, "/uploadFile"); upload.BytesSent != want || want == 0 {
+		t.Errorf("upload sent %d bytes, gateway received %d", upload.BytesSent, want)
+	}
+	if want := int64(g.bytesSent("/uploadFile")); upload.BytesReceived != want {
+		t.Errorf("upload received %d bytes, gateway sent %d", upload.BytesReceived, want)
+	}
+	if read.BytesSent != 0 {
+		t.Errorf("read sent %d body bytes, want none", read.BytesSent)
+	}
+	if want := int64(g.bytesSent("/read")); read.BytesReceived != want || want == 0 {
+		t.Errorf("read received %d bytes, gateway sent %d", read.BytesReceived, want)
+	}
+	if !read.Reused {
+		t.Error("second request did not reuse the connection")
+	}
+	for _, s := range stats {
+		if s.Duration <= 0 || s.TTFB <= 0 || s.TTFB > s.Duration {
+			t.Errorf("%s timings: duration %s, TTFB %s", s.Endpoint, s.Duration, s.TTFB)
+		}
+	}
+}
+
+func TestRequestStatsAttempts(t *testing.T) {
+	g := newFakeGateway(t)
+	g.load("dev", "plan.xml", planDoc)
+	rec := &statsRecorder{}
+	failFirst(g, "/update", 1, http.StatusServiceUnavailable)
+	c := g.client(WithRequestStats(rec.record), WithRetries(2), WithBackoff(ConstantBackoff(0)))
+
+	if _, err := c.UpdateNode("dev", "plan.xml", "/plan/phase[1]/minGreen", "6"); err != nil {
+		t.Fatal(err)
+	}
+	stats := rec.take()
+	if len(stats) != 2 || stats[0].Attempt != 1 || stats[0].StatusCode != http.StatusServiceUnavailable || stats[0].Err == nil ||
+		stats[1].Attempt != 2 || stats[1].StatusCode != http.StatusOK || stats[1].Err != nil {
+		t.Fatalf("stats %+v, want a failed first attempt and a successful second", stats)
+	}
+
+	// A request repeated after re-authorization is one attempt
+	g.reset()
+	g.revokeTokens()
+	if _, err := c.UploadFile("dev", "plan.xml", strings.NewReader(planDoc), true); err != nil {
+		t.Fatal(err)
+	}
+	stats = rec.take()
+	if len(stats) != 1 || stats[0].Attempt != 1 || stats[0].StatusCode != http.StatusOK {
+		t.Fatalf("stats %+v, want a single successful attempt", stats)
+	}
+	if n := len(g.receivedAt("/uploadFile")); n != 2 {
+		t.Fatalf("%d uploads sent, want the rejected one and its repeat", n)
+	}
+	if want := rawBytes(g, "/uploadFile"); stats[0].BytesSent != want || want == 0 {
+		t.Errorf("attempt sent %d bytes, gateway received %d", stats[0].BytesSent, want)
+	}
+}
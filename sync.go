@@ -0,0 +1,134 @@
+package xmlapi
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SyncFile brings the XML file in line with desired and returns the changes
+// it applied. The current tree is read with ReadFile and compared with Diff
+// using positional matching, then value, attribute, addition and removal
+// changes are applied with the node methods. New elements are appended to
+// their parent, so the order of differently named siblings is not enforced.
+func (c *Client) SyncFile(deviceID, filename string, desired *Node, opts ...RequestOption) (_ []Change, err error) {
+	ctx, op := startOp(context.Background(), "SyncFile", opts, deviceID, filename, nil)
+	defer op.finish(&err)
+
+	current, err := c.readNodeWith(ctx, deviceID, filename, "/")
+	if err != nil {
+		return nil, err
+	}
+
+	changes := Diff(current, desired)
+	var removals []Change
+	for i, change := range changes {
+		switch change.Type {
+		case ChangeValueChanged:
+			_, err = c.updateNode(ctx, deviceID, filename, change.Path, change.New)
+		case ChangeAttrChanged:
+			if _, ok := change.Node.Attr(change.Attr); !ok {
+				_, err = c.deleteAttribute(ctx, deviceID, filename, change.Path, change.Attr)
+				break
+			}
+			_, err = c.setAttribute(ctx, deviceID, filename, change.Path, change.Attr, change.New)
+		case ChangeAdded:
+			if change.Path == "/"+escapeSegment(desired.XMLName.Local) {
+				return changes[:i], fmt.Errorf("cannot replace root element %q with %q", current.XMLName.Local, desired.XMLName.Local)
+			}
+			err = c.createSubtree(ctx, deviceID, filename, parentPath(change.Path), change.Node)
+		case ChangeRemoved:
+			// Removed siblings are trailing, delete them last and from the end
+			// so earlier indexes stay valid
+			removals = append(removals, change)
+			continue
+		}
+		if err != nil {
+			return changes[:i], err
+		}
+	}
+
+	for i := len(removals) - 1; i >= 0; i-- {
+		if _, err := c.deleteNode(ctx, deviceID, filename, removals[i].Path); err != nil {
+			return changes, err
+		}
+	}
+
+	return changes, nil
+}
+
+// createSubtree creates n and its descendants as the last child of parent
+func (c *Client) createSubtree(ctx context.Context, deviceID, filename, parent string, n *Node) error {
+	params := map[string]string{
+		"deviceid":    deviceID,
+		"filename":    filename,
+		"parent_path": parent,
+		"value":       n.Value,
+	}
+	switch {
+	case n.Kind == NodeComment:
+		params["kind"] = "comment"
+	case n.XMLName.Space != "":
+		params["namespace"] = n.XMLName.Space
+		if prefix, ok := c.prefixFor(n.XMLName.Space); ok {
+			params["prefix"] = prefix
+		}
+		fallthrough
+	default:
+		params["tag"] = n.XMLName.Local
+		if n.ValueKind == ValueCDATA {
+			params["cdata"] = "true"
+		}
+		value, err := c.encodeValue(ctx, childValuePath(parent, escapeSegment(n.XMLName.Local)), n.Value)
+		if err != nil {
+			return err
+		}
+		params["value"] = value
+	}
+	if _, err := c.statusRequestContext(ctx, "POST", "/create", params, nil); err != nil {
+		return err
+	}
+	if n.Kind == NodeComment {
+		return nil
+	}
+
+	if len(n.Attrs) == 0 && len(n.Nodes) == 0 {
+		return nil
+	}
+
+	// The new element is the last of its name under parent
+	siblings, err := c.readNode(ctx, deviceID, filename, parent)
+	if err != nil {
+		return err
+	}
+	count := 0
+	for i := range siblings.Nodes {
+		if siblings.Nodes[i].Kind == NodeElement && siblings.Nodes[i].XMLName.Local == n.XMLName.Local {
+			count++
+		}
+	}
+	path := parent + "/" + escapeSegment(n.XMLName.Local) + "[" + strconv.Itoa(count) + "]"
+
+	for _, attr := range n.Attrs {
+		if isNamespaceDecl(attr.Name) {
+			continue
+		}
+		if _, err := c.setAttribute(ctx, deviceID, filename, path, attr.Name.Local, attr.Value); err != nil {
+			return err
+		}
+	}
+	for i := range n.Nodes {
+		if err := c.createSubtree(ctx, deviceID, filename, path, &n.Nodes[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parentPath returns the path of the parent of the element at path
+func parentPath(path string) string {
+	segments := splitPath(strings.TrimPrefix(path, "/"))
+	return "/" + strings.Join(segments[:len(segments)-1], "/")
+}
@@ -0,0 +1,220 @@
+package xmlapi
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"sync"
+)
+
+// Tags kept inside files by WithInFileTags live in this element, a child of
+// the root, as <tag key="environment">production</tag>
+const (
+	tagsElement = "xmlapi-tags"
+	tagElement  = "tag"
+	tagKeyAttr  = "key"
+)
+
+// WithInFileTags keeps file tags in a reserved <xmlapi-tags> element under
+// each file's root instead of the gateway's /tags endpoints, for gateways
+// without tag support. The element is ordinary content: it is read,
+// exported and diffed along with the rest of the file, and must not be
+// removed. FindFilesByTag then reads every file of the device.
+func WithInFileTags() Option {
+	return func(c *Client) {
+		c.inFileTags = true
+	}
+}
+
+// tagsResponse represents the response of /tags
+type tagsResponse struct {
+	Tags map[string]string `json:"tags"`
+}
+
+// SetFileTags replaces the tags of a file
+func (c *Client) SetFileTags(deviceID, filename string, tags map[string]string, opts ...RequestOption) (err error) {
+	ctx, op := startOp(context.Background(), "SetFileTags", opts, deviceID, filename, nil)
+	defer op.finish(&err)
+
+	if c.inFileTags {
+		return c.setInFileTags(ctx, deviceID, filename, tags)
+	}
+
+	params := map[string]string{
+		"deviceid": deviceID,
+		"filename": filename,
+	}
+	body := map[string]interface{}{
+		"tags": tags,
+	}
+
+	_, err = c.statusRequestContext(ctx, "PUT", "/tags", params, body)
+	return err
+}
+
+// GetFileTags returns the tags of a file
+func (c *Client) GetFileTags(deviceID, filename string, opts ...RequestOption) (_ map[string]string, err error) {
+	ctx, op := startOp(context.Background(), "GetFileTags", opts, deviceID, filename, nil)
+	defer op.finish(&err)
+
+	return c.fileTags(ctx, deviceID, filename)
+}
+
+// fileTags implements GetFileTags, carrying ctx
+func (c *Client) fileTags(ctx context.Context, deviceID, filename string) (map[string]string, error) {
+	if c.inFileTags {
+		root, err := c.readFile(ctx, deviceID, filename)
+		if err != nil {
+			return nil, err
+		}
+		return inFileTags(root), nil
+	}
+
+	params := map[string]string{
+		"deviceid": deviceID,
+		"filename": filename,
+	}
+
+	resp, err := c.requestContext(ctx, "GET", "/tags", params, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result tagsResponse
+	err = c.decode(resp, &result)
+	if err != nil {
+		return nil, err
+	}
+	if result.Tags == nil {
+		result.Tags = make(map[string]string)
+	}
+
+	return result.Tags, nil
+}
+
+// filesResponse represents the response of /tags/search
+type filesResponse struct {
+	Files []string `json:"files"`
+}
+
+// FindFilesByTag returns the files of a device, in sorted order, carrying
+// every tag of selector with the given value. An empty selector matches
+// every file.
+func (c *Client) FindFilesByTag(deviceID string, selector map[string]string, opts ...RequestOption) (_ []string, err error) {
+	ctx, op := startOp(context.Background(), "FindFilesByTag", opts, deviceID, "", nil)
+	defer op.finish(&err)
+
+	if c.inFileTags {
+		return c.findInFileTags(ctx, deviceID, selector)
+	}
+
+	params := map[string]string{
+		"deviceid": deviceID,
+	}
+	multi := make(url.Values)
+	for key, value := range selector {
+		multi.Add("tag", key+"="+value)
+	}
+
+	resp, err := c.requestMulti(ctx, "GET", "/tags/search", params, multi, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result filesResponse
+	err = c.decode(resp, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(result.Files)
+	return result.Files, nil
+}
+
+// inFileTags returns the tags kept in the reserved element of root
+func inFileTags(root *Node) map[string]string {
+	tags := make(map[string]string)
+	for i := range root.Nodes {
+		tagsNode := &root.Nodes[i]
+		if tagsNode.Kind != NodeElement || tagsNode.XMLName.Local != tagsElement {
+			continue
+		}
+		for j := range tagsNode.Nodes {
+			tag := &tagsNode.Nodes[j]
+			if tag.Kind != NodeElement || tag.XMLName.Local != tagElement {
+				continue
+			}
+			if key, ok := tag.Attr(tagKeyAttr); ok {
+				tags[key] = tag.Value
+			}
+		}
+		break
+	}
+	return tags
+}
+
+// setInFileTags replaces the reserved tags element of a file
+func (c *Client) setInFileTags(ctx context.Context, deviceID, filename string, tags map[string]string) error {
+	root, err := c.readFile(ctx, deviceID, filename)
+	if err != nil {
+		return err
+	}
+	rootPath := "/" + escapeSegment(root.XMLName.Local)
+	tagsPath := rootPath + "/" + tagsElement
+
+	if _, ok := root.Find(tagsPath); ok {
+		if _, err := c.deleteNode(ctx, deviceID, filename, tagsPath); err != nil {
+			return err
+		}
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+
+	tagsNode := &Node{XMLName: XMLName{Local: tagsElement}}
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		tagsNode.Nodes = append(tagsNode.Nodes, Node{
+			XMLName: XMLName{Local: tagElement},
+			Attrs:   []Attr{{Name: XMLName{Local: tagKeyAttr}, Value: key}},
+			Value:   tags[key],
+		})
+	}
+	return c.createSubtree(ctx, deviceID, filename, rootPath, tagsNode)
+}
+
+// findInFileTags implements FindFilesByTag by reading the tags of every file
+func (c *Client) findInFileTags(ctx context.Context, deviceID string, selector map[string]string) ([]string, error) {
+	files, err := c.listFiles(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	matches := make(map[string]bool)
+	errs := runEach(files, defaultBulkConcurrency, func(file string) error {
+		tags, err := c.fileTags(ctx, deviceID, file)
+		if err != nil {
+			return err
+		}
+		for key, value := range selector {
+			if got, ok := tags[key]; !ok || got != value {
+				return nil
+			}
+		}
+		mu.Lock()
+		matches[file] = true
+		mu.Unlock()
+		return nil
+	})
+	for _, file := range files {
+		if err := errs[file]; err != nil {
+			return nil, err
+		}
+	}
+	return sortedKeys(matches), nil
+}
@@ -0,0 +1,134 @@
+package xmlapi
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// placeholderPattern matches a "{{name}}" token inside a template value
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([^{}\s]+)\s*\}\}`)
+
+// TemplateResult reports what CreateFileFromTemplate substituted
+type TemplateResult struct {
+	Status string
+	// Applied lists the substitution keys that changed the new file
+	Applied []string
+	// Unmatched lists the placeholders left in the new file because no
+	// substitution named them
+	Unmatched []string
+}
+
+// templateResponse represents the response of /createFromTemplate
+type templateResponse struct {
+	APIResponse
+	Applied   []string `json:"applied"`
+	Unmatched []string `json:"unmatched"`
+}
+
+// CreateFileFromTemplate creates newFilename on deviceID as a copy of a
+// template file with substitutions applied to its node values. A key
+// starting with "/" is a path whose element's value is replaced; any other
+// key replaces the "{{key}}" placeholders inside values. The gateway's
+// /createFromTemplate is used where available, otherwise the template is
+// read, substituted client-side and written with WriteFile.
+func (c *Client) CreateFileFromTemplate(deviceID, newFilename, templateDevice, templateFilename string, substitutions map[string]string, opts ...RequestOption) (_ *TemplateResult, err error) {
+	ctx, op := startOp(context.Background(), "CreateFileFromTemplate", opts, deviceID, newFilename, nil)
+	defer op.finish(&err)
+
+	result, err := c.createFromTemplate(ctx, deviceID, newFilename, templateDevice, templateFilename, substitutions)
+	if !errors.Is(err, ErrUnsupportedByServer) {
+		return result, err
+	}
+
+	tree, err := c.readFile(ctx, templateDevice, templateFilename)
+	if err != nil {
+		return nil, err
+	}
+	result = applySubstitutions(tree, substitutions)
+	result.Status, err = c.WriteFile(ctx, deviceID, newFilename, tree, Replace)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// createFromTemplate calls the gateway's template endpoint
+func (c *Client) createFromTemplate(ctx context.Context, deviceID, newFilename, templateDevice, templateFilename string, substitutions map[string]string) (*TemplateResult, error) {
+	params := map[string]string{
+		"deviceid":          deviceID,
+		"filename":          newFilename,
+		"template_deviceid": templateDevice,
+		"template_filename": templateFilename,
+	}
+	body := map[string]interface{}{
+		"substitutions": substitutions,
+	}
+
+	resp, err := c.requestContext(ctx, "POST", "/createFromTemplate", params, body)
+	if err != nil {
+		return nil, err
+	}
+
+	var result templateResponse
+	err = c.decode(resp, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Error != "" {
+		return nil, resp.op.wrap(result.err(resp.StatusCode))
+	}
+
+	return &TemplateResult{Status: result.Status, Applied: result.Applied, Unmatched: result.Unmatched}, nil
+}
+
+// applySubstitutions substitutes the values of tree in place
+func applySubstitutions(tree *Node, substitutions map[string]string) *TemplateResult {
+	applied := make(map[string]bool)
+	unmatched := make(map[string]bool)
+
+	for key, value := range substitutions {
+		if !strings.HasPrefix(key, "/") {
+			continue
+		}
+		for _, node := range tree.FindAll(key) {
+			node.setScalar(value)
+			applied[key] = true
+		}
+	}
+
+	tree.Walk(func(_ string, n *Node) error {
+		if !strings.Contains(n.Value, "{{") {
+			return nil
+		}
+		value := placeholderPattern.ReplaceAllStringFunc(n.Value, func(token string) string {
+			name := placeholderPattern.FindStringSubmatch(token)[1]
+			replacement, ok := substitutions[name]
+			if !ok {
+				unmatched[name] = true
+				return token
+			}
+			applied[name] = true
+			return replacement
+		})
+		if value != n.Value {
+			n.setScalar(value)
+		}
+		return nil
+	})
+
+	return &TemplateResult{Applied: sortedKeys(applied), Unmatched: sortedKeys(unmatched)}
+}
+
+// sortedKeys returns the keys of a set in sorted order
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,55 @@
+package xmlapi
+
+import (
+	"context"
+	"time"
+)
+
+// WithTimeout limits each attempt of a request, including reading the
+// response, to d. Endpoints without their own WithEndpointTimeout use it; a
+// caller's context deadline applies as well, whichever is sooner.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = d
+	}
+}
+
+// WithEndpointTimeout limits each attempt of requests to endpoint (e.g.
+// "/copyDevice") to d, overriding WithTimeout for that endpoint
+func WithEndpointTimeout(endpoint string, d time.Duration) Option {
+	return func(c *Client) {
+		if c.endpointTimeouts == nil {
+			c.endpointTimeouts = make(map[string]time.Duration)
+		}
+		c.endpointTimeouts[endpoint] = d
+	}
+}
+
+// WithDebug logs every request attempt, with its effective timeout, to the
+// client's Logger
+func WithDebug() Option {
+	return func(c *Client) {
+		c.debug = true
+	}
+}
+
+// timeoutFor returns the per-attempt timeout of endpoint, 0 for none. A
+// RequestTimeout of the call takes precedence; it bounds the attempts
+// together as well.
+func (c *Client) timeoutFor(ctx context.Context, endpoint string) time.Duration {
+	if d := requestConfig(ctx).timeout; d > 0 {
+		return d
+	}
+	if d, ok := c.endpointTimeouts[endpoint]; ok {
+		return d
+	}
+	return c.timeout
+}
+
+// formatTimeout renders a timeout for the debug log
+func formatTimeout(d time.Duration) string {
+	if d <= 0 {
+		return "none"
+	}
+	return d.String()
+}
@@ -0,0 +1,109 @@
+package xmlapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// TransformError reports a stylesheet failure, with the line of the
+// stylesheet or document the gateway blamed when it reported one
+type TransformError struct {
+	Line    int
+	Message string
+	Err     *APIError
+}
+
+// Error implements the error interface
+func (e *TransformError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("transform failed at line %d: %s", e.Line, e.Message)
+	}
+	return "transform failed: " + e.Message
+}
+
+// Unwrap returns the underlying API error
+func (e *TransformError) Unwrap() error {
+	return e.Err
+}
+
+// transformErrorResponse represents the error body of the transform endpoint
+type transformErrorResponse struct {
+	Error string `json:"error"`
+	Line  int    `json:"line"`
+}
+
+// TransformFile applies a stylesheet stored on the gateway to an XML file and
+// writes the result to outputFilename on the same device. params are passed
+// to the stylesheet as its parameters.
+func (c *Client) TransformFile(deviceID, filename, stylesheet, outputFilename string, params map[string]string, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "TransformFile", opts, deviceID, filename, nil)
+	defer op.finish(&err)
+
+	if outputFilename == "" {
+		return "", errors.New("transform file: output filename is required, use TransformFileTo to stream the result")
+	}
+
+	resp, err := c.transform(ctx, deviceID, filename, stylesheet, outputFilename, params)
+	if err != nil {
+		return "", err
+	}
+
+	var result APIResponse
+	err = c.decode(resp, &result)
+	if err != nil {
+		return "", err
+	}
+
+	if result.Error != "" {
+		return "", result.err(resp.StatusCode)
+	}
+
+	return result.Status, nil
+}
+
+// TransformFileTo applies a stylesheet stored on the gateway to an XML file
+// and writes the transformed document to w instead of storing it
+func (c *Client) TransformFileTo(w io.Writer, deviceID, filename, stylesheet string, params map[string]string, opts ...RequestOption) (err error) {
+	ctx, op := startOp(context.Background(), "TransformFileTo", opts, deviceID, filename, nil)
+	defer op.finish(&err)
+
+	resp, err := c.transform(ctx, deviceID, filename, stylesheet, "", params)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(resp.Body)
+	return err
+}
+
+// transform calls the transform endpoint, turning failures into a TransformError
+func (c *Client) transform(ctx context.Context, deviceID, filename, stylesheet, outputFilename string, stylesheetParams map[string]string) (*Response, error) {
+	params := map[string]string{
+		"deviceid":   deviceID,
+		"filename":   filename,
+		"stylesheet": stylesheet,
+	}
+	if outputFilename != "" {
+		params["output_filename"] = outputFilename
+	}
+	for name, value := range stylesheetParams {
+		params["param."+name] = value
+	}
+
+	resp, err := c.requestContext(ctx, "POST", "/transform", params, nil)
+	if err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && !errors.Is(err, ErrUnsupportedByServer) {
+			var body transformErrorResponse
+			if json.Unmarshal(apiErr.Body, &body) == nil && body.Error != "" {
+				return nil, &TransformError{Line: body.Line, Message: body.Error, Err: apiErr}
+			}
+		}
+		return nil, err
+	}
+
+	return resp, nil
+}
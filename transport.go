@@ -0,0 +1,177 @@
+package xmlapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Transport defaults. Timeouts match net/http's DefaultTransport; the pool
+// keeps more idle connections per host, since a client usually talks to a
+// single gateway from many goroutines.
+const (
+	defaultDialTimeout         = 30 * time.Second
+	defaultKeepAlive           = 30 * time.Second
+	defaultMaxIdleConns        = 100
+	defaultMaxIdleConnsPerHost = 32
+	defaultIdleConnTimeout     = 90 * time.Second
+)
+
+// newTransport returns the transport shared by all requests of a client
+func newTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = dialer(defaultDialTimeout)
+	t.MaxIdleConns = defaultMaxIdleConns
+	t.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	t.IdleConnTimeout = defaultIdleConnTimeout
+	return t
+}
+
+// dialer returns a DialContext function with the given connect timeout
+func dialer(timeout time.Duration) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	d := &net.Dialer{Timeout: timeout, KeepAlive: defaultKeepAlive}
+	return d.DialContext
+}
+
+// WithDialTimeout limits how long connecting to the gateway may take, 30s
+// by default. A connect that times out fails with an error matching
+// ErrConnectTimeout.
+func WithDialTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.transport.DialContext = dialer(d)
+	}
+}
+
+// WithResponseHeaderTimeout limits how long to wait for the gateway's
+// response headers once the request is sent; there is no limit by default.
+// Exceeding it fails with an error matching ErrResponseTimeout.
+func WithResponseHeaderTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.transport.ResponseHeaderTimeout = d
+	}
+}
+
+// WithMaxIdleConnsPerHost sets how many idle connections to the gateway are
+// kept for reuse, 32 by default (net/http keeps 2)
+func WithMaxIdleConnsPerHost(n int) Option {
+	return func(c *Client) {
+		c.transport.MaxIdleConnsPerHost = n
+		if n > c.transport.MaxIdleConns {
+			c.transport.MaxIdleConns = n
+		}
+	}
+}
+
+// WithMaxConnsPerHost caps the connections to the gateway, idle or in use;
+// requests beyond it wait for a free connection. There is no cap by default.
+func WithMaxConnsPerHost(n int) Option {
+	return func(c *Client) {
+		c.transport.MaxConnsPerHost = n
+	}
+}
+
+// WithIdleConnTimeout sets how long an idle connection is kept, 90s by default
+func WithIdleConnTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.transport.IdleConnTimeout = d
+	}
+}
+
+// do sends req through the client's transport. Failures to reach the
+// gateway are returned as a *TransportError.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, transportError(req, err)
+	}
+	return resp, nil
+}
+
+// TransportError reports a request that failed before the gateway answered
+// it, or whose response could not be read: a dial, TLS or connection
+// failure, or a timeout. Errors the gateway reports are an *APIError
+// instead. An attempt cut short by WithTimeout, WithEndpointTimeout or
+// RequestTimeout is a TransportError with Timeout set; only the caller's
+// own context ending is returned as it is.
+type TransportError struct {
+	// URL is the request URL, without user info
+	URL string
+	// Timeout is set when the request timed out
+	Timeout bool
+	// Err is the underlying error, usually a *url.Error wrapping a *net.OpError
+	Err error
+}
+
+// Error implements the error interface
+func (e *TransportError) Error() string {
+	return "transport error: " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// transportError wraps a failure to send req. Connect and response-header
+// timeouts also match ErrConnectTimeout and ErrResponseTimeout.
+func transportError(req *http.Request, err error) error {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	redacted := redactedURL(req)
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) && urlErr.URL != redacted {
+		err = &url.Error{Op: urlErr.Op, URL: redacted, Err: urlErr.Err}
+	}
+
+	var timeout interface{ Timeout() bool }
+	isTimeout := errors.As(err, &timeout) && timeout.Timeout()
+
+	var opErr *net.OpError
+	switch {
+	case errors.As(err, &opErr) && opErr.Op == "dial" && opErr.Timeout():
+		err = fmt.Errorf("%w: %w", ErrConnectTimeout, err)
+	case isTimeout:
+		err = fmt.Errorf("%w: %w", ErrResponseTimeout, err)
+	}
+
+	return &TransportError{URL: redacted, Timeout: isTimeout, Err: err}
+}
+
+// redactedURL returns the URL of req without user info
+func redactedURL(req *http.Request) string {
+	if req == nil {
+		return ""
+	}
+	u := *req.URL
+	u.User = nil
+	return u.String()
+}
+
+// attemptTimeout turns err, the failure of an attempt of req, into a timed
+// out *TransportError when the attempt's own timeout caused it rather than
+// parent, the context of the whole call, ending
+func attemptTimeout(parent context.Context, req *http.Request, err error) error {
+	if parent.Err() != nil || !errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return &TransportError{URL: redactedURL(req), Timeout: true, Err: fmt.Errorf("%w: %w", ErrResponseTimeout, err)}
+}
+
+// readBody reads a response body to the end. The transport closes the body
+// when the request's context ends, so a body trickling in cannot outlive
+// the caller; the context's error is then returned instead of the read
+// error it caused.
+func readBody(ctx context.Context, body io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(body)
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return data, err
+}
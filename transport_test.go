@@ -0,0 +1,190 @@
+package xmlapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// holdReads makes /read requests wait until n of them have arrived
+func holdReads(g *fakeGateway, n int) {
+	var mu sync.Mutex
+	arrived := 0
+	release := make(chan struct{})
+	g.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/read" {
+			return false
+		}
+		mu.Lock()
+		arrived++
+		wait := release
+		last := arrived%n == 0
+		if last {
+			close(release)
+			release = make(chan struct{})
+		}
+		mu.Unlock()
+		<-wait
+		return false
+	}
+}
+
+// settledGoroutines waits up to a second for the number of goroutines to
+// fall to want and returns the number left
+func settledGoroutines(want int) int {
+	deadline := time.Now().Add(time.Second)
+	n := runtime.NumGoroutine()
+	for n > want && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		n = runtime.NumGoroutine()
+	}
+	return n
+}
+
+// readConcurrently makes n concurrent reads
+func readConcurrently(t *testing.T, c *Client, n int) {
+	t.Helper()
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.ReadNode("dev", "plan.xml", "/plan"); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestTransportDefaults(t *testing.T) {
+	c := NewClient("key", "http://gateway.invalid")
+	defer c.Close()
+	if c.transport.MaxIdleConnsPerHost != defaultMaxIdleConnsPerHost || c.transport.MaxIdleConns != defaultMaxIdleConns || c.transport.IdleConnTimeout != defaultIdleConnTimeout {
+		t.Errorf("pool %d/%d/%s, want the defaults", c.transport.MaxIdleConnsPerHost, c.transport.MaxIdleConns, c.transport.IdleConnTimeout)
+	}
+
+	c = NewClient("key", "http://gateway.invalid", WithMaxIdleConnsPerHost(500), WithMaxConnsPerHost(8), WithIdleConnTimeout(time.Second))
+	defer c.Close()
+	if c.transport.MaxIdleConnsPerHost != 500 || c.transport.MaxIdleConns < 500 || c.transport.MaxConnsPerHost != 8 || c.transport.IdleConnTimeout != time.Second {
+		t.Errorf("pool %d/%d/%d/%s, want the options", c.transport.MaxIdleConnsPerHost, c.transport.MaxIdleConns, c.transport.MaxConnsPerHost, c.transport.IdleConnTimeout)
+	}
+}
+
+func TestConnectionReuse(t *testing.T) {
+	const parallel = 20
+	for _, tc := range []struct {
+		name string
+		opts []Option
+		// want is the connections after two rounds of parallel reads
+		want int
+	}{
+		{name: "default pool", want: parallel},
+		// Only two connections stay idle after the first round
+		{name: "small pool", opts: []Option{WithMaxIdleConnsPerHost(2)}, want: 2*parallel - 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := newFakeGateway(t)
+			g.load("dev", "plan.xml", planDoc)
+			holdReads(g, parallel)
+			c := g.client(tc.opts...)
+			if err := c.Authorize(); err != nil {
+				t.Fatal(err)
+			}
+
+			readConcurrently(t, c, parallel)
+			if n := g.connections(); n != parallel {
+				t.Fatalf("%d connections after the first round, want %d", n, parallel)
+			}
+			readConcurrently(t, c, parallel)
+			if n := g.connections(); n != tc.want {
+				t.Errorf("%d connections after the second round, want %d", n, tc.want)
+			}
+		})
+	}
+}
+
+func TestMaxConnsPerHost(t *testing.T) {
+	g := newFakeGateway(t)
+	g.load("dev", "plan.xml", planDoc)
+
+	var mu sync.Mutex
+	inFlight, peak := 0, 0
+	g.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		mu.Lock()
+		inFlight++
+		if inFlight > peak {
+			peak = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		return false
+	}
+	c := g.client(WithMaxConnsPerHost(4))
+
+	readConcurrently(t, c, 16)
+	if n := g.connections(); n > 4 {
+		t.Errorf("%d connections, want at most 4", n)
+	}
+	if peak > 4 {
+		t.Errorf("%d requests in flight at once, want at most 4", peak)
+	}
+}
+
+func TestCancelTricklingBody(t *testing.T) {
+	g := newFakeGateway(t)
+	g.load("dev", "plan.xml", planDoc)
+	// The body never ends, a byte at a time
+	g.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/children" {
+			return false
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		for {
+			w.Write([]byte(" "))
+			http.NewResponseController(w).Flush()
+			select {
+			case <-r.Context().Done():
+				return true
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+	}
+	c := g.client()
+	if err := c.Authorize(); err != nil {
+		t.Fatal(err)
+	}
+	baseline := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	var err error
+	for _, err = range c.Children(ctx, "dev", "plan.xml", "/plan") {
+		if err != nil {
+			break
+		}
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("error %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("returned after %s, want promptly after the cancel", elapsed)
+	}
+	if n := settledGoroutines(baseline); n > baseline {
+		t.Errorf("%d goroutines after the cancel, want at most the %d before", n, baseline)
+	}
+}
@@ -0,0 +1,136 @@
+package xmlapi
+
+import (
+	"context"
+	"net/url"
+	"time"
+)
+
+// WithSoftDeleteDefault makes DeleteFile move files to the trash, from
+// which RestoreFromTrash brings them back, unless Permanent is passed
+func WithSoftDeleteDefault() Option {
+	return func(c *Client) {
+		c.softDelete = true
+	}
+}
+
+// DeleteOption configures DeleteFile. Every RequestOption is a DeleteOption too.
+type DeleteOption interface {
+	applyDelete(*deleteConfig)
+}
+
+// deleteOption is a DeleteOption setting an option of DeleteFile
+type deleteOption func(*deleteConfig)
+
+func (f deleteOption) applyDelete(cfg *deleteConfig) {
+	f(cfg)
+}
+
+// deleteConfig holds the options of a DeleteFile call
+type deleteConfig struct {
+	trash bool
+
+	// call holds the RequestOptions among the options
+	call []RequestOption
+}
+
+// Permanent deletes the file outright even with WithSoftDeleteDefault
+func Permanent() DeleteOption {
+	return deleteOption(func(cfg *deleteConfig) {
+		cfg.trash = false
+	})
+}
+
+// TrashEntry is a file in a device's trash
+type TrashEntry struct {
+	// ID identifies this deletion, as a file may be trashed more than once
+	ID       string    `json:"id"`
+	Filename string    `json:"filename"`
+	Deleted  time.Time `json:"deleted"`
+	Size     int64     `json:"size"`
+}
+
+// trashList represents the response of /trash/list
+type trashList struct {
+	Entries []TrashEntry `json:"entries"`
+}
+
+// TrashFile moves a file to the trash
+func (c *Client) TrashFile(deviceID, filename string, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "TrashFile", opts, deviceID, filename, nil)
+	defer op.finish(&err)
+
+	return c.trashFile(ctx, deviceID, filename)
+}
+
+// trashFile implements TrashFile, carrying ctx
+func (c *Client) trashFile(ctx context.Context, deviceID, filename string) (string, error) {
+	params := map[string]string{
+		"deviceid": deviceID,
+		"filename": filename,
+		"trash":    "true",
+	}
+
+	return c.statusRequestContext(ctx, "DELETE", "/deleteFile", params, nil)
+}
+
+// ListTrash lists the files in a device's trash
+func (c *Client) ListTrash(deviceID string, opts ...RequestOption) (_ []TrashEntry, err error) {
+	ctx, op := startOp(context.Background(), "ListTrash", opts, deviceID, "", nil)
+	defer op.finish(&err)
+
+	params := map[string]string{
+		"deviceid": deviceID,
+	}
+
+	resp, err := c.requestContext(ctx, "GET", "/trash/list", params, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result trashList
+	err = c.decode(resp, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Entries, nil
+}
+
+// RestoreFromTrash restores the trashed file with the given entry ID, under
+// filename if set and under its original name otherwise. It never
+// overwrites: if a file of that name exists, the entry stays in the trash
+// and the error matches ErrAlreadyExists, so it can be restored under
+// another name.
+func (c *Client) RestoreFromTrash(deviceID, id, filename string, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "RestoreFromTrash", opts, deviceID, filename, nil)
+	defer op.finish(&err)
+
+	params := map[string]string{
+		"deviceid": deviceID,
+		"id":       id,
+	}
+	if filename != "" {
+		params["filename"] = filename
+	}
+
+	return c.statusRequestContext(ctx, "POST", "/trash/restore", params, nil)
+}
+
+// PurgeTrash permanently deletes the trash entries with the given IDs, or
+// the whole trash of the device when ids is empty
+func (c *Client) PurgeTrash(deviceID string, ids []string, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "PurgeTrash", opts, deviceID, "", nil)
+	defer op.finish(&err)
+
+	params := map[string]string{
+		"deviceid": deviceID,
+	}
+	multi := url.Values{"id": ids}
+
+	resp, err := c.requestMulti(ctx, "DELETE", "/trash/purge", params, multi, nil)
+	if err != nil {
+		return "", err
+	}
+	return c.status(resp)
+}
@@ -0,0 +1,159 @@
+package xmlapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"sort"
+	"strconv"
+)
+
+// maxLargestSubtrees is how many subtrees TreeStats.Largest lists
+const maxLargestSubtrees = 5
+
+// TreeStats is a cheap structural summary of an XML file
+type TreeStats struct {
+	// Elements is the number of elements, the root included
+	Elements int `json:"elements"`
+	// Tags counts the elements by local name
+	Tags map[string]int `json:"tags"`
+	// MaxDepth is the depth of the deepest element, the root being 0
+	MaxDepth int `json:"max_depth"`
+	// ValueBytes is the total length of all element values
+	ValueBytes int64 `json:"value_bytes"`
+	// Largest lists the biggest subtrees below the root, largest first
+	Largest []SubtreeSize `json:"largest"`
+	// Hash is a hex SHA-256 over the canonical content: names, attributes
+	// sorted by name, values and children in order, comments left out.
+	// Files with the same content have the same hash.
+	Hash string `json:"hash"`
+}
+
+// SubtreeSize is the size of the subtree at Path
+type SubtreeSize struct {
+	Path     string `json:"path"`
+	Elements int    `json:"elements"`
+}
+
+// TreeStats summarizes a file, using the gateway's /stats where available.
+// Otherwise the whole document is read with ReadFile and summarized
+// client-side, which is logged since it can be costly for large files.
+func (c *Client) TreeStats(deviceID, filename string, opts ...RequestOption) (_ *TreeStats, err error) {
+	ctx, op := startOp(context.Background(), "TreeStats", opts, deviceID, filename, nil)
+	defer op.finish(&err)
+
+	return c.treeStats(ctx, deviceID, filename)
+}
+
+// treeStats implements TreeStats, carrying ctx
+func (c *Client) treeStats(ctx context.Context, deviceID, filename string) (*TreeStats, error) {
+	params := map[string]string{
+		"deviceid": deviceID,
+		"filename": filename,
+	}
+
+	resp, err := c.requestContext(ctx, "GET", "/stats", params, nil)
+	if err == nil {
+		var stats TreeStats
+		if err := c.decode(resp, &stats); err != nil {
+			return nil, err
+		}
+		return &stats, nil
+	}
+	if !errors.Is(err, ErrUnsupportedByServer) {
+		return nil, err
+	}
+
+	c.logger.Printf("Gateway has no /stats endpoint; downloading %s from %s to compute its statistics", filename, deviceID)
+	root, err := c.readFile(ctx, deviceID, filename)
+	if err != nil {
+		return nil, err
+	}
+	return computeTreeStats(root), nil
+}
+
+// computeTreeStats summarizes the tree rooted at root
+func computeTreeStats(root *Node) *TreeStats {
+	stats := &TreeStats{Tags: make(map[string]int)}
+	sizes := make(map[*Node]int)
+	var subtrees []SubtreeSize
+
+	root.WalkWithDepth(func(path string, depth int, n *Node) error {
+		stats.Elements++
+		stats.Tags[n.XMLName.Local]++
+		stats.ValueBytes += int64(len(n.Value))
+		if depth > stats.MaxDepth {
+			stats.MaxDepth = depth
+		}
+		if depth > 0 {
+			subtrees = append(subtrees, SubtreeSize{Path: path, Elements: subtreeSize(n, sizes)})
+		}
+		return nil
+	})
+
+	sort.SliceStable(subtrees, func(i, j int) bool { return subtrees[i].Elements > subtrees[j].Elements })
+	if len(subtrees) > maxLargestSubtrees {
+		subtrees = subtrees[:maxLargestSubtrees]
+	}
+	stats.Largest = subtrees
+
+	h := sha256.New()
+	hashNode(h, root)
+	stats.Hash = hex.EncodeToString(h.Sum(nil))
+	return stats
+}
+
+// subtreeSize returns the number of elements in the subtree at n, memoized in sizes
+func subtreeSize(n *Node, sizes map[*Node]int) int {
+	if size, ok := sizes[n]; ok {
+		return size
+	}
+	size := 1
+	for i := range n.Nodes {
+		if n.Nodes[i].Kind == NodeElement {
+			size += subtreeSize(&n.Nodes[i], sizes)
+		}
+	}
+	sizes[n] = size
+	return size
+}
+
+// hashNode writes the canonical form of the element n to h. Every field is
+// length-prefixed so that no two trees share a form.
+func hashNode(h hash.Hash, n *Node) {
+	field := func(s string) {
+		h.Write([]byte(strconv.Itoa(len(s)) + ":" + s))
+	}
+
+	field(n.XMLName.Space)
+	field(n.XMLName.Local)
+
+	attrs := make([]Attr, len(n.Attrs))
+	copy(attrs, n.Attrs)
+	sort.Slice(attrs, func(i, j int) bool {
+		if attrs[i].Name.Space != attrs[j].Name.Space {
+			return attrs[i].Name.Space < attrs[j].Name.Space
+		}
+		return attrs[i].Name.Local < attrs[j].Name.Local
+	})
+	field(strconv.Itoa(len(attrs)))
+	for _, attr := range attrs {
+		field(attr.Name.Space)
+		field(attr.Name.Local)
+		field(attr.Value)
+	}
+	field(n.Value)
+
+	var children []*Node
+	for i := range n.Nodes {
+		if n.Nodes[i].Kind == NodeElement {
+			children = append(children, &n.Nodes[i])
+		}
+	}
+	field(strconv.Itoa(len(children)))
+	for _, child := range children {
+		hashNode(h, child)
+	}
+}
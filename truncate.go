@@ -0,0 +1,74 @@
+package xmlapi
+
+import (
+	"context"
+	"errors"
+)
+
+// TruncateOptions configures TruncateFile
+type TruncateOptions struct {
+	// Confirm must be set for TruncateFile to do anything, so a script
+	// cannot wipe a file by accident
+	Confirm bool
+}
+
+// TruncateFile removes every child of the file's root element while keeping
+// the root, its attributes and the file itself, so the gateway's revision
+// history continues. The gateway's /truncate is used where available,
+// otherwise the root's element children are deleted in one bulk request
+// or, failing that, one by one. Without opts.Confirm it returns
+// ErrNotConfirmed.
+func (c *Client) TruncateFile(deviceID, filename string, opts TruncateOptions, reqOpts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "TruncateFile", reqOpts, deviceID, filename, nil)
+	defer op.finish(&err)
+
+	if !opts.Confirm {
+		return "", ErrNotConfirmed
+	}
+
+	params := map[string]string{
+		"deviceid": deviceID,
+		"filename": filename,
+	}
+	status, err := c.statusRequestContext(ctx, "POST", "/truncate", params, nil)
+	if !errors.Is(err, ErrUnsupportedByServer) {
+		return status, err
+	}
+
+	root, err := c.readFile(ctx, deviceID, filename)
+	if err != nil {
+		return "", err
+	}
+	var paths []string
+	for i, path := range childPaths("/"+escapeSegment(root.XMLName.Local), root, true) {
+		if root.Nodes[i].Kind == NodeElement {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		return "", nil
+	}
+
+	return c.deleteSiblings(ctx, deviceID, filename, paths)
+}
+
+// deleteSiblings deletes the elements at paths, which are siblings given in
+// document order, in one bulk request where the gateway supports it and one
+// by one otherwise
+func (c *Client) deleteSiblings(ctx context.Context, deviceID, filename string, paths []string) (string, error) {
+	// Later siblings go first so the indexes of earlier ones stay valid
+	reversed := make([]string, len(paths))
+	for i, path := range paths {
+		reversed[len(paths)-1-i] = path
+	}
+	status, err := c.deleteNodes(ctx, deviceID, filename, reversed)
+	if !errors.Is(err, ErrUnsupportedByServer) {
+		return status, err
+	}
+	for _, path := range reversed {
+		if status, err = c.deleteNode(ctx, deviceID, filename, path); err != nil {
+			return "", err
+		}
+	}
+	return status, nil
+}
@@ -0,0 +1,108 @@
+package xmlapi
+
+import (
+	"context"
+	"time"
+)
+
+// The typed variants of UpdateNode and CreateNode write values in the same
+// canonical formats as the Node setters, which the typed Node accessors
+// parse back to the same value
+
+// UpdateNodeInt updates a node to a base 10 integer
+func (c *Client) UpdateNodeInt(deviceID, filename string, path PathLike, v int64, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "UpdateNodeInt", opts, deviceID, filename, path)
+	defer op.finish(&err)
+
+	return c.updateTyped(ctx, deviceID, filename, path, formatInt(v))
+}
+
+// UpdateNodeFloat updates a node to the shortest representation of a float
+func (c *Client) UpdateNodeFloat(deviceID, filename string, path PathLike, v float64, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "UpdateNodeFloat", opts, deviceID, filename, path)
+	defer op.finish(&err)
+
+	return c.updateTyped(ctx, deviceID, filename, path, formatFloat(v))
+}
+
+// UpdateNodeBool updates a node to "true" or "false"
+func (c *Client) UpdateNodeBool(deviceID, filename string, path PathLike, v bool, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "UpdateNodeBool", opts, deviceID, filename, path)
+	defer op.finish(&err)
+
+	return c.updateTyped(ctx, deviceID, filename, path, formatBool(v))
+}
+
+// UpdateNodeTime updates a node to an RFC 3339 timestamp
+func (c *Client) UpdateNodeTime(deviceID, filename string, path PathLike, v time.Time, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "UpdateNodeTime", opts, deviceID, filename, path)
+	defer op.finish(&err)
+
+	return c.updateTyped(ctx, deviceID, filename, path, formatTime(v))
+}
+
+// UpdateNodeDuration updates a node to a Go duration string
+func (c *Client) UpdateNodeDuration(deviceID, filename string, path PathLike, v time.Duration, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "UpdateNodeDuration", opts, deviceID, filename, path)
+	defer op.finish(&err)
+
+	return c.updateTyped(ctx, deviceID, filename, path, formatDuration(v))
+}
+
+// CreateNodeInt creates a node holding a base 10 integer
+func (c *Client) CreateNodeInt(deviceID, filename string, parentPath PathLike, tag string, v int64, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "CreateNodeInt", opts, deviceID, filename, parentPath)
+	defer op.finish(&err)
+
+	return c.createTyped(ctx, deviceID, filename, parentPath, tag, formatInt(v))
+}
+
+// CreateNodeFloat creates a node holding the shortest representation of a float
+func (c *Client) CreateNodeFloat(deviceID, filename string, parentPath PathLike, tag string, v float64, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "CreateNodeFloat", opts, deviceID, filename, parentPath)
+	defer op.finish(&err)
+
+	return c.createTyped(ctx, deviceID, filename, parentPath, tag, formatFloat(v))
+}
+
+// CreateNodeBool creates a node holding "true" or "false"
+func (c *Client) CreateNodeBool(deviceID, filename string, parentPath PathLike, tag string, v bool, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "CreateNodeBool", opts, deviceID, filename, parentPath)
+	defer op.finish(&err)
+
+	return c.createTyped(ctx, deviceID, filename, parentPath, tag, formatBool(v))
+}
+
+// CreateNodeTime creates a node holding an RFC 3339 timestamp
+func (c *Client) CreateNodeTime(deviceID, filename string, parentPath PathLike, tag string, v time.Time, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "CreateNodeTime", opts, deviceID, filename, parentPath)
+	defer op.finish(&err)
+
+	return c.createTyped(ctx, deviceID, filename, parentPath, tag, formatTime(v))
+}
+
+// CreateNodeDuration creates a node holding a Go duration string
+func (c *Client) CreateNodeDuration(deviceID, filename string, parentPath PathLike, tag string, v time.Duration, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "CreateNodeDuration", opts, deviceID, filename, parentPath)
+	defer op.finish(&err)
+
+	return c.createTyped(ctx, deviceID, filename, parentPath, tag, formatDuration(v))
+}
+
+// updateTyped implements the typed variants of UpdateNode, carrying ctx
+func (c *Client) updateTyped(ctx context.Context, deviceID, filename string, path PathLike, value string) (string, error) {
+	pathStr, err := PathString(path)
+	if err != nil {
+		return "", err
+	}
+	return c.updateNode(ctx, deviceID, filename, pathStr, value)
+}
+
+// createTyped implements the typed variants of CreateNode, carrying ctx
+func (c *Client) createTyped(ctx context.Context, deviceID, filename string, parentPath PathLike, tag, value string) (string, error) {
+	parentStr, err := PathString(parentPath)
+	if err != nil {
+		return "", err
+	}
+	return c.createNode(ctx, deviceID, filename, parentStr, tag, value)
+}
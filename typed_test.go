@@ -0,0 +1,138 @@
+package xmlapi
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTypedClientRoundTrip(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 30, 0, 123456789, time.FixedZone("", 2*3600))
+
+	for _, tc := range []struct {
+		name string
+		// create and update write the typed values through the client
+		create func(c *Client, tag string) (string, error)
+		update func(c *Client, path string) (string, error)
+		// check reads the value back through the typed accessor
+		check func(n *Node) error
+		// created and updated are the canonical texts stored
+		created, updated string
+	}{
+		{
+			name: "int",
+			create: func(c *Client, tag string) (string, error) {
+				return c.CreateNodeInt("dev", "cfg.xml", "/cfg", tag, math.MinInt64)
+			},
+			update: func(c *Client, path string) (string, error) {
+				return c.UpdateNodeInt("dev", "cfg.xml", path, 42)
+			},
+			check:   wantValue((*Node).Int, int64(42)),
+			created: "-9223372036854775808", updated: "42",
+		},
+		{
+			name: "float",
+			create: func(c *Client, tag string) (string, error) {
+				return c.CreateNodeFloat("dev", "cfg.xml", "/cfg", tag, 1e21)
+			},
+			update: func(c *Client, path string) (string, error) {
+				return c.UpdateNodeFloat("dev", "cfg.xml", path, -3.75)
+			},
+			check:   wantValue((*Node).Float, -3.75),
+			created: "1e+21", updated: "-3.75",
+		},
+		{
+			name: "bool",
+			create: func(c *Client, tag string) (string, error) {
+				return c.CreateNodeBool("dev", "cfg.xml", "/cfg", tag, true)
+			},
+			update: func(c *Client, path string) (string, error) {
+				return c.UpdateNodeBool("dev", "cfg.xml", path, false)
+			},
+			check:   wantValue((*Node).Bool, false),
+			created: "true", updated: "false",
+		},
+		{
+			name: "time",
+			create: func(c *Client, tag string) (string, error) {
+				return c.CreateNodeTime("dev", "cfg.xml", "/cfg", tag, at.UTC())
+			},
+			update: func(c *Client, path string) (string, error) {
+				return c.UpdateNodeTime("dev", "cfg.xml", path, at)
+			},
+			check: func(n *Node) error {
+				got, err := n.Time()
+				if err != nil {
+					return err
+				}
+				if !got.Equal(at) {
+					return mismatch(got, at)
+				}
+				return nil
+			},
+			created: "2024-03-01T10:30:00.123456789Z", updated: "2024-03-01T12:30:00.123456789+02:00",
+		},
+		{
+			name: "duration",
+			create: func(c *Client, tag string) (string, error) {
+				return c.CreateNodeDuration("dev", "cfg.xml", "/cfg", tag, 0)
+			},
+			update: func(c *Client, path string) (string, error) {
+				return c.UpdateNodeDuration("dev", "cfg.xml", path, 1500*time.Millisecond)
+			},
+			check:   wantValue((*Node).Duration, 1500*time.Millisecond),
+			created: "0s", updated: "1.5s",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := newFakeGateway(t)
+			g.load("dev", "cfg.xml", `<cfg/>`)
+			c := g.client()
+
+			if _, err := tc.create(c, "v"); err != nil {
+				t.Fatalf("create: %v", err)
+			}
+			n, err := c.ReadNode("dev", "cfg.xml", "/cfg/v")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n.Value != tc.created {
+				t.Errorf("created %q, want %q", n.Value, tc.created)
+			}
+
+			if _, err := tc.update(c, "/cfg/v"); err != nil {
+				t.Fatalf("update: %v", err)
+			}
+			n, err = c.ReadNode("dev", "cfg.xml", "/cfg/v")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n.Value != tc.updated {
+				t.Errorf("updated to %q, want %q", n.Value, tc.updated)
+			}
+			if err := tc.check(n); err != nil {
+				t.Errorf("reading the update back: %v", err)
+			}
+		})
+	}
+}
+
+// wantValue returns a check that the accessor reads want
+func wantValue[T comparable](accessor func(*Node) (T, error), want T) func(*Node) error {
+	return func(n *Node) error {
+		got, err := accessor(n)
+		if err != nil {
+			return err
+		}
+		if got != want {
+			return mismatch(got, want)
+		}
+		return nil
+	}
+}
+
+// mismatch describes a value read back differently from the one written
+func mismatch(got, want interface{}) error {
+	return fmt.Errorf("read %v, want %v", got, want)
+}
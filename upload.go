@@ -0,0 +1,159 @@
+package xmlapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// XMLError describes a well-formedness error at a position in an XML document
+type XMLError struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+// Error implements the error interface
+func (e XMLError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+}
+
+// ValidateWellFormed checks that r holds a single well-formed XML document:
+// tags closed and properly nested, only legal characters, and no entity
+// references beyond the predefined ones. The input is streamed, never held
+// in memory whole. The decoder cannot resynchronise after an error, so at
+// most one error is reported; nil means the document is well-formed.
+func ValidateWellFormed(r io.Reader) []XMLError {
+	d := xml.NewDecoder(r)
+	d.Strict = true
+
+	depth := 0
+	roots := 0
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			line, column := d.InputPos()
+			if syntaxErr, ok := err.(*xml.SyntaxError); ok {
+				return []XMLError{{Line: line, Column: column, Message: syntaxErr.Msg}}
+			}
+			return []XMLError{{Line: line, Column: column, Message: err.Error()}}
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if depth == 0 {
+				roots++
+				if roots > 1 {
+					line, column := d.InputPos()
+					return []XMLError{{Line: line, Column: column, Message: "multiple root elements"}}
+				}
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		case xml.CharData:
+			if depth == 0 && len(bytes.TrimSpace(t)) > 0 {
+				line, column := d.InputPos()
+				return []XMLError{{Line: line, Column: column, Message: "character data outside the root element"}}
+			}
+		}
+	}
+
+	if roots == 0 {
+		line, column := d.InputPos()
+		return []XMLError{{Line: line, Column: column, Message: "no root element"}}
+	}
+
+	return nil
+}
+
+// UploadOption configures UploadFile. Every RequestOption is a UploadOption too.
+type UploadOption interface {
+	applyUpload(*uploadConfig)
+}
+
+// uploadOption is a UploadOption setting an option of UploadFile
+type uploadOption func(*uploadConfig)
+
+func (f uploadOption) applyUpload(cfg *uploadConfig) {
+	f(cfg)
+}
+
+// uploadConfig holds the options of an UploadFile call
+type uploadConfig struct {
+	skipWellFormed bool
+	checkCapacity  bool
+
+	// call holds the RequestOptions among the options
+	call []RequestOption
+}
+
+// SkipWellFormedCheck uploads the document without checking it is well-formed first
+func SkipWellFormedCheck() UploadOption {
+	return uploadOption(func(cfg *uploadConfig) {
+		cfg.skipWellFormed = true
+	})
+}
+
+// CheckCapacityFirst reads the device's storage usage before uploading and
+// fails with ErrInsufficientStorage if the document does not fit. When
+// overwriting, the space of the file being replaced counts as available.
+func CheckCapacityFirst() UploadOption {
+	return uploadOption(func(cfg *uploadConfig) {
+		cfg.checkCapacity = true
+	})
+}
+
+// UploadFile uploads a whole XML document as a file. The document is checked
+// with ValidateWellFormed before anything is sent, since a malformed file
+// breaks the device's import; the first error is returned as an XMLError.
+func (c *Client) UploadFile(deviceID, filename string, r io.Reader, overwrite bool, opts ...UploadOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "UploadFile", nil, deviceID, filename, nil)
+	defer op.finish(&err)
+
+	return c.uploadFile(ctx, deviceID, filename, r, overwrite, opts...)
+}
+
+// uploadFile implements UploadFile, carrying ctx
+func (c *Client) uploadFile(ctx context.Context, deviceID, filename string, r io.Reader, overwrite bool, opts ...UploadOption) (string, error) {
+	var cfg uploadConfig
+	for _, opt := range opts {
+		opt.applyUpload(&cfg)
+	}
+	ctx = withRequestOptions(ctx, cfg.call)
+
+	var content bytes.Buffer
+	if cfg.skipWellFormed {
+		if _, err := content.ReadFrom(r); err != nil {
+			return "", err
+		}
+	} else if errs := ValidateWellFormed(io.TeeReader(r, &content)); len(errs) > 0 {
+		return "", fmt.Errorf("%s is not well-formed: %w", filename, errs[0])
+	}
+
+	if cfg.checkCapacity {
+		replacing := ""
+		if overwrite {
+			replacing = filename
+		}
+		if err := c.checkCapacity(ctx, deviceID, replacing, int64(content.Len())); err != nil {
+			return "", err
+		}
+	}
+
+	params := map[string]string{
+		"deviceid":  deviceID,
+		"filename":  filename,
+		"overwrite": fmt.Sprintf("%t", overwrite),
+	}
+	body := map[string]string{
+		"content": content.String(),
+	}
+
+	return c.statusRequestContext(ctx, "POST", "/uploadFile", params, body)
+}
@@ -0,0 +1,102 @@
+package xmlapi
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// UpsertNode sets the value of the first <tag> child of parentPath, creating
+// it if there is none. The gateway's /upsert does this atomically where
+// available. Otherwise the node is updated, and created only when the
+// update finds it missing; upserts of the same node through one Client are
+// serialized, so concurrent callers never create duplicates, but other
+// clients racing the same node may.
+func (c *Client) UpsertNode(deviceID, filename string, parentPath PathLike, tag, value string, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "UpsertNode", opts, deviceID, filename, parentPath)
+	defer op.finish(&err)
+
+	parentStr, err := PathString(parentPath)
+	if err != nil {
+		return "", err
+	}
+	return c.upsertNode(ctx, deviceID, filename, parentStr, tag, value)
+}
+
+// upsertNode implements UpsertNode, carrying ctx
+func (c *Client) upsertNode(ctx context.Context, deviceID, filename, parentPath, tag, value string) (string, error) {
+	stored, err := c.encodeValue(ctx, childValuePath(parentPath, tag), value)
+	if err != nil {
+		return "", err
+	}
+	params := map[string]string{
+		"deviceid":    deviceID,
+		"filename":    filename,
+		"parent_path": parentPath,
+		"tag":         tag,
+		"value":       stored,
+	}
+
+	status, err := c.statusRequestContext(ctx, "POST", "/upsert", params, nil)
+	if !errors.Is(err, ErrUnsupportedByServer) {
+		return status, err
+	}
+
+	// A prefixed tag names a namespace prefix, not a literal colon
+	parent, err := ParsePath(parentPath)
+	if err != nil {
+		return "", err
+	}
+	child := parent.Join(tag)
+	if prefix, local, ok := strings.Cut(tag, ":"); ok {
+		child = parent.JoinNS(prefix, local)
+	}
+	path := child.Index(1).String()
+	unlock := c.upserts.lock(deviceID + "\x00" + filename + "\x00" + path)
+	defer unlock()
+
+	status, err = c.updateNode(ctx, deviceID, filename, path, value)
+	if !errors.Is(err, ErrNotFound) {
+		return status, err
+	}
+	return c.createNode(ctx, deviceID, filename, parentPath, tag, value)
+}
+
+// pathLocks hands out a mutex per key, dropping it once no one holds it
+type pathLocks struct {
+	mu    sync.Mutex
+	locks map[string]*pathLock
+}
+
+// pathLock is the mutex of one key and the number of its holders and waiters
+type pathLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lock locks key and returns the function unlocking it
+func (l *pathLocks) lock(key string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*pathLock)
+	}
+	pl, ok := l.locks[key]
+	if !ok {
+		pl = &pathLock{}
+		l.locks[key] = pl
+	}
+	pl.refs++
+	l.mu.Unlock()
+
+	pl.mu.Lock()
+	return func() {
+		pl.mu.Unlock()
+		l.mu.Lock()
+		pl.refs--
+		if pl.refs == 0 {
+			delete(l.locks, key)
+		}
+		l.mu.Unlock()
+	}
+}
@@ -0,0 +1,102 @@
+package xmlapi
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUpsertNode(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		doc         string
+		disabled    []string
+		want        string
+		wantCreates int
+	}{
+		{
+			name: "gateway creates", doc: `<cfg/>`,
+			want: `<cfg><v>x</v></cfg>`,
+		},
+		{
+			name: "gateway updates the first sibling", doc: `<cfg><v>1</v><v>2</v></cfg>`,
+			want: `<cfg><v>x</v><v>2</v></cfg>`,
+		},
+		{
+			name: "fallback creates", doc: `<cfg/>`, disabled: []string{"/upsert"},
+			want: `<cfg><v>x</v></cfg>`, wantCreates: 1,
+		},
+		{
+			name: "fallback updates the first sibling", doc: `<cfg><v>1</v><v>2</v></cfg>`, disabled: []string{"/upsert"},
+			want: `<cfg><v>x</v><v>2</v></cfg>`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := newFakeGateway(t)
+			g.load("dev", "cfg.xml", tc.doc)
+			g.disable(tc.disabled...)
+			c := g.client()
+
+			if _, err := c.UpsertNode("dev", "cfg.xml", "/cfg", "v", "x"); err != nil {
+				t.Fatal(err)
+			}
+			if got := mustXML(t, g.file("dev", "cfg.xml")); got != tc.want {
+				t.Errorf("document %s\nwant %s", got, tc.want)
+			}
+			if n := len(g.receivedAt("/create")); n != tc.wantCreates {
+				t.Errorf("%d creates, want %d", n, tc.wantCreates)
+			}
+			if updates := g.receivedAt("/update"); len(updates) > 0 && updates[0].Query.Get("path") != "/cfg/v[1]" {
+				t.Errorf("updated %s, want the first sibling", updates[0].Query.Get("path"))
+			}
+		})
+	}
+}
+
+func TestUpsertNodeConcurrent(t *testing.T) {
+	const callers = 16
+
+	for _, tc := range []struct {
+		name     string
+		disabled []string
+	}{
+		{name: "gateway upsert"},
+		{name: "update then create", disabled: []string{"/upsert"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := newFakeGateway(t)
+			g.load("dev", "cfg.xml", `<cfg/>`)
+			g.disable(tc.disabled...)
+			// Slow updates leave every caller time to find the node missing
+			g.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+				if r.URL.Path == "/update" {
+					time.Sleep(2 * time.Millisecond)
+				}
+				return false
+			}
+			c := g.client()
+
+			var wg sync.WaitGroup
+			for i := 0; i < callers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := c.UpsertNode("dev", "cfg.xml", "/cfg", "v", strconv.Itoa(i)); err != nil {
+						t.Error(err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			doc := g.file("dev", "cfg.xml")
+			if len(doc.Nodes) != 1 {
+				t.Fatalf("document %s, want a single <v>", mustXML(t, doc))
+			}
+			if v, err := strconv.Atoi(doc.Nodes[0].Value); err != nil || v < 0 || v >= callers {
+				t.Errorf("value %q, want one of the callers'", doc.Nodes[0].Value)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package xmlapi
+
+import (
+	"context"
+	"fmt"
+)
+
+// Usage is the flash storage consumption of a device
+type Usage struct {
+	Used      int64 `json:"bytes_used"`
+	Available int64 `json:"bytes_available"`
+	Files     int   `json:"file_count"`
+	// FileSizes maps each file to its size in bytes, when the gateway reports it
+	FileSizes map[string]int64 `json:"files,omitempty"`
+}
+
+// Usage reads the storage consumption of a device
+func (c *Client) Usage(deviceID string, opts ...RequestOption) (_ *Usage, err error) {
+	ctx, op := startOp(context.Background(), "Usage", opts, deviceID, "", nil)
+	defer op.finish(&err)
+
+	return c.usage(ctx, deviceID)
+}
+
+// usage implements Usage, carrying ctx
+func (c *Client) usage(ctx context.Context, deviceID string) (*Usage, error) {
+	params := map[string]string{
+		"deviceid": deviceID,
+	}
+
+	resp, err := c.requestContext(ctx, "GET", "/usage", params, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var usage Usage
+	err = c.decode(resp, &usage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &usage, nil
+}
+
+// CheckCapacity returns an error matching ErrInsufficientStorage if the
+// device has fewer than needed bytes available
+func (c *Client) CheckCapacity(deviceID string, needed int64, opts ...RequestOption) (err error) {
+	ctx, op := startOp(context.Background(), "CheckCapacity", opts, deviceID, "", nil)
+	defer op.finish(&err)
+
+	return c.checkCapacity(ctx, deviceID, "", needed)
+}
+
+// checkCapacity implements CheckCapacity. The size of replacing, a file
+// about to be overwritten, is counted as available.
+func (c *Client) checkCapacity(ctx context.Context, deviceID, replacing string, needed int64) error {
+	usage, err := c.usage(ctx, deviceID)
+	if err != nil {
+		return err
+	}
+
+	available := usage.Available
+	if replacing != "" {
+		available += usage.FileSizes[replacing]
+	}
+	if needed > available {
+		return fmt.Errorf("device %s needs %d bytes, %d available: %w", deviceID, needed, available, ErrInsufficientStorage)
+	}
+	return nil
+}
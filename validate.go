@@ -0,0 +1,98 @@
+package xmlapi
+
+import (
+	"context"
+	"io"
+)
+
+// ValidationError describes one schema violation
+type ValidationError struct {
+	Path    string `json:"path"`
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// Error implements the error interface
+func (e ValidationError) Error() string {
+	if e.Path != "" {
+		return e.Path + ": " + e.Message
+	}
+	return e.Message
+}
+
+// ValidationResult represents the response structure for the validate endpoint
+type ValidationResult struct {
+	Valid  bool              `json:"valid"`
+	Errors []ValidationError `json:"errors"`
+}
+
+// SchemaList represents the response structure for the listSchemas endpoint
+type SchemaList struct {
+	Schemas []string `json:"schemas"`
+}
+
+// ValidateFile validates an XML file against a schema stored on the gateway.
+// Gateways without validation support return ErrUnsupportedByServer.
+func (c *Client) ValidateFile(deviceID, filename, schemaName string, opts ...RequestOption) (_ *ValidationResult, err error) {
+	ctx, op := startOp(context.Background(), "ValidateFile", opts, deviceID, filename, nil)
+	defer op.finish(&err)
+
+	params := map[string]string{
+		"deviceid": deviceID,
+		"filename": filename,
+		"schema":   schemaName,
+	}
+
+	resp, err := c.requestContext(ctx, "GET", "/validate", params, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result ValidationResult
+	err = c.decode(resp, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// ListSchemas lists the schemas stored on the gateway
+func (c *Client) ListSchemas(opts ...RequestOption) (_ []string, err error) {
+	ctx, op := startOp(context.Background(), "ListSchemas", opts, "", "", nil)
+	defer op.finish(&err)
+
+	resp, err := c.requestContext(ctx, "GET", "/listSchemas", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result SchemaList
+	err = c.decode(resp, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Schemas, nil
+}
+
+// UploadSchema stores an XSD schema on the gateway under name, replacing any
+// schema of the same name
+func (c *Client) UploadSchema(name string, r io.Reader, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "UploadSchema", opts, "", "", nil)
+	defer op.finish(&err)
+
+	schema, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+
+	params := map[string]string{
+		"name": name,
+	}
+	body := map[string]string{
+		"schema": string(schema),
+	}
+
+	return c.statusRequestContext(ctx, "POST", "/uploadSchema", params, body)
+}
@@ -0,0 +1,171 @@
+package xmlapi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeLayouts are tried in order by Node.Time when no layouts are given
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// scalar returns the trimmed value used by the typed accessors
+func (n *Node) scalar() (string, error) {
+	if n == nil {
+		return "", ErrEmptyValue
+	}
+	value := strings.TrimSpace(n.Value)
+	if value == "" {
+		return "", ErrEmptyValue
+	}
+	return value, nil
+}
+
+// Int parses the value as a base 10 integer
+func (n *Node) Int() (int64, error) {
+	value, err := n.scalar()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// Float parses the value as a floating point number
+func (n *Node) Float() (float64, error) {
+	value, err := n.scalar()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+// Bool parses the value as a boolean, accepting true/false, 1/0, yes/no,
+// on/off, t/f and y/n in any case
+func (n *Node) Bool() (bool, error) {
+	value, err := n.scalar()
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(value) {
+	case "true", "1", "yes", "on", "t", "y":
+		return true, nil
+	case "false", "0", "no", "off", "f", "n":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean value %q", value)
+}
+
+// Time parses the value with the first of layouts that matches. Without
+// layouts RFC 3339 and a few common date-time forms are tried.
+func (n *Node) Time(layouts ...string) (time.Time, error) {
+	value, err := n.scalar()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(layouts) == 0 {
+		layouts = timeLayouts
+	}
+
+	var t time.Time
+	for _, layout := range layouts {
+		t, err = time.Parse(layout, value)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// Duration parses the value as a Go duration ("1m30s"); a bare integer is
+// taken as a number of seconds
+func (n *Node) Duration() (time.Duration, error) {
+	value, err := n.scalar()
+	if err != nil {
+		return 0, err
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// IntOr returns the value as an integer, or def if it is empty or invalid
+func (n *Node) IntOr(def int64) int64 {
+	if v, err := n.Int(); err == nil {
+		return v
+	}
+	return def
+}
+
+// FloatOr returns the value as a float, or def if it is empty or invalid
+func (n *Node) FloatOr(def float64) float64 {
+	if v, err := n.Float(); err == nil {
+		return v
+	}
+	return def
+}
+
+// BoolOr returns the value as a boolean, or def if it is empty or invalid
+func (n *Node) BoolOr(def bool) bool {
+	if v, err := n.Bool(); err == nil {
+		return v
+	}
+	return def
+}
+
+// TimeOr returns the value as a time, or def if it is empty or invalid
+func (n *Node) TimeOr(def time.Time, layouts ...string) time.Time {
+	if v, err := n.Time(layouts...); err == nil {
+		return v
+	}
+	return def
+}
+
+// DurationOr returns the value as a duration, or def if it is empty or invalid
+func (n *Node) DurationOr(def time.Duration) time.Duration {
+	if v, err := n.Duration(); err == nil {
+		return v
+	}
+	return def
+}
+
+// The canonical formats written by the typed setters, all of which the
+// typed accessors parse back to the same value
+
+func formatInt(v int64) string { return strconv.FormatInt(v, 10) }
+
+func formatFloat(v float64) string { return strconv.FormatFloat(v, 'g', -1, 64) }
+
+func formatBool(v bool) string { return strconv.FormatBool(v) }
+
+func formatTime(v time.Time) string { return v.Format(time.RFC3339Nano) }
+
+func formatDuration(v time.Duration) string { return v.String() }
+
+// setScalar replaces the value with canonically formatted text
+func (n *Node) setScalar(value string) {
+	n.Value = value
+	n.RawValue = ""
+	n.ValueKind = ValueText
+}
+
+// SetInt sets the value to a base 10 integer
+func (n *Node) SetInt(v int64) { n.setScalar(formatInt(v)) }
+
+// SetFloat sets the value to the shortest representation of a float
+func (n *Node) SetFloat(v float64) { n.setScalar(formatFloat(v)) }
+
+// SetBool sets the value to "true" or "false"
+func (n *Node) SetBool(v bool) { n.setScalar(formatBool(v)) }
+
+// SetTime sets the value to an RFC 3339 timestamp
+func (n *Node) SetTime(v time.Time) { n.setScalar(formatTime(v)) }
+
+// SetDuration sets the value to a Go duration string
+func (n *Node) SetDuration(v time.Duration) { n.setScalar(formatDuration(v)) }
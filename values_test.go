@@ -0,0 +1,150 @@
+package xmlapi
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTypedAccessors(t *testing.T) {
+	t.Run("int", func(t *testing.T) {
+		for value, want := range map[string]int64{"42": 42, " -7\n": -7, "\t0 ": 0} {
+			if got, err := (&Node{Value: value}).Int(); err != nil || got != want {
+				t.Errorf("Int(%q) = %d, %v, want %d", value, got, err, want)
+			}
+		}
+		for _, value := range []string{"4 2", "0x10", "1.5", "9223372036854775808"} {
+			if _, err := (&Node{Value: value}).Int(); err == nil || errors.Is(err, ErrEmptyValue) {
+				t.Errorf("Int(%q) = %v, want a parse error", value, err)
+			}
+		}
+	})
+
+	t.Run("float", func(t *testing.T) {
+		for value, want := range map[string]float64{"1.5": 1.5, " 2e3 ": 2000, "-0.25": -0.25} {
+			if got, err := (&Node{Value: value}).Float(); err != nil || got != want {
+				t.Errorf("Float(%q) = %v, %v, want %v", value, got, err, want)
+			}
+		}
+		if _, err := (&Node{Value: "1,5"}).Float(); err == nil {
+			t.Error("Float(1,5) succeeded")
+		}
+	})
+
+	t.Run("bool", func(t *testing.T) {
+		for _, value := range []string{"true", "TRUE", "1", "yes", "On", "t", "Y", " true\n"} {
+			if got, err := (&Node{Value: value}).Bool(); err != nil || !got {
+				t.Errorf("Bool(%q) = %v, %v, want true", value, got, err)
+			}
+		}
+		for _, value := range []string{"false", "False", "0", "no", "OFF", "f", "n"} {
+			if got, err := (&Node{Value: value}).Bool(); err != nil || got {
+				t.Errorf("Bool(%q) = %v, %v, want false", value, got, err)
+			}
+		}
+		for _, value := range []string{"2", "enabled", "tru"} {
+			if _, err := (&Node{Value: value}).Bool(); err == nil {
+				t.Errorf("Bool(%q) succeeded", value)
+			}
+		}
+	})
+
+	t.Run("time", func(t *testing.T) {
+		want := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+		for _, value := range []string{"2024-03-01T12:30:00Z", "2024-03-01T12:30:00", " 2024-03-01 12:30:00 "} {
+			if got, err := (&Node{Value: value}).Time(); err != nil || !got.Equal(want) {
+				t.Errorf("Time(%q) = %v, %v, want %v", value, got, err, want)
+			}
+		}
+		if got, err := (&Node{Value: "01/03/2024"}).Time("02/01/2006"); err != nil || got.Day() != 1 || got.Month() != time.March {
+			t.Errorf("Time with a layout = %v, %v", got, err)
+		}
+		if _, err := (&Node{Value: "01/03/2024"}).Time(); err == nil {
+			t.Error("Time without a matching default layout succeeded")
+		}
+	})
+
+	t.Run("duration", func(t *testing.T) {
+		for value, want := range map[string]time.Duration{"1m30s": 90 * time.Second, "90": 90 * time.Second, " 250ms ": 250 * time.Millisecond} {
+			if got, err := (&Node{Value: value}).Duration(); err != nil || got != want {
+				t.Errorf("Duration(%q) = %v, %v, want %v", value, got, err, want)
+			}
+		}
+		if _, err := (&Node{Value: "soon"}).Duration(); err == nil {
+			t.Error("Duration(soon) succeeded")
+		}
+	})
+}
+
+func TestTypedAccessorsEmpty(t *testing.T) {
+	for _, n := range []*Node{nil, {}, {Value: " \n\t"}} {
+		if _, err := n.Int(); !errors.Is(err, ErrEmptyValue) {
+			t.Errorf("Int(%v) = %v, want ErrEmptyValue", n, err)
+		}
+		if _, err := n.Float(); !errors.Is(err, ErrEmptyValue) {
+			t.Errorf("Float(%v) = %v, want ErrEmptyValue", n, err)
+		}
+		if _, err := n.Bool(); !errors.Is(err, ErrEmptyValue) {
+			t.Errorf("Bool(%v) = %v, want ErrEmptyValue", n, err)
+		}
+		if _, err := n.Time(); !errors.Is(err, ErrEmptyValue) {
+			t.Errorf("Time(%v) = %v, want ErrEmptyValue", n, err)
+		}
+		if _, err := n.Duration(); !errors.Is(err, ErrEmptyValue) {
+			t.Errorf("Duration(%v) = %v, want ErrEmptyValue", n, err)
+		}
+	}
+}
+
+func TestTypedAccessorDefaults(t *testing.T) {
+	def := time.Unix(0, 0)
+	for _, n := range []*Node{nil, {Value: ""}, {Value: "junk"}} {
+		if n.IntOr(3) != 3 || n.FloatOr(1.5) != 1.5 || !n.BoolOr(true) || !n.TimeOr(def).Equal(def) || n.DurationOr(time.Second) != time.Second {
+			t.Errorf("defaults not returned for %v", n)
+		}
+	}
+	n := &Node{Value: "0"}
+	if n.IntOr(3) != 0 || n.BoolOr(true) || n.DurationOr(time.Second) != 0 {
+		t.Error("a valid zero value was replaced by the default")
+	}
+}
+
+func TestTypedSettersRoundTrip(t *testing.T) {
+	n := &Node{Value: "a<b", RawValue: "a&lt;b", ValueKind: ValueCDATA}
+
+	n.SetInt(math.MinInt64)
+	if got, err := n.Int(); err != nil || got != math.MinInt64 {
+		t.Errorf("Int after SetInt = %d, %v", got, err)
+	}
+	if n.RawValue != "" || n.ValueKind != ValueText {
+		t.Errorf("setter left RawValue %q and kind %v", n.RawValue, n.ValueKind)
+	}
+
+	for _, v := range []float64{0.1, 1e21, -3.75, math.MaxFloat64} {
+		n.SetFloat(v)
+		if got, err := n.Float(); err != nil || got != v {
+			t.Errorf("Float after SetFloat(%v) = %v, %v", v, got, err)
+		}
+	}
+
+	for _, v := range []bool{true, false} {
+		n.SetBool(v)
+		if got, err := n.Bool(); err != nil || got != v {
+			t.Errorf("Bool after SetBool(%v) = %v, %v", v, got, err)
+		}
+	}
+
+	at := time.Date(2024, 3, 1, 12, 30, 0, 123456789, time.FixedZone("", 2*3600))
+	n.SetTime(at)
+	if got, err := n.Time(); err != nil || !got.Equal(at) {
+		t.Errorf("Time after SetTime = %v, %v, want %v", got, err, at)
+	}
+
+	for _, v := range []time.Duration{0, 1500 * time.Millisecond, 36 * time.Hour} {
+		n.SetDuration(v)
+		if got, err := n.Duration(); err != nil || got != v {
+			t.Errorf("Duration after SetDuration(%v) = %v, %v", v, got, err)
+		}
+	}
+}
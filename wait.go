@@ -0,0 +1,182 @@
+package xmlapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Defaults of WaitOptions
+const (
+	defaultWaitInterval    = 500 * time.Millisecond
+	defaultWaitMaxInterval = 10 * time.Second
+)
+
+// WaitOptions configures the polling of WaitForValue. Zero fields take
+// their defaults.
+type WaitOptions struct {
+	// Interval is the delay before the first re-read, 500ms by default
+	Interval time.Duration
+	// MaxInterval caps the delay as it grows, 10s by default
+	MaxInterval time.Duration
+	// Multiplier grows the delay after every read; 1 or less keeps it fixed
+	Multiplier float64
+	// Jitter randomizes each delay by up to this fraction, e.g. 0.2 for ±20%
+	Jitter float64
+	// NoWatch always polls, even if the gateway supports WatchFile
+	NoWatch bool
+}
+
+// WaitTimeoutError is returned when WaitForValue's context deadline passes
+// before the predicate is satisfied. It matches ErrWaitTimeout and unwraps
+// to the context error.
+type WaitTimeoutError struct {
+	// LastValue is the last value read, empty if the node was never found
+	LastValue string
+	// Found reports whether the node was read at least once
+	Found bool
+	Err   error
+}
+
+// Error implements the error interface
+func (e *WaitTimeoutError) Error() string {
+	if !e.Found {
+		return "wait timed out: node not found"
+	}
+	return fmt.Sprintf("wait timed out: last value %q", e.LastValue)
+}
+
+// Is matches ErrWaitTimeout
+func (e *WaitTimeoutError) Is(target error) bool {
+	return target == ErrWaitTimeout
+}
+
+// Unwrap returns the context error
+func (e *WaitTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// WaitForValue reads the node at path until predicate accepts its value and
+// returns that value. A node that does not exist yet counts as not matching.
+// When the gateway supports WatchFile the node is re-read only when the file
+// changes, otherwise it is polled as configured by opts. If ctx's deadline
+// passes first, a *WaitTimeoutError carrying the last value is returned;
+// closing the client ends the wait with ErrClientClosed.
+func (c *Client) WaitForValue(ctx context.Context, deviceID, filename string, path PathLike, predicate func(string) bool, opts WaitOptions, reqOpts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(ctx, "WaitForValue", reqOpts, deviceID, filename, path)
+	defer op.finish(&err)
+
+	pathStr, err := PathString(path)
+	if err != nil {
+		return "", err
+	}
+	w := &waiter{c: c, deviceID: deviceID, filename: filename, path: pathStr, predicate: predicate}
+
+	var events <-chan FileEvent
+	if !opts.NoWatch {
+		watchCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		var err error
+		events, err = c.WatchFile(watchCtx, deviceID, filename)
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", w.done(ctx)
+			}
+			// Gateways without the watch endpoint are polled instead
+			events = nil
+		}
+	}
+
+	// The first read happens after the watch is set up so no change is missed
+	if value, ok, err := w.check(ctx); ok || err != nil {
+		return value, err
+	}
+
+	if events != nil {
+		for range events {
+			if value, ok, err := w.check(ctx); ok || err != nil {
+				return value, err
+			}
+		}
+		// The watch also ends when the client is closed; should it end for
+		// any other reason the node is polled instead
+		if ctx.Err() != nil {
+			return "", w.done(ctx)
+		}
+		if err := c.usable(); err != nil {
+			return "", err
+		}
+	}
+
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = defaultWaitInterval
+	}
+	maxInterval := opts.MaxInterval
+	if maxInterval <= 0 {
+		maxInterval = defaultWaitMaxInterval
+	}
+
+	for {
+		delay := interval
+		if opts.Jitter > 0 {
+			delay += time.Duration(float64(delay) * opts.Jitter * (2*rand.Float64() - 1))
+		}
+		if !sleepContext(ctx, delay) {
+			return "", w.done(ctx)
+		}
+
+		if value, ok, err := w.check(ctx); ok || err != nil {
+			return value, err
+		}
+
+		if opts.Multiplier > 1 {
+			interval = time.Duration(float64(interval) * opts.Multiplier)
+			if interval > maxInterval {
+				interval = maxInterval
+			}
+		}
+	}
+}
+
+// waiter holds the state of a WaitForValue call
+type waiter struct {
+	c                        *Client
+	deviceID, filename, path string
+	predicate                func(string) bool
+
+	last  string
+	found bool
+}
+
+// check reads the node once and reports whether its value matches. The
+// read cache is bypassed, since it would keep answering with the value
+// being waited on to change.
+func (w *waiter) check(ctx context.Context) (string, bool, error) {
+	node, _, err := w.c.fetchNode(ctx, w.deviceID, w.filename, w.path, "", requestConfig(ctx).meta)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", false, w.done(ctx)
+		}
+		if errors.Is(err, ErrNotFound) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+
+	w.last, w.found = node.Value, true
+	if w.predicate(node.Value) {
+		return node.Value, true, nil
+	}
+	return "", false, nil
+}
+
+// done returns the error for a wait whose context ended
+func (w *waiter) done(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &WaitTimeoutError{LastValue: w.last, Found: w.found, Err: ctx.Err()}
+	}
+	return ctx.Err()
+}
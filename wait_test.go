@@ -0,0 +1,68 @@
+package xmlapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestWaitForValueClientClosed(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts WaitOptions
+	}{
+		{name: "watching"},
+		{name: "polling", opts: WaitOptions{Interval: 10 * time.Millisecond, NoWatch: true}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := newFakeGateway(t)
+			g.load("dev", "plan.xml", planDoc)
+			watching := make(chan struct{}, 1)
+			// Polls for a new revision block until they are cancelled
+			g.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+				if r.URL.Path != "/watch" {
+					return false
+				}
+				if r.URL.Query().Get("since") == "" {
+					writeJSON(w, http.StatusOK, watchResponse{Revision: 1})
+					return true
+				}
+				select {
+				case watching <- struct{}{}:
+				default:
+				}
+				<-r.Context().Done()
+				return true
+			}
+			c := g.client()
+
+			result := make(chan error, 1)
+			go func() {
+				value, err := c.WaitForValue(context.Background(), "dev", "plan.xml", "/plan/phase[1]/minGreen",
+					func(v string) bool { return v == "never" }, tc.opts)
+				if err == nil {
+					err = errors.New("returned " + value + " without an error")
+				}
+				result <- err
+			}()
+
+			if tc.opts.NoWatch {
+				time.Sleep(30 * time.Millisecond)
+			} else {
+				<-watching
+			}
+			c.Close()
+
+			select {
+			case err := <-result:
+				if !errors.Is(err, ErrClientClosed) {
+					t.Errorf("WaitForValue after Close: %v, want ErrClientClosed", err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("WaitForValue still waiting after Close")
+			}
+		})
+	}
+}
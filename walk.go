@@ -0,0 +1,97 @@
+package xmlapi
+
+import (
+	"errors"
+	"strconv"
+)
+
+// SkipSubtree is returned by a walk function to skip the children of the
+// node it was called for. It is never returned by Walk itself.
+var SkipSubtree = errors.New("skip this subtree")
+
+// WalkFunc is called by WalkWithDepth for every element of a tree, with the
+// element's canonical path and its depth below the walk's root (which is 0)
+type WalkFunc func(path string, depth int, n *Node) error
+
+// Walk visits every element of the tree rooted at n in depth-first document
+// order, calling fn with the element's canonical path. Repeated sibling tags
+// get a 1-based index ("/plan/phase[2]"), unique ones do not. Comment nodes
+// are not visited.
+//
+// If fn returns SkipSubtree the element's children are skipped; any other
+// error stops the walk and is returned. The traversal is iterative, so deep
+// trees do not grow the goroutine stack.
+func (n *Node) Walk(fn func(path string, n *Node) error) error {
+	return n.WalkWithDepth(func(path string, _ int, n *Node) error {
+		return fn(path, n)
+	})
+}
+
+// WalkWithDepth is like Walk but also passes the depth of each element
+func (n *Node) WalkWithDepth(fn WalkFunc) error {
+	return n.walk(true, fn)
+}
+
+// walk implements WalkWithDepth; when indexed is false repeated sibling tags
+// are not indexed, so siblings share a path
+func (n *Node) walk(indexed bool, fn WalkFunc) error {
+	if n == nil || n.Kind != NodeElement {
+		return nil
+	}
+
+	type entry struct {
+		node  *Node
+		path  string
+		depth int
+	}
+	stack := []entry{{n, "/" + escapeSegment(n.XMLName.Local), 0}}
+	for len(stack) > 0 {
+		e := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		err := fn(e.path, e.depth, e.node)
+		if err == SkipSubtree {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		paths := childPaths(e.path, e.node, indexed)
+		for i := len(e.node.Nodes) - 1; i >= 0; i-- {
+			if e.node.Nodes[i].Kind != NodeElement {
+				continue
+			}
+			stack = append(stack, entry{&e.node.Nodes[i], paths[i], e.depth + 1})
+		}
+	}
+
+	return nil
+}
+
+// childPaths returns the canonical path of each element child of n, indexing
+// tags that occur more than once if indexed is set
+func childPaths(parent string, n *Node, indexed bool) []string {
+	counts := make(map[string]int, len(n.Nodes))
+	for i := range n.Nodes {
+		if n.Nodes[i].Kind == NodeElement {
+			counts[n.Nodes[i].XMLName.Local]++
+		}
+	}
+
+	seen := make(map[string]int, len(counts))
+	paths := make([]string, len(n.Nodes))
+	for i := range n.Nodes {
+		child := &n.Nodes[i]
+		if child.Kind != NodeElement {
+			continue
+		}
+		name := child.XMLName.Local
+		paths[i] = parent + "/" + escapeSegment(name)
+		if indexed && counts[name] > 1 {
+			seen[name]++
+			paths[i] += "[" + strconv.Itoa(seen[name]) + "]"
+		}
+	}
+	return paths
+}
@@ -0,0 +1,69 @@
+package xmlapi
+
+import (
+	"strconv"
+	"testing"
+)
+
+// wideTree returns a plan of phases with repeated children, about
+// phases*children elements in all
+func wideTree(phases, children int) *Node {
+	root := &Node{XMLName: XMLName{Local: "plan"}, Nodes: make([]Node, phases)}
+	for i := range root.Nodes {
+		phase := &root.Nodes[i]
+		phase.XMLName.Local = "phase"
+		phase.Nodes = make([]Node, children)
+		for j := range phase.Nodes {
+			phase.Nodes[j] = Node{XMLName: XMLName{Local: "step"}, Value: strconv.Itoa(j)}
+		}
+	}
+	return root
+}
+
+// chainTree returns a chain of depth nested elements
+func chainTree(depth int) *Node {
+	root := &Node{XMLName: XMLName{Local: "n"}}
+	n := root
+	for i := 1; i < depth; i++ {
+		n.Nodes = []Node{{XMLName: XMLName{Local: "n"}}}
+		n = &n.Nodes[0]
+	}
+	return root
+}
+
+func BenchmarkWalk(b *testing.B) {
+	root := wideTree(100, 1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		visited := 0
+		if err := root.Walk(func(path string, n *Node) error {
+			visited++
+			return nil
+		}); err != nil {
+			b.Fatal(err)
+		}
+		if visited != 1+100+100*1000 {
+			b.Fatalf("visited %d elements", visited)
+		}
+	}
+}
+
+func BenchmarkWalkWithDepthChain(b *testing.B) {
+	const depth = 10000
+	root := chainTree(depth)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		deepest := 0
+		if err := root.WalkWithDepth(func(path string, d int, n *Node) error {
+			deepest = d
+			return nil
+		}); err != nil {
+			b.Fatal(err)
+		}
+		if deepest != depth-1 {
+			b.Fatalf("deepest element at depth %d, want %d", deepest, depth-1)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package xmlapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Reconnect delays of WatchFile after a failed long-poll
+const (
+	watchMinBackoff = 500 * time.Millisecond
+	watchMaxBackoff = 30 * time.Second
+)
+
+// FileEvent reports a change to a watched file
+type FileEvent struct {
+	// Revision is the file revision after the change
+	Revision int64
+	// Paths lists the changed node paths, when the gateway reports them
+	Paths []string
+}
+
+// watchResponse represents the response of the watch endpoint
+type watchResponse struct {
+	Revision int64    `json:"revision"`
+	Paths    []string `json:"paths"`
+	Error    string   `json:"error"`
+}
+
+// WatchFile long-polls the gateway for changes to an XML file and sends an
+// event for every new revision. The current revision is fetched before
+// WatchFile returns, so an error means the gateway cannot watch the file;
+// ErrUnsupportedByServer is matched when it has no watch endpoint. Failed
+// polls are retried with exponential backoff, and the channel is closed when
+// ctx is cancelled or the client is closed. Every new revision drops the
+// file's reads from the read cache.
+func (c *Client) WatchFile(ctx context.Context, deviceID, filename string, opts ...RequestOption) (_ <-chan FileEvent, err error) {
+	ctx, op := startOp(ctx, "WatchFile", opts, deviceID, filename, nil)
+	defer op.finish(&err)
+
+	current, err := c.watch(ctx, deviceID, filename, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	if !c.startBackground() {
+		return nil, ErrClientClosed
+	}
+	ctx, cancel := c.withClose(ctx)
+
+	events := make(chan FileEvent)
+	go func() {
+		defer c.background.Done()
+		defer cancel()
+		defer close(events)
+
+		revision := current.Revision
+		backoff := watchMinBackoff
+		for {
+			result, err := c.watch(ctx, deviceID, filename, revision)
+			if err != nil {
+				if ctx.Err() != nil || !sleepContext(ctx, backoff) {
+					return
+				}
+				backoff *= 2
+				if backoff > watchMaxBackoff {
+					backoff = watchMaxBackoff
+				}
+				continue
+			}
+			backoff = watchMinBackoff
+
+			// A poll that timed out server-side reports the revision it was
+			// given; anything not newer has already been delivered
+			if result.Revision <= revision {
+				continue
+			}
+			revision = result.Revision
+
+			// Cached reads of the file are stale now
+			c.InvalidateCache(deviceID, filename, "")
+
+			select {
+			case events <- FileEvent{Revision: result.Revision, Paths: result.Paths}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// watch performs a single long-poll, returning once the file has a revision
+// newer than since. A negative since returns the current revision at once.
+func (c *Client) watch(ctx context.Context, deviceID, filename string, since int64) (*watchResponse, error) {
+	params := map[string]string{
+		"deviceid": deviceID,
+		"filename": filename,
+	}
+	if since >= 0 {
+		params["since"] = strconv.FormatInt(since, 10)
+	}
+
+	resp, err := c.requestContext(ctx, "GET", "/watch", params, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// The gateway answers 204 when the poll times out without a change
+	if resp.StatusCode == http.StatusNoContent {
+		return &watchResponse{Revision: since}, nil
+	}
+
+	var result watchResponse
+	err = c.decode(resp, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Error != "" {
+		return nil, errors.New(result.Error)
+	}
+
+	return &result, nil
+}
+
+// sleepContext waits for d, returning false if ctx is done first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,141 @@
+package xmlapi
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// WebhookID identifies a registered webhook
+type WebhookID string
+
+// WebhookEvent is a kind of change a webhook is notified of
+type WebhookEvent string
+
+// Webhook event types
+const (
+	EventFileCreated WebhookEvent = "file.created"
+	EventFileDeleted WebhookEvent = "file.deleted"
+	EventNodeUpdated WebhookEvent = "node.updated"
+)
+
+// WebhookSignatureHeader is the request header carrying the gateway's
+// signature of a webhook delivery
+const WebhookSignatureHeader = "X-Signature"
+
+// WebhookConfig describes a webhook to register
+type WebhookConfig struct {
+	// URL is the target the gateway posts deliveries to
+	URL string `json:"url"`
+	// Events lists the event types delivered; empty means all
+	Events []WebhookEvent `json:"events,omitempty"`
+	// Secret is the shared key the gateway signs deliveries with
+	Secret string `json:"secret,omitempty"`
+	// PathFilter restricts node events to paths with this prefix
+	PathFilter string `json:"path_filter,omitempty"`
+}
+
+// Webhook is a registered webhook. Secret is not reported back by the gateway.
+type Webhook struct {
+	ID WebhookID `json:"id"`
+	WebhookConfig
+}
+
+// webhookResponse represents the response of registering a webhook
+type webhookResponse struct {
+	ID    WebhookID `json:"id"`
+	Error string    `json:"error"`
+}
+
+// webhookList represents the response of listing webhooks
+type webhookList struct {
+	Webhooks []Webhook `json:"webhooks"`
+}
+
+// RegisterWebhook registers a webhook for a device
+func (c *Client) RegisterWebhook(deviceID string, cfg WebhookConfig, opts ...RequestOption) (_ WebhookID, err error) {
+	ctx, op := startOp(context.Background(), "RegisterWebhook", opts, deviceID, "", nil)
+	defer op.finish(&err)
+
+	params := map[string]string{
+		"deviceid": deviceID,
+	}
+
+	resp, err := c.requestContext(ctx, "POST", "/webhooks", params, cfg)
+	if err != nil {
+		return "", err
+	}
+
+	var result webhookResponse
+	err = c.decode(resp, &result)
+	if err != nil {
+		return "", err
+	}
+
+	if result.Error != "" {
+		return "", errors.New(result.Error)
+	}
+
+	return result.ID, nil
+}
+
+// ListWebhooks lists the webhooks registered for a device
+func (c *Client) ListWebhooks(deviceID string, opts ...RequestOption) (_ []Webhook, err error) {
+	ctx, op := startOp(context.Background(), "ListWebhooks", opts, deviceID, "", nil)
+	defer op.finish(&err)
+
+	params := map[string]string{
+		"deviceid": deviceID,
+	}
+
+	resp, err := c.requestContext(ctx, "GET", "/webhooks", params, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result webhookList
+	err = c.decode(resp, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Webhooks, nil
+}
+
+// DeleteWebhook removes a registered webhook
+func (c *Client) DeleteWebhook(deviceID string, id WebhookID, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(context.Background(), "DeleteWebhook", opts, deviceID, "", nil)
+	defer op.finish(&err)
+
+	params := map[string]string{
+		"deviceid": deviceID,
+		"id":       string(id),
+	}
+
+	return c.statusRequestContext(ctx, "DELETE", "/webhooks", params, nil)
+}
+
+// VerifyWebhookSignature checks the signature header of a webhook delivery
+// against its raw body. The header holds "sha256=" followed by the hex
+// HMAC-SHA256 of the body keyed with the shared secret. The comparison is
+// constant-time; a mismatch returns ErrInvalidSignature.
+func VerifyWebhookSignature(secret []byte, header string, body []byte) error {
+	digest, ok := strings.CutPrefix(strings.TrimSpace(header), "sha256=")
+	if !ok {
+		return ErrInvalidSignature
+	}
+	got, err := hex.DecodeString(digest)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
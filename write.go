@@ -0,0 +1,174 @@
+package xmlapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// WriteStrategy selects how WriteFile puts a tree on the gateway
+type WriteStrategy int
+
+const (
+	// Replace serializes the tree to XML and uploads it over the file in a
+	// single request
+	Replace WriteStrategy = iota
+	// Rebuild deletes the file, recreates it with the tree's root element
+	// and imports the children node by node
+	Rebuild
+)
+
+// WriteFile writes a whole tree as the content of an XML file
+func (c *Client) WriteFile(ctx context.Context, deviceID, filename string, root *Node, strategy WriteStrategy, opts ...RequestOption) (_ string, err error) {
+	ctx, op := startOp(ctx, "WriteFile", opts, deviceID, filename, nil)
+	defer op.finish(&err)
+
+	if root == nil || root.Kind != NodeElement {
+		return "", errors.New("write file: root must be an element")
+	}
+
+	switch strategy {
+	case Replace:
+		var doc bytes.Buffer
+		if err := root.ToXML(&doc, MarshalOptions{Header: true}); err != nil {
+			return "", err
+		}
+		// The tree may hold names or text no XML document can, check the
+		// rendered form rather than trusting the serializer
+		if errs := ValidateWellFormed(bytes.NewReader(doc.Bytes())); len(errs) > 0 {
+			return "", fmt.Errorf("%s would not be well-formed: %w", filename, errs[0])
+		}
+		return c.uploadFile(ctx, deviceID, filename, &doc, true, SkipWellFormedCheck())
+
+	case Rebuild:
+		if _, err := c.deleteFile(ctx, deviceID, filename); err != nil && !errors.Is(err, ErrNotFound) {
+			return "", err
+		}
+		status, err := c.createFile(ctx, deviceID, filename, root.XMLName.Local)
+		if err != nil {
+			return "", err
+		}
+		if err := c.fillRoot(ctx, deviceID, filename, root); err != nil {
+			return "", err
+		}
+		return status, nil
+	}
+
+	return "", fmt.Errorf("unknown write strategy %d", strategy)
+}
+
+// fillRoot gives the root element of a newly created file the attributes,
+// value and children of root
+func (c *Client) fillRoot(ctx context.Context, deviceID, filename string, root *Node) error {
+	rootPath := "/" + escapeSegment(root.XMLName.Local)
+	for _, attr := range root.Attrs {
+		if isNamespaceDecl(attr.Name) {
+			continue
+		}
+		if _, err := c.setAttribute(ctx, deviceID, filename, rootPath, attr.Name.Local, attr.Value); err != nil {
+			return err
+		}
+	}
+	if root.Value != "" {
+		if _, err := c.updateNode(ctx, deviceID, filename, rootPath, root.Value); err != nil {
+			return err
+		}
+	}
+	for i := range root.Nodes {
+		if err := c.createSubtree(ctx, deviceID, filename, rootPath, &root.Nodes[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateOption configures CreateFileWithContent. Every RequestOption is a CreateOption too.
+type CreateOption interface {
+	applyCreate(*createConfig)
+}
+
+// createOption is a CreateOption setting an option of CreateFileWithContent
+type createOption func(*createConfig)
+
+func (f createOption) applyCreate(cfg *createConfig) {
+	f(cfg)
+}
+
+// createConfig holds the options of a CreateFileWithContent call
+type createConfig struct {
+	atomic bool
+
+	// call holds the RequestOptions among the options
+	call []RequestOption
+}
+
+// AtomicCreate deletes the file again when CreateFileWithContent fails
+// part way, so that no one sees it half-built
+func AtomicCreate() CreateOption {
+	return createOption(func(cfg *createConfig) {
+		cfg.atomic = true
+	})
+}
+
+// CreateFileWithContent creates a file holding the whole tree rooted at
+// root. The tree is uploaded in one request where the gateway supports it;
+// otherwise the file is created and its content imported node by node, and
+// success is only reported once all of it exists. Without overwrite, an
+// existing file is left alone and the gateway's error returned.
+func (c *Client) CreateFileWithContent(ctx context.Context, deviceID, filename string, root *Node, overwrite bool, opts ...CreateOption) (_ string, err error) {
+	ctx, op := startOp(ctx, "CreateFileWithContent", nil, deviceID, filename, nil)
+	defer op.finish(&err)
+
+	var cfg createConfig
+	for _, opt := range opts {
+		opt.applyCreate(&cfg)
+	}
+	ctx = withRequestOptions(ctx, cfg.call)
+	if root == nil || root.Kind != NodeElement {
+		return "", errors.New("create file: root must be an element")
+	}
+
+	var doc bytes.Buffer
+	if err := root.ToXML(&doc, MarshalOptions{Header: true}); err != nil {
+		return "", err
+	}
+	if errs := ValidateWellFormed(bytes.NewReader(doc.Bytes())); len(errs) > 0 {
+		return "", fmt.Errorf("%s would not be well-formed: %w", filename, errs[0])
+	}
+	status, err := c.uploadFile(ctx, deviceID, filename, &doc, overwrite, SkipWellFormedCheck())
+	if !errors.Is(err, ErrUnsupportedByServer) {
+		return status, err
+	}
+
+	if overwrite {
+		if _, err := c.deleteFile(ctx, deviceID, filename); err != nil && !errors.Is(err, ErrNotFound) {
+			return "", err
+		}
+	}
+	status, err = c.createFile(ctx, deviceID, filename, root.XMLName.Local)
+	if err != nil {
+		return "", err
+	}
+	if err := c.fillRoot(ctx, deviceID, filename, root); err != nil {
+		if cfg.atomic {
+			if _, delErr := c.deleteFile(ctx, deviceID, filename); delErr != nil {
+				return "", fmt.Errorf("%w (removing the incomplete file failed: %v)", err, delErr)
+			}
+		}
+		return "", err
+	}
+	return status, nil
+}
+
+// ImportTree creates n and all its descendants as the last child of parentPath
+func (c *Client) ImportTree(ctx context.Context, deviceID, filename string, parentPath PathLike, n *Node, opts ...RequestOption) (err error) {
+	ctx, op := startOp(ctx, "ImportTree", opts, deviceID, filename, parentPath)
+	defer op.finish(&err)
+
+	parentStr, err := PathString(parentPath)
+	if err != nil {
+		return err
+	}
+	return c.createSubtree(ctx, deviceID, filename, parentStr, n)
+}
@@ -0,0 +1,341 @@
+package xmlapi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	xmlnsPrefix = "xmlns"
+	xmlPrefix   = "xml"
+	xmlURL      = "http://www.w3.org/XML/1998/namespace"
+)
+
+// MarshalOptions controls how ToXML renders a node tree
+type MarshalOptions struct {
+	// Indent is repeated once per nesting level; empty renders the tree on a single line
+	Indent string
+	// Header prepends the standard XML declaration
+	Header bool
+}
+
+// MarshalXML implements xml.Marshaler. The element is named after n.XMLName
+// and any attributes in start are added to the node's own. Namespace
+// declarations are left to the encoder, which emits them as needed.
+func (n *Node) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if n.Kind == NodeComment {
+		return e.EncodeToken(xml.Comment(n.Value))
+	}
+
+	start.Name = xml.Name{Space: n.XMLName.Space, Local: n.XMLName.Local}
+	for _, attr := range n.Attrs {
+		if isNamespaceDecl(attr.Name) {
+			continue
+		}
+		start.Attr = append(start.Attr, xml.Attr{
+			Name:  xml.Name{Space: attr.Name.Space, Local: attr.Name.Local},
+			Value: attr.Value,
+		})
+	}
+
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	if n.Value != "" {
+		if err := e.EncodeToken(xml.CharData(n.Value)); err != nil {
+			return err
+		}
+	}
+	for i := range n.Nodes {
+		if err := n.Nodes[i].MarshalXML(e, xml.StartElement{}); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// ToXML writes the node tree to w as an XML document. Unlike MarshalXML it
+// keeps CDATA sections and namespace prefixes declared through xmlns
+// attributes. An element's value is written before its children, which is
+// where ParseXML finds it in every document it accepts, so parsed trees
+// render back to the same content.
+func (n *Node) ToXML(w io.Writer, opts MarshalOptions) error {
+	bw := bufio.NewWriter(w)
+	if opts.Header {
+		bw.WriteString(xml.Header)
+	}
+
+	x := &xmlWriter{w: bw, opts: opts}
+	x.writeNode(n, namespaceScope{}, 0)
+
+	return bw.Flush()
+}
+
+// ParseError reports malformed XML together with its position in the input
+type ParseError struct {
+	Line   int
+	Column int
+	Err    error
+}
+
+// Error implements the error interface
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("xml: line %d, column %d: %v", e.Line, e.Column, e.Err)
+}
+
+// Unwrap returns the decoder's error
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ParseXML builds a Node tree from an XML document.
+//
+// Element order, attributes (xmlns declarations included), resolved
+// namespaces and the comments inside the root element are preserved;
+// comments, processing instructions and directives outside the root are
+// dropped. Whitespace policy: all character data directly inside an element,
+// CDATA sections included, is concatenated into its Value and trimmed of
+// leading and trailing whitespace, so indentation between elements vanishes
+// while interior whitespace is kept. The decoder cannot tell CDATA from
+// escaped text, so parsed values are always ValueText.
+//
+// A Node holds its text apart from its children, so text after a child
+// element or comment cannot keep its place; such mixed content is rejected
+// with a *ParseError matching ErrMixedContent rather than being moved.
+// Only text before the first child is accepted.
+//
+// Malformed input returns a *ParseError carrying the line and column.
+func ParseXML(r io.Reader) (*Node, error) {
+	d := xml.NewDecoder(r)
+
+	var root *Node
+	var stack []*Node
+	var text []*strings.Builder
+
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			line, column := d.InputPos()
+			return nil, &ParseError{Line: line, Column: column, Err: err}
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if root != nil && len(stack) == 0 {
+				line, column := d.InputPos()
+				return nil, &ParseError{Line: line, Column: column, Err: errors.New("multiple root elements")}
+			}
+			node := &Node{XMLName: XMLName{Space: t.Name.Space, Local: t.Name.Local}}
+			for _, attr := range t.Attr {
+				node.Attrs = append(node.Attrs, Attr{
+					Name:  XMLName{Space: attr.Name.Space, Local: attr.Name.Local},
+					Value: attr.Value,
+				})
+			}
+			if root == nil {
+				root = node
+			}
+			stack = append(stack, node)
+			text = append(text, &strings.Builder{})
+
+		case xml.EndElement:
+			node := stack[len(stack)-1]
+			node.Value = strings.TrimSpace(text[len(text)-1].String())
+			stack = stack[:len(stack)-1]
+			text = text[:len(text)-1]
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Nodes = append(parent.Nodes, *node)
+			}
+
+		case xml.CharData:
+			if len(text) > 0 {
+				if len(stack[len(stack)-1].Nodes) > 0 && len(bytes.TrimSpace(t)) > 0 {
+					line, column := d.InputPos()
+					return nil, &ParseError{Line: line, Column: column, Err: ErrMixedContent}
+				}
+				text[len(text)-1].Write(t)
+			}
+
+		case xml.Comment:
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Nodes = append(parent.Nodes, Node{Kind: NodeComment, Value: string(t)})
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, errors.New("xml: no root element")
+	}
+
+	return root, nil
+}
+
+// namespaceScope records the namespaces in effect for an element
+type namespaceScope struct {
+	defaultSpace string
+	prefixes     map[string]string // URI -> prefix
+}
+
+// bind returns a copy of the scope with prefix bound to uri
+func (s namespaceScope) bind(prefix, uri string) namespaceScope {
+	prefixes := make(map[string]string, len(s.prefixes)+1)
+	for k, v := range s.prefixes {
+		prefixes[k] = v
+	}
+	prefixes[uri] = prefix
+	s.prefixes = prefixes
+	return s
+}
+
+// xmlWriter renders nodes as XML text
+type xmlWriter struct {
+	w    *bufio.Writer
+	opts MarshalOptions
+	gen  int
+}
+
+// writeNode renders n and its descendants at the given nesting depth
+func (x *xmlWriter) writeNode(n *Node, scope namespaceScope, depth int) {
+	if n.Kind == NodeComment {
+		x.w.WriteString("<!--")
+		x.w.WriteString(strings.ReplaceAll(n.Value, "--", "- -"))
+		x.w.WriteString("-->")
+		return
+	}
+
+	// Bind the prefixes declared on this element before resolving names
+	var decls []string
+	for _, attr := range n.Attrs {
+		if attr.Name.Space == xmlnsPrefix {
+			scope = scope.bind(attr.Name.Local, attr.Value)
+			decls = append(decls, " xmlns:"+attr.Name.Local+`="`+escapeText(attr.Value, true)+`"`)
+		}
+	}
+
+	name := n.XMLName.Local
+	if n.XMLName.Space != scope.defaultSpace {
+		if prefix, ok := scope.prefixes[n.XMLName.Space]; ok && n.XMLName.Space != "" {
+			name = prefix + ":" + name
+		} else {
+			scope.defaultSpace = n.XMLName.Space
+			decls = append(decls, ` xmlns="`+escapeText(n.XMLName.Space, true)+`"`)
+		}
+	}
+
+	var attrs []string
+	for _, attr := range n.Attrs {
+		if isNamespaceDecl(attr.Name) {
+			continue
+		}
+		attrName := attr.Name.Local
+		switch space := attr.Name.Space; {
+		case space == "":
+		case space == xmlURL || space == xmlPrefix:
+			attrName = xmlPrefix + ":" + attrName
+		default:
+			prefix, ok := scope.prefixes[space]
+			if !ok {
+				if !strings.ContainsAny(space, ":/") {
+					// The gateway reports undeclared prefixes as the space itself
+					prefix = space
+				} else {
+					x.gen++
+					prefix = "ns" + strconv.Itoa(x.gen)
+					scope = scope.bind(prefix, space)
+					decls = append(decls, " xmlns:"+prefix+`="`+escapeText(space, true)+`"`)
+				}
+			}
+			attrName = prefix + ":" + attrName
+		}
+		attrs = append(attrs, " "+attrName+`="`+escapeText(attr.Value, true)+`"`)
+	}
+
+	x.w.WriteString("<" + name)
+	for _, decl := range decls {
+		x.w.WriteString(decl)
+	}
+	for _, attr := range attrs {
+		x.w.WriteString(attr)
+	}
+
+	if n.Value == "" && len(n.Nodes) == 0 {
+		x.w.WriteString("/>")
+		return
+	}
+	x.w.WriteString(">")
+
+	if n.ValueKind == ValueCDATA {
+		x.w.WriteString("<![CDATA[")
+		x.w.WriteString(strings.ReplaceAll(n.Value, "]]>", "]]]]><![CDATA[>"))
+		x.w.WriteString("]]>")
+	} else {
+		x.w.WriteString(escapeText(n.Value, false))
+	}
+
+	for i := range n.Nodes {
+		x.newline(depth + 1)
+		x.writeNode(&n.Nodes[i], scope, depth+1)
+	}
+	if len(n.Nodes) > 0 {
+		x.newline(depth)
+	}
+
+	x.w.WriteString("</" + name + ">")
+}
+
+// newline starts a new line indented to depth when indentation is enabled
+func (x *xmlWriter) newline(depth int) {
+	if x.opts.Indent == "" {
+		return
+	}
+	x.w.WriteByte('\n')
+	for i := 0; i < depth; i++ {
+		x.w.WriteString(x.opts.Indent)
+	}
+}
+
+// isNamespaceDecl reports whether an attribute name is an xmlns declaration
+func isNamespaceDecl(name XMLName) bool {
+	return name.Space == xmlnsPrefix || (name.Space == "" && name.Local == xmlnsPrefix)
+}
+
+// escapeText escapes s for use as character data, or as an attribute value
+func escapeText(s string, attr bool) string {
+	if !strings.ContainsAny(s, `&<>"`+"\t\n\r") {
+		return s
+	}
+
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '&':
+			b.WriteString("&amp;")
+		case r == '<':
+			b.WriteString("&lt;")
+		case r == '>':
+			b.WriteString("&gt;")
+		case r == '"' && attr:
+			b.WriteString("&quot;")
+		case r == '\t' && attr:
+			b.WriteString("&#x9;")
+		case r == '\n' && attr:
+			b.WriteString("&#xA;")
+		case r == '\r':
+			b.WriteString("&#xD;")
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
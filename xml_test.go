@@ -0,0 +1,98 @@
+package xmlapi
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// throughJSON returns n as a client decodes it after the gateway sent it
+func throughJSON(t *testing.T, n *Node) *Node {
+	t.Helper()
+	data, err := json.Marshal(wire(n))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Node
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	decoded.normalizeValues()
+	return &decoded
+}
+
+func TestXMLRoundTrip(t *testing.T) {
+	for _, doc := range []string{
+		`<plan version="3"><phase id="1">5</phase><phase id="2">7 &lt; 9 &amp; "quoted"</phase><empty/></plan>`,
+		`<ntcip:plan xmlns:ntcip="urn:ntcip" xmlns:cfg="urn:cfg"><ntcip:phase cfg:unit="s">5</ntcip:phase><cfg:note>x</cfg:note></ntcip:plan>`,
+		`<plan xmlns="urn:default"><phase>1</phase><other xmlns="urn:other"><leaf>2</leaf></other></plan>`,
+		`<plan><!--generated - do not edit--><phase xml:lang="en">5</phase></plan>`,
+		`<plan>label<phase>5</phase></plan>`,
+	} {
+		parsed, err := ParseXML(strings.NewReader(doc))
+		if err != nil {
+			t.Fatalf("ParseXML(%s): %v", doc, err)
+		}
+		if got := mustXML(t, throughJSON(t, parsed)); got != doc {
+			t.Errorf("round trip of\n  %s\ngave\n  %s", doc, got)
+		}
+	}
+}
+
+func TestParseXMLRejectsMixedContent(t *testing.T) {
+	for _, doc := range []string{
+		`<p>Hello <b>world</b>!</p>`,
+		`<p><b>bold</b>tail</p>`,
+		`<p><!--note-->text</p>`,
+	} {
+		_, err := ParseXML(strings.NewReader(doc))
+		var parseErr *ParseError
+		if !errors.Is(err, ErrMixedContent) || !errors.As(err, &parseErr) {
+			t.Errorf("ParseXML(%s) = %v, want a *ParseError matching ErrMixedContent", doc, err)
+		}
+	}
+
+	// Indentation between children is not content
+	if _, err := ParseXML(strings.NewReader("<p>\n  <b>x</b>\n  <i>y</i>\n</p>")); err != nil {
+		t.Errorf("indented document: %v", err)
+	}
+}
+
+func TestToXMLIndent(t *testing.T) {
+	n, err := ParseXML(strings.NewReader(`<plan><phase id="1"><minGreen>5</minGreen></phase><!--c--></plan>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	if err := n.ToXML(&b, MarshalOptions{Indent: "  ", Header: true}); err != nil {
+		t.Fatal(err)
+	}
+	want := xml.Header + `<plan>
+  <phase id="1">
+    <minGreen>5</minGreen>
+  </phase>
+  <!--c-->
+</plan>`
+	if b.String() != want {
+		t.Errorf("indented:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestMarshalXML(t *testing.T) {
+	n := &Node{
+		XMLName: XMLName{Space: "urn:x", Local: "plan"},
+		Attrs:   []Attr{{Name: XMLName{Local: "id"}, Value: `a"b`}},
+		Value:   "1 < 2",
+		Nodes:   []Node{{Kind: NodeComment, Value: "note"}, {XMLName: XMLName{Local: "phase"}}},
+	}
+	data, err := xml.Marshal(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<plan xmlns="urn:x" id="a&#34;b">1 &lt; 2<!--note--><phase></phase></plan>`
+	if string(data) != want {
+		t.Errorf("xml.Marshal = %s\nwant %s", data, want)
+	}
+}
@@ -0,0 +1,401 @@
+// Package xmlapimem provides MemClient, an in-memory implementation of
+// xmlapi.API for unit tests that want real file and node semantics without
+// a gateway
+package xmlapimem
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	xmlapi "github.com/Applied-Information/golibxml"
+)
+
+// Status is the status MemClient returns for every successful change
+const Status = "success"
+
+// MemClient implements xmlapi.API against trees kept in memory, by device
+// and file name. It reports failures with the sentinels the gateway's
+// errors match: a missing file, node or attribute matches
+// xmlapi.ErrNotFound, and creating a file that exists matches
+// xmlapi.ErrAlreadyExists. Paths are evaluated like Node.Find, so a path
+// matching several elements addresses the first. Options are accepted and
+// ignored, and namespaces are not modelled.
+//
+// Every method returns and stores copies, so callers never share a tree
+// with the client. A MemClient is safe for concurrent use and starts no
+// goroutines.
+type MemClient struct {
+	mu      sync.Mutex
+	devices map[string]map[string]*xmlapi.Node
+}
+
+var _ xmlapi.API = (*MemClient)(nil)
+
+// New returns a MemClient without any files
+func New() *MemClient {
+	return &MemClient{devices: make(map[string]map[string]*xmlapi.Node)}
+}
+
+// Preload stores a copy of root as filename on deviceID, replacing any
+// file of that name
+func (m *MemClient) Preload(deviceID, filename string, root *xmlapi.Node) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.store(deviceID, filename, root.Clone())
+}
+
+// PreloadXML parses doc and preloads it as Preload does
+func (m *MemClient) PreloadXML(deviceID, filename, doc string) error {
+	root, err := xmlapi.ParseXML(strings.NewReader(doc))
+	if err != nil {
+		return err
+	}
+	m.Preload(deviceID, filename, root)
+	return nil
+}
+
+// Snapshot returns a copy of every file, by device and file name
+func (m *MemClient) Snapshot() map[string]map[string]*xmlapi.Node {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snapshot := make(map[string]map[string]*xmlapi.Node, len(m.devices))
+	for deviceID, files := range m.devices {
+		copies := make(map[string]*xmlapi.Node, len(files))
+		for filename, root := range files {
+			copies[filename] = root.Clone()
+		}
+		snapshot[deviceID] = copies
+	}
+	return snapshot
+}
+
+// ListFiles lists the files of a device in name order
+func (m *MemClient) ListFiles(deviceID string, opts ...xmlapi.RequestOption) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	files := make([]string, 0, len(m.devices[deviceID]))
+	for filename := range m.devices[deviceID] {
+		files = append(files, filename)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// CreateFile creates a file holding an empty rootName element
+func (m *MemClient) CreateFile(deviceID, filename, rootName string, opts ...xmlapi.RequestOption) (string, error) {
+	if rootName == "" {
+		return "", errors.New("create file: root name is required")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.devices[deviceID][filename]; ok {
+		return "", fileError(deviceID, filename, xmlapi.ErrAlreadyExists)
+	}
+	m.store(deviceID, filename, &xmlapi.Node{Kind: xmlapi.NodeElement, XMLName: xmlapi.XMLName{Local: rootName}})
+	return Status, nil
+}
+
+// UploadFile parses the document read from r and stores it as a file.
+// Without overwrite an existing file is an error.
+func (m *MemClient) UploadFile(deviceID, filename string, r io.Reader, overwrite bool, opts ...xmlapi.UploadOption) (string, error) {
+	root, err := xmlapi.ParseXML(r)
+	if err != nil {
+		return "", fmt.Errorf("%s is not well-formed: %w", filename, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.devices[deviceID][filename]; ok && !overwrite {
+		return "", fileError(deviceID, filename, xmlapi.ErrAlreadyExists)
+	}
+	m.store(deviceID, filename, root)
+	return Status, nil
+}
+
+// CopyDevice copies a file to another device. Without overwrite an existing
+// file there is an error.
+func (m *MemClient) CopyDevice(deviceID, newDeviceID, filename string, overwrite bool, opts ...xmlapi.RequestOption) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	root, err := m.file(deviceID, filename)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := m.devices[newDeviceID][filename]; ok && !overwrite {
+		return "", fileError(newDeviceID, filename, xmlapi.ErrAlreadyExists)
+	}
+	m.store(newDeviceID, filename, root.Clone())
+	return Status, nil
+}
+
+// DeleteFile deletes a file. There is no trash, so it is always deleted
+// outright.
+func (m *MemClient) DeleteFile(deviceID, filename string, opts ...xmlapi.DeleteOption) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.file(deviceID, filename); err != nil {
+		return "", err
+	}
+	delete(m.devices[deviceID], filename)
+	return Status, nil
+}
+
+// ReadFile returns a copy of a whole file
+func (m *MemClient) ReadFile(deviceID, filename string, opts ...xmlapi.RequestOption) (*xmlapi.Node, error) {
+	return m.ReadNode(deviceID, filename, "/", opts...)
+}
+
+// ReadNode returns a copy of the element at path
+func (m *MemClient) ReadNode(deviceID, filename string, path xmlapi.PathLike, opts ...xmlapi.RequestOption) (*xmlapi.Node, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, err := m.node(deviceID, filename, path)
+	if err != nil {
+		return nil, err
+	}
+	return n.Clone(), nil
+}
+
+// ReadNodes returns copies of the elements at paths, in their order. A
+// missing element fails the whole read.
+func (m *MemClient) ReadNodes(deviceID, filename string, paths []string, opts ...xmlapi.RequestOption) ([]*xmlapi.Node, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	nodes := make([]*xmlapi.Node, len(paths))
+	for i, path := range paths {
+		n, err := m.node(deviceID, filename, path)
+		if err != nil {
+			return nil, err
+		}
+		nodes[i] = n.Clone()
+	}
+	return nodes, nil
+}
+
+// CreateNode appends a tag element holding value to the element at parentPath
+func (m *MemClient) CreateNode(deviceID, filename string, parentPath xmlapi.PathLike, tag, value string, opts ...xmlapi.RequestOption) (string, error) {
+	if tag == "" {
+		return "", errors.New("create node: tag is required")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	parent, err := m.node(deviceID, filename, parentPath)
+	if err != nil {
+		return "", err
+	}
+	parent.Nodes = append(parent.Nodes, xmlapi.Node{Kind: xmlapi.NodeElement, XMLName: xmlapi.XMLName{Local: tag}, Value: value})
+	return Status, nil
+}
+
+// UpdateNode sets the value of the element at path
+func (m *MemClient) UpdateNode(deviceID, filename string, path xmlapi.PathLike, value string, opts ...xmlapi.RequestOption) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, err := m.node(deviceID, filename, path)
+	if err != nil {
+		return "", err
+	}
+	n.Value, n.RawValue, n.ValueKind = value, "", xmlapi.ValueText
+	return Status, nil
+}
+
+// UpsertNode sets the value of the first tag child of the element at
+// parentPath, appending one if there is none
+func (m *MemClient) UpsertNode(deviceID, filename string, parentPath xmlapi.PathLike, tag, value string, opts ...xmlapi.RequestOption) (string, error) {
+	if tag == "" {
+		return "", errors.New("upsert node: tag is required")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	parent, err := m.node(deviceID, filename, parentPath)
+	if err != nil {
+		return "", err
+	}
+	for i := range parent.Nodes {
+		n := &parent.Nodes[i]
+		if n.Kind == xmlapi.NodeElement && n.XMLName.Local == tag {
+			n.Value, n.RawValue, n.ValueKind = value, "", xmlapi.ValueText
+			return Status, nil
+		}
+	}
+	parent.Nodes = append(parent.Nodes, xmlapi.Node{Kind: xmlapi.NodeElement, XMLName: xmlapi.XMLName{Local: tag}, Value: value})
+	return Status, nil
+}
+
+// DeleteNode deletes the element at path with its descendants. The root
+// element cannot be deleted.
+func (m *MemClient) DeleteNode(deviceID, filename string, path xmlapi.PathLike, opts ...xmlapi.RequestOption) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, err := m.node(deviceID, filename, path)
+	if err != nil {
+		return "", err
+	}
+	root := m.devices[deviceID][filename]
+	if n == root {
+		return "", fmt.Errorf("delete node %q: cannot delete the root element", path)
+	}
+	parent, i := parentOf(root, n)
+	parent.Nodes = append(parent.Nodes[:i], parent.Nodes[i+1:]...)
+	return Status, nil
+}
+
+// DeleteNodes deletes the elements at paths, each path evaluated after the
+// deletions before it. Nothing is deleted unless every path addresses a
+// non-root element.
+func (m *MemClient) DeleteNodes(deviceID, filename string, paths []string, opts ...xmlapi.RequestOption) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	root, err := m.file(deviceID, filename)
+	if err != nil {
+		return "", err
+	}
+	work := root.Clone()
+	for _, path := range paths {
+		if err := deleteFrom(work, path); err != nil {
+			return "", fmt.Errorf("%s on %s: %w", filename, deviceID, err)
+		}
+	}
+	m.store(deviceID, filename, work)
+	return Status, nil
+}
+
+// GetAttribute returns an attribute of the element at path
+func (m *MemClient) GetAttribute(deviceID, filename string, path xmlapi.PathLike, name string, opts ...xmlapi.RequestOption) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, err := m.node(deviceID, filename, path)
+	if err != nil {
+		return "", err
+	}
+	value, ok := n.Attr(name)
+	if !ok {
+		return "", attrError(path, name)
+	}
+	return value, nil
+}
+
+// SetAttribute sets an attribute of the element at path, adding it if needed
+func (m *MemClient) SetAttribute(deviceID, filename string, path xmlapi.PathLike, name, value string, opts ...xmlapi.RequestOption) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, err := m.node(deviceID, filename, path)
+	if err != nil {
+		return "", err
+	}
+	for i := range n.Attrs {
+		if n.Attrs[i].Name.Local == name {
+			n.Attrs[i].Value = value
+			return Status, nil
+		}
+	}
+	n.Attrs = append(n.Attrs, xmlapi.Attr{Name: xmlapi.XMLName{Local: name}, Value: value})
+	return Status, nil
+}
+
+// DeleteAttribute removes an attribute of the element at path
+func (m *MemClient) DeleteAttribute(deviceID, filename string, path xmlapi.PathLike, name string, opts ...xmlapi.RequestOption) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, err := m.node(deviceID, filename, path)
+	if err != nil {
+		return "", err
+	}
+	for i := range n.Attrs {
+		if n.Attrs[i].Name.Local == name {
+			n.Attrs = append(n.Attrs[:i], n.Attrs[i+1:]...)
+			return Status, nil
+		}
+	}
+	return "", attrError(path, name)
+}
+
+// store stores root as a file; m.mu must be held
+func (m *MemClient) store(deviceID, filename string, root *xmlapi.Node) {
+	files, ok := m.devices[deviceID]
+	if !ok {
+		files = make(map[string]*xmlapi.Node)
+		m.devices[deviceID] = files
+	}
+	files[filename] = root
+}
+
+// file returns the stored root of a file; m.mu must be held
+func (m *MemClient) file(deviceID, filename string) (*xmlapi.Node, error) {
+	root, ok := m.devices[deviceID][filename]
+	if !ok {
+		return nil, fileError(deviceID, filename, xmlapi.ErrNotFound)
+	}
+	return root, nil
+}
+
+// node returns the stored element at path; m.mu must be held
+func (m *MemClient) node(deviceID, filename string, p xmlapi.PathLike) (*xmlapi.Node, error) {
+	path, err := xmlapi.PathString(p)
+	if err != nil {
+		return nil, err
+	}
+	root, err := m.file(deviceID, filename)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := xmlapi.ParsePath(path); err != nil {
+		return nil, err
+	}
+	if path == "/" {
+		return root, nil
+	}
+	n, ok := root.Find(path)
+	if !ok {
+		return nil, fmt.Errorf("node %q of %s on %s: %w", path, filename, deviceID, xmlapi.ErrNotFound)
+	}
+	return n, nil
+}
+
+// deleteFrom deletes the element at path from the tree rooted at root
+func deleteFrom(root *xmlapi.Node, path string) error {
+	if _, err := xmlapi.ParsePath(path); err != nil {
+		return err
+	}
+	n, ok := root.Find(path)
+	if path == "/" || n == root {
+		return fmt.Errorf("delete node %q: cannot delete the root element", path)
+	}
+	if !ok {
+		return fmt.Errorf("node %q: %w", path, xmlapi.ErrNotFound)
+	}
+	parent, i := parentOf(root, n)
+	parent.Nodes = append(parent.Nodes[:i], parent.Nodes[i+1:]...)
+	return nil
+}
+
+// parentOf returns the parent of n in the tree rooted at root and n's index
+// among its children
+func parentOf(root, n *xmlapi.Node) (*xmlapi.Node, int) {
+	for i := range root.Nodes {
+		if &root.Nodes[i] == n {
+			return root, i
+		}
+		if parent, j := parentOf(&root.Nodes[i], n); parent != nil {
+			return parent, j
+		}
+	}
+	return nil, -1
+}
+
+// fileError reports err for a file
+func fileError(deviceID, filename string, err error) error {
+	return fmt.Errorf("file %s on %s: %w", filename, deviceID, err)
+}
+
+// attrError reports a missing attribute
+func attrError(path xmlapi.PathLike, name string) error {
+	return fmt.Errorf("%q of %q: %w", name, path, xmlapi.ErrAttrNotFound)
+}
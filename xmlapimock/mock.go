@@ -0,0 +1,230 @@
+// Package xmlapimock provides MockClient, a hand-written stub of
+// xmlapi.API for unit tests of code that uses the gateway
+package xmlapimock
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	xmlapi "github.com/Applied-Information/golibxml"
+)
+
+// Call is a recorded invocation of a MockClient method. Args holds the
+// arguments in order, without the options.
+type Call struct {
+	Method string
+	Args   []interface{}
+}
+
+// MockClient implements xmlapi.API by calling the function field named
+// after each method, e.g. ReadNodeFunc for ReadNode. Calling a method whose
+// field is nil panics with the method's name. Every call is recorded,
+// stubbed or not. A MockClient is safe for concurrent use once its fields
+// are set.
+type MockClient struct {
+	ListFilesFunc       func(deviceID string, opts ...xmlapi.RequestOption) ([]string, error)
+	CreateFileFunc      func(deviceID, filename, rootName string, opts ...xmlapi.RequestOption) (string, error)
+	UploadFileFunc      func(deviceID, filename string, r io.Reader, overwrite bool, opts ...xmlapi.UploadOption) (string, error)
+	CopyDeviceFunc      func(deviceID, newDeviceID, filename string, overwrite bool, opts ...xmlapi.RequestOption) (string, error)
+	DeleteFileFunc      func(deviceID, filename string, opts ...xmlapi.DeleteOption) (string, error)
+	ReadFileFunc        func(deviceID, filename string, opts ...xmlapi.RequestOption) (*xmlapi.Node, error)
+	ReadNodeFunc        func(deviceID, filename string, path xmlapi.PathLike, opts ...xmlapi.RequestOption) (*xmlapi.Node, error)
+	ReadNodesFunc       func(deviceID, filename string, paths []string, opts ...xmlapi.RequestOption) ([]*xmlapi.Node, error)
+	CreateNodeFunc      func(deviceID, filename string, parentPath xmlapi.PathLike, tag, value string, opts ...xmlapi.RequestOption) (string, error)
+	UpdateNodeFunc      func(deviceID, filename string, path xmlapi.PathLike, value string, opts ...xmlapi.RequestOption) (string, error)
+	UpsertNodeFunc      func(deviceID, filename string, parentPath xmlapi.PathLike, tag, value string, opts ...xmlapi.RequestOption) (string, error)
+	DeleteNodeFunc      func(deviceID, filename string, path xmlapi.PathLike, opts ...xmlapi.RequestOption) (string, error)
+	DeleteNodesFunc     func(deviceID, filename string, paths []string, opts ...xmlapi.RequestOption) (string, error)
+	GetAttributeFunc    func(deviceID, filename string, path xmlapi.PathLike, name string, opts ...xmlapi.RequestOption) (string, error)
+	SetAttributeFunc    func(deviceID, filename string, path xmlapi.PathLike, name, value string, opts ...xmlapi.RequestOption) (string, error)
+	DeleteAttributeFunc func(deviceID, filename string, path xmlapi.PathLike, name string, opts ...xmlapi.RequestOption) (string, error)
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+var _ xmlapi.API = (*MockClient)(nil)
+
+// Calls returns the recorded calls, oldest first
+func (m *MockClient) Calls() []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Call(nil), m.calls...)
+}
+
+// CallsTo returns the recorded calls of method, oldest first
+func (m *MockClient) CallsTo(method string) []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var calls []Call
+	for _, call := range m.calls {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Reset forgets the recorded calls, keeping the stubs
+func (m *MockClient) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = nil
+}
+
+// record records a call of method
+func (m *MockClient) record(method string, args ...interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, Call{Method: method, Args: args})
+}
+
+// unstubbed panics for a call of a method without its function field
+func unstubbed(method string) {
+	panic(fmt.Sprintf("xmlapimock: MockClient.%s called without %sFunc set", method, method))
+}
+
+// ListFiles records the call and calls ListFilesFunc
+func (m *MockClient) ListFiles(deviceID string, opts ...xmlapi.RequestOption) ([]string, error) {
+	m.record("ListFiles", deviceID)
+	if m.ListFilesFunc == nil {
+		unstubbed("ListFiles")
+	}
+	return m.ListFilesFunc(deviceID, opts...)
+}
+
+// CreateFile records the call and calls CreateFileFunc
+func (m *MockClient) CreateFile(deviceID, filename, rootName string, opts ...xmlapi.RequestOption) (string, error) {
+	m.record("CreateFile", deviceID, filename, rootName)
+	if m.CreateFileFunc == nil {
+		unstubbed("CreateFile")
+	}
+	return m.CreateFileFunc(deviceID, filename, rootName, opts...)
+}
+
+// UploadFile records the call and calls UploadFileFunc
+func (m *MockClient) UploadFile(deviceID, filename string, r io.Reader, overwrite bool, opts ...xmlapi.UploadOption) (string, error) {
+	m.record("UploadFile", deviceID, filename, r, overwrite)
+	if m.UploadFileFunc == nil {
+		unstubbed("UploadFile")
+	}
+	return m.UploadFileFunc(deviceID, filename, r, overwrite, opts...)
+}
+
+// CopyDevice records the call and calls CopyDeviceFunc
+func (m *MockClient) CopyDevice(deviceID, newDeviceID, filename string, overwrite bool, opts ...xmlapi.RequestOption) (string, error) {
+	m.record("CopyDevice", deviceID, newDeviceID, filename, overwrite)
+	if m.CopyDeviceFunc == nil {
+		unstubbed("CopyDevice")
+	}
+	return m.CopyDeviceFunc(deviceID, newDeviceID, filename, overwrite, opts...)
+}
+
+// DeleteFile records the call and calls DeleteFileFunc
+func (m *MockClient) DeleteFile(deviceID, filename string, opts ...xmlapi.DeleteOption) (string, error) {
+	m.record("DeleteFile", deviceID, filename)
+	if m.DeleteFileFunc == nil {
+		unstubbed("DeleteFile")
+	}
+	return m.DeleteFileFunc(deviceID, filename, opts...)
+}
+
+// ReadFile records the call and calls ReadFileFunc
+func (m *MockClient) ReadFile(deviceID, filename string, opts ...xmlapi.RequestOption) (*xmlapi.Node, error) {
+	m.record("ReadFile", deviceID, filename)
+	if m.ReadFileFunc == nil {
+		unstubbed("ReadFile")
+	}
+	return m.ReadFileFunc(deviceID, filename, opts...)
+}
+
+// ReadNode records the call and calls ReadNodeFunc
+func (m *MockClient) ReadNode(deviceID, filename string, path xmlapi.PathLike, opts ...xmlapi.RequestOption) (*xmlapi.Node, error) {
+	m.record("ReadNode", deviceID, filename, path)
+	if m.ReadNodeFunc == nil {
+		unstubbed("ReadNode")
+	}
+	return m.ReadNodeFunc(deviceID, filename, path, opts...)
+}
+
+// ReadNodes records the call and calls ReadNodesFunc
+func (m *MockClient) ReadNodes(deviceID, filename string, paths []string, opts ...xmlapi.RequestOption) ([]*xmlapi.Node, error) {
+	m.record("ReadNodes", deviceID, filename, paths)
+	if m.ReadNodesFunc == nil {
+		unstubbed("ReadNodes")
+	}
+	return m.ReadNodesFunc(deviceID, filename, paths, opts...)
+}
+
+// CreateNode records the call and calls CreateNodeFunc
+func (m *MockClient) CreateNode(deviceID, filename string, parentPath xmlapi.PathLike, tag, value string, opts ...xmlapi.RequestOption) (string, error) {
+	m.record("CreateNode", deviceID, filename, parentPath, tag, value)
+	if m.CreateNodeFunc == nil {
+		unstubbed("CreateNode")
+	}
+	return m.CreateNodeFunc(deviceID, filename, parentPath, tag, value, opts...)
+}
+
+// UpdateNode records the call and calls UpdateNodeFunc
+func (m *MockClient) UpdateNode(deviceID, filename string, path xmlapi.PathLike, value string, opts ...xmlapi.RequestOption) (string, error) {
+	m.record("UpdateNode", deviceID, filename, path, value)
+	if m.UpdateNodeFunc == nil {
+		unstubbed("UpdateNode")
+	}
+	return m.UpdateNodeFunc(deviceID, filename, path, value, opts...)
+}
+
+// UpsertNode records the call and calls UpsertNodeFunc
+func (m *MockClient) UpsertNode(deviceID, filename string, parentPath xmlapi.PathLike, tag, value string, opts ...xmlapi.RequestOption) (string, error) {
+	m.record("UpsertNode", deviceID, filename, parentPath, tag, value)
+	if m.UpsertNodeFunc == nil {
+		unstubbed("UpsertNode")
+	}
+	return m.UpsertNodeFunc(deviceID, filename, parentPath, tag, value, opts...)
+}
+
+// DeleteNode records the call and calls DeleteNodeFunc
+func (m *MockClient) DeleteNode(deviceID, filename string, path xmlapi.PathLike, opts ...xmlapi.RequestOption) (string, error) {
+	m.record("DeleteNode", deviceID, filename, path)
+	if m.DeleteNodeFunc == nil {
+		unstubbed("DeleteNode")
+	}
+	return m.DeleteNodeFunc(deviceID, filename, path, opts...)
+}
+
+// DeleteNodes records the call and calls DeleteNodesFunc
+func (m *MockClient) DeleteNodes(deviceID, filename string, paths []string, opts ...xmlapi.RequestOption) (string, error) {
+	m.record("DeleteNodes", deviceID, filename, paths)
+	if m.DeleteNodesFunc == nil {
+		unstubbed("DeleteNodes")
+	}
+	return m.DeleteNodesFunc(deviceID, filename, paths, opts...)
+}
+
+// GetAttribute records the call and calls GetAttributeFunc
+func (m *MockClient) GetAttribute(deviceID, filename string, path xmlapi.PathLike, name string, opts ...xmlapi.RequestOption) (string, error) {
+	m.record("GetAttribute", deviceID, filename, path, name)
+	if m.GetAttributeFunc == nil {
+		unstubbed("GetAttribute")
+	}
+	return m.GetAttributeFunc(deviceID, filename, path, name, opts...)
+}
+
+// SetAttribute records the call and calls SetAttributeFunc
+func (m *MockClient) SetAttribute(deviceID, filename string, path xmlapi.PathLike, name, value string, opts ...xmlapi.RequestOption) (string, error) {
+	m.record("SetAttribute", deviceID, filename, path, name, value)
+	if m.SetAttributeFunc == nil {
+		unstubbed("SetAttribute")
+	}
+	return m.SetAttributeFunc(deviceID, filename, path, name, value, opts...)
+}
+
+// DeleteAttribute records the call and calls DeleteAttributeFunc
+func (m *MockClient) DeleteAttribute(deviceID, filename string, path xmlapi.PathLike, name string, opts ...xmlapi.RequestOption) (string, error) {
+	m.record("DeleteAttribute", deviceID, filename, path, name)
+	if m.DeleteAttributeFunc == nil {
+		unstubbed("DeleteAttribute")
+	}
+	return m.DeleteAttributeFunc(deviceID, filename, path, name, opts...)
+}